@@ -0,0 +1,53 @@
+package bitknn
+
+import (
+	"math/bits"
+	"slices"
+
+	"github.com/keilerkonzept/bitknn/internal/slice"
+)
+
+// bucketIndices groups the indices 0..n-1 by the given key function.
+// Returns the grouped indices and the range of each group in them, by key.
+func bucketIndices(n int, key func(i int) uint64) ([]int, map[uint64]slice.IndexRange) {
+	indices := make([]int, n)
+	keys := make([]uint64, n)
+	for i := range indices {
+		indices[i] = i
+		keys[i] = key(i)
+	}
+	slices.SortStableFunc(indices, func(a, b int) int {
+		switch {
+		case keys[a] < keys[b]:
+			return -1
+		case keys[a] > keys[b]:
+			return 1
+		}
+		return 0
+	})
+	for i, index := range indices {
+		keys[i] = key(index)
+	}
+	buckets, _ := slice.GroupSorted(indices, keys)
+	return indices, buckets
+}
+
+// nextCombination returns the next larger integer with the same number of set bits (Gosper's hack).
+func nextCombination(v uint64) uint64 {
+	c := v & -v
+	r := v + c
+	return (((r ^ v) >> 2) / c) | r
+}
+
+// binomial returns n choose k, for 0 <= n <= 64.
+func binomial(n, k int) uint64 {
+	if k < 0 || k > n {
+		return 0
+	}
+	c := uint64(1)
+	for i := range min(k, n-k) {
+		hi, lo := bits.Mul64(c, uint64(n-i))
+		c, _ = bits.Div64(hi, lo, uint64(i+1))
+	}
+	return c
+}
@@ -0,0 +1,103 @@
+package bitknn
+
+// Create a k-NN classifier for the given data points and labels of any comparable type.
+// The labels are encoded as the [Model.Labels] of the underlying model (see [EncodeLabels]).
+func FitClassifier[L comparable](data []uint64, labels []L, opts ...Option) *Classifier[L] {
+	encoding, codes := EncodeLabels(labels)
+	return &Classifier[L]{
+		Model:    Fit(data, codes, opts...),
+		Encoding: encoding,
+		Votes:    make(VoteSlice, encoding.Len()),
+	}
+}
+
+// A k-NN classifier for uint64s with labels of type L, wrapping a [Model] with encoded labels.
+type Classifier[L comparable] struct {
+	Model *Model
+
+	// Encoding of the labels as the model's [Model.Labels].
+	Encoding *LabelEncoding[L]
+
+	// Vote counter used by [Classifier.Predict], indexed by the label codes.
+	Votes VoteSlice
+}
+
+// Label returns the label of the data point with the given index, such as that of a neighbor found by [Model.Find].
+func (me *Classifier[L]) Label(index int) L {
+	return me.Encoding.Decode(me.Model.Labels[index])
+}
+
+// Predicts the label of a single input point. Reuses the model's neighbor heap and the classifier's vote counter.
+// If there are no neighbors, returns the zero value of L.
+func (me *Classifier[L]) Predict(k int, x uint64) L {
+	if me.Model.predict(k, x, me.Votes) == 0 {
+		var zero L
+		return zero
+	}
+	return me.Encoding.Decode(argMaxLowest(me.Votes))
+}
+
+// Predicts the label of a single input point, writing the label votes into the given vote counter. Reuses the model's neighbor heap.
+// Returns the label with the most votes.
+func (me *Classifier[L]) PredictVotes(k int, x uint64, votes LabelVoteCounter[L]) L {
+	me.Model.Predict(k, x, me.Encoding.votes(votes))
+	return votes.ArgMax()
+}
+
+// Predicts the label of a single input point, using the given slices for the neighbor heap and writing the label votes into the given vote counter.
+// Returns the label with the most votes.
+func (me *Classifier[L]) PredictInto(k int, x uint64, distances []int, indices []int, votes LabelVoteCounter[L]) L {
+	me.Model.PredictInto(k, x, distances, indices, me.Encoding.votes(votes))
+	return votes.ArgMax()
+}
+
+// Create a k-NN classifier for the given wide data points and labels of any comparable type.
+// The labels are encoded as the [Model.Labels] of the underlying model (see [EncodeLabels]).
+func FitWideClassifier[L comparable](data [][]uint64, labels []L, opts ...Option) *WideClassifier[L] {
+	encoding, codes := EncodeLabels(labels)
+	return &WideClassifier[L]{
+		Model:    FitWide(data, codes, opts...),
+		Encoding: encoding,
+		Votes:    make(VoteSlice, encoding.Len()),
+	}
+}
+
+// A k-NN classifier for slices of uint64s with labels of type L, wrapping a [WideModel] with encoded labels.
+type WideClassifier[L comparable] struct {
+	Model *WideModel
+
+	// Encoding of the labels as the model's [Model.Labels].
+	Encoding *LabelEncoding[L]
+
+	// Vote counter used by [WideClassifier.Predict], indexed by the label codes.
+	Votes VoteSlice
+}
+
+// Label returns the label of the data point with the given index, such as that of a neighbor found by [WideModel.Find].
+func (me *WideClassifier[L]) Label(index int) L {
+	return me.Encoding.Decode(me.Model.Narrow.Labels[index])
+}
+
+// Predicts the label of a single input point. Reuses the model's neighbor heap and the classifier's vote counter.
+// If there are no neighbors, returns the zero value of L.
+func (me *WideClassifier[L]) Predict(k int, x []uint64) L {
+	if me.Model.Predict(k, x, me.Votes) == 0 {
+		var zero L
+		return zero
+	}
+	return me.Encoding.Decode(argMaxLowest(me.Votes))
+}
+
+// Predicts the label of a single input point, writing the label votes into the given vote counter. Reuses the model's neighbor heap.
+// Returns the label with the most votes.
+func (me *WideClassifier[L]) PredictVotes(k int, x []uint64, votes LabelVoteCounter[L]) L {
+	me.Model.Predict(k, x, me.Encoding.votes(votes))
+	return votes.ArgMax()
+}
+
+// Predicts the label of a single input point, using the given slices for the neighbor heap and writing the label votes into the given vote counter.
+// Returns the label with the most votes.
+func (me *WideClassifier[L]) PredictInto(k int, x []uint64, distances []int, indices []int, votes LabelVoteCounter[L]) L {
+	me.Model.PredictInto(k, x, distances, indices, me.Encoding.votes(votes))
+	return votes.ArgMax()
+}
@@ -0,0 +1,238 @@
+package bitknn_test
+
+import (
+	"fmt"
+	"math"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/keilerkonzept/bitknn"
+	"github.com/keilerkonzept/bitknn/internal/testrandom"
+	"pgregory.net/rapid"
+)
+
+func TestEncodeLabels(t *testing.T) {
+	rapid.Check(t, func(t *rapid.T) {
+		labels := rapid.SliceOf(rapid.StringMatching("[a-c]{0,2}")).Draw(t, "labels")
+		encoding, codes := bitknn.EncodeLabels(labels)
+		next := 0
+		for i, label := range labels {
+			if encoding.Decode(codes[i]) != label {
+				t.Fatalf("label %d: %q != %q", i, encoding.Decode(codes[i]), label)
+			}
+			if code, ok := encoding.Encode(label); !ok || code != codes[i] {
+				t.Fatalf("label %d: code %d != %d", i, code, codes[i])
+			}
+			if codes[i] > next {
+				t.Fatalf("label %d: code %d is not in order of first appearance", i, codes[i])
+			}
+			next = max(next, codes[i]+1)
+		}
+		if encoding.Len() != next {
+			t.Fatalf("%d labels, expected %d", encoding.Len(), next)
+		}
+		if _, ok := encoding.Encode("unknown"); ok {
+			t.Fatal("unknown label is encoded")
+		}
+	})
+}
+
+// classes returns string class labels for the given int labels, and the class of each int label.
+func classes(labels []int) ([]string, func(int) string) {
+	class := func(label int) string { return fmt.Sprint("class-", label) }
+	out := make([]string, len(labels))
+	for i, label := range labels {
+		out[i] = class(label)
+	}
+	return out, class
+}
+
+// checkClassifierVotes checks that the given label votes are the given int label votes of the same classes.
+func checkClassifierVotes(t *rapid.T, votes bitknn.LabelVoteCounter[string], expected bitknn.VoteMap, class func(int) string) {
+	for label, vote := range expected {
+		if got := votes.Get(class(label)); math.Abs(got-vote) > eps {
+			t.Fatalf("votes for %q: %v != %v", class(label), got, vote)
+		}
+	}
+	if len(expected) > 0 && math.Abs(votes.Max()-expected.Max()) > eps {
+		t.Fatalf("max vote %v != %v", votes.Max(), expected.Max())
+	}
+	if got := votes.Get(votes.ArgMax()); math.Abs(got-votes.Max()) > eps {
+		t.Fatalf("votes for arg max %q: %v != %v", votes.ArgMax(), got, votes.Max())
+	}
+}
+
+func TestClassifier_Equiv_Model(t *testing.T) {
+	rapid.Check(t, func(t *rapid.T) {
+		size := rapid.IntRange(0, 200).Draw(t, "size")
+		k := rapid.IntRange(1, 20).Draw(t, "k")
+		data := testrandom.Data(size)
+		labels := rapid.SliceOfN(rapid.IntRange(0, 5), size, size).Draw(t, "labels")
+		values := testrandom.Values(size)
+		x := testrandom.Query()
+
+		model := bitknn.Fit(data, labels, bitknn.WithValues(values), bitknn.WithLinearDistanceWeighting())
+		expected := make(bitknn.VoteMap)
+		model.PredictAlloc(k, x, expected)
+
+		strings, class := classes(labels)
+		classifier := bitknn.FitClassifier(data, strings, bitknn.WithValues(values), bitknn.WithLinearDistanceWeighting())
+		denseVotes := classifier.Encoding.NewVoteSlice()
+		sparseVotes := classifier.Encoding.NewVoteMap()
+		for _, votes := range []bitknn.LabelVoteCounter[string]{denseVotes, sparseVotes} {
+			if label := classifier.PredictVotes(k, x, votes); label != votes.ArgMax() {
+				t.Fatalf("predicted %q, arg max %q", label, votes.ArgMax())
+			}
+			checkClassifierVotes(t, votes, expected, class)
+		}
+
+		label := classifier.Predict(k, x)
+		if size == 0 {
+			if label != "" {
+				t.Fatalf("predicted %q without data", label)
+			}
+			return
+		}
+		if label != sparseVotes.ArgMax() {
+			t.Fatalf("predicted %q, arg max %q", label, sparseVotes.ArgMax())
+		}
+		_, indices := classifier.Model.Find(k, x)
+		for _, index := range indices {
+			if classifier.Label(index) != strings[index] {
+				t.Fatalf("label of %d: %q != %q", index, classifier.Label(index), strings[index])
+			}
+		}
+	})
+}
+
+func TestClassifier_Predict_Workers(t *testing.T) {
+	const k = 10
+	data := testrandom.Data(10_000)
+	labels := testrandom.Labels(len(data))
+	x := testrandom.Query()
+	expected := bitknn.FitClassifier(data, labels).Predict(k, x)
+
+	classifier := bitknn.FitClassifier(data, labels, bitknn.WithWorkers(8))
+	before := settledGoroutines()
+	if actual := classifier.Predict(k, x); actual != expected {
+		t.Fatal(expected, actual)
+	}
+	if runtime.NumGoroutine() <= before {
+		t.Fatal("Classifier.Predict should search on the model's worker goroutines", runtime.NumGoroutine(), before)
+	}
+	classifier.Model.Close()
+	for range 100 {
+		if runtime.NumGoroutine() <= before {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("the worker goroutines should stop once closed", runtime.NumGoroutine(), before)
+}
+
+func TestWideClassifier_Equiv_WideModel(t *testing.T) {
+	rapid.Check(t, func(t *rapid.T) {
+		size := rapid.IntRange(0, 200).Draw(t, "size")
+		dim := rapid.IntRange(1, 4).Draw(t, "dim")
+		k := rapid.IntRange(1, 20).Draw(t, "k")
+		data := testrandom.WideData(dim, size)
+		labels := rapid.SliceOfN(rapid.IntRange(0, 5), size, size).Draw(t, "labels")
+		x := testrandom.WideQuery(dim)
+
+		model := bitknn.FitWide(data, labels, bitknn.WithQuadraticDistanceWeighting())
+		expected := make(bitknn.VoteMap)
+		model.Predict(k, x, expected)
+
+		strings, class := classes(labels)
+		classifier := bitknn.FitWideClassifier(data, strings, bitknn.WithQuadraticDistanceWeighting())
+		denseVotes := classifier.Encoding.NewVoteSlice()
+		sparseVotes := classifier.Encoding.NewVoteMap()
+		distances, indices := make([]int, k+1), make([]int, k+1)
+		if label := classifier.PredictVotes(k, x, denseVotes); label != denseVotes.ArgMax() {
+			t.Fatalf("predicted %q, arg max %q", label, denseVotes.ArgMax())
+		}
+		if label := classifier.PredictInto(k, x, distances, indices, sparseVotes); label != sparseVotes.ArgMax() {
+			t.Fatalf("predicted %q, arg max %q", label, sparseVotes.ArgMax())
+		}
+		checkClassifierVotes(t, denseVotes, expected, class)
+		checkClassifierVotes(t, sparseVotes, expected, class)
+
+		label := classifier.Predict(k, x)
+		if size == 0 {
+			if label != "" {
+				t.Fatalf("predicted %q without data", label)
+			}
+			return
+		}
+		if label != sparseVotes.ArgMax() {
+			t.Fatalf("predicted %q, arg max %q", label, sparseVotes.ArgMax())
+		}
+		_, indices = classifier.Model.Find(k, x)
+		for _, index := range indices {
+			if classifier.Label(index) != strings[index] {
+				t.Fatalf("label of %d: %q != %q", index, classifier.Label(index), strings[index])
+			}
+		}
+	})
+}
+
+func TestLabelVoteSlice(t *testing.T) {
+	encoding, _ := bitknn.EncodeLabels([]string{"a", "b"})
+	votes := encoding.NewVoteSlice()
+	votes.Add("b", 2)
+	votes.Add("a", 1)
+	votes.Add("c", 3) // unknown, ignored
+	if diff := cmp.Diff(bitknn.VoteSlice{1, 2}, votes.Votes); diff != "" {
+		t.Fatal(diff)
+	}
+	if votes.Get("c") != 0 || votes.Get("b") != 2 || votes.ArgMax() != "b" || votes.Max() != 2 {
+		t.Fatal(votes)
+	}
+	votes.Clear()
+	if votes.Get("b") != 0 {
+		t.Fatal(votes)
+	}
+
+	empty, _ := bitknn.EncodeLabels[string](nil)
+	if label := empty.NewVoteSlice().ArgMax(); label != "" {
+		t.Fatalf("arg max of no votes: %q", label)
+	}
+}
+
+func TestLabelVoteMap(t *testing.T) {
+	encoding, _ := bitknn.EncodeLabels([]string{"a", "b", "c"})
+	votes := encoding.NewVoteMap()
+	if votes.ArgMax() != "" || votes.Max() != 0 {
+		t.Fatal(votes)
+	}
+	votes.Add("a", -1)
+	votes.Add("b", -2)
+	votes.Add("d", 3) // unknown, ignored
+	if votes.ArgMax() != "a" || votes.Max() != -1 || votes.Get("b") != -2 || votes.Get("d") != 0 {
+		t.Fatal(votes)
+	}
+	votes.Clear()
+	if len(votes.Votes) != 0 {
+		t.Fatal(votes)
+	}
+}
+
+func TestLabelVoteCounter_ArgMax_Ties(t *testing.T) {
+	encoding, _ := bitknn.EncodeLabels([]string{"c", "a", "b"})
+	for _, votes := range []bitknn.LabelVoteCounter[string]{encoding.NewVoteSlice(), encoding.NewVoteMap()} {
+		for range 10 {
+			votes.Clear()
+			votes.Add("b", 1)
+			votes.Add("a", 1)
+			if label := votes.ArgMax(); label != "a" {
+				t.Fatalf("%T: arg max %q, expected the lowest code %q", votes, label, "a")
+			}
+			votes.Add("c", 1)
+			if label := votes.ArgMax(); label != "c" {
+				t.Fatalf("%T: arg max %q, expected the lowest code %q", votes, label, "c")
+			}
+		}
+	}
+}
@@ -0,0 +1,455 @@
+package bitknn
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"math"
+)
+
+// Binary model format:
+//
+//	magic      [4]byte  "BKNN"
+//	version    uint16
+//	kind       uint8    (0: Model, 1: WideModel)
+//	weighting  uint8    (DistanceWeighting)
+//	dims       uint64   (words per data point)
+//	n          uint64   (number of data points)
+//	nLabels    uint64
+//	nValues    uint64
+//	data       [n*dims]uint64
+//	labels     [nLabels]int64
+//	values     [nValues]float64
+//	checksum   uint32   (CRC-32C of all preceding bytes)
+//
+// All integers are little-endian. Since the header size is a multiple of 8,
+// all sections are 8-byte aligned, so that the file can be memory-mapped (see [OpenModel]).
+const (
+	encodingMagic   = "BKNN"
+	encodingVersion = 1
+
+	encodingHeaderSize = 40
+
+	encodingKindModel     = 0
+	encodingKindWideModel = 1
+
+	// Number of 8-byte values encoded or decoded at once.
+	encodingChunkSize = 4096
+)
+
+var (
+	// ErrInvalidFormat is returned when reading data that is not an encoded model of the expected kind.
+	ErrInvalidFormat = errors.New("bitknn: invalid model format")
+	// ErrUnsupportedVersion is returned when reading a model encoded with an unknown format version.
+	ErrUnsupportedVersion = errors.New("bitknn: unsupported model format version")
+	// ErrChecksumMismatch is returned when reading a corrupted model.
+	ErrChecksumMismatch = errors.New("bitknn: model checksum mismatch")
+	// ErrMissingDistanceWeightingFunc is returned when reading a model with [DistanceWeightingCustom],
+	// since custom distance weighting functions can't be encoded.
+	// The model is returned along with the error; set its [Model.DistanceWeightingFunc] before using it,
+	// or pass [WithDistanceWeightingFunc] when reading it.
+	ErrMissingDistanceWeightingFunc = errors.New("bitknn: custom distance weighting function must be re-attached after loading")
+	// ErrInconsistentDimensions is returned when writing a [WideModel] whose data points have different lengths.
+	ErrInconsistentDimensions = errors.New("bitknn: data points have different lengths")
+	// ErrUnsupportedSetting is returned when writing a model with a setting that the format can't encode,
+	// and without which the model would give different results after reading it, e.g. [Model.DataMasks] or [Model.TieBreaking].
+	// Write the model without the setting, and pass it as an option when reading the model instead.
+	ErrUnsupportedSetting = errors.New("bitknn: model setting can't be encoded")
+)
+
+var (
+	_ io.WriterTo                = (*Model)(nil)
+	_ encoding.BinaryMarshaler   = (*Model)(nil)
+	_ encoding.BinaryUnmarshaler = (*Model)(nil)
+	_ io.WriterTo                = (*WideModel)(nil)
+	_ encoding.BinaryMarshaler   = (*WideModel)(nil)
+	_ encoding.BinaryUnmarshaler = (*WideModel)(nil)
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+type encodingHeader struct {
+	Kind      uint8
+	Weighting DistanceWeighting
+	Dims      uint64
+	N         uint64
+	NLabels   uint64
+	NValues   uint64
+}
+
+// WriteTo writes the model in a binary format to w.
+// The [Model.DistanceWeightingFunc] of a model with [DistanceWeightingCustom] is not written.
+// Returns [ErrUnsupportedSetting] without writing anything if the model has a setting that the format can't encode.
+func (me *Model) WriteTo(w io.Writer) (int64, error) {
+	if err := me.checkEncodable(); err != nil {
+		return 0, err
+	}
+	e := newEncoder(w)
+	e.header(encodingHeader{
+		Kind:      encodingKindModel,
+		Weighting: me.DistanceWeighting,
+		Dims:      1,
+		N:         uint64(len(me.Data)),
+		NLabels:   uint64(len(me.Labels)),
+		NValues:   uint64(len(me.Values)),
+	})
+	encodeSlice(e, me.Data, identity)
+	e.labelsAndValues(me)
+	return e.finish()
+}
+
+// WriteTo writes the model in a binary format to w.
+// The data points must all have the same length.
+// The [Model.DistanceWeightingFunc] of a model with [DistanceWeightingCustom] is not written.
+// Returns [ErrUnsupportedSetting] without writing anything if the model has a setting that the format can't encode.
+func (me *WideModel) WriteTo(w io.Writer) (int64, error) {
+	if err := me.Narrow.checkEncodable(); err != nil {
+		return 0, err
+	}
+	dims := 0
+	if len(me.WideData) > 0 {
+		dims = len(me.WideData[0])
+	}
+	for _, d := range me.WideData {
+		if len(d) != dims {
+			return 0, ErrInconsistentDimensions
+		}
+	}
+	e := newEncoder(w)
+	e.header(encodingHeader{
+		Kind:      encodingKindWideModel,
+		Weighting: me.Narrow.DistanceWeighting,
+		Dims:      uint64(dims),
+		N:         uint64(len(me.WideData)),
+		NLabels:   uint64(len(me.Narrow.Labels)),
+		NValues:   uint64(len(me.Narrow.Values)),
+	})
+	for _, d := range me.WideData {
+		encodeSlice(e, d, identity)
+	}
+	e.labelsAndValues(me.Narrow)
+	return e.finish()
+}
+
+// checkEncodable returns [ErrUnsupportedSetting] if the model has a setting that changes its results, but can't be encoded.
+// The settings that only change how the data is searched, like [Model.Workers], aren't encoded either.
+func (me *Model) checkEncodable() error {
+	var setting string
+	switch {
+	case me.DataMasks != nil:
+		setting = "DataMasks"
+	case me.WideDataMasks != nil:
+		setting = "WideDataMasks"
+	case me.BitWeights != nil:
+		setting = "BitWeights"
+	case me.FloatBitWeights != nil:
+		setting = "FloatBitWeights"
+	case me.Similarity != SimilarityTanimoto:
+		setting = "Similarity"
+	case me.Metric != nil:
+		setting = "Metric"
+	case me.SimilarityWeightingFunc != nil:
+		setting = "SimilarityWeightingFunc"
+	case me.Aggregation != AggregationMean:
+		setting = "Aggregation"
+	case me.TrimFraction != 0:
+		setting = "TrimFraction"
+	case me.TieBreaking != TieBreakingLowestIndex:
+		setting = "TieBreaking"
+	case me.MaskedDistanceNormalization:
+		setting = "MaskedDistanceNormalization"
+	default:
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrUnsupportedSetting, setting)
+}
+
+// MarshalBinary encodes the model in the format written by [Model.WriteTo].
+func (me *Model) MarshalBinary() ([]byte, error) {
+	var b bytes.Buffer
+	_, err := me.WriteTo(&b)
+	return b.Bytes(), err
+}
+
+// MarshalBinary encodes the model in the format written by [WideModel.WriteTo].
+func (me *WideModel) MarshalBinary() ([]byte, error) {
+	var b bytes.Buffer
+	_, err := me.WriteTo(&b)
+	return b.Bytes(), err
+}
+
+// ReadModel reads a model written by [Model.WriteTo], and applies the given options to it.
+// If the model uses [DistanceWeightingCustom] and no [WithDistanceWeightingFunc] option is given,
+// the model is returned along with [ErrMissingDistanceWeightingFunc].
+// Panics if the options set bit weights of more than 64 bits, like [Fit].
+func ReadModel(r io.Reader, opts ...Option) (*Model, error) {
+	d := newDecoder(r)
+	h := d.header(encodingKindModel)
+	if d.err != nil {
+		return nil, d.err
+	}
+	m := &Model{DistanceWeighting: h.Weighting}
+	m.Data = decodeSlice(d, h.N, identity)
+	d.labelsAndValues(m, h)
+	if err := d.finish(); err != nil {
+		return nil, err
+	}
+	err := applyDecodedOptions(m, opts)
+	m.checkWeights()
+	if m.countOnes {
+		m.CountOnes()
+	}
+	return m, err
+}
+
+// ReadWideModel reads a model written by [WideModel.WriteTo], and applies the given options to it.
+// The data points are allocated using a flat backing slice.
+// If the model uses [DistanceWeightingCustom] and no [WithDistanceWeightingFunc] option is given,
+// the model is returned along with [ErrMissingDistanceWeightingFunc].
+func ReadWideModel(r io.Reader, opts ...Option) (*WideModel, error) {
+	m, _, err := readWideModel(r, opts)
+	return m, err
+}
+
+// readWideModel is [ReadWideModel], and also returns the flat backing slice of the data points.
+func readWideModel(r io.Reader, opts []Option) (*WideModel, []uint64, error) {
+	d := newDecoder(r)
+	h := d.header(encodingKindWideModel)
+	if d.err != nil {
+		return nil, nil, d.err
+	}
+	m := &WideModel{Narrow: &Model{DistanceWeighting: h.Weighting}}
+	if h.Dims > 0 && h.N > math.MaxInt/h.Dims {
+		return nil, nil, ErrInvalidFormat
+	}
+	flat := decodeSlice(d, h.N*h.Dims, identity)
+	if d.err == nil {
+		m.WideData = make([][]uint64, h.N)
+		for i := range m.WideData {
+			m.WideData[i] = flat[uint64(i)*h.Dims : uint64(i+1)*h.Dims : uint64(i+1)*h.Dims]
+		}
+	}
+	d.labelsAndValues(m.Narrow, h)
+	if err := d.finish(); err != nil {
+		return nil, nil, err
+	}
+	err := applyDecodedOptions(m.Narrow, opts)
+	if m.Narrow.countOnes {
+		m.CountOnes()
+	}
+	return m, flat, err
+}
+
+// UnmarshalBinary decodes a model encoded by [Model.MarshalBinary] into the receiver.
+// An existing [Model.DistanceWeightingFunc] is kept, so it can be attached before decoding.
+func (me *Model) UnmarshalBinary(data []byte) error {
+	m, err := ReadModel(bytes.NewReader(data))
+	if m == nil {
+		return err
+	}
+	f := me.DistanceWeightingFunc
+	*me = *m
+	if me.DistanceWeighting == DistanceWeightingCustom && f != nil {
+		me.DistanceWeightingFunc = f
+		return nil
+	}
+	return err
+}
+
+// UnmarshalBinary decodes a model encoded by [WideModel.MarshalBinary] into the receiver.
+// An existing [Model.DistanceWeightingFunc] is kept, so it can be attached before decoding.
+func (me *WideModel) UnmarshalBinary(data []byte) error {
+	m, err := ReadWideModel(bytes.NewReader(data))
+	if m == nil {
+		return err
+	}
+	var f func(int) float64
+	if me.Narrow != nil {
+		f = me.Narrow.DistanceWeightingFunc
+	}
+	*me = *m
+	if me.Narrow.DistanceWeighting == DistanceWeightingCustom && f != nil {
+		me.Narrow.DistanceWeightingFunc = f
+		return nil
+	}
+	return err
+}
+
+func identity(v uint64) uint64 { return v }
+
+func applyDecodedOptions(m *Model, opts []Option) error {
+	for _, opt := range opts {
+		opt(m)
+	}
+	if m.DistanceWeighting == DistanceWeightingCustom && m.DistanceWeightingFunc == nil {
+		return ErrMissingDistanceWeightingFunc
+	}
+	return nil
+}
+
+type encoder struct {
+	w   io.Writer
+	crc hash.Hash32
+	buf []byte
+	n   int64
+	err error
+}
+
+func newEncoder(w io.Writer) *encoder {
+	return &encoder{w: w, crc: crc32.New(castagnoli)}
+}
+
+func (me *encoder) write(p []byte) {
+	if me.err != nil {
+		return
+	}
+	n, err := me.w.Write(p)
+	me.n += int64(n)
+	me.err = err
+	me.crc.Write(p)
+}
+
+func (me *encoder) header(h encodingHeader) {
+	b := append(me.buf[:0], encodingMagic...)
+	b = binary.LittleEndian.AppendUint16(b, encodingVersion)
+	b = append(b, h.Kind, uint8(h.Weighting))
+	b = binary.LittleEndian.AppendUint64(b, h.Dims)
+	b = binary.LittleEndian.AppendUint64(b, h.N)
+	b = binary.LittleEndian.AppendUint64(b, h.NLabels)
+	b = binary.LittleEndian.AppendUint64(b, h.NValues)
+	me.buf = b
+	me.write(b)
+}
+
+// encodeSlice writes the elements of s, converted to uint64s by f.
+func encodeSlice[T any](e *encoder, s []T, f func(T) uint64) {
+	for len(s) > 0 {
+		chunk := s[:min(len(s), encodingChunkSize)]
+		b := e.buf[:0]
+		for _, v := range chunk {
+			b = binary.LittleEndian.AppendUint64(b, f(v))
+		}
+		e.buf = b
+		e.write(b)
+		s = s[len(chunk):]
+	}
+}
+
+func (me *encoder) labelsAndValues(m *Model) {
+	encodeSlice(me, m.Labels, func(v int) uint64 { return uint64(v) })
+	encodeSlice(me, m.Values, math.Float64bits)
+}
+
+func (me *encoder) finish() (int64, error) {
+	if me.err != nil {
+		return me.n, me.err
+	}
+	b := binary.LittleEndian.AppendUint32(me.buf[:0], me.crc.Sum32())
+	n, err := me.w.Write(b)
+	return me.n + int64(n), err
+}
+
+type decoder struct {
+	r   io.Reader
+	crc hash.Hash32
+	buf []byte
+	err error
+}
+
+func newDecoder(r io.Reader) *decoder {
+	return &decoder{r: r, crc: crc32.New(castagnoli), buf: make([]byte, 8*encodingChunkSize)}
+}
+
+// read reads the next n <= len(me.buf) bytes.
+func (me *decoder) read(n int) []byte {
+	if me.err != nil {
+		return nil
+	}
+	b := me.buf[:n]
+	if _, err := io.ReadFull(me.r, b); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		me.err = err
+		return nil
+	}
+	me.crc.Write(b)
+	return b
+}
+
+func (me *decoder) header(kind uint8) encodingHeader {
+	var h encodingHeader
+	b := me.read(encodingHeaderSize)
+	if b == nil {
+		return h
+	}
+	if string(b[:4]) != encodingMagic {
+		me.err = ErrInvalidFormat
+		return h
+	}
+	if version := binary.LittleEndian.Uint16(b[4:]); version != encodingVersion {
+		me.err = fmt.Errorf("%w: %d", ErrUnsupportedVersion, version)
+		return h
+	}
+	h.Kind, h.Weighting = b[6], DistanceWeighting(b[7])
+	h.Dims = binary.LittleEndian.Uint64(b[8:])
+	h.N = binary.LittleEndian.Uint64(b[16:])
+	h.NLabels = binary.LittleEndian.Uint64(b[24:])
+	h.NValues = binary.LittleEndian.Uint64(b[32:])
+	if h.Kind != kind || h.Weighting > DistanceWeightingCustom {
+		me.err = ErrInvalidFormat
+	}
+	if kind == encodingKindModel && h.Dims != 1 {
+		me.err = ErrInvalidFormat
+	}
+	return h
+}
+
+// decodeSlice reads n uint64s, converted by f.
+// Memory is allocated as the data is read, so that a corrupt length fails before exhausting memory.
+func decodeSlice[T any](d *decoder, n uint64, f func(uint64) T) []T {
+	if n > math.MaxInt/8 {
+		d.err = ErrInvalidFormat
+	}
+	var out []T
+	for n > 0 && d.err == nil {
+		chunk := min(n, encodingChunkSize)
+		b := d.read(int(chunk) * 8)
+		if b == nil {
+			return nil
+		}
+		for i := range int(chunk) {
+			out = append(out, f(binary.LittleEndian.Uint64(b[8*i:])))
+		}
+		n -= chunk
+	}
+	return out
+}
+
+func (me *decoder) labelsAndValues(m *Model, h encodingHeader) {
+	m.Labels = decodeSlice(me, h.NLabels, func(v uint64) int { return int(v) })
+	m.Values = decodeSlice(me, h.NValues, math.Float64frombits)
+}
+
+func (me *decoder) finish() error {
+	if me.err != nil {
+		return me.err
+	}
+	sum := me.crc.Sum32()
+	var b [4]byte
+	if _, err := io.ReadFull(me.r, b[:]); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	if binary.LittleEndian.Uint32(b[:]) != sum {
+		return ErrChecksumMismatch
+	}
+	return nil
+}
@@ -0,0 +1,233 @@
+package bitknn_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/keilerkonzept/bitknn"
+	"pgregory.net/rapid"
+)
+
+var weightingOptions = []bitknn.Option{
+	func(*bitknn.Model) {},
+	bitknn.WithLinearDistanceWeighting(),
+	bitknn.WithQuadraticDistanceWeighting(),
+}
+
+func drawModelOptions(t *rapid.T, n int) []bitknn.Option {
+	opts := []bitknn.Option{rapid.SampledFrom(weightingOptions).Draw(t, "weighting")}
+	if rapid.Bool().Draw(t, "hasValues") {
+		opts = append(opts, bitknn.WithValues(rapid.SliceOfN(rapid.Float64(), n, n).Draw(t, "values")))
+	}
+	return opts
+}
+
+func TestModel_WriteToReadModel(t *testing.T) {
+	rapid.Check(t, func(t *rapid.T) {
+		data := rapid.SliceOf(rapid.Uint64()).Draw(t, "data")
+		var labels []int
+		if rapid.Bool().Draw(t, "hasLabels") {
+			labels = rapid.SliceOfN(rapid.Int(), len(data), len(data)).Draw(t, "labels")
+		}
+		model := bitknn.Fit(data, labels, drawModelOptions(t, len(data))...)
+
+		var b bytes.Buffer
+		n, err := model.WriteTo(&b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != int64(b.Len()) {
+			t.Fatal("WriteTo should return the number of bytes written", n, b.Len())
+		}
+		read, err := bitknn.ReadModel(&b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(model, read, cmpopts.EquateEmpty(), cmpopts.EquateNaNs(), cmpopts.IgnoreUnexported(bitknn.Model{}, bitknn.WideModel{})); diff != "" {
+			t.Fatal(diff)
+		}
+
+		encoded, err := model.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var unmarshaled bitknn.Model
+		if err := unmarshaled.UnmarshalBinary(encoded); err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(model, &unmarshaled, cmpopts.EquateEmpty(), cmpopts.EquateNaNs(), cmpopts.IgnoreUnexported(bitknn.Model{}, bitknn.WideModel{})); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+}
+
+func TestWideModel_WriteToReadWideModel(t *testing.T) {
+	rapid.Check(t, func(t *rapid.T) {
+		dims := rapid.IntRange(1, 8).Draw(t, "dims")
+		data := rapid.SliceOf(rapid.SliceOfN(rapid.Uint64(), dims, dims)).Draw(t, "data")
+		var labels []int
+		if rapid.Bool().Draw(t, "hasLabels") {
+			labels = rapid.SliceOfN(rapid.Int(), len(data), len(data)).Draw(t, "labels")
+		}
+		model := bitknn.FitWide(data, labels, drawModelOptions(t, len(data))...)
+
+		var b bytes.Buffer
+		if _, err := model.WriteTo(&b); err != nil {
+			t.Fatal(err)
+		}
+		read, err := bitknn.ReadWideModel(&b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(model, read, cmpopts.EquateEmpty(), cmpopts.EquateNaNs(), cmpopts.IgnoreUnexported(bitknn.Model{}, bitknn.WideModel{})); diff != "" {
+			t.Fatal(diff)
+		}
+
+		encoded, err := model.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var unmarshaled bitknn.WideModel
+		if err := unmarshaled.UnmarshalBinary(encoded); err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(model, &unmarshaled, cmpopts.EquateEmpty(), cmpopts.EquateNaNs(), cmpopts.IgnoreUnexported(bitknn.Model{}, bitknn.WideModel{})); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+}
+
+func TestReadModel_Corrupted(t *testing.T) {
+	model := bitknn.Fit([]uint64{1, 2, 3}, []int{0, 1, 0}, bitknn.WithValues([]float64{1, 2, 3}))
+	encoded, err := model.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	corrupt := func(f func(b []byte) []byte) io.Reader {
+		return bytes.NewReader(f(bytes.Clone(encoded)))
+	}
+	const headerSize = 40
+
+	cases := []struct {
+		name string
+		r    io.Reader
+		err  error
+	}{
+		{"magic", corrupt(func(b []byte) []byte { b[0] = 'X'; return b }), bitknn.ErrInvalidFormat},
+		{"version", corrupt(func(b []byte) []byte { b[4]++; return b }), bitknn.ErrUnsupportedVersion},
+		{"weighting", corrupt(func(b []byte) []byte { b[7] = 0xFF; return b }), bitknn.ErrInvalidFormat},
+		{"data", corrupt(func(b []byte) []byte { b[headerSize] ^= 1; return b }), bitknn.ErrChecksumMismatch},
+		{"checksum", corrupt(func(b []byte) []byte { b[len(b)-1] ^= 1; return b }), bitknn.ErrChecksumMismatch},
+		{"truncated", corrupt(func(b []byte) []byte { return b[:len(b)-5] }), io.ErrUnexpectedEOF},
+		{"empty", bytes.NewReader(nil), io.ErrUnexpectedEOF},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if _, err := bitknn.ReadModel(c.r); !errors.Is(err, c.err) {
+				t.Fatalf("expected %v, got %v", c.err, err)
+			}
+		})
+	}
+
+	wide, err := bitknn.FitWide([][]uint64{{1}}, nil).MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bitknn.ReadModel(bytes.NewReader(wide)); !errors.Is(err, bitknn.ErrInvalidFormat) {
+		t.Fatal("reading a WideModel as a Model should fail", err)
+	}
+	if _, err := bitknn.ReadWideModel(bytes.NewReader(encoded)); !errors.Is(err, bitknn.ErrInvalidFormat) {
+		t.Fatal("reading a Model as a WideModel should fail", err)
+	}
+}
+
+func TestReadModel_CustomDistanceWeighting(t *testing.T) {
+	f := func(dist int) float64 { return 1 / float64(1+dist) }
+	data := []uint64{0b0000, 0b1111, 0b0011}
+	labels := []int{0, 1, 1}
+	model := bitknn.Fit(data, labels, bitknn.WithDistanceWeightingFunc(f))
+	encoded, err := model.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	read, err := bitknn.ReadModel(bytes.NewReader(encoded))
+	if !errors.Is(err, bitknn.ErrMissingDistanceWeightingFunc) {
+		t.Fatal("loading a model with custom weighting should report the missing function", err)
+	}
+	if read == nil || read.DistanceWeighting != bitknn.DistanceWeightingCustom {
+		t.Fatal("the model should be returned along with the error", read)
+	}
+
+	read, err = bitknn.ReadModel(bytes.NewReader(encoded), bitknn.WithDistanceWeightingFunc(f))
+	if err != nil {
+		t.Fatal(err)
+	}
+	votes, readVotes := make([]float64, 2), make([]float64, 2)
+	model.Predict(2, 0b0001, bitknn.VoteSlice(votes))
+	read.Predict(2, 0b0001, bitknn.VoteSlice(readVotes))
+	if diff := cmp.Diff(votes, readVotes); diff != "" {
+		t.Fatal(diff)
+	}
+
+	var unmarshaled bitknn.Model
+	if err := unmarshaled.UnmarshalBinary(encoded); !errors.Is(err, bitknn.ErrMissingDistanceWeightingFunc) {
+		t.Fatal("unmarshaling a model with custom weighting should report the missing function", err)
+	}
+	unmarshaled = bitknn.Model{DistanceWeightingFunc: f}
+	if err := unmarshaled.UnmarshalBinary(encoded); err != nil {
+		t.Fatal("a function set before unmarshaling should be kept", err)
+	}
+	if unmarshaled.DistanceWeightingFunc == nil {
+		t.Fatal("a function set before unmarshaling should be kept")
+	}
+
+	wide, err := bitknn.FitWide([][]uint64{{1, 2}}, []int{0}, bitknn.WithDistanceWeightingFunc(f)).MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	unmarshaledWide := bitknn.WideModel{Narrow: &bitknn.Model{DistanceWeightingFunc: f}}
+	if err := unmarshaledWide.UnmarshalBinary(wide); err != nil {
+		t.Fatal("a function set before unmarshaling should be kept", err)
+	}
+}
+
+func TestWideModel_WriteTo_InconsistentDimensions(t *testing.T) {
+	model := bitknn.FitWide([][]uint64{{1, 2}, {3}}, nil)
+	if _, err := model.WriteTo(io.Discard); !errors.Is(err, bitknn.ErrInconsistentDimensions) {
+		t.Fatal(err)
+	}
+}
+
+func TestModel_WriteTo_UnsupportedSetting(t *testing.T) {
+	for name, opt := range map[string]bitknn.Option{
+		"DataMasks":                   bitknn.WithDataMasks([]uint64{1}),
+		"WideDataMasks":               bitknn.WithWideDataMasks([][]uint64{{1, 2}}),
+		"BitWeights":                  bitknn.WithBitWeights(bitknn.ByteWeights([]int{1})),
+		"FloatBitWeights":             bitknn.WithFloatBitWeights(bitknn.ByteWeights([]float64{1})),
+		"Similarity":                  bitknn.WithSimilarity(bitknn.SimilarityDice),
+		"Metric":                      bitknn.WithMetric(bitknn.SimilarityCosine),
+		"SimilarityWeightingFunc":     bitknn.WithSimilarityWeighting(),
+		"Aggregation":                 bitknn.WithAggregation(bitknn.AggregationMedian),
+		"TrimFraction":                bitknn.WithTrimmedMean(0.1),
+		"TieBreaking":                 bitknn.WithTieBreaking(bitknn.TieBreakingHighestIndex),
+		"MaskedDistanceNormalization": bitknn.WithMaskedDistanceNormalization(),
+	} {
+		var b bytes.Buffer
+		if _, err := bitknn.Fit([]uint64{1}, []int{0}, opt).WriteTo(&b); !errors.Is(err, bitknn.ErrUnsupportedSetting) || b.Len() > 0 {
+			t.Error(name, err, b.Len())
+		}
+		if _, err := bitknn.FitWide([][]uint64{{1, 2}}, []int{0}, opt).WriteTo(&b); !errors.Is(err, bitknn.ErrUnsupportedSetting) || b.Len() > 0 {
+			t.Error(name, "(wide)", err, b.Len())
+		}
+	}
+	// Settings that don't change the results are simply not written.
+	model := bitknn.Fit([]uint64{1}, []int{0}, bitknn.WithWorkers(4), bitknn.WithSorted(), bitknn.WithEarlyAbandon())
+	if _, err := model.WriteTo(io.Discard); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -59,3 +59,23 @@ func ExampleFitWide() {
 	// Output:
 	// Votes: [0.25 0.16666666666666666]
 }
+
+func ExampleFitClassifier() {
+	// feature vectors packed into uint64s
+	data := []uint64{0b101010, 0b111000, 0b000111}
+	// class labels of any comparable type
+	labels := []string{"even", "odd", "odd"}
+
+	classifier := bitknn.FitClassifier(data, labels, bitknn.WithLinearDistanceWeighting())
+
+	k := 2
+	fmt.Println("Label:", classifier.Predict(k, 0b101011))
+
+	// one vote counter per class, keyed by the labels
+	votes := classifier.Encoding.NewVoteSlice()
+	classifier.PredictVotes(k, 0b101011, votes)
+	fmt.Println("Votes for odd:", votes.Get("odd"))
+	// Output:
+	// Label: even
+	// Votes for odd: 0.25
+}
@@ -2,47 +2,67 @@ package heap
 
 import "unsafe"
 
-// Max is a max-heap used to keep track of nearest neighbors.
-type Max[T int | uint64] struct {
-	distances    []int
-	lastDistance *int
+// Max is a max-heap used to keep track of nearest neighbors, with integer or floating-point distances.
+// Neighbors with equal distances are ordered by their value, so that the k smallest (distance, value) pairs are kept.
+type Max[D int | float64, T int | uint64] struct {
+	distances    []D
+	lastDistance *D
 	values       []T
 	lastValue    *T
 	len          int
 }
 
-const unsafeSizeofInt = unsafe.Sizeof(int(0))
-
-func MakeMax[T int | uint64](distances []int, value []T) Max[T] {
-	return Max[T]{
+func MakeMax[D int | float64, T int | uint64](distances []D, value []T) Max[D, T] {
+	return Max[D, T]{
 		distances:    distances,
-		lastDistance: (*int)(unsafe.Add(unsafe.Pointer(unsafe.SliceData(distances)), unsafeSizeofInt*uintptr(len(distances)-1))),
+		lastDistance: (*D)(unsafe.Add(unsafe.Pointer(unsafe.SliceData(distances)), unsafe.Sizeof(D(0))*uintptr(len(distances)-1))),
 		values:       value,
 		lastValue:    (*T)(unsafe.Add(unsafe.Pointer(unsafe.SliceData(value)), unsafe.Sizeof(T(0))*uintptr(len(value)-1))),
 	}
 }
 
-func (me *Max[T]) Len() int {
+// MakeMaxLen is [MakeMax] for slices that already contain a heap of length n.
+func MakeMaxLen[D int | float64, T int | uint64](distances []D, value []T, n int) Max[D, T] {
+	heap := MakeMax(distances, value)
+	heap.len = n
+	return heap
+}
+
+func (me *Max[D, T]) Len() int {
 	return me.len
 }
 
-func (me *Max[T]) swap(i, j int) {
+func (me *Max[D, T]) swap(i, j int) {
 	me.distances[i], me.distances[j] = me.distances[j], me.distances[i]
 	me.values[i], me.values[j] = me.values[j], me.values[i]
 }
 
-func (me *Max[T]) less(i, j int) bool {
-	return me.distances[i] > me.distances[j]
+// less orders the heap by descending distance, and equal distances by descending value.
+// The heap root is thus the neighbor with the largest (distance, value) pair.
+func (me *Max[D, T]) less(i, j int) bool {
+	di, dj := me.distances[i], me.distances[j]
+	return di > dj || (di == dj && me.values[i] > me.values[j])
 }
 
-func (me *Max[T]) PushPop(dist int, value T) {
+// PushPop pushes the given neighbor and pops the largest one, leaving it in the last slot of the slices.
+func (me *Max[D, T]) PushPop(dist D, value T) {
 	n := me.len
-	*me.lastDistance = dist
-	*me.lastValue = value
-	me.up(n)
-	me.swap(0, n)
+	if n == 0 {
+		*me.lastDistance = dist
+		*me.lastValue = value
+		return
+	}
+	d0, v0 := me.distances[0], me.values[0]
+	if dist > d0 || (dist == d0 && value >= v0) { // The pushed neighbor is the largest one
+		*me.lastDistance = dist
+		*me.lastValue = value
+		return
+	}
+	*me.lastDistance = d0
+	*me.lastValue = v0
+	me.distances[0] = dist
+	me.values[0] = value
 
-	// me.down(0, n)
 	i := 0
 	for {
 		l := 2*i + 1         // Left child
@@ -61,7 +81,7 @@ func (me *Max[T]) PushPop(dist int, value T) {
 	}
 }
 
-func (me *Max[T]) Push(dist int, value T) {
+func (me *Max[D, T]) Push(dist D, value T) {
 	n := me.len
 	me.distances[n] = dist
 	me.values[n] = value
@@ -69,7 +89,7 @@ func (me *Max[T]) Push(dist int, value T) {
 	me.up(n)
 }
 
-func (me *Max[T]) up(i int) {
+func (me *Max[D, T]) up(i int) {
 	for {
 		p := (i - 1) / 2              // Parent index
 		if p == i || !me.less(i, p) { // If parent is larger or i is root, stop
@@ -79,3 +99,45 @@ func (me *Max[T]) up(i int) {
 		i = p         // Continue moving up
 	}
 }
+
+// Sort sorts the given neighbors in place by ascending distance, and equal distances by ascending value, without allocating.
+// The slices need not be a heap.
+func Sort[D int | float64, T int | uint64](distances []D, values []T) {
+	SortFunc(distances, values, func(i, j int) bool {
+		di, dj := distances[i], distances[j]
+		return di < dj || (di == dj && values[i] < values[j])
+	})
+}
+
+// SortFunc sorts the given neighbors in place without allocating, ordered by the given comparison of the neighbors at two positions of the slices.
+// The slices need not be a heap.
+func SortFunc[D int | float64, T int | uint64](distances []D, values []T, less func(i, j int) bool) {
+	n := len(distances)
+	values = values[:n]
+	down := func(i, n int) {
+		for {
+			l := 2*i + 1
+			if l >= n || l < 0 {
+				break
+			}
+			j := l
+			if r := l + 1; r < n && less(l, r) {
+				j = r
+			}
+			if !less(i, j) {
+				break
+			}
+			distances[i], distances[j] = distances[j], distances[i]
+			values[i], values[j] = values[j], values[i]
+			i = j
+		}
+	}
+	for i := n/2 - 1; i >= 0; i-- {
+		down(i, n)
+	}
+	for end := n - 1; end > 0; end-- {
+		distances[0], distances[end] = distances[end], distances[0]
+		values[0], values[end] = values[end], values[0]
+		down(0, end)
+	}
+}
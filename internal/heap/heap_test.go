@@ -1,7 +1,11 @@
 package heap
 
 import (
+	"cmp"
+	"slices"
 	"testing"
+
+	"pgregory.net/rapid"
 )
 
 func TestMakeNeighborHeap(t *testing.T) {
@@ -19,7 +23,7 @@ func TestMakeNeighborHeap(t *testing.T) {
 }
 
 func TestNeighborHeapSwap(t *testing.T) {
-	heap := Max[int]{
+	heap := Max[int, int]{
 		distances: []int{10, 20, 30},
 		values:    []int{1, 2, 3},
 	}
@@ -35,7 +39,7 @@ func TestNeighborHeapSwap(t *testing.T) {
 }
 
 func TestNeighborHeapLess(t *testing.T) {
-	heap := Max[int]{
+	heap := Max[int, int]{
 		distances: []int{10, 20, 30},
 		values:    []int{1, 2, 3},
 	}
@@ -99,3 +103,131 @@ func TestNeighborHeapPush(t *testing.T) {
 		t.Errorf("Expected root value to be 6, got %d", heap.values[0])
 	}
 }
+
+func TestMakeMaxLen(t *testing.T) {
+	distances := make([]int, 4)
+	values := make([]int, 4)
+	heap := MakeMax(distances, values)
+	heap.Push(10, 3)
+	heap.Push(15, 5)
+	heap.Push(25, 6)
+
+	resumed := MakeMaxLen(distances, values, heap.Len())
+	if resumed.Len() != 3 {
+		t.Errorf("Expected length 3, got %d", resumed.Len())
+	}
+	heap.PushPop(9, 1)
+	resumed.PushPop(9, 1)
+	for i := range distances[:3] {
+		if heap.distances[i] != resumed.distances[i] || heap.values[i] != resumed.values[i] {
+			t.Errorf("Expected resumed heap to match at %d", i)
+		}
+	}
+}
+
+func TestSort(t *testing.T) {
+	rapid.Check(t, func(t *rapid.T) {
+		distances := rapid.SliceOf(rapid.IntRange(0, 10)).Draw(t, "distances")
+		values := make([]int, len(distances))
+		for i := range values {
+			values[i] = i
+		}
+		values = rapid.Permutation(values).Draw(t, "values")
+		type pair struct{ d, v int }
+		expected := make([]pair, len(distances))
+		for i := range distances {
+			expected[i] = pair{distances[i], values[i]}
+		}
+		slices.SortFunc(expected, func(a, b pair) int { return cmp.Or(cmp.Compare(a.d, b.d), cmp.Compare(a.v, b.v)) })
+
+		Sort(distances, values)
+		for i, e := range expected {
+			if distances[i] != e.d || values[i] != e.v {
+				t.Fatalf("at %d: expected %v, got (%d, %d)", i, e, distances[i], values[i])
+			}
+		}
+	})
+}
+
+func TestSort_Heap(t *testing.T) {
+	distances, values := make([]int, 6), make([]int, 6)
+	heap := MakeMax(distances, values)
+	for i, d := range []int{5, 1, 4, 1, 5} {
+		heap.Push(d, i)
+	}
+	Sort(distances[:5], values[:5])
+	if !slices.Equal(distances[:5], []int{1, 1, 4, 5, 5}) || !slices.Equal(values[:5], []int{1, 3, 2, 0, 4}) {
+		t.Error(distances, values)
+	}
+	if allocs := testing.AllocsPerRun(10, func() { Sort(distances[:5], values[:5]) }); allocs != 0 {
+		t.Error(allocs)
+	}
+}
+
+func TestSortFunc(t *testing.T) {
+	rapid.Check(t, func(t *rapid.T) {
+		distances := rapid.SliceOf(rapid.IntRange(0, 10)).Draw(t, "distances")
+		values := make([]int, len(distances))
+		for i := range values {
+			values[i] = i
+		}
+		values = rapid.Permutation(values).Draw(t, "values")
+		keys := rapid.SliceOfN(rapid.IntRange(0, 3), len(values), len(values)).Draw(t, "keys")
+		type pair struct{ d, v int }
+		compare := func(a, b pair) int {
+			return cmp.Or(cmp.Compare(keys[b.v], keys[a.v]), cmp.Compare(a.d, b.d), cmp.Compare(a.v, b.v))
+		}
+		expected := make([]pair, len(distances))
+		for i := range distances {
+			expected[i] = pair{distances[i], values[i]}
+		}
+		slices.SortFunc(expected, compare)
+
+		SortFunc(distances, values, func(i, j int) bool {
+			return compare(pair{distances[i], values[i]}, pair{distances[j], values[j]}) < 0
+		})
+		for i, e := range expected {
+			if distances[i] != e.d || values[i] != e.v {
+				t.Fatalf("at %d: expected %v, got (%d, %d)", i, e, distances[i], values[i])
+			}
+		}
+		if allocs := testing.AllocsPerRun(10, func() {
+			SortFunc(distances, values, func(i, j int) bool { return values[i] < values[j] })
+		}); allocs != 0 {
+			t.Fatal(allocs)
+		}
+	})
+}
+
+func TestMax_Float(t *testing.T) {
+	rapid.Check(t, func(t *rapid.T) {
+		k := rapid.IntRange(1, 10).Draw(t, "k")
+		all := rapid.SliceOf(rapid.SampledFrom([]float64{0, 0.25, 0.5, 1.5, 2})).Draw(t, "distances")
+		distances, values := make([]float64, k+1), make([]int, k+1)
+		heap := MakeMax(distances, values)
+		for i, dist := range all {
+			if heap.Len() < k {
+				heap.Push(dist, i)
+				continue
+			}
+			heap.PushPop(dist, i)
+		}
+		type pair struct {
+			d float64
+			v int
+		}
+		expected := make([]pair, len(all))
+		for i, dist := range all {
+			expected[i] = pair{dist, i}
+		}
+		slices.SortFunc(expected, func(a, b pair) int { return cmp.Or(cmp.Compare(a.d, b.d), cmp.Compare(a.v, b.v)) })
+		expected = expected[:heap.Len()]
+
+		Sort(distances[:heap.Len()], values[:heap.Len()])
+		for i, e := range expected {
+			if distances[i] != e.d || values[i] != e.v {
+				t.Fatalf("at %d: expected %v, got (%v, %d)", i, e, distances[i], values[i])
+			}
+		}
+	})
+}
@@ -1,7 +1,19 @@
-//go:build !arm64
+//go:build !arm64 && !amd64
 
 package neon
 
+func Distances(x uint64, data []uint64, out []uint32) {
+	distancesGeneric(x, data, out)
+}
+
 func DistancesWide(a []uint64, bs [][]uint64, out []uint32) {
 	distancesWideGeneric(a, bs, out)
 }
+
+func DistancesFlat(a []uint64, bs []uint64, out []uint32) {
+	distancesFlatGeneric(a, bs, out)
+}
+
+func DistancesWideMasked(a, mask []uint64, bs [][]uint64, out []uint32) {
+	distancesWideMaskedGeneric(a, mask, bs, out)
+}
@@ -0,0 +1,48 @@
+package neon
+
+import (
+	"golang.org/x/sys/cpu"
+)
+
+func init() {
+	switch {
+	case cpu.X86.HasAVX512F && cpu.X86.HasAVX512VPOPCNTDQ:
+		Distances = DistancesAVX512
+		DistancesWide = DistancesWideAVX512
+		DistancesFlat = DistancesFlatAVX512
+		DistancesWideMasked = DistancesWideMaskedAVX512
+	case cpu.X86.HasAVX2 && cpu.X86.HasPOPCNT:
+		Distances = DistancesAVX2
+		DistancesWide = DistancesWideAVX2
+		DistancesFlat = DistancesFlatAVX2
+	}
+}
+
+var Distances = distancesGeneric
+
+var DistancesWide = distancesWideGeneric
+
+var DistancesFlat = distancesFlatGeneric
+
+var DistancesWideMasked = distancesWideMaskedGeneric
+
+//go:noescape
+func DistancesAVX2(x uint64, data []uint64, out []uint32)
+
+//go:noescape
+func DistancesAVX512(x uint64, data []uint64, out []uint32)
+
+//go:noescape
+func DistancesWideAVX2(a []uint64, bs [][]uint64, out []uint32)
+
+//go:noescape
+func DistancesFlatAVX2(a []uint64, bs []uint64, out []uint32)
+
+//go:noescape
+func DistancesWideAVX512(a []uint64, bs [][]uint64, out []uint32)
+
+//go:noescape
+func DistancesFlatAVX512(a []uint64, bs []uint64, out []uint32)
+
+//go:noescape
+func DistancesWideMaskedAVX512(a, mask []uint64, bs [][]uint64, out []uint32)
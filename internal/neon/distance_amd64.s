@@ -0,0 +1,473 @@
+#include "textflag.h"
+
+// Popcounts of the nibbles 0..15, twice (one copy per 128-bit lane).
+DATA popcnt_lookup<>+0x00(SB)/8, $0x0302020102010100
+DATA popcnt_lookup<>+0x08(SB)/8, $0x0403030203020201
+DATA popcnt_lookup<>+0x10(SB)/8, $0x0302020102010100
+DATA popcnt_lookup<>+0x18(SB)/8, $0x0403030203020201
+GLOBL popcnt_lookup<>(SB), RODATA|NOPTR, $32
+
+DATA nibble_mask<>+0x00(SB)/8, $0x0f0f0f0f0f0f0f0f
+DATA nibble_mask<>+0x08(SB)/8, $0x0f0f0f0f0f0f0f0f
+DATA nibble_mask<>+0x10(SB)/8, $0x0f0f0f0f0f0f0f0f
+DATA nibble_mask<>+0x18(SB)/8, $0x0f0f0f0f0f0f0f0f
+GLOBL nibble_mask<>(SB), RODATA|NOPTR, $32
+
+// Dword indices moving the even dwords before the odd ones.
+DATA even_odd_dwords<>+0x00(SB)/8, $0x0000000200000000
+DATA even_odd_dwords<>+0x08(SB)/8, $0x0000000600000004
+DATA even_odd_dwords<>+0x10(SB)/8, $0x0000000300000001
+DATA even_odd_dwords<>+0x18(SB)/8, $0x0000000700000005
+GLOBL even_odd_dwords<>(SB), RODATA|NOPTR, $32
+
+// Loads two 256-bit vectors of a^b from SI and DI into Y12 and Y13.
+#define LOAD2(off0, off1) \
+	VMOVDQU off0(SI), Y12; \
+	VPXOR   off0(DI), Y12, Y12; \
+	VMOVDQU off1(SI), Y13; \
+	VPXOR   off1(DI), Y13, Y13
+
+// Carry-save adder: h, l = (l&b)|((l^b)&c), l^b^c. Clobbers Y14 and Y15.
+#define CSA(h, l, b, c) \
+	VPXOR b, l, Y14; \
+	VPAND b, l, h; \
+	VPAND c, Y14, Y15; \
+	VPOR  Y15, h, h; \
+	VPXOR c, Y14, l
+
+// Adds the popcounts of the bytes of r to the four uint64s in Y5.
+// Clobbers Y0 and Y12-Y15.
+#define POPCNT256(r) \
+	VMOVDQU popcnt_lookup<>(SB), Y12; \
+	VMOVDQU nibble_mask<>(SB), Y13; \
+	VPSRLW  $4, r, Y14; \
+	VPAND   Y13, r, Y15; \
+	VPAND   Y13, Y14, Y14; \
+	VPSHUFB Y15, Y12, Y15; \
+	VPSHUFB Y14, Y12, Y14; \
+	VPADDB  Y14, Y15, Y15; \
+	VPXOR   Y0, Y0, Y0; \
+	VPSADBW Y0, Y15, Y15; \
+	VPADDQ  Y15, Y5, Y5
+
+// Replaces the bytes of r by their popcounts, using the lookup table in Y12 and the nibble mask in Y13.
+// Clobbers t1 and t2.
+#define POPCNT_BYTES(r, t1, t2) \
+	VPSRLW  $4, r, t1; \
+	VPAND   Y13, r, t2; \
+	VPAND   Y13, t1, t1; \
+	VPSHUFB t2, Y12, t2; \
+	VPSHUFB t1, Y12, t1; \
+	VPADDB  t1, t2, r
+
+// Computes the Hamming distance between the CX uint64s at SI and at DI into AX,
+// advancing SI and DI past them.
+//
+// Blocks of 64 uint64s (16 256-bit vectors) are counted using the Harley-Seal algorithm:
+// a tree of carry-save adders reduces each block to a single vector of "sixteens",
+// so that only one vector popcount is needed per block.
+// Remaining uint64s are counted using POPCNT.
+//
+// Clobbers Y0-Y15, R8, R12.
+#define DISTANCE_AVX2 \
+	XORQ AX, AX; \
+	CMPQ CX, $64; \
+	JB   scalar4; \
+	VPXOR Y1, Y1, Y1; \
+	VPXOR Y2, Y2, Y2; \
+	VPXOR Y3, Y3, Y3; \
+	VPXOR Y4, Y4, Y4; \
+	VPXOR Y5, Y5, Y5; \
+hs_loop: \
+	LOAD2(0, 32); \
+	CSA(Y6, Y1, Y12, Y13); \
+	LOAD2(64, 96); \
+	CSA(Y7, Y1, Y12, Y13); \
+	CSA(Y8, Y2, Y6, Y7); \
+	LOAD2(128, 160); \
+	CSA(Y6, Y1, Y12, Y13); \
+	LOAD2(192, 224); \
+	CSA(Y7, Y1, Y12, Y13); \
+	CSA(Y9, Y2, Y6, Y7); \
+	CSA(Y10, Y3, Y8, Y9); \
+	LOAD2(256, 288); \
+	CSA(Y6, Y1, Y12, Y13); \
+	LOAD2(320, 352); \
+	CSA(Y7, Y1, Y12, Y13); \
+	CSA(Y8, Y2, Y6, Y7); \
+	LOAD2(384, 416); \
+	CSA(Y6, Y1, Y12, Y13); \
+	LOAD2(448, 480); \
+	CSA(Y7, Y1, Y12, Y13); \
+	CSA(Y9, Y2, Y6, Y7); \
+	CSA(Y11, Y3, Y8, Y9); \
+	CSA(Y6, Y4, Y10, Y11); \
+	POPCNT256(Y6); \
+	ADDQ $512, SI; \
+	ADDQ $512, DI; \
+	SUBQ $64, CX; \
+	CMPQ CX, $64; \
+	JAE  hs_loop; \
+	VPSLLQ $1, Y5, Y5; \
+	POPCNT256(Y4); \
+	VPSLLQ $1, Y5, Y5; \
+	POPCNT256(Y3); \
+	VPSLLQ $1, Y5, Y5; \
+	POPCNT256(Y2); \
+	VPSLLQ $1, Y5, Y5; \
+	POPCNT256(Y1); \
+	VEXTRACTI128 $1, Y5, X0; \
+	VPADDQ  X0, X5, X5; \
+	VPSRLDQ $8, X5, X0; \
+	VPADDQ  X0, X5, X5; \
+	VMOVQ   X5, AX; \
+scalar4: \
+	CMPQ CX, $4; \
+	JB   scalar1; \
+	MOVQ    (SI), R8; \
+	XORQ    (DI), R8; \
+	POPCNTQ R8, R8; \
+	ADDQ    R8, AX; \
+	MOVQ    8(SI), R12; \
+	XORQ    8(DI), R12; \
+	POPCNTQ R12, R12; \
+	ADDQ    R12, AX; \
+	MOVQ    16(SI), R8; \
+	XORQ    16(DI), R8; \
+	POPCNTQ R8, R8; \
+	ADDQ    R8, AX; \
+	MOVQ    24(SI), R12; \
+	XORQ    24(DI), R12; \
+	POPCNTQ R12, R12; \
+	ADDQ    R12, AX; \
+	ADDQ $32, SI; \
+	ADDQ $32, DI; \
+	SUBQ $4, CX; \
+	JMP  scalar4; \
+scalar1: \
+	TESTQ CX, CX; \
+	JZ    distance_done; \
+	MOVQ    (SI), R8; \
+	XORQ    (DI), R8; \
+	POPCNTQ R8, R8; \
+	ADDQ    R8, AX; \
+	ADDQ $8, SI; \
+	ADDQ $8, DI; \
+	DECQ CX; \
+	JMP  scalar1; \
+distance_done:
+
+// Computes the Hamming distance between the CX uint64s at SI and at DI into AX,
+// advancing SI and DI past them.
+// Expects K1 to mask the lowest CX%8 uint64s.
+//
+// Clobbers Z0-Z2, CX.
+#define DISTANCE_AVX512 \
+	VPXORQ Z0, Z0, Z0; \
+	CMPQ CX, $8; \
+	JB   tail; \
+loop8: \
+	VMOVDQU64 (SI), Z1; \
+	VPXORQ    (DI), Z1, Z1; \
+	VPOPCNTQ  Z1, Z1; \
+	VPADDQ    Z1, Z0, Z0; \
+	ADDQ $64, SI; \
+	ADDQ $64, DI; \
+	SUBQ $8, CX; \
+	CMPQ CX, $8; \
+	JAE  loop8; \
+tail: \
+	TESTQ CX, CX; \
+	JZ    reduce; \
+	VMOVDQU64.Z (SI), K1, Z1; \
+	VMOVDQU64.Z (DI), K1, Z2; \
+	VPXORQ      Z2, Z1, Z1; \
+	VPOPCNTQ    Z1, Z1; \
+	VPADDQ      Z1, Z0, Z0; \
+	LEAQ (SI)(CX*8), SI; \
+	LEAQ (DI)(CX*8), DI; \
+reduce: \
+	VEXTRACTI64X4 $1, Z0, Y1; \
+	VPADDQ        Y1, Y0, Y0; \
+	VEXTRACTI128  $1, Y0, X1; \
+	VPADDQ        X1, X0, X0; \
+	VPSRLDQ       $8, X0, X1; \
+	VPADDQ        X1, X0, X0; \
+	VMOVQ         X0, AX
+
+// Sets K1 to mask the lowest R11%8 uint64s. Clobbers CX, R8.
+#define TAIL_MASK \
+	MOVQ R11, CX; \
+	ANDQ $7, CX; \
+	MOVQ $1, R8; \
+	SHLQ CX, R8; \
+	DECQ R8; \
+	KMOVW R8, K1
+
+// func DistancesWideAVX2(a []uint64, bs [][]uint64, out []uint32)
+//
+// Computes the Hamming distance between 'a' and each slice in 'bs',
+// storing the results in 'out'.
+// Assumes that all slices in 'bs' have the same length as 'a',
+// and that 'out' has at least len(bs) elements.
+TEXT ·DistancesWideAVX2(SB), NOSPLIT, $0-72
+	MOVQ a_base+0(FP), R10
+	MOVQ a_len+8(FP), R11
+	MOVQ bs_base+24(FP), BX
+	MOVQ bs_len+32(FP), DX
+	MOVQ out_base+48(FP), R9
+	TESTQ DX, DX
+	JZ    done
+
+outer_loop:
+	MOVQ R10, SI
+	MOVQ (BX), DI
+	MOVQ R11, CX
+	DISTANCE_AVX2
+	MOVL AX, (R9)
+	ADDQ $24, BX
+	ADDQ $4, R9
+	DECQ DX
+	JNZ  outer_loop
+
+done:
+	VZEROUPPER
+	RET
+
+// func DistancesFlatAVX2(a []uint64, bs []uint64, out []uint32)
+//
+// Computes the Hamming distance between 'a' and each of the first
+// len(out) consecutive len(a)-word points in 'bs',
+// storing the results in 'out'.
+// Assumes that 'bs' has at least len(a)*len(out) elements.
+TEXT ·DistancesFlatAVX2(SB), NOSPLIT, $0-72
+	MOVQ a_base+0(FP), R10
+	MOVQ a_len+8(FP), R11
+	MOVQ bs_base+24(FP), DI
+	MOVQ out_base+48(FP), R9
+	MOVQ out_len+56(FP), DX
+	TESTQ DX, DX
+	JZ    done
+
+outer_loop:
+	MOVQ R10, SI
+	MOVQ R11, CX
+	DISTANCE_AVX2
+	MOVL AX, (R9)
+	ADDQ $4, R9
+	DECQ DX
+	JNZ  outer_loop
+
+done:
+	VZEROUPPER
+	RET
+
+// func DistancesWideAVX512(a []uint64, bs [][]uint64, out []uint32)
+//
+// Like DistancesWideAVX2, using AVX-512 VPOPCNTQ.
+TEXT ·DistancesWideAVX512(SB), NOSPLIT, $0-72
+	MOVQ a_base+0(FP), R10
+	MOVQ a_len+8(FP), R11
+	MOVQ bs_base+24(FP), BX
+	MOVQ bs_len+32(FP), DX
+	MOVQ out_base+48(FP), R9
+	TESTQ DX, DX
+	JZ    done
+	TAIL_MASK
+
+outer_loop:
+	MOVQ R10, SI
+	MOVQ (BX), DI
+	MOVQ R11, CX
+	DISTANCE_AVX512
+	MOVL AX, (R9)
+	ADDQ $24, BX
+	ADDQ $4, R9
+	DECQ DX
+	JNZ  outer_loop
+
+done:
+	VZEROUPPER
+	RET
+
+// func DistancesFlatAVX512(a []uint64, bs []uint64, out []uint32)
+//
+// Like DistancesFlatAVX2, using AVX-512 VPOPCNTQ.
+TEXT ·DistancesFlatAVX512(SB), NOSPLIT, $0-72
+	MOVQ a_base+0(FP), R10
+	MOVQ a_len+8(FP), R11
+	MOVQ bs_base+24(FP), DI
+	MOVQ out_base+48(FP), R9
+	MOVQ out_len+56(FP), DX
+	TESTQ DX, DX
+	JZ    done
+	TAIL_MASK
+
+outer_loop:
+	MOVQ R10, SI
+	MOVQ R11, CX
+	DISTANCE_AVX512
+	MOVL AX, (R9)
+	ADDQ $4, R9
+	DECQ DX
+	JNZ  outer_loop
+
+done:
+	VZEROUPPER
+	RET
+
+// func DistancesWideMaskedAVX512(a, mask []uint64, bs [][]uint64, out []uint32)
+//
+// Like DistancesWideAVX512, counting only the bits set in 'mask',
+// which must have the same length as 'a'.
+TEXT ·DistancesWideMaskedAVX512(SB), NOSPLIT, $0-96
+	MOVQ a_base+0(FP), R10
+	MOVQ a_len+8(FP), R11
+	MOVQ mask_base+24(FP), R12
+	MOVQ bs_base+48(FP), BX
+	MOVQ bs_len+56(FP), DX
+	MOVQ out_base+72(FP), R9
+	TESTQ DX, DX
+	JZ    done
+	TAIL_MASK
+
+outer_loop:
+	MOVQ R10, SI
+	MOVQ (BX), DI
+	MOVQ R12, R13
+	MOVQ R11, CX
+	VPXORQ Z0, Z0, Z0
+	CMPQ CX, $8
+	JB   tail
+
+loop8:
+	VMOVDQU64 (SI), Z1
+	VPXORQ    (DI), Z1, Z1
+	VPANDQ    (R13), Z1, Z1
+	VPOPCNTQ  Z1, Z1
+	VPADDQ    Z1, Z0, Z0
+	ADDQ $64, SI
+	ADDQ $64, DI
+	ADDQ $64, R13
+	SUBQ $8, CX
+	CMPQ CX, $8
+	JAE  loop8
+
+tail:
+	TESTQ CX, CX
+	JZ    reduce
+	VMOVDQU64.Z (SI), K1, Z1
+	VMOVDQU64.Z (DI), K1, Z2
+	VPXORQ      Z2, Z1, Z1
+	VMOVDQU64.Z (R13), K1, Z2
+	VPANDQ      Z2, Z1, Z1
+	VPOPCNTQ    Z1, Z1
+	VPADDQ      Z1, Z0, Z0
+
+reduce:
+	VEXTRACTI64X4 $1, Z0, Y1
+	VPADDQ        Y1, Y0, Y0
+	VEXTRACTI128  $1, Y0, X1
+	VPADDQ        X1, X0, X0
+	VPSRLDQ       $8, X0, X1
+	VPADDQ        X1, X0, X0
+	VMOVQ         X0, AX
+	MOVL AX, (R9)
+	ADDQ $24, BX
+	ADDQ $4, R9
+	DECQ DX
+	JNZ  outer_loop
+
+done:
+	VZEROUPPER
+	RET
+
+// func DistancesAVX2(x uint64, data []uint64, out []uint32)
+//
+// Computes the Hamming distance between 'x' and each element of 'data',
+// storing the results in 'out'.
+// Assumes that 'out' has at least len(data) elements.
+TEXT ·DistancesAVX2(SB), NOSPLIT, $0-56
+	MOVQ x+0(FP), AX
+	MOVQ data_base+8(FP), SI
+	MOVQ data_len+16(FP), CX
+	MOVQ out_base+32(FP), DI
+	VPBROADCASTQ x+0(FP), Y11
+	VMOVDQU popcnt_lookup<>(SB), Y12
+	VMOVDQU nibble_mask<>(SB), Y13
+	VMOVDQU even_odd_dwords<>(SB), Y10
+	VPXOR   Y14, Y14, Y14
+	CMPQ CX, $8
+	JB   scalar1
+
+loop8:
+	VPXOR (SI), Y11, Y0
+	VPXOR 32(SI), Y11, Y1
+	POPCNT_BYTES(Y0, Y2, Y3)
+	POPCNT_BYTES(Y1, Y4, Y5)
+	// Sum the byte counts of each uint64
+	VPSADBW Y14, Y0, Y0
+	VPSADBW Y14, Y1, Y1
+	// Interleave the counts of the two vectors as dwords, and restore their order
+	VPSLLQ  $32, Y1, Y1
+	VPOR    Y1, Y0, Y0
+	VPERMD  Y0, Y10, Y0
+	VMOVDQU Y0, (DI)
+	ADDQ $64, SI
+	ADDQ $32, DI
+	SUBQ $8, CX
+	CMPQ CX, $8
+	JAE  loop8
+
+scalar1:
+	TESTQ CX, CX
+	JZ    done
+	MOVQ    (SI), R8
+	XORQ    AX, R8
+	POPCNTQ R8, R8
+	MOVL    R8, (DI)
+	ADDQ $8, SI
+	ADDQ $4, DI
+	DECQ CX
+	JMP  scalar1
+
+done:
+	VZEROUPPER
+	RET
+
+// func DistancesAVX512(x uint64, data []uint64, out []uint32)
+//
+// Like DistancesAVX2, using AVX-512 VPOPCNTQ.
+TEXT ·DistancesAVX512(SB), NOSPLIT, $0-56
+	MOVQ data_base+8(FP), SI
+	MOVQ data_len+16(FP), CX
+	MOVQ out_base+32(FP), DI
+	VPBROADCASTQ x+0(FP), Z31
+	CMPQ CX, $8
+	JB   tail
+
+loop8:
+	VPXORQ   (SI), Z31, Z0
+	VPOPCNTQ Z0, Z0
+	VPMOVQD  Z0, (DI)
+	ADDQ $64, SI
+	ADDQ $32, DI
+	SUBQ $8, CX
+	CMPQ CX, $8
+	JAE  loop8
+
+tail:
+	TESTQ CX, CX
+	JZ    done
+	MOVQ $1, R8
+	SHLQ CX, R8
+	DECQ R8
+	KMOVW R8, K1
+	VMOVDQU64.Z (SI), K1, Z0
+	VPXORQ      Z31, Z0, Z0
+	VPOPCNTQ    Z0, Z0
+	VPMOVQD     Z0, K1, (DI)
+
+done:
+	VZEROUPPER
+	RET
@@ -0,0 +1,40 @@
+package neon
+
+import (
+	"testing"
+
+	"golang.org/x/sys/cpu"
+)
+
+func TestDistancesWideAVX2(t *testing.T) {
+	if !cpu.X86.HasAVX2 || !cpu.X86.HasPOPCNT {
+		t.Skip("AVX2 is not supported")
+	}
+	t.Run("DistancesAVX2EquivBits", func(t *testing.T) {
+		testDistances(t, DistancesAVX2)
+	})
+	t.Run("DistancesWideAVX2EquivBits", func(t *testing.T) {
+		testDistancesWide(t, DistancesWideAVX2)
+	})
+	t.Run("DistancesFlatAVX2EquivBits", func(t *testing.T) {
+		testDistancesFlat(t, DistancesFlatAVX2)
+	})
+}
+
+func TestDistancesWideAVX512(t *testing.T) {
+	if !cpu.X86.HasAVX512F || !cpu.X86.HasAVX512VPOPCNTDQ {
+		t.Skip("AVX-512 VPOPCNTDQ is not supported")
+	}
+	t.Run("DistancesAVX512EquivBits", func(t *testing.T) {
+		testDistances(t, DistancesAVX512)
+	})
+	t.Run("DistancesWideAVX512EquivBits", func(t *testing.T) {
+		testDistancesWide(t, DistancesWideAVX512)
+	})
+	t.Run("DistancesFlatAVX512EquivBits", func(t *testing.T) {
+		testDistancesFlat(t, DistancesFlatAVX512)
+	})
+	t.Run("DistancesWideMaskedAVX512EquivBits", func(t *testing.T) {
+		testDistancesWideMasked(t, DistancesWideMaskedAVX512)
+	})
+}
@@ -6,10 +6,25 @@ import (
 
 func init() {
 	if cpu.ARM64.HasASIMD {
+		Distances = DistancesNEON
 		DistancesWide = DistancesWideNEON
+		DistancesFlat = DistancesFlatNEON
+		DistancesWideMasked = DistancesWideMaskedNEON
 	}
 }
 
+var Distances = distancesGeneric
+
 var DistancesWide = distancesWideGeneric
 
+var DistancesFlat = distancesFlatGeneric
+
+var DistancesWideMasked = distancesWideMaskedGeneric
+
 func DistancesWideNEON(a []uint64, bs [][]uint64, out []uint32)
+
+func DistancesFlatNEON(a []uint64, bs []uint64, out []uint32)
+
+func DistancesNEON(x uint64, data []uint64, out []uint32)
+
+func DistancesWideMaskedNEON(a, mask []uint64, bs [][]uint64, out []uint32)
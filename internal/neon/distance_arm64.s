@@ -100,3 +100,296 @@ inner_done:
 
 done:
     RET
+
+// func DistancesFlatNEON(a []uint64, bs []uint64, out []uint32)
+//
+// Computes the Hamming distance between 'a' and each of the first
+// len(out) consecutive len(a)-word points in 'bs',
+// storing the results in 'out'.
+//
+// Inputs:
+//   a_base+0(FP)  : base address of slice a
+//   a_len+8(FP)   : length of slice a
+//   (a_cap+16(FP)  : capacity of slice a)
+//   bs_base+24(FP) : base address of slice bs (flat points)
+//   (bs_len+32(FP)  : length of slice bs)
+//   (bs_cap+40(FP)  : capacity of slice bs)
+//   out_base+48(FP): base address of output slice
+//   out_len+56(FP): length of output slice (number of points)
+//   (out_cap+64(FP)): capacity of output slice
+//
+// Assumes that 'bs' has at least len(a)*len(out) elements.
+
+//go:noescape
+TEXT ·DistancesFlatNEON(SB), NOSPLIT, $0-72
+    // Load input parameters
+    MOVD a_len+8(FP), R1
+    MOVD bs_base+24(FP), R6
+    MOVD out_base+48(FP), R4
+    MOVD out_len+56(FP), R5
+
+    // Outer loop counter
+    CBZ R5, flat_done
+
+flat_outer_loop:
+    MOVD a_base+0(FP), R0
+
+    // Initialize the result for this point to 0
+    MOVD $0, R7
+
+    // Inner loop counter (number of uint64 in 'a')
+    MOVD R1, R8
+
+    VEOR V1.B16,V1.B16,V1.B16
+    VEOR V2.B16,V2.B16,V2.B16
+    VEOR V3.B16,V3.B16,V3.B16
+    // Check if the length is at least 2 (16 bytes)
+    CMP $2, R8
+    BLT flat_inner_remainder
+
+flat_inner_loop:
+    // Load 16 bytes (2 uint64s) from 'a' and the current point
+    VLD1.P 16(R0), [V0.D2]
+    VLD1.P 16(R6), [V1.D2]
+
+    // XOR the loaded vectors
+    VEOR V0.B16, V1.B16, V2.B16
+
+    // Count the set bits
+    VCNT V2.B16, V2.B16
+
+    // Sum up the counts
+    VUADDLV V2.B16, V3
+
+    // Add the result to the total
+    FMOVD F3, R9
+    ADD R9, R7
+
+    // Decrement the counter by 2 and continue if there are more elements
+    SUB $2, R8
+    CMP $2, R8
+    BGE flat_inner_loop
+
+flat_inner_remainder:
+    // Handle the remaining element if the length is odd
+    CBZ R8, flat_inner_done
+    MOVD (R0), R9
+    MOVD.P 8(R6), R10 // Move to the next point in 'bs'
+    EOR R9, R10, R9
+    FMOVD R9, F0
+    VCNT V0.B8, V0.B8
+    VUADDLV V0.B8, V0
+    FMOVD F0, R9
+    ADD R9, R7
+
+flat_inner_done:
+    // Store the distance in the output slice
+    MOVW R7, (R4)
+    ADD $4, R4  // Move to the next element in 'out'
+
+    // Decrement the outer loop counter and continue if there are more points
+    SUB $1, R5
+    CBNZ R5, flat_outer_loop
+
+flat_done:
+    RET
+
+// func DistancesNEON(x uint64, data []uint64, out []uint32)
+//
+// Computes the Hamming distance between 'x' and each element of 'data',
+// storing the results in 'out'.
+//
+// Inputs:
+//   x+0(FP)          : the query point
+//   data_base+8(FP)  : base address of slice data
+//   data_len+16(FP)  : length of slice data
+//   (data_cap+24(FP)  : capacity of slice data)
+//   out_base+32(FP)  : base address of output slice
+//   (out_len+40(FP))  : length of output slice
+//   (out_cap+48(FP))  : capacity of output slice
+//
+// Assumes that 'out' has at least len(data) elements.
+
+//go:noescape
+TEXT ·DistancesNEON(SB), NOSPLIT, $0-56
+    // Load input parameters
+    MOVD x+0(FP), R0
+    MOVD data_base+8(FP), R1
+    MOVD data_len+16(FP), R2
+    MOVD out_base+32(FP), R3
+
+    // Broadcast 'x' to both lanes of V31
+    VDUP R0, V31.D2
+
+    // Check if there are at least 16 elements
+    CMP $16, R2
+    BLT narrow_remainder
+
+narrow_loop:
+    // Load 16 elements (8 vectors of 2 uint64s)
+    VLD1.P 64(R1), [V0.D2, V1.D2, V2.D2, V3.D2]
+    VLD1.P 64(R1), [V4.D2, V5.D2, V6.D2, V7.D2]
+
+    // XOR with 'x'
+    VEOR V31.B16, V0.B16, V0.B16
+    VEOR V31.B16, V1.B16, V1.B16
+    VEOR V31.B16, V2.B16, V2.B16
+    VEOR V31.B16, V3.B16, V3.B16
+    VEOR V31.B16, V4.B16, V4.B16
+    VEOR V31.B16, V5.B16, V5.B16
+    VEOR V31.B16, V6.B16, V6.B16
+    VEOR V31.B16, V7.B16, V7.B16
+
+    // Count the set bits of each byte
+    VCNT V0.B16, V0.B16
+    VCNT V1.B16, V1.B16
+    VCNT V2.B16, V2.B16
+    VCNT V3.B16, V3.B16
+    VCNT V4.B16, V4.B16
+    VCNT V5.B16, V5.B16
+    VCNT V6.B16, V6.B16
+    VCNT V7.B16, V7.B16
+
+    // Add adjacent bytes three times, until byte i of V0 holds the count of element i
+    VADDP V1.B16, V0.B16, V0.B16
+    VADDP V3.B16, V2.B16, V2.B16
+    VADDP V5.B16, V4.B16, V4.B16
+    VADDP V7.B16, V6.B16, V6.B16
+    VADDP V2.B16, V0.B16, V0.B16
+    VADDP V6.B16, V4.B16, V4.B16
+    VADDP V4.B16, V0.B16, V0.B16
+
+    // Widen the counts to uint32s
+    VUXTL V0.B8, V1.H8
+    VUXTL2 V0.B16, V2.H8
+    VUXTL V1.H4, V4.S4
+    VUXTL2 V1.H8, V5.S4
+    VUXTL V2.H4, V6.S4
+    VUXTL2 V2.H8, V7.S4
+
+    // Store the 16 distances
+    VST1.P [V4.S4, V5.S4, V6.S4, V7.S4], 64(R3)
+
+    // Decrement the counter by 16 and continue if there are more elements
+    SUB $16, R2
+    CMP $16, R2
+    BGE narrow_loop
+
+narrow_remainder:
+    // Handle the remaining elements one at a time
+    CBZ R2, narrow_done
+    MOVD.P 8(R1), R4
+    EOR R0, R4, R4
+    FMOVD R4, F0
+    VCNT V0.B8, V0.B8
+    VUADDLV V0.B8, V0
+    FMOVD F0, R4
+    MOVW.P R4, 4(R3)
+    SUB $1, R2
+    B narrow_remainder
+
+narrow_done:
+    RET
+
+// func DistancesWideMaskedNEON(a, mask []uint64, bs [][]uint64, out []uint32)
+//
+// Computes the Hamming distance between 'a' and each slice in 'b',
+// counting only the bits set in 'mask', and stores the results in 'out'.
+//
+// Inputs:
+//   a_base+0(FP)    : base address of slice a
+//   a_len+8(FP)     : length of slice a
+//   (a_cap+16(FP)    : capacity of slice a)
+//   mask_base+24(FP): base address of slice mask
+//   (mask_len+32(FP) : length of slice mask)
+//   (mask_cap+40(FP) : capacity of slice mask)
+//   bs_base+48(FP)  : base address of slice b (slice of slices)
+//   bs_len+56(FP)   : length of slice b (number of slices)
+//   (bs_cap+64(FP)   : capacity of slice b)
+//   out_base+72(FP) : base address of output slice
+//   (out_len+80(FP)) : length of output slice
+//   (out_cap+88(FP)) : capacity of output slice
+//
+// Assumes that 'mask' and all slices in 'b' have the same length as 'a',
+// and that 'out' has at least 'bs_len' elements.
+
+//go:noescape
+TEXT ·DistancesWideMaskedNEON(SB), NOSPLIT, $0-96
+    // Load input parameters
+    MOVD a_len+8(FP), R1
+    MOVD bs_base+48(FP), R2
+    MOVD bs_len+56(FP), R3
+    MOVD out_base+72(FP), R4
+
+    // Outer loop counter
+    MOVD R3, R5
+    CBZ R5, masked_done
+
+masked_outer_loop:
+    MOVD a_base+0(FP), R0
+    MOVD mask_base+24(FP), R11
+
+    // Load the base address of the current slice in 'b'
+    MOVD (R2), R6
+    ADD $24, R2  // Move to the next slice in 'b'
+
+    // Initialize the result for this slice to 0
+    MOVD $0, R7
+
+    // Inner loop counter (number of uint64 in 'a')
+    MOVD R1, R8
+
+    // Check if the length is at least 2 (16 bytes)
+    CMP $2, R8
+    BLT masked_inner_remainder
+
+masked_inner_loop:
+    // Load 16 bytes (2 uint64s) from each slice and the mask
+    VLD1.P 16(R0), [V0.D2]
+    VLD1.P 16(R6), [V1.D2]
+    VLD1.P 16(R11), [V4.D2]
+
+    // XOR the loaded vectors, and keep the masked bits
+    VEOR V0.B16, V1.B16, V2.B16
+    VAND V4.B16, V2.B16, V2.B16
+
+    // Count the set bits
+    VCNT V2.B16, V2.B16
+
+    // Sum up the counts
+    VUADDLV V2.B16, V3
+
+    // Add the result to the total
+    FMOVD F3, R9
+    ADD R9, R7
+
+    // Decrement the counter by 2 and continue if there are more elements
+    SUB $2, R8
+    CMP $2, R8
+    BGE masked_inner_loop
+
+masked_inner_remainder:
+    // Handle the remaining element if the length is odd
+    CBZ R8, masked_inner_done
+    MOVD (R0), R9
+    MOVD (R6), R10
+    MOVD (R11), R12
+    EOR R9, R10, R9
+    AND R12, R9, R9
+    FMOVD R9, F0
+    VCNT V0.B8, V0.B8
+    VUADDLV V0.B8, V0
+    FMOVD F0, R9
+    ADD R9, R7
+
+masked_inner_done:
+    // Store the distance in the output slice
+    MOVW R7, (R4)
+    ADD $4, R4  // Move to the next element in 'out'
+
+    // Decrement the outer loop counter and continue if there are more slices
+    SUB $1, R5
+    CBNZ R5, masked_outer_loop
+
+masked_done:
+    RET
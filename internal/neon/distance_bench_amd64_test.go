@@ -0,0 +1,74 @@
+package neon
+
+import (
+	"fmt"
+	"testing"
+
+	"golang.org/x/sys/cpu"
+)
+
+func BenchmarkDistancesWide(b *testing.B) {
+	impls := []struct {
+		name          string
+		supported     bool
+		distancesWide func(a []uint64, bs [][]uint64, out []uint32)
+	}{
+		{"generic", true, distancesWideGeneric},
+		{"AVX2", cpu.X86.HasAVX2 && cpu.X86.HasPOPCNT, DistancesWideAVX2},
+		{"AVX512", cpu.X86.HasAVX512F && cpu.X86.HasAVX512VPOPCNTDQ, DistancesWideAVX512},
+	}
+	const n = 1000
+	for _, dims := range []int{2, 4, 8, 16, 64, 128, 1024} {
+		a := make([]uint64, dims)
+		flat := make([]uint64, n*dims)
+		for i := range flat {
+			flat[i] = uint64(i) * 0x9E3779B97F4A7C15
+		}
+		bs := make([][]uint64, n)
+		for i := range bs {
+			bs[i] = flat[i*dims : (i+1)*dims]
+		}
+		out := make([]uint32, n)
+		for _, impl := range impls {
+			if !impl.supported {
+				continue
+			}
+			b.Run(fmt.Sprintf("impl=%s_bits=%d_N=%d", impl.name, dims*64, n), func(b *testing.B) {
+				b.SetBytes(int64(8 * dims * n))
+				for range b.N {
+					impl.distancesWide(a, bs, out)
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkDistances(b *testing.B) {
+	impls := []struct {
+		name      string
+		supported bool
+		distances func(x uint64, data []uint64, out []uint32)
+	}{
+		{"generic", true, distancesGeneric},
+		{"AVX2", cpu.X86.HasAVX2 && cpu.X86.HasPOPCNT, DistancesAVX2},
+		{"AVX512", cpu.X86.HasAVX512F && cpu.X86.HasAVX512VPOPCNTDQ, DistancesAVX512},
+	}
+	for _, n := range []int{16, 1000, 100_000} {
+		data := make([]uint64, n)
+		for i := range data {
+			data[i] = uint64(i) * 0x9E3779B97F4A7C15
+		}
+		out := make([]uint32, n)
+		for _, impl := range impls {
+			if !impl.supported {
+				continue
+			}
+			b.Run(fmt.Sprintf("impl=%s_bits=64_N=%d", impl.name, n), func(b *testing.B) {
+				b.SetBytes(int64(8 * n))
+				for range b.N {
+					impl.distances(0x5555, data, out)
+				}
+			})
+		}
+	}
+}
@@ -2,6 +2,13 @@ package neon
 
 import "math/bits"
 
+func distancesGeneric(x uint64, data []uint64, out []uint32) {
+	out = out[:len(data)]
+	for i, d := range data {
+		out[i] = uint32(bits.OnesCount64(x ^ d))
+	}
+}
+
 func distancesWideGeneric(a []uint64, bs [][]uint64, out []uint32) {
 	for i, b := range bs {
 		dist := 0
@@ -11,3 +18,25 @@ func distancesWideGeneric(a []uint64, bs [][]uint64, out []uint32) {
 		out[i] = uint32(dist)
 	}
 }
+
+func distancesFlatGeneric(a []uint64, bs []uint64, out []uint32) {
+	s := len(a)
+	for i := range out {
+		b := bs[i*s : (i+1)*s]
+		dist := 0
+		for j, aj := range a {
+			dist += bits.OnesCount64(aj ^ b[j])
+		}
+		out[i] = uint32(dist)
+	}
+}
+
+func distancesWideMaskedGeneric(a, mask []uint64, bs [][]uint64, out []uint32) {
+	for i, b := range bs {
+		dist := 0
+		for j, aj := range a {
+			dist += bits.OnesCount64((aj ^ b[j]) & mask[j])
+		}
+		out[i] = uint32(dist)
+	}
+}
@@ -7,25 +7,122 @@ import (
 	"pgregory.net/rapid"
 )
 
-func TestDistancesWideGeneric(t *testing.T) {
-	t.Run("DistancesWideGenericEquivBits", func(t *testing.T) {
-		rapid.Check(t, func(t *rapid.T) {
-			dims := rapid.IntRange(0, 10_000).Draw(t, "dims")
-			data := rapid.SliceOfN(rapid.SliceOfN(rapid.Uint64(), dims, dims), 16, 10_000).Draw(t, "data")
-			q := rapid.SliceOfN(rapid.Uint64(), dims, dims).Draw(t, "q")
-			for batchSize := range []int{0, 1, 2, len(data), len(data) - 1, len(data) * 2} {
-				out := make([]uint32, batchSize)
-				distancesWideGeneric(q, data[:batchSize], out)
-				for i, d := range out {
-					expected := 0
-					for j, q := range q {
-						expected += bits.OnesCount64(q ^ data[i][j])
-					}
-					if int(d) != expected {
-						t.Fatal(d, expected)
-					}
+// testDistances checks that the given Distances implementation agrees with math/bits.
+func testDistances(t *testing.T, distances func(x uint64, data []uint64, out []uint32)) {
+	rapid.Check(t, func(t *rapid.T) {
+		data := rapid.SliceOfN(rapid.Uint64(), 0, 10_000).Draw(t, "data")
+		x := rapid.Uint64().Draw(t, "x")
+		for _, batchSize := range []int{0, 1, 2, len(data), len(data) - 1} {
+			if batchSize < 0 || batchSize > len(data) {
+				continue
+			}
+			out := make([]uint32, batchSize+1)
+			out[batchSize] = 0xFFFFFFFF
+			distances(x, data[:batchSize], out)
+			for i, d := range out[:batchSize] {
+				if expected := bits.OnesCount64(x ^ data[i]); int(d) != expected {
+					t.Fatal(i, d, expected)
+				}
+			}
+			if out[batchSize] != 0xFFFFFFFF {
+				t.Fatal("should not write past len(data)")
+			}
+		}
+	})
+}
+
+// testDistancesWide checks that the given DistancesWide implementation agrees with math/bits.
+func testDistancesWide(t *testing.T, distancesWide func(a []uint64, bs [][]uint64, out []uint32)) {
+	rapid.Check(t, func(t *rapid.T) {
+		dims := rapid.IntRange(0, 10_000).Draw(t, "dims")
+		data := rapid.SliceOfN(rapid.SliceOfN(rapid.Uint64(), dims, dims), 16, 10_000).Draw(t, "data")
+		q := rapid.SliceOfN(rapid.Uint64(), dims, dims).Draw(t, "q")
+		for _, batchSize := range []int{0, 1, 2, len(data), len(data) - 1} {
+			out := make([]uint32, batchSize)
+			distancesWide(q, data[:batchSize], out)
+			for i, d := range out {
+				expected := 0
+				for j, q := range q {
+					expected += bits.OnesCount64(q ^ data[i][j])
+				}
+				if int(d) != expected {
+					t.Fatal(d, expected)
 				}
 			}
-		})
+		}
+	})
+}
+
+// testDistancesFlat checks that the given DistancesFlat implementation agrees with math/bits.
+func testDistancesFlat(t *testing.T, distancesFlat func(a []uint64, bs []uint64, out []uint32)) {
+	rapid.Check(t, func(t *rapid.T) {
+		dims := rapid.IntRange(0, 1_000).Draw(t, "dims")
+		n := rapid.IntRange(16, 1_000).Draw(t, "n")
+		data := rapid.SliceOfN(rapid.Uint64(), n*dims, n*dims).Draw(t, "data")
+		q := rapid.SliceOfN(rapid.Uint64(), dims, dims).Draw(t, "q")
+		for _, batchSize := range []int{0, 1, 2, n, n - 1} {
+			out := make([]uint32, batchSize)
+			distancesFlat(q, data[:batchSize*dims], out)
+			for i, d := range out {
+				expected := 0
+				for j, q := range q {
+					expected += bits.OnesCount64(q ^ data[i*dims+j])
+				}
+				if int(d) != expected {
+					t.Fatal(d, expected)
+				}
+			}
+		}
+	})
+}
+
+// testDistancesWideMasked checks that the given DistancesWideMasked implementation agrees with math/bits.
+func testDistancesWideMasked(t *testing.T, distancesWideMasked func(a, mask []uint64, bs [][]uint64, out []uint32)) {
+	rapid.Check(t, func(t *rapid.T) {
+		dims := rapid.IntRange(0, 1_000).Draw(t, "dims")
+		data := rapid.SliceOfN(rapid.SliceOfN(rapid.Uint64(), dims, dims), 16, 1_000).Draw(t, "data")
+		q := rapid.SliceOfN(rapid.Uint64(), dims, dims).Draw(t, "q")
+		mask := rapid.SliceOfN(rapid.SampledFrom([]uint64{0, 1<<64 - 1, 0xF0F0F0F0F0F0F0F0, 1 << 63}), dims, dims).Draw(t, "mask")
+		for _, batchSize := range []int{0, 1, 2, len(data), len(data) - 1} {
+			out := make([]uint32, batchSize+1)
+			out[batchSize] = 0xFFFFFFFF
+			distancesWideMasked(q, mask, data[:batchSize], out)
+			for i, d := range out[:batchSize] {
+				expected := 0
+				for j, q := range q {
+					expected += bits.OnesCount64((q ^ data[i][j]) & mask[j])
+				}
+				if int(d) != expected {
+					t.Fatal(d, expected)
+				}
+			}
+			if out[batchSize] != 0xFFFFFFFF {
+				t.Fatal("should not write past len(bs)")
+			}
+		}
+	})
+}
+
+func TestDistancesGeneric(t *testing.T) {
+	t.Run("DistancesGenericEquivBits", func(t *testing.T) {
+		testDistances(t, distancesGeneric)
+	})
+}
+
+func TestDistancesWideGeneric(t *testing.T) {
+	t.Run("DistancesWideGenericEquivBits", func(t *testing.T) {
+		testDistancesWide(t, distancesWideGeneric)
+	})
+}
+
+func TestDistancesFlatGeneric(t *testing.T) {
+	t.Run("DistancesFlatGenericEquivBits", func(t *testing.T) {
+		testDistancesFlat(t, distancesFlatGeneric)
+	})
+}
+
+func TestDistancesWideMaskedGeneric(t *testing.T) {
+	t.Run("DistancesWideMaskedGenericEquivBits", func(t *testing.T) {
+		testDistancesWideMasked(t, distancesWideMaskedGeneric)
 	})
 }
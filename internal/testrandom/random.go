@@ -31,6 +31,30 @@ func WideData(dim int, size int) [][]uint64 {
 	return data
 }
 
+// ClusteredWideData returns `size` points around `clusters` random centers.
+// Each point is a random center with each bit flipped with probability 2^-`sparsity`.
+func ClusteredWideData(dim int, size int, clusters int, sparsity int) [][]uint64 {
+	centers := WideData(dim, clusters)
+	data := make([][]uint64, size)
+	for i := range data {
+		data[i] = Noisy(centers[Source.IntN(clusters)], sparsity)
+	}
+	return data
+}
+
+// Noisy returns a copy of `x` with each bit flipped with probability 2^-`sparsity`.
+func Noisy(x []uint64, sparsity int) []uint64 {
+	out := make([]uint64, len(x))
+	for j := range out {
+		noise := ^uint64(0)
+		for range sparsity {
+			noise &= Source.Uint64()
+		}
+		out[j] = x[j] ^ noise
+	}
+	return out
+}
+
 func Labels(size int) []int {
 	labels := make([]int, size)
 	for i := range labels {
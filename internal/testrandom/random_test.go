@@ -1,6 +1,7 @@
 package testrandom_test
 
 import (
+	"slices"
 	"testing"
 
 	"github.com/keilerkonzept/bitknn/internal/testrandom"
@@ -34,6 +35,23 @@ func TestWideData(t *testing.T) {
 	}
 }
 
+func TestClusteredWideData(t *testing.T) {
+	data := testrandom.ClusteredWideData(3, 123, 4, 3)
+	if len(data) != 123 {
+		t.Fatal()
+	}
+	if len(data[0]) != 3 {
+		t.Fatal()
+	}
+}
+
+func TestNoisy(t *testing.T) {
+	x := testrandom.WideQuery(3)
+	if y := testrandom.Noisy(x, 64); !slices.Equal(x, y) {
+		t.Fatal(x, y)
+	}
+}
+
 func TestLabels(t *testing.T) {
 	data := testrandom.Labels(123)
 	if len(data) != 123 {
@@ -0,0 +1,216 @@
+package topk
+
+import (
+	"slices"
+	"sync"
+
+	"github.com/keilerkonzept/bitknn/internal/slice"
+)
+
+// Ties determines which of several candidates at the k-th smallest distance are selected.
+type Ties int
+
+const (
+	// Select the candidates pushed first (with the lowest indices).
+	TiesFirst Ties = iota
+	// Select the candidates pushed last (with the highest indices).
+	TiesLast
+	// Select the candidates with the smallest pseudo-random keys, derived from their indices and a seed.
+	TiesKeyed
+	// Select all candidates at the k-th smallest distance, possibly more than k in total.
+	TiesAll
+)
+
+// Counting selects the k smallest (distance, index) pairs from a stream of pairs with bounded integer distances.
+// Instead of a heap, it keeps a count of the candidates at each distance, and a threshold distance
+// that shrinks as soon as enough candidates below it have been seen.
+// Candidates are buffered in the order they are pushed, and the buffer is compacted when it fills up.
+type Counting struct {
+	counts    []int
+	distances []int
+	indices   []int
+	keys      []uint64
+
+	k         int
+	threshold int
+	total     int
+	ties      Ties
+	seed      uint64 // Mixed seed for [TiesKeyed]
+	offset    int
+}
+
+var pool = sync.Pool{New: func() any { return new(Counting) }}
+
+// Get returns a [Counting] selector from a pool, reset for the given k and maximum distance.
+func Get(k, maxDistance int) *Counting {
+	me := pool.Get().(*Counting)
+	me.Reset(k, maxDistance)
+	return me
+}
+
+// Put returns a [Counting] selector to the pool.
+func Put(me *Counting) {
+	pool.Put(me)
+}
+
+// Reset prepares the selector for a new stream of distances in [0, maxDistance], reusing its buffers.
+// The number of pairs to select, k, must be positive.
+// Ties are broken by [TiesFirst], and indices are not offset.
+func (me *Counting) Reset(k, maxDistance int) {
+	me.counts = slice.OrAlloc(me.counts, maxDistance+1)
+	clear(me.counts)
+	n := max(2*k, 64)
+	if cap(me.distances) < n {
+		me.distances = make([]int, 0, n)
+		me.indices = make([]int, 0, n)
+	}
+	me.distances = me.distances[:0]
+	me.indices = me.indices[:0]
+	me.k = k
+	me.threshold = maxDistance
+	me.total = 0
+	me.ties = TiesFirst
+	me.seed = 0
+	me.offset = 0
+}
+
+// SetTies sets the tie-breaking policy, and the seed for [TiesKeyed]. Must be called before the first [Counting.Push].
+func (me *Counting) SetTies(ties Ties, seed uint64) {
+	me.ties = ties
+	me.seed = mix(seed)
+}
+
+// SetOffset sets an offset that is added to the indices of all subsequently pushed pairs.
+// Pairs must still be pushed in increasing order of their offset indices.
+func (me *Counting) SetOffset(offset int) {
+	me.offset = offset
+}
+
+// Threshold returns the current threshold distance. Pairs with larger distances can be skipped without calling [Counting.Push].
+func (me *Counting) Threshold() int {
+	return me.threshold
+}
+
+// Push adds a candidate pair. Candidates must be pushed in increasing index order, with distances <= [Counting.Threshold].
+func (me *Counting) Push(dist, index int) {
+	if dist == me.threshold && me.total >= me.k && me.ties == TiesFirst { // Later ties can never be selected
+		return
+	}
+	if len(me.distances) == cap(me.distances) {
+		me.compact()
+	}
+	me.distances = append(me.distances, dist)
+	me.indices = append(me.indices, index+me.offset)
+	me.counts[dist]++
+	me.total++
+	for me.total-me.counts[me.threshold] >= me.k {
+		me.total -= me.counts[me.threshold]
+		me.counts[me.threshold] = 0
+		me.threshold--
+	}
+}
+
+// compact removes the buffered candidates that can no longer be selected:
+// those beyond the threshold, and those at the threshold that lose the tie-break to others.
+// Grows the buffer if it is still more than half full afterwards.
+func (me *Counting) compact() {
+	t := me.threshold
+	keep := me.counts[t]
+	if me.ties != TiesAll {
+		keep = min(keep, me.k-(me.total-me.counts[t]))
+	}
+	me.distances, me.indices = me.filter(t, keep, me.distances[:0], me.indices[:0])
+	me.total -= me.counts[t] - keep
+	me.counts[t] = keep
+	if n := len(me.distances); 2*n > cap(me.distances) {
+		me.distances = append(make([]int, 0, 2*cap(me.distances)), me.distances...)
+		me.indices = append(make([]int, 0, 2*cap(me.indices)), me.indices...)
+	}
+}
+
+// filter appends the buffered candidates closer than `t`, and `keep` of those at distance `t`
+// chosen according to the tie-breaking policy, to the given slices, in the order they were pushed.
+// The given slices may share the buffer's backing arrays, since candidates are never written ahead of where they are read.
+func (me *Counting) filter(t, keep int, distances, indices []int) ([]int, []int) {
+	skip := 0
+	var cutoff uint64
+	switch me.ties {
+	case TiesLast:
+		skip = me.counts[t] - keep
+	case TiesKeyed:
+		cutoff = me.keyCutoff(t, keep)
+	}
+	for i, dist := range me.distances {
+		if dist > t {
+			continue
+		}
+		index := me.indices[i]
+		if dist == t {
+			if keep == 0 {
+				continue
+			}
+			switch me.ties {
+			case TiesFirst:
+				keep--
+			case TiesLast:
+				if skip > 0 {
+					skip--
+					continue
+				}
+			case TiesKeyed:
+				if me.key(index) > cutoff {
+					continue
+				}
+			}
+		}
+		distances = append(distances, dist)
+		indices = append(indices, index)
+	}
+	return distances, indices
+}
+
+// keyCutoff returns the `keep`-th smallest key of the buffered candidates at distance `t`.
+func (me *Counting) keyCutoff(t, keep int) uint64 {
+	if keep == 0 {
+		return 0
+	}
+	me.keys = me.keys[:0]
+	for i, dist := range me.distances {
+		if dist == t {
+			me.keys = append(me.keys, me.key(me.indices[i]))
+		}
+	}
+	slices.Sort(me.keys)
+	return me.keys[keep-1]
+}
+
+// key is [Key] for the selector's seed.
+func (me *Counting) key(index int) uint64 {
+	return mix(uint64(index) ^ me.seed)
+}
+
+// Key returns the pseudo-random key of the given index used by [TiesKeyed]. Distinct indices have distinct keys.
+func Key(seed uint64, index int) uint64 {
+	return mix(uint64(index) ^ mix(seed))
+}
+
+// mix is a bijective 64-bit mixing function (the finalizer of SplitMix64).
+func mix(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// Append appends the selected pairs to the given slices, in the order they were pushed.
+// Appends min(k, number of pairs pushed) pairs, or more with [TiesAll].
+func (me *Counting) Append(distances, indices []int) ([]int, []int) {
+	t := me.threshold
+	keep := me.counts[t]
+	if me.ties != TiesAll {
+		keep = min(me.k, me.total) - (me.total - me.counts[t])
+	}
+	return me.filter(t, keep, distances, indices)
+}
@@ -0,0 +1,111 @@
+package topk_test
+
+import (
+	"cmp"
+	"slices"
+	"testing"
+
+	gocmp "github.com/google/go-cmp/cmp"
+	"github.com/keilerkonzept/bitknn/internal/topk"
+	"pgregory.net/rapid"
+)
+
+type pair struct{ Distance, Index int }
+
+var allTies = []topk.Ties{topk.TiesFirst, topk.TiesLast, topk.TiesKeyed, topk.TiesAll}
+
+// checkCounting checks that [topk.Counting] selects the k smallest (distance, index) pairs with the given tie-breaking, in index order.
+func checkCounting(t interface{ Fatal(...any) }, k, maxDistance int, distances []int, ties topk.Ties, seed uint64) {
+	const offset = 1000
+	c := topk.Get(k, maxDistance)
+	defer topk.Put(c)
+	c.SetTies(ties, seed)
+	c.SetOffset(offset)
+	for i, dist := range distances {
+		if dist > c.Threshold() {
+			continue
+		}
+		c.Push(dist, i)
+	}
+	d, ix := c.Append(nil, nil)
+
+	// Oracle: sort by distance, break ties by the policy's order, take the first k (and any further ties for [topk.TiesAll]).
+	tieOrder := func(a, b pair) int {
+		switch ties {
+		case topk.TiesLast:
+			return cmp.Compare(b.Index, a.Index)
+		case topk.TiesKeyed:
+			return cmp.Compare(topk.Key(seed, a.Index), topk.Key(seed, b.Index))
+		}
+		return cmp.Compare(a.Index, b.Index)
+	}
+	expected := make([]pair, len(distances))
+	for i, dist := range distances {
+		expected[i] = pair{dist, offset + i}
+	}
+	slices.SortFunc(expected, func(a, b pair) int {
+		return cmp.Or(cmp.Compare(a.Distance, b.Distance), tieOrder(a, b))
+	})
+	n := min(k, len(expected))
+	if ties == topk.TiesAll {
+		for n > 0 && n < len(expected) && expected[n].Distance == expected[n-1].Distance {
+			n++
+		}
+	}
+	expected = expected[:n]
+	slices.SortFunc(expected, func(a, b pair) int { return cmp.Compare(a.Index, b.Index) })
+
+	actual := make([]pair, len(d))
+	for i := range actual {
+		actual[i] = pair{d[i], ix[i]}
+	}
+	if diff := gocmp.Diff(expected, actual); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func TestCounting_Oracle(t *testing.T) {
+	rapid.Check(t, func(t *rapid.T) {
+		maxDistance := rapid.IntRange(0, 200).Draw(t, "maxDistance")
+		k := rapid.IntRange(1, 100).Draw(t, "k")
+		distances := rapid.SliceOf(rapid.IntRange(0, maxDistance)).Draw(t, "distances")
+		ties := rapid.SampledFrom(allTies).Draw(t, "ties")
+		seed := rapid.Uint64().Draw(t, "seed")
+		checkCounting(t, k, maxDistance, distances, ties, seed)
+	})
+}
+
+func TestCounting_Compact(t *testing.T) {
+	// Decreasing distances with repeats make most pairs candidates at some point, filling the candidate buffer.
+	for _, k := range []int{1, 3, 10, 50, 100} {
+		for _, repeats := range []int{1, 2, 7} {
+			const maxDistance = 500
+			var distances []int
+			for dist := maxDistance; dist >= 0; dist-- {
+				for range repeats {
+					distances = append(distances, dist)
+				}
+			}
+			distances = append(distances, distances...)
+			for _, ties := range allTies {
+				checkCounting(t, k, maxDistance, distances, ties, 42)
+			}
+		}
+	}
+}
+
+func TestCounting_Reuse(t *testing.T) {
+	c := topk.Get(2, 10)
+	for i, dist := range []int{5, 3, 3, 1} {
+		if dist <= c.Threshold() {
+			c.Push(dist, i)
+		}
+	}
+	c.Reset(1, 3)
+	c.Push(2, 0)
+	c.Push(2, 1)
+	if d, ix := c.Append(nil, nil); len(d) != 1 || d[0] != 2 || ix[0] != 0 {
+		t.Fatal(d, ix)
+	}
+	topk.Put(c)
+}
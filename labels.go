@@ -0,0 +1,227 @@
+package bitknn
+
+// LabelEncoding is a dense encoding of class labels of any comparable type L as the ints 0, ..., n-1 used by [Model.Labels].
+type LabelEncoding[L comparable] struct {
+	// The label of each code.
+	Labels []L
+
+	codes map[L]int
+}
+
+// EncodeLabels returns a dense encoding of the given labels, numbered in order of first appearance, and the code of each label.
+func EncodeLabels[L comparable](labels []L) (*LabelEncoding[L], []int) {
+	me := &LabelEncoding[L]{codes: make(map[L]int)}
+	codes := make([]int, len(labels))
+	for i, label := range labels {
+		code, ok := me.codes[label]
+		if !ok {
+			code = len(me.Labels)
+			me.codes[label] = code
+			me.Labels = append(me.Labels, label)
+		}
+		codes[i] = code
+	}
+	return me, codes
+}
+
+// Len returns the number of distinct labels.
+func (me *LabelEncoding[L]) Len() int {
+	return len(me.Labels)
+}
+
+// Encode returns the code of the given label, and whether the label is known.
+func (me *LabelEncoding[L]) Encode(label L) (int, bool) {
+	code, ok := me.codes[label]
+	return code, ok
+}
+
+// Decode returns the label with the given code.
+func (me *LabelEncoding[L]) Decode(code int) L {
+	return me.Labels[code]
+}
+
+// NewVoteSlice returns a dense vote counter for the encoded labels.
+func (me *LabelEncoding[L]) NewVoteSlice() LabelVoteSlice[L] {
+	return LabelVoteSlice[L]{
+		Encoding: me,
+		Votes:    make(VoteSlice, me.Len()),
+	}
+}
+
+// NewVoteMap returns a sparse vote counter for the encoded labels.
+func (me *LabelEncoding[L]) NewVoteMap() LabelVoteMap[L] {
+	return LabelVoteMap[L]{
+		Encoding: me,
+		Votes:    make(VoteMap),
+	}
+}
+
+// votes returns a [VoteCounter] for the label codes that counts the votes in the given label vote counter.
+func (me *LabelEncoding[L]) votes(votes LabelVoteCounter[L]) VoteCounter {
+	switch votes := votes.(type) {
+	case LabelVoteSlice[L]:
+		if votes.Encoding == me {
+			return votes.Votes
+		}
+	case LabelVoteMap[L]:
+		if votes.Encoding == me {
+			return votes.Votes
+		}
+	}
+	return decodedVotes[L]{me, votes}
+}
+
+// LabelVoteCounter is [VoteCounter] for labels of type L.
+type LabelVoteCounter[L comparable] interface {
+	// Clear removes all votes.
+	Clear()
+
+	// ArgMax returns the label with the highest vote count.
+	// Ties are broken in favor of the label with the lowest code (see [EncodeLabels]).
+	// If there are no votes, it returns the zero value of L.
+	ArgMax() L
+
+	// Max returns the highest vote count.
+	Max() float64
+
+	// Get returns the vote count for the given label.
+	Get(label L) float64
+
+	// Add adds the specified delta to the vote count for the given label.
+	Add(label L, delta float64)
+}
+
+// LabelVoteSlice is a dense vote counter for labels of type L that stores votes in a [VoteSlice], indexed by the labels' codes.
+// It is efficient for small sets of class labels. Votes for labels not in the encoding are ignored.
+type LabelVoteSlice[L comparable] struct {
+	Encoding *LabelEncoding[L]
+	Votes    VoteSlice
+}
+
+// Clear resets all the votes to zero.
+func (me LabelVoteSlice[L]) Clear() {
+	me.Votes.Clear()
+}
+
+// ArgMax returns the label with the highest vote count, and of several, the one with the lowest code.
+// If there are no votes, it returns the zero value of L.
+func (me LabelVoteSlice[L]) ArgMax() L {
+	if len(me.Votes) == 0 {
+		var zero L
+		return zero
+	}
+	return me.Encoding.Decode(argMaxLowest(me.Votes))
+}
+
+// Max returns the highest vote count.
+// If there are no labels, it returns 0.
+func (me LabelVoteSlice[L]) Max() float64 {
+	if len(me.Votes) == 0 {
+		return 0
+	}
+	return me.Votes.Max()
+}
+
+// Get retrieves the vote count for the given label.
+func (me LabelVoteSlice[L]) Get(label L) float64 {
+	code, ok := me.Encoding.Encode(label)
+	if !ok {
+		return 0
+	}
+	return me.Votes.Get(code)
+}
+
+// Add adds the specified delta to the vote count for the given label.
+func (me LabelVoteSlice[L]) Add(label L, delta float64) {
+	if code, ok := me.Encoding.Encode(label); ok {
+		me.Votes.Add(code, delta)
+	}
+}
+
+// LabelVoteMap is a sparse vote counter for labels of type L that stores votes in a [VoteMap], keyed by the labels' codes.
+// Good for large sets of class labels. Votes for labels not in the encoding are ignored.
+type LabelVoteMap[L comparable] struct {
+	Encoding *LabelEncoding[L]
+	Votes    VoteMap
+}
+
+// Clear resets all the votes in the map.
+func (me LabelVoteMap[L]) Clear() {
+	me.Votes.Clear()
+}
+
+// ArgMax returns the label with the highest vote count, and of several, the one with the lowest code.
+// If there are no votes, it returns the zero value of L.
+func (me LabelVoteMap[L]) ArgMax() L {
+	if len(me.Votes) == 0 {
+		var zero L
+		return zero
+	}
+	var out struct {
+		code  int
+		value float64
+		any   bool
+	}
+	for code, x := range me.Votes {
+		if !out.any || x > out.value || (x == out.value && code < out.code) {
+			out.code = code
+			out.value = x
+			out.any = true
+		}
+	}
+	return me.Encoding.Decode(out.code)
+}
+
+// Max returns the highest vote count in the map.
+func (me LabelVoteMap[L]) Max() float64 {
+	return me.Votes.Max()
+}
+
+// Add adds the specified delta to the vote count for the given label.
+func (me LabelVoteMap[L]) Add(label L, delta float64) {
+	if code, ok := me.Encoding.Encode(label); ok {
+		me.Votes.Add(code, delta)
+	}
+}
+
+// Get retrieves the vote count for the given label.
+func (me LabelVoteMap[L]) Get(label L) float64 {
+	code, ok := me.Encoding.Encode(label)
+	if !ok {
+		return 0
+	}
+	return me.Votes.Get(code)
+}
+
+// argMaxLowest is [VoteSlice.ArgMax], but breaks ties in favor of the lowest label.
+func argMaxLowest(votes VoteSlice) int {
+	out := 0
+	for i, x := range votes {
+		if x > votes[out] {
+			out = i
+		}
+	}
+	return out
+}
+
+// decodedVotes is a [VoteCounter] for label codes that counts the votes for the decoded labels.
+type decodedVotes[L comparable] struct {
+	encoding *LabelEncoding[L]
+	votes    LabelVoteCounter[L]
+}
+
+func (me decodedVotes[L]) Clear()       { me.votes.Clear() }
+func (me decodedVotes[L]) Max() float64 { return me.votes.Max() }
+
+func (me decodedVotes[L]) ArgMax() int {
+	code, _ := me.encoding.Encode(me.votes.ArgMax())
+	return code
+}
+
+func (me decodedVotes[L]) Get(label int) float64 {
+	return me.votes.Get(me.encoding.Decode(label))
+}
+
+func (me decodedVotes[L]) Add(label int, delta float64) {
+	me.votes.Add(me.encoding.Decode(label), delta)
+}
@@ -0,0 +1,98 @@
+package bitknn
+
+import (
+	"maps"
+	"slices"
+	"sync"
+)
+
+// Metric is a similarity coefficient of two binary data points computed from their [Contingency] counts, where higher is more similar,
+// such as the built-in [Similarity] coefficients. Custom metrics can be registered by name with [RegisterMetric].
+//
+// The similarity search functions like [NearestSimilar] skip data points by the largest similarity possible with their number of bits set,
+// the coefficient of the counts with as many bits set in both points as possible. They are exact for metrics that don't decrease
+// as more bits are set in both points while the numbers of bits set in each point stay the same, which holds for all the built-in ones.
+type Metric interface {
+	Coefficient(c Contingency) float64
+}
+
+// MetricFunc is a [Metric] given by a function of the contingency counts.
+type MetricFunc func(c Contingency) float64
+
+// Coefficient returns `f(c)`.
+func (f MetricFunc) Coefficient(c Contingency) float64 {
+	return f(c)
+}
+
+// Contingency holds the counts of bits of two data points `x` and `y`, from which a [Metric] computes their similarity.
+type Contingency struct {
+	// Number of bits set in both points, `popcount(x & y)`.
+	And int
+	// Number of bits set in either point, `popcount(x | y)`.
+	Or int
+	// Number of bits set in `x`, `popcount(x)`.
+	OnesA int
+	// Number of bits set in `y`, `popcount(y)`.
+	OnesB int
+	// Total number of bits of a data point, e.g. 64 for a [Model].
+	Bits int
+}
+
+// newContingency returns the contingency counts of two data points with `onesA` and `onesB` bits set, `and` of them in both, and `bits` bits in total.
+func newContingency(and, onesA, onesB, bits int) Contingency {
+	return Contingency{And: and, Or: onesA + onesB - and, OnesA: onesA, OnesB: onesB, Bits: bits}
+}
+
+// Mismatches returns the number of bits set in only one of the points, their Hamming distance `popcount(x ^ y)`.
+func (me Contingency) Mismatches() int {
+	return me.Or - me.And
+}
+
+// Neither returns the number of bits set in neither point.
+func (me Contingency) Neither() int {
+	return me.Bits - me.Or
+}
+
+// metricBound returns the largest possible similarity by `metric` of two data points with `onesA` and `onesB` bits set,
+// which have at most the smaller number of bits in common.
+// Uses the same arithmetic as the similarities themselves, so that no similarity exceeds it.
+func metricBound(metric Metric, onesA, onesB, bits int) float64 {
+	return metric.Coefficient(newContingency(min(onesA, onesB), onesA, onesB, bits))
+}
+
+var (
+	metricsMu sync.RWMutex
+	metrics   = make(map[string]Metric)
+)
+
+func init() {
+	for _, s := range builtinSimilarities {
+		metrics[s.String()] = s
+	}
+}
+
+// RegisterMetric registers the given metric under the given name, replacing any metric registered under the same name.
+// The built-in [Similarity] coefficients are registered under their names, e.g. "tanimoto" and "rogers-tanimoto".
+// Safe for concurrent use.
+func RegisterMetric(name string, metric Metric) {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	metrics[name] = metric
+}
+
+// LookupMetric returns the metric registered under the given name, and whether there is one (see [RegisterMetric]).
+// Safe for concurrent use.
+func LookupMetric(name string) (Metric, bool) {
+	metricsMu.RLock()
+	defer metricsMu.RUnlock()
+	metric, ok := metrics[name]
+	return metric, ok
+}
+
+// MetricNames returns the names of all registered metrics, in ascending order.
+// Safe for concurrent use.
+func MetricNames() []string {
+	metricsMu.RLock()
+	defer metricsMu.RUnlock()
+	return slices.Sorted(maps.Keys(metrics))
+}
@@ -0,0 +1,92 @@
+package bitknn_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/keilerkonzept/bitknn"
+	"github.com/keilerkonzept/bitknn/internal/testrandom"
+	"pgregory.net/rapid"
+)
+
+// matches is a custom metric, the number of equal bits.
+var matches = bitknn.MetricFunc(func(c bitknn.Contingency) float64 {
+	return float64(c.Bits - c.Mismatches())
+})
+
+func TestContingency(t *testing.T) {
+	c := bitknn.Contingency{And: 2, Or: 7, OnesA: 4, OnesB: 5, Bits: 64}
+	if c.Mismatches() != 5 || c.Neither() != 57 {
+		t.Errorf("%+v: %d mismatches, %d in neither", c, c.Mismatches(), c.Neither())
+	}
+}
+
+func TestRegisterMetric(t *testing.T) {
+	for _, similarity := range similarities {
+		metric, ok := bitknn.LookupMetric(similarity.String())
+		if !ok || metric != bitknn.Metric(similarity) {
+			t.Errorf("metric %q: %v, %v", similarity, metric, ok)
+		}
+	}
+	if _, ok := bitknn.LookupMetric("matches"); ok {
+		t.Fatal("unregistered metric found")
+	}
+	bitknn.RegisterMetric("matches", matches)
+	metric, ok := bitknn.LookupMetric("matches")
+	if !ok || metric.Coefficient(bitknn.Contingency{And: 1, Or: 3, OnesA: 2, OnesB: 2, Bits: 64}) != 62 {
+		t.Fatalf("metric %q: %v, %v", "matches", metric, ok)
+	}
+	if names := bitknn.MetricNames(); !slices.IsSorted(names) || !slices.Contains(names, "matches") || !slices.Contains(names, "cosine") {
+		t.Error(names)
+	}
+}
+
+func TestModel_Metric(t *testing.T) {
+	rapid.Check(t, func(t *rapid.T) {
+		k := rapid.IntRange(1, 20).Draw(t, "k")
+		size := rapid.SampledFrom([]int{0, 1, 10, 300, 3000}).Draw(t, "size")
+		dims := rapid.IntRange(1, 3).Draw(t, "dims")
+		data := sparseWideData(t, dims, size)
+		labels := testrandom.Labels(size)
+		x := testrandom.WideQuery(dims)
+		opts := []bitknn.Option{
+			bitknn.WithMetric(matches),
+			bitknn.WithWorkers(rapid.IntRange(1, 4).Draw(t, "workers")),
+			bitknn.WithSorted(),
+		}
+		model := bitknn.FitWide(data, labels, opts...)
+
+		// The number of equal bits ranks the neighbors by ascending Hamming distance.
+		distances, indices := make([]int, k+1), make([]int, k+1)
+		n := bitknn.NearestWide(data, k, x, distances, indices)
+		expectedIndices := indices[:n]
+		bitknn.SortNeighbors(distances[:n], expectedIndices)
+		expectedSimilarities := make([]float64, n)
+		for i, dist := range distances[:n] {
+			expectedSimilarities[i] = float64(64*dims - dist)
+		}
+
+		finds := map[string]func() ([]float64, []int){
+			"WideModel.FindSimilar": func() ([]float64, []int) { return model.FindSimilar(k, x) },
+		}
+		if dims == 1 {
+			narrowData := make([]uint64, size)
+			for i, d := range data {
+				narrowData[i] = d[0]
+			}
+			narrow := bitknn.Fit(narrowData, labels, opts...)
+			finds["Model.FindSimilar"] = func() ([]float64, []int) { return narrow.FindSimilar(k, x[0]) }
+		}
+		for name, find := range finds {
+			actualSimilarities, actualIndices := find()
+			if diff := cmp.Diff(expectedSimilarities, actualSimilarities, cmpopts.EquateEmpty()); diff != "" {
+				t.Fatal(name, diff)
+			}
+			if diff := cmp.Diff(expectedIndices, actualIndices, cmpopts.EquateEmpty()); diff != "" {
+				t.Fatal(name, diff)
+			}
+		}
+	})
+}
@@ -0,0 +1,104 @@
+package bitknn
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+)
+
+// A [Model] opened from a file written by [Model.WriteTo].
+//
+// On 64-bit little-endian Linux, the file is memory-mapped read-only, and the model's data, labels and values
+// point directly into the mapping: opening takes constant time, pages are only read when accessed,
+// and are shared between processes mapping the same file. With the [WithSimilarity] or [WithMetric] option, however,
+// opening takes linear time to count the bits of the data points (see [Model.OnesCounts]).
+// The slices must not be modified, and the model must not be used after [MappedModel.Close].
+// On other platforms, the file is read into memory instead.
+type MappedModel struct {
+	Narrow *Model
+
+	mapping []byte
+}
+
+// A [WideModel] opened from a file written by [WideModel.WriteTo]. See [MappedModel].
+// The data points are sub-slices of a flat backing slice, like those produced by [pack.ReallocateFlat].
+// Unlike a [MappedModel], opening takes time linear in the number of data points: it allocates their slice headers,
+// and with the [WithSimilarity] or [WithMetric] option, counts their bits (see [Model.OnesCounts]).
+// To open a wide model in constant time, use [OpenFlatWideModel].
+//
+// [pack.ReallocateFlat]: https://pkg.go.dev/github.com/keilerkonzept/bitknn/pack#ReallocateFlat
+type MappedWideModel struct {
+	Wide *WideModel
+
+	// Flat backing slice of the data points.
+	Flat []uint64
+
+	mapping []byte
+}
+
+// A [FlatWideModel] opened from a file written by [WideModel.WriteTo]. See [MappedModel].
+// The model views the mapped data points by their stride, so that opening takes constant time, as for a [MappedModel].
+type MappedFlatWideModel struct {
+	Flat *FlatWideModel
+
+	mapping []byte
+}
+
+// Close stops the model's worker goroutines (see [Model.Close]) and releases the memory mapping.
+func (me *MappedModel) Close() error {
+	me.Narrow.Close()
+	return unmap(&me.mapping)
+}
+
+// Verify reads the whole mapped file and checks its checksum, returning [ErrChecksumMismatch] if it doesn't match.
+// Since opening a mapped model doesn't read the data, corruption is otherwise not detected.
+func (me *MappedModel) Verify() error {
+	return verifyMapping(me.mapping)
+}
+
+// Close stops the model's worker goroutines (see [WideModel.Close]) and releases the memory mapping.
+func (me *MappedWideModel) Close() error {
+	me.Wide.Close()
+	return unmap(&me.mapping)
+}
+
+// Verify reads the whole mapped file and checks its checksum, returning [ErrChecksumMismatch] if it doesn't match.
+// Since opening a mapped model doesn't read the data, corruption is otherwise not detected.
+func (me *MappedWideModel) Verify() error {
+	return verifyMapping(me.mapping)
+}
+
+// Close stops the model's worker goroutines (see [FlatWideModel.Close]) and releases the memory mapping.
+func (me *MappedFlatWideModel) Close() error {
+	me.Flat.Close()
+	return unmap(&me.mapping)
+}
+
+// Verify reads the whole mapped file and checks its checksum, returning [ErrChecksumMismatch] if it doesn't match.
+// Since opening a mapped model doesn't read the data, corruption is otherwise not detected.
+func (me *MappedFlatWideModel) Verify() error {
+	return verifyMapping(me.mapping)
+}
+
+// verifyMapping checks the checksum of a mapped file.
+// Models that were read into memory have already been verified, and have no mapping.
+func verifyMapping(mapping []byte) error {
+	if len(mapping) == 0 {
+		return nil
+	}
+	n := len(mapping) - 4
+	if crc32.Checksum(mapping[:n], castagnoli) != binary.LittleEndian.Uint32(mapping[n:]) {
+		return ErrChecksumMismatch
+	}
+	return nil
+}
+
+// FlatWide returns a [FlatWideModel] using the mapped data.
+// Panics if the model's options are not supported by a [FlatWideModel], like [FitFlatWide].
+func (me *MappedWideModel) FlatWide() *FlatWideModel {
+	stride := 0
+	if len(me.Wide.WideData) > 0 {
+		stride = len(me.Wide.WideData[0])
+	}
+	checkFlatWide(me.Wide.Narrow)
+	return &FlatWideModel{Narrow: me.Wide.Narrow, FlatData: me.Flat, Stride: stride}
+}
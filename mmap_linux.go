@@ -0,0 +1,159 @@
+//go:build linux && (amd64 || arm64 || loong64 || mips64le || ppc64le || riscv64)
+
+package bitknn
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// OpenModel memory-maps a model file written by [Model.WriteTo], and applies the given options to the model.
+// The checksum is not verified; use [MappedModel.Verify] for that.
+// If the model uses [DistanceWeightingCustom] and no [WithDistanceWeightingFunc] option is given,
+// the model is returned along with [ErrMissingDistanceWeightingFunc], and must still be closed.
+// Panics if the options set bit weights of more than 64 bits, like [Fit].
+func OpenModel(path string, opts ...Option) (*MappedModel, error) {
+	mapping, h, err := mapModelFile(path, encodingKindModel)
+	if err != nil {
+		return nil, err
+	}
+	m := &MappedModel{Narrow: &Model{DistanceWeighting: h.Weighting}, mapping: mapping}
+	offset := encodingHeaderSize
+	m.Narrow.Data = mappedSlice[uint64](mapping, &offset, h.N)
+	m.Narrow.Labels = mappedSlice[int](mapping, &offset, h.NLabels)
+	m.Narrow.Values = mappedSlice[float64](mapping, &offset, h.NValues)
+	err = applyDecodedOptions(m.Narrow, opts)
+	if m.Narrow.wideWeights() {
+		m.Close()
+		m.Narrow.checkWeights()
+	}
+	if m.Narrow.countOnes {
+		m.Narrow.CountOnes()
+	}
+	return m, err
+}
+
+// OpenWideModel memory-maps a model file written by [WideModel.WriteTo], and applies the given options to the model.
+// The checksum is not verified; use [MappedWideModel.Verify] for that.
+// If the model uses [DistanceWeightingCustom] and no [WithDistanceWeightingFunc] option is given,
+// the model is returned along with [ErrMissingDistanceWeightingFunc], and must still be closed.
+func OpenWideModel(path string, opts ...Option) (*MappedWideModel, error) {
+	mapping, h, err := mapModelFile(path, encodingKindWideModel)
+	if err != nil {
+		return nil, err
+	}
+	m := &MappedWideModel{Wide: &WideModel{Narrow: &Model{DistanceWeighting: h.Weighting}}, mapping: mapping}
+	offset := encodingHeaderSize
+	m.Flat = mappedSlice[uint64](mapping, &offset, h.N*h.Dims)
+	m.Wide.WideData = make([][]uint64, h.N)
+	for i := range m.Wide.WideData {
+		m.Wide.WideData[i] = m.Flat[uint64(i)*h.Dims : uint64(i+1)*h.Dims : uint64(i+1)*h.Dims]
+	}
+	m.Wide.Narrow.Labels = mappedSlice[int](mapping, &offset, h.NLabels)
+	m.Wide.Narrow.Values = mappedSlice[float64](mapping, &offset, h.NValues)
+	err = applyDecodedOptions(m.Wide.Narrow, opts)
+	if m.Wide.Narrow.countOnes {
+		m.Wide.CountOnes()
+	}
+	return m, err
+}
+
+// OpenFlatWideModel memory-maps a model file written by [WideModel.WriteTo] as a [FlatWideModel],
+// and applies the given options to the model. Unlike [OpenWideModel], it takes constant time.
+// The checksum is not verified; use [MappedFlatWideModel.Verify] for that.
+// If the model uses [DistanceWeightingCustom] and no [WithDistanceWeightingFunc] option is given,
+// the model is returned along with [ErrMissingDistanceWeightingFunc], and must still be closed.
+// Panics if the options set bit weights or data masks, like [FitFlatWide].
+func OpenFlatWideModel(path string, opts ...Option) (*MappedFlatWideModel, error) {
+	mapping, h, err := mapModelFile(path, encodingKindWideModel)
+	if err != nil {
+		return nil, err
+	}
+	m := &MappedFlatWideModel{Flat: &FlatWideModel{Narrow: &Model{DistanceWeighting: h.Weighting}, Stride: int(h.Dims)}, mapping: mapping}
+	offset := encodingHeaderSize
+	m.Flat.FlatData = mappedSlice[uint64](mapping, &offset, h.N*h.Dims)
+	m.Flat.Narrow.Labels = mappedSlice[int](mapping, &offset, h.NLabels)
+	m.Flat.Narrow.Values = mappedSlice[float64](mapping, &offset, h.NValues)
+	err = applyDecodedOptions(m.Flat.Narrow, opts)
+	if !supportsFlatWide(m.Flat.Narrow) {
+		m.Close()
+		checkFlatWide(m.Flat.Narrow)
+	}
+	return m, err
+}
+
+// mapModelFile maps the given file read-only, and checks that its size matches the sizes in its header.
+func mapModelFile(path string, kind uint8) ([]byte, encodingHeader, error) {
+	var h encodingHeader
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, h, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, h, err
+	}
+	size := info.Size()
+	if size < encodingHeaderSize+4 {
+		return nil, h, io.ErrUnexpectedEOF
+	}
+	mapping, err := unix.Mmap(int(f.Fd()), 0, int(size), unix.PROT_READ, unix.MAP_SHARED)
+	if err != nil {
+		return nil, h, &os.PathError{Op: "mmap", Path: path, Err: err}
+	}
+	d := newDecoder(bytes.NewReader(mapping))
+	h = d.header(kind)
+	if d.err == nil {
+		d.err = checkMappedSize(h, uint64(size))
+	}
+	if d.err != nil {
+		unix.Munmap(mapping)
+		return nil, h, d.err
+	}
+	return mapping, h, nil
+}
+
+// checkMappedSize checks that a file of the given size exactly contains the sections described by the header.
+func checkMappedSize(h encodingHeader, size uint64) error {
+	words := (size - encodingHeaderSize - 4) / 8
+	if h.Dims > 0 && h.N > words/h.Dims {
+		return io.ErrUnexpectedEOF
+	}
+	words -= h.N * h.Dims
+	if h.NLabels > words {
+		return io.ErrUnexpectedEOF
+	}
+	words -= h.NLabels
+	if h.NValues > words {
+		return io.ErrUnexpectedEOF
+	}
+	words -= h.NValues
+	if words != 0 || (size-encodingHeaderSize-4)%8 != 0 {
+		return ErrInvalidFormat
+	}
+	return nil
+}
+
+// mappedSlice views the n 8-byte values at the given offset in the mapping as a []T, and advances the offset.
+func mappedSlice[T uint64 | int | float64](mapping []byte, offset *int, n uint64) []T {
+	if n == 0 {
+		return nil
+	}
+	s := unsafe.Slice((*T)(unsafe.Pointer(&mapping[*offset])), n)
+	*offset += 8 * int(n)
+	return s
+}
+
+func unmap(mapping *[]byte) error {
+	if *mapping == nil {
+		return nil
+	}
+	err := unix.Munmap(*mapping)
+	*mapping = nil
+	return err
+}
@@ -0,0 +1,60 @@
+//go:build !linux || !(amd64 || arm64 || loong64 || mips64le || ppc64le || riscv64)
+
+package bitknn
+
+import (
+	"bufio"
+	"os"
+)
+
+// OpenModel reads a model file written by [Model.WriteTo], and applies the given options to the model.
+// Memory-mapping is only supported on 64-bit little-endian Linux; on this platform, the file is read into memory.
+// If the model uses [DistanceWeightingCustom] and no [WithDistanceWeightingFunc] option is given,
+// the model is returned along with [ErrMissingDistanceWeightingFunc].
+// Panics if the options set bit weights of more than 64 bits, like [Fit].
+func OpenModel(path string, opts ...Option) (*MappedModel, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	m, err := ReadModel(bufio.NewReader(f), opts...)
+	if m == nil {
+		return nil, err
+	}
+	return &MappedModel{Narrow: m}, err
+}
+
+// OpenWideModel reads a model file written by [WideModel.WriteTo], and applies the given options to the model.
+// Memory-mapping is only supported on 64-bit little-endian Linux; on this platform, the file is read into memory.
+// If the model uses [DistanceWeightingCustom] and no [WithDistanceWeightingFunc] option is given,
+// the model is returned along with [ErrMissingDistanceWeightingFunc].
+func OpenWideModel(path string, opts ...Option) (*MappedWideModel, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	m, flat, err := readWideModel(bufio.NewReader(f), opts)
+	if m == nil {
+		return nil, err
+	}
+	return &MappedWideModel{Wide: m, Flat: flat}, err
+}
+
+// OpenFlatWideModel reads a model file written by [WideModel.WriteTo] as a [FlatWideModel], and applies the given options to the model.
+// Memory-mapping is only supported on 64-bit little-endian Linux; on this platform, the file is read into memory.
+// If the model uses [DistanceWeightingCustom] and no [WithDistanceWeightingFunc] option is given,
+// the model is returned along with [ErrMissingDistanceWeightingFunc].
+// Panics if the options set bit weights or data masks, like [FitFlatWide].
+func OpenFlatWideModel(path string, opts ...Option) (*MappedFlatWideModel, error) {
+	m, err := OpenWideModel(path, opts...)
+	if m == nil {
+		return nil, err
+	}
+	return &MappedFlatWideModel{Flat: m.FlatWide()}, err
+}
+
+func unmap(*[]byte) error {
+	return nil
+}
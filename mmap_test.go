@@ -0,0 +1,212 @@
+package bitknn_test
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/keilerkonzept/bitknn"
+	"github.com/keilerkonzept/bitknn/pack"
+	"pgregory.net/rapid"
+)
+
+func writeModelFile(t interface{ Fatal(...any) }, dir string, model io.WriterTo) string {
+	path := filepath.Join(dir, "model.bin")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := model.WriteTo(f); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestOpenModel(t *testing.T) {
+	dir := t.TempDir()
+	rapid.Check(t, func(t *rapid.T) {
+		data := rapid.SliceOf(rapid.Uint64()).Draw(t, "data")
+		labels := rapid.SliceOfN(rapid.Int(), len(data), len(data)).Draw(t, "labels")
+		model := bitknn.Fit(data, labels, drawModelOptions(t, len(data))...)
+		path := writeModelFile(t, dir, model)
+
+		mapped, err := bitknn.OpenModel(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mapped.Close()
+		if err := mapped.Verify(); err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(model, mapped.Narrow, cmpopts.EquateEmpty(), cmpopts.EquateNaNs(), cmpopts.IgnoreUnexported(bitknn.Model{}, bitknn.WideModel{})); diff != "" {
+			t.Fatal(diff)
+		}
+		if len(data) > 0 {
+			q := rapid.Uint64().Draw(t, "q")
+			k := rapid.IntRange(1, len(data)).Draw(t, "k")
+			d, i := model.Find(k, q)
+			md, mi := mapped.Narrow.Find(k, q)
+			if diff := cmp.Diff([][]int{d, i}, [][]int{md, mi}); diff != "" {
+				t.Fatal(diff)
+			}
+		}
+	})
+}
+
+func TestOpenWideModel(t *testing.T) {
+	dir := t.TempDir()
+	rapid.Check(t, func(t *rapid.T) {
+		dims := rapid.IntRange(1, 8).Draw(t, "dims")
+		data := rapid.SliceOf(rapid.SliceOfN(rapid.Uint64(), dims, dims)).Draw(t, "data")
+		model := bitknn.FitWide(data, nil, drawModelOptions(t, len(data))...)
+		path := writeModelFile(t, dir, model)
+
+		mapped, err := bitknn.OpenWideModel(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mapped.Close()
+		if err := mapped.Verify(); err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(model, mapped.Wide, cmpopts.EquateEmpty(), cmpopts.EquateNaNs(), cmpopts.IgnoreUnexported(bitknn.Model{}, bitknn.WideModel{})); diff != "" {
+			t.Fatal(diff)
+		}
+		if len(mapped.Flat) != len(data)*dims {
+			t.Fatal("the flat backing slice should contain all data points", len(mapped.Flat))
+		}
+		for i, d := range mapped.Wide.WideData {
+			if &d[0] != &mapped.Flat[i*dims] {
+				t.Fatal("data points should be sub-slices of the flat backing slice")
+			}
+		}
+		if flat := mapped.FlatWide(); flat.Len() != len(data) {
+			t.Fatal("the flat model should contain all data points", flat.Len())
+		}
+	})
+}
+
+func TestOpenFlatWideModel(t *testing.T) {
+	dir := t.TempDir()
+	rapid.Check(t, func(t *rapid.T) {
+		dims := rapid.IntRange(1, 8).Draw(t, "dims")
+		data := rapid.SliceOfN(rapid.SliceOfN(rapid.Uint64(), dims, dims), 1, -1).Draw(t, "data")
+		labels := rapid.SliceOfN(rapid.Int(), len(data), len(data)).Draw(t, "labels")
+		opts := drawModelOptions(t, len(data))
+		model := bitknn.FitWide(data, labels, opts...)
+		path := writeModelFile(t, dir, model)
+
+		mapped, err := bitknn.OpenFlatWideModel(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mapped.Close()
+		if err := mapped.Verify(); err != nil {
+			t.Fatal(err)
+		}
+		expected := bitknn.FitFlatWide(pack.Flatten(data), dims, labels, opts...)
+		if diff := cmp.Diff(expected, mapped.Flat, cmpopts.EquateEmpty(), cmpopts.EquateNaNs(), cmpopts.IgnoreUnexported(bitknn.Model{}, bitknn.FlatWideModel{}), cmpopts.IgnoreFields(bitknn.Model{}, "OnesCounts")); diff != "" {
+			t.Fatal(diff)
+		}
+		x := rapid.SliceOfN(rapid.Uint64(), dims, dims).Draw(t, "x")
+		expectedVotes, actualVotes := make(bitknn.VoteMap), make(bitknn.VoteMap)
+		model.Predict(3, x, expectedVotes)
+		mapped.Flat.Predict(3, x, actualVotes)
+		if diff := cmp.Diff(expectedVotes, actualVotes, cmpopts.EquateNaNs()); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+}
+
+func TestOpenFlatWideModel_RejectsUnsupportedOptions(t *testing.T) {
+	path := writeModelFile(t, t.TempDir(), bitknn.FitWide([][]uint64{{0b0000}, {0b1111}}, nil))
+	for name, opt := range map[string]bitknn.Option{
+		"BitWeights":    bitknn.WithBitWeights(bitknn.ByteWeights([]int{1, 2, 3, 4, 5, 6, 7, 8})),
+		"WideDataMasks": bitknn.WithWideDataMasks([][]uint64{{1}, {1}}),
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatal("OpenFlatWideModel should panic with", name)
+				}
+			}()
+			bitknn.OpenFlatWideModel(path, opt)
+		}()
+	}
+}
+
+func TestOpenModel_Invalid(t *testing.T) {
+	dir := t.TempDir()
+	model := bitknn.Fit([]uint64{1, 2, 3}, []int{0, 1, 0})
+	path := writeModelFile(t, dir, model)
+	encoded, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("corrupted", func(t *testing.T) {
+		corrupted := filepath.Join(dir, "corrupted.bin")
+		b := append([]byte(nil), encoded...)
+		b[len(b)-8] ^= 1
+		if err := os.WriteFile(corrupted, b, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		mapped, err := bitknn.OpenModel(corrupted)
+		if err == nil {
+			err = mapped.Verify()
+			mapped.Close()
+		}
+		if !errors.Is(err, bitknn.ErrChecksumMismatch) {
+			t.Fatal(err)
+		}
+	})
+	t.Run("truncated", func(t *testing.T) {
+		truncated := filepath.Join(dir, "truncated.bin")
+		if err := os.WriteFile(truncated, encoded[:len(encoded)-12], 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := bitknn.OpenModel(truncated); !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Fatal(err)
+		}
+	})
+	t.Run("kind", func(t *testing.T) {
+		if _, err := bitknn.OpenWideModel(path); !errors.Is(err, bitknn.ErrInvalidFormat) {
+			t.Fatal(err)
+		}
+	})
+	t.Run("missing", func(t *testing.T) {
+		if _, err := bitknn.OpenModel(filepath.Join(dir, "missing.bin")); !errors.Is(err, os.ErrNotExist) {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestOpenModel_CustomDistanceWeighting(t *testing.T) {
+	f := func(dist int) float64 { return 1 / float64(1+dist) }
+	model := bitknn.Fit([]uint64{1, 2, 3}, []int{0, 1, 0}, bitknn.WithDistanceWeightingFunc(f))
+	path := writeModelFile(t, t.TempDir(), model)
+
+	mapped, err := bitknn.OpenModel(path)
+	if !errors.Is(err, bitknn.ErrMissingDistanceWeightingFunc) {
+		t.Fatal("opening a model with custom weighting should report the missing function", err)
+	}
+	mapped.Close()
+
+	mapped, err = bitknn.OpenModel(path, bitknn.WithDistanceWeightingFunc(f))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mapped.Close()
+	votes := make([]float64, 2)
+	mapped.Narrow.Predict(1, 1, bitknn.VoteSlice(votes))
+	if diff := cmp.Diff([]float64{1, 0}, votes); diff != "" {
+		t.Fatal(diff)
+	}
+}
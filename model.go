@@ -2,11 +2,40 @@
 package bitknn
 
 import (
+	"iter"
+	"math"
+	"math/bits"
+
 	"github.com/keilerkonzept/bitknn/internal/slice"
+	"github.com/keilerkonzept/bitknn/internal/topk"
 )
 
 // Create a k-NN model for the given data points and labels.
+// With the [WithSimilarity] or [WithMetric] option, counts the bits set in each data point (see [Model.OnesCounts]).
+// Panics if the options set bit weights of more than 64 bits.
 func Fit(data []uint64, labels []int, opts ...Option) *Model {
+	m := fit(data, labels, opts)
+	m.checkWeights()
+	if m.countOnes {
+		m.CountOnes()
+	}
+	return m
+}
+
+// checkWeights panics if the model's bit weights cover more than the 64 bits of a data point, which the searches would ignore.
+func (me *Model) checkWeights() {
+	if me.wideWeights() {
+		panic("bitknn: the bit weights of a Model must not cover more than 64 bits")
+	}
+}
+
+// wideWeights returns whether the model's bit weights cover more than 64 bits.
+func (me *Model) wideWeights() bool {
+	return (me.BitWeights != nil && me.BitWeights.Words() > 1) || (me.FloatBitWeights != nil && me.FloatBitWeights.Words() > 1)
+}
+
+// fit is [Fit], without counting the bits set in the data points, for the wide models.
+func fit(data []uint64, labels []int, opts []Option) *Model {
 	m := &Model{
 		Data:              data,
 		Labels:            labels,
@@ -24,16 +53,90 @@ type Model struct {
 	Data []uint64
 	// Class labels for each data point.
 	Labels []int
-	// Vote values for each data point.
+	// Vote values for each data point, and targets for the Regress methods, which require them.
 	Values []float64
+	// Validity masks for each data point, whose cleared bits are unknown features.
+	// If set, all searches only count the bits known for both the query and a data point (see [NearestDataMasked]),
+	// and neither [Model.Selection] nor the vectorized (V) methods apply.
+	// The masks are not saved with the model (see [Model.WriteTo]).
+	DataMasks []uint64
+	// Validity masks for each data point of a [WideModel], as [Model.DataMasks] (see [NearestWideDataMasked]).
+	// If set, [Model.EarlyAbandon] doesn't apply either.
+	WideDataMasks [][]uint64
+
+	// Integer weights of the data points' bits. If set, and there are no data masks, the Find, Predict and Regress methods search by
+	// the weighted Hamming distance (see [NearestWeighted] and [NearestWideWeighted]),
+	// except for the masked ones, and neither [Model.Selection], [Model.EarlyAbandon] nor the vectorized (V) methods apply.
+	// The weights of a narrow model must not cover more than 64 bits.
+	BitWeights *BitWeights[int]
+	// Floating-point weights of the data points' bits, for the FindWeighted and PredictWeighted methods.
+	FloatBitWeights *BitWeights[float64]
+
+	// Similarity coefficient of the FindSimilar and PredictSimilar methods.
+	Similarity Similarity
+	// Custom similarity coefficient of the FindSimilar and PredictSimilar methods. If set, replaces [Model.Similarity].
+	// The other methods always search by the Hamming distance.
+	Metric Metric
+	// Number of bits set in each data point, for the FindSimilar and PredictSimilar methods (see [OnesCounts] and [WideOnesCounts]).
+	// Computed by the CountOnes methods, or when fitting or reading the model with the [WithSimilarity] or [WithMetric] option.
+	// If empty, the bits are counted during each search instead.
+	OnesCounts []int
+	// Whether fitting or reading the model counts the bits set in its data points, as requested by [WithSimilarity] and [WithMetric].
+	countOnes bool
+	// Weight of a neighbor with the given similarity in the PredictSimilar methods. If nil, all neighbors weigh the same.
+	SimilarityWeightingFunc func(float64) float64
 
 	// Distance weighting function.
 	DistanceWeighting DistanceWeighting
 	// Custom function when [Model.DistanceWeighting] is [DistanceWeightingCustom].
 	DistanceWeightingFunc func(int) float64
 
+	// Number of goroutines searching the data concurrently for a single query.
+	// If <= 1, the data is searched sequentially. A [Searcher], and the Find and Predict methods using the model's own neighbor heap,
+	// keep their worker goroutines between queries (see [Model.Close]).
+	Workers int
+
+	// Whether wide models abandon the distance computation for a data point once it exceeds the current k-th nearest distance.
+	// See [NearestWideEarlyAbandon].
+	EarlyAbandon bool
+
+	// How the nearest neighbors are selected among the data points.
+	Selection Selection
+
+	// Which of several neighbors at the k-th nearest distance are returned.
+	TieBreaking TieBreaking
+	// Seed of the pseudo-random order when [Model.TieBreaking] is [TieBreakingRandom].
+	TieBreakingSeed uint64
+
+	// Whether the Find methods return the neighbors sorted by distance (see [SortNeighbors]).
+	Sorted bool
+
+	// Whether the PredictMasked methods weigh the neighbors by their masked distances rescaled to the full width (see [NormalizeMaskedDistances]).
+	// With data masks, all searches find and return the neighbors by their distances rescaled by their own number of comparable bits
+	// (see [NearestDataMaskedNormalized] and [NearestWideDataMaskedNormalized]).
+	MaskedDistanceNormalization bool
+
+	// How the Regress methods aggregate the targets of the nearest neighbors.
+	Aggregation Aggregation
+	// Fraction of the neighbors excluded at either end of the targets by [AggregationTrimmedMean].
+	// Fractions of one half or more keep only the middle one or two neighbors; negative or NaN fractions exclude none.
+	TrimFraction float64
+
 	HeapDistances []int
 	HeapIndices   []int
+	// Neighbor heap distances of the FindWeighted and PredictWeighted methods, and similarities of the FindSimilar and PredictSimilar methods.
+	HeapFloatDistances []float64
+
+	// Worker goroutines of the parallel searches into the model's own neighbor heap (see [Model.Close]).
+	workers *shardWorkers
+}
+
+// Close stops the worker goroutines that the Find and Predict methods keep between queries if [Model.Workers] > 1,
+// as a [Searcher] does. Otherwise, they stop once the model is garbage collected.
+// The model can still be used afterwards, starting new ones.
+func (me *Model) Close() {
+	me.workers.close()
+	me.workers = nil
 }
 
 func (me *Model) PreallocateHeap(k int) {
@@ -46,6 +149,9 @@ func (me *Model) PreallocateHeap(k int) {
 // Returns the distance and index slices, truncated to the actual number of neighbors found.
 func (me *Model) Find(k int, x uint64) ([]int, []int) {
 	me.PreallocateHeap(k)
+	if k, ok := me.nearestOnWorkers(&me.workers, k, x, nil, me.HeapDistances, me.HeapIndices); ok {
+		return me.sort(me.HeapDistances[:k], me.HeapIndices[:k])
+	}
 	return me.FindInto(k, x, me.HeapDistances, me.HeapIndices)
 }
 
@@ -53,9 +159,99 @@ func (me *Model) Find(k int, x uint64) ([]int, []int) {
 // Writes their distances and indices in the dataset into the provided slices.
 // The slices should be pre-allocated to length k+1.
 // Returns the distance and index slices, truncated to the actual number of neighbors found.
+// With [TieBreakingIncludeAll], the slices are grown if there are more than k neighbors.
 func (me *Model) FindInto(k int, x uint64, distances []int, indices []int) ([]int, []int) {
-	k = Nearest(me.Data, k, x, distances, indices)
-	return distances[:k], indices[:k]
+	if me.TieBreaking != TieBreakingLowestIndex {
+		return me.sort(me.nearestTies(k, x, distances, indices))
+	}
+	k = me.nearest(k, x, distances, indices)
+	return me.sort(distances[:k], indices[:k])
+}
+
+// FindSorted is [Model.Find], but returns the neighbors sorted by ascending distance, and equal distances by ascending index.
+func (me *Model) FindSorted(k int, x uint64) ([]int, []int) {
+	distances, indices := me.Find(k, x)
+	SortNeighbors(distances, indices)
+	return distances, indices
+}
+
+// FindSeq returns an iterator over the nearest neighbors of the given point as (index, distance) pairs, sorted as by [Model.FindSorted].
+// The neighbors are searched when the iteration starts, reusing the model's neighbor heap slices.
+func (me *Model) FindSeq(k int, x uint64) iter.Seq2[int, int] {
+	return func(yield func(int, int) bool) {
+		for index, dist := range Neighbors(me.FindSorted(k, x)) {
+			if !yield(index, dist) {
+				return
+			}
+		}
+	}
+}
+
+// FindV is [Model.Find], but vectorized (on ARM64 with NEON, and on amd64 with AVX2 or AVX-512 instructions).
+// The provided [batch] slice must have length >=k and is used to pre-compute batches of distances.
+func (me *Model) FindV(k int, x uint64, batch []uint32) ([]int, []int) {
+	me.PreallocateHeap(k)
+	if k, ok := me.nearestOnWorkers(&me.workers, k, x, batch, me.HeapDistances, me.HeapIndices); ok {
+		return me.sort(me.HeapDistances[:k], me.HeapIndices[:k])
+	}
+	return me.FindIntoV(k, x, batch, me.HeapDistances, me.HeapIndices)
+}
+
+// FindIntoV is [Model.FindInto], but vectorized (on ARM64 with NEON, and on amd64 with AVX2 or AVX-512 instructions).
+// The provided [batch] slice must have length >=k and is used to pre-compute batches of distances.
+func (me *Model) FindIntoV(k int, x uint64, batch []uint32, distances []int, indices []int) ([]int, []int) {
+	if me.TieBreaking != TieBreakingLowestIndex {
+		return me.sort(me.nearestTies(k, x, distances, indices))
+	}
+	k = me.nearestV(k, x, batch, distances, indices)
+	return me.sort(distances[:k], indices[:k])
+}
+
+// Finds the nearest neighbors of the given point, only counting the bits set in `mask` (see [NearestMasked]).
+// Reuses the model's neighbor heap slices.
+// Returns the distance and index slices, truncated to the actual number of neighbors found.
+func (me *Model) FindMasked(k int, x, mask uint64) ([]int, []int) {
+	me.PreallocateHeap(k)
+	return me.FindMaskedInto(k, x, mask, me.HeapDistances, me.HeapIndices)
+}
+
+// Finds the nearest neighbors of the given point, only counting the bits set in `mask` (see [NearestMasked]).
+// Writes their distances and indices in the dataset into the provided slices, which should be pre-allocated to length k+1.
+// Returns the distance and index slices, truncated to the actual number of neighbors found.
+// With [TieBreakingIncludeAll], the slices are grown if there are more than k neighbors.
+func (me *Model) FindMaskedInto(k int, x, mask uint64, distances []int, indices []int) ([]int, []int) {
+	if me.TieBreaking != TieBreakingLowestIndex {
+		return me.sort(me.nearestMaskedTies(k, x, mask, distances, indices))
+	}
+	k = me.nearestMasked(k, x, mask, distances, indices)
+	return me.sort(distances[:k], indices[:k])
+}
+
+// Finds the nearest neighbors of each of the given points, scanning the dataset only once for all of them.
+// Writes the distances and indices of the neighbors of `queries[q]` into the provided slices `distances[q]` and `indices[q]`,
+// which should be pre-allocated to length k+1.
+// Returns the smallest number of neighbors found for any query, which, with the supported tie-breaking policies,
+// is the number found for every query.
+// Unless [Model.TieBreaking] is [TieBreakingLowestIndex], or if [Model.DataMasks] or [Model.BitWeights] is set, the queries are searched one by one.
+// [TieBreakingIncludeAll] isn't supported, since the number of neighbors can differ between queries and exceed k+1:
+// then nothing is searched, and 0 is returned.
+func (me *Model) FindBatch(k int, queries []uint64, distances [][]int, indices [][]int) int {
+	if me.TieBreaking == TieBreakingIncludeAll {
+		return 0
+	}
+	if me.TieBreaking != TieBreakingLowestIndex || me.DataMasks != nil || me.BitWeights != nil {
+		n := min(k, len(me.Data))
+		for q, x := range queries {
+			d, _ := me.FindInto(k, x, distances[q], indices[q])
+			n = min(n, len(d))
+		}
+		return n
+	}
+	k = NearestBatch(me.Data, k, queries, distances, indices)
+	for q := range queries {
+		me.sort(distances[q][:k], indices[q][:k])
+	}
+	return k
 }
 
 // Predicts the label of a single input point. Each call allocates two new slices of length K+1 for the neighbor heap.
@@ -66,15 +262,404 @@ func (me *Model) PredictAlloc(k int, x uint64, votes VoteCounter) {
 
 // Predicts the label of a single input point. Reuses two slices of length K+1 for the neighbor heap.
 func (me *Model) Predict(k int, x uint64, votes VoteCounter) {
-	me.HeapDistances = slice.OrAlloc(me.HeapDistances, k+1)
-	me.HeapIndices = slice.OrAlloc(me.HeapIndices, k+1)
-	me.PredictInto(k, x, me.HeapDistances, me.HeapIndices, votes)
+	me.predict(k, x, votes)
+}
+
+// predict is [Model.Predict], returning the number of neighbors found.
+func (me *Model) predict(k int, x uint64, votes VoteCounter) int {
+	me.PreallocateHeap(k)
+	if k, ok := me.nearestOnWorkers(&me.workers, k, x, nil, me.HeapDistances, me.HeapIndices); ok {
+		me.Vote(k, me.HeapDistances, me.HeapIndices, votes)
+		return k
+	}
+	return me.predictInto(k, x, me.HeapDistances, me.HeapIndices, votes)
 }
 
 // Predicts the label of a single input point, using the given slices for the neighbor heap.
 func (me *Model) PredictInto(k int, x uint64, distances []int, indices []int, votes VoteCounter) {
-	k = Nearest(me.Data, k, x, distances, indices)
+	me.predictInto(k, x, distances, indices, votes)
+}
+
+// predictInto is [Model.PredictInto], returning the number of neighbors found.
+func (me *Model) predictInto(k int, x uint64, distances []int, indices []int, votes VoteCounter) int {
+	if me.TieBreaking != TieBreakingLowestIndex {
+		distances, indices = me.nearestTies(k, x, distances, indices)
+		k = len(indices)
+	} else {
+		k = me.nearest(k, x, distances, indices)
+	}
+	me.normalizeMasked(1<<64-1, distances[:k])
+	me.Vote(k, distances, indices, votes)
+	return k
+}
+
+// Predicts the label of a single input point from its nearest neighbors, only counting the bits set in `mask` (see [NearestMasked]).
+// Reuses the model's neighbor heap slices.
+// Returns the number of neighbors found.
+func (me *Model) PredictMasked(k int, x, mask uint64, votes VoteCounter) int {
+	me.PreallocateHeap(k)
+	return me.PredictMaskedInto(k, x, mask, me.HeapDistances, me.HeapIndices, votes)
+}
+
+// Predicts the label of a single input point from its nearest neighbors, only counting the bits set in `mask` (see [NearestMasked]),
+// using the given slices for the neighbor heap.
+// If [Model.MaskedDistanceNormalization] is set, the neighbors' distances are rescaled to 64 bits before weighting them.
+// Returns the number of neighbors found.
+func (me *Model) PredictMaskedInto(k int, x, mask uint64, distances []int, indices []int, votes VoteCounter) int {
+	if me.TieBreaking != TieBreakingLowestIndex {
+		distances, indices = me.nearestMaskedTies(k, x, mask, distances, indices)
+		k = len(indices)
+	} else {
+		k = me.nearestMasked(k, x, mask, distances, indices)
+	}
+	me.normalizeMasked(mask, distances[:k])
+	me.Vote(k, distances, indices, votes)
+	return k
+}
+
+// Finds the nearest neighbors of the given point by the weighted Hamming distance with [Model.FloatBitWeights] (see [NearestWeighted]).
+// Reuses the model's neighbor heap slices.
+// Returns the distance and index slices, truncated to the actual number of neighbors found.
+func (me *Model) FindWeighted(k int, x uint64) ([]float64, []int) {
+	me.preallocateFloatHeap(k)
+	return me.FindWeightedInto(k, x, me.HeapFloatDistances, me.HeapIndices)
+}
+
+// Finds the nearest neighbors of the given point by the weighted Hamming distance with [Model.FloatBitWeights] (see [NearestWeighted]).
+// Writes their distances and indices in the dataset into the provided slices, which should be pre-allocated to length k+1.
+// Returns the distance and index slices, truncated to the actual number of neighbors found.
+// With [TieBreakingIncludeAll], the slices are grown if there are more than k neighbors.
+func (me *Model) FindWeightedInto(k int, x uint64, distances []float64, indices []int) ([]float64, []int) {
+	distances, indices = me.nearestFloatWeighted(k, x, distances, indices)
+	if me.Sorted {
+		SortNeighbors(distances, indices)
+	}
+	return distances, indices
+}
+
+// Predicts the label of a single input point from its nearest neighbors by the weighted Hamming distance with [Model.FloatBitWeights].
+// Reuses the model's neighbor heap slices.
+// Returns the number of neighbors found.
+func (me *Model) PredictWeighted(k int, x uint64, votes VoteCounter) int {
+	me.preallocateFloatHeap(k)
+	return me.PredictWeightedInto(k, x, me.HeapFloatDistances, me.HeapIndices, votes)
+}
+
+// Predicts the label of a single input point from its nearest neighbors by the weighted Hamming distance with [Model.FloatBitWeights],
+// using the given slices for the neighbor heap (see [Model.VoteWeighted]).
+// Returns the number of neighbors found.
+func (me *Model) PredictWeightedInto(k int, x uint64, distances []float64, indices []int, votes VoteCounter) int {
+	distances, indices = me.nearestFloatWeighted(k, x, distances, indices)
+	me.VoteWeighted(len(indices), distances, indices, votes)
+	return len(indices)
+}
+
+// Finds the data points most similar to the given point by [Model.Similarity] or [Model.Metric] (see [NearestSimilar]).
+// Reuses the model's neighbor heap slices.
+// Returns the similarity and index slices, truncated to the actual number of neighbors found.
+func (me *Model) FindSimilar(k int, x uint64) ([]float64, []int) {
+	me.preallocateFloatHeap(k)
+	return me.FindSimilarInto(k, x, me.HeapFloatDistances, me.HeapIndices)
+}
+
+// Finds the data points most similar to the given point by [Model.Similarity] or [Model.Metric] (see [NearestSimilar]).
+// Writes their similarities and indices in the dataset into the provided slices, which should be pre-allocated to length k+1.
+// Returns the similarity and index slices, truncated to the actual number of neighbors found.
+// With [TieBreakingIncludeAll], the slices are grown if there are more than k neighbors.
+// With [Model.Sorted], the neighbors are sorted by descending similarity, and equal similarities by ascending index.
+func (me *Model) FindSimilarInto(k int, x uint64, similarities []float64, indices []int) ([]float64, []int) {
+	similarities, indices = me.nearestSimilar(k, x, similarities, indices)
+	if me.Sorted {
+		SortSimilarNeighbors(similarities, indices)
+	}
+	return similarities, indices
+}
+
+// Predicts the label of a single input point from its most similar data points by [Model.Similarity] or [Model.Metric].
+// Reuses the model's neighbor heap slices.
+// Returns the number of neighbors found.
+func (me *Model) PredictSimilar(k int, x uint64, votes VoteCounter) int {
+	me.preallocateFloatHeap(k)
+	return me.PredictSimilarInto(k, x, me.HeapFloatDistances, me.HeapIndices, votes)
+}
+
+// Predicts the label of a single input point from its most similar data points by [Model.Similarity] or [Model.Metric],
+// using the given slices for the neighbor heap (see [Model.VoteSimilar]).
+// Returns the number of neighbors found.
+func (me *Model) PredictSimilarInto(k int, x uint64, similarities []float64, indices []int, votes VoteCounter) int {
+	similarities, indices = me.nearestSimilar(k, x, similarities, indices)
+	me.VoteSimilar(len(indices), similarities, indices, votes)
+	return len(indices)
+}
+
+// nearestSimilar is [NearestSimilar] or [NearestSimilarParallel] with the model's metric, depending on [Model.Workers],
+// with the ties at the k-th highest similarity broken by [Model.TieBreaking].
+// Returns the similarity and index slices, truncated to the number of neighbors found, or grown if there are more than k.
+func (me *Model) nearestSimilar(k int, x uint64, similarities []float64, indices []int) ([]float64, []int) {
+	metric := me.metric()
+	if me.Workers > 1 {
+		k = NearestSimilarParallel(me.Data, me.OnesCounts, metric, k, x, me.Workers, similarities, indices)
+	} else {
+		k = NearestSimilar(me.Data, me.OnesCounts, metric, k, x, similarities, indices)
+	}
+	if me.TieBreaking == TieBreakingLowestIndex {
+		return similarities[:k], indices[:k]
+	}
+	nx := bits.OnesCount64(x)
+	negate(similarities[:k])
+	similarities, indices = selectTies(len(me.Data), k, me.TieBreaking, me.TieBreakingSeed, similarities, indices, func(i int) float64 {
+		return -similarity(metric, x, nx, me.Data[i])
+	})
+	negate(similarities)
+	return similarities, indices
+}
+
+// metric returns [Model.Metric], or [Model.Similarity] if it isn't set.
+func (me *Model) metric() Metric {
+	if me.Metric != nil {
+		return me.Metric
+	}
+	return me.Similarity
+}
+
+// CountOnes sets [Model.OnesCounts] for the model's data points.
+func (me *Model) CountOnes() {
+	me.OnesCounts = OnesCounts(me.Data)
+}
+
+// preallocateFloatHeap is [Model.PreallocateHeap] for the FindWeighted, PredictWeighted, FindSimilar and PredictSimilar methods.
+func (me *Model) preallocateFloatHeap(k int) {
+	me.HeapFloatDistances = slice.OrAlloc(me.HeapFloatDistances, k+1)
+	me.HeapIndices = slice.OrAlloc(me.HeapIndices, k+1)
+}
+
+// PredictV is [Model.Predict], but vectorized (on ARM64 with NEON, and on amd64 with AVX2 or AVX-512 instructions).
+// The provided [batch] slice must have length >=k and is used to pre-compute batches of distances.
+func (me *Model) PredictV(k int, x uint64, batch []uint32, votes VoteCounter) {
+	me.PreallocateHeap(k)
+	if k, ok := me.nearestOnWorkers(&me.workers, k, x, batch, me.HeapDistances, me.HeapIndices); ok {
+		me.Vote(k, me.HeapDistances, me.HeapIndices, votes)
+		return
+	}
+	me.PredictIntoV(k, x, batch, me.HeapDistances, me.HeapIndices, votes)
+}
+
+// PredictIntoV is [Model.PredictInto], but vectorized (on ARM64 with NEON, and on amd64 with AVX2 or AVX-512 instructions).
+// The provided [batch] slice must have length >=k and is used to pre-compute batches of distances.
+func (me *Model) PredictIntoV(k int, x uint64, batch []uint32, distances []int, indices []int, votes VoteCounter) {
+	me.predictIntoV(k, x, batch, distances, indices, votes)
+}
+
+// predictIntoV is [Model.PredictIntoV], returning the number of neighbors found.
+func (me *Model) predictIntoV(k int, x uint64, batch []uint32, distances []int, indices []int, votes VoteCounter) int {
+	if me.TieBreaking != TieBreakingLowestIndex {
+		return me.predictInto(k, x, distances, indices, votes)
+	}
+	k = me.nearestV(k, x, batch, distances, indices)
+	me.normalizeMasked(1<<64-1, distances[:k])
 	me.Vote(k, distances, indices, votes)
+	return k
+}
+
+// Predicts the target of a single input point from the [Model.Values] of its nearest neighbors (see [Model.Aggregate]).
+// Reuses the model's neighbor heap slices.
+func (me *Model) Regress(k int, x uint64) Regression {
+	me.PreallocateHeap(k)
+	return me.RegressInto(k, x, me.HeapDistances, me.HeapIndices)
+}
+
+// Predicts the target of a single input point from the [Model.Values] of its nearest neighbors (see [Model.Aggregate]),
+// using the given slices for the neighbor heap.
+func (me *Model) RegressInto(k int, x uint64, distances []int, indices []int) Regression {
+	if me.TieBreaking != TieBreakingLowestIndex {
+		distances, indices = me.nearestTies(k, x, distances, indices)
+		k = len(indices)
+	} else {
+		k = me.nearest(k, x, distances, indices)
+	}
+	me.normalizeMasked(1<<64-1, distances[:k])
+	return me.Aggregate(k, distances, indices)
+}
+
+// sort sorts the given neighbors if [Model.Sorted] is set, and returns them.
+func (me *Model) sort(distances, indices []int) ([]int, []int) {
+	if me.Sorted {
+		SortNeighbors(distances, indices)
+	}
+	return distances, indices
+}
+
+// nearest is [Nearest], [NearestCounting] or [NearestParallel], depending on [Model.Workers] and [Model.Selection],
+// or [NearestDataMasked] if [Model.DataMasks] is set, or [NearestWeighted] if [Model.BitWeights] is set.
+func (me *Model) nearest(k int, x uint64, distances []int, indices []int) int {
+	if me.DataMasks != nil {
+		return me.nearestMasked(k, x, 1<<64-1, distances, indices)
+	}
+	if me.BitWeights != nil {
+		if me.Workers > 1 {
+			return NearestWeightedParallel(me.Data, me.BitWeights, k, x, me.Workers, distances, indices)
+		}
+		return NearestWeighted(me.Data, me.BitWeights, k, x, distances, indices)
+	}
+	if me.Workers > 1 {
+		return NearestParallel(me.Data, k, x, me.Workers, distances, indices)
+	}
+	if me.Selection.counting(k, 1) {
+		return NearestCounting(me.Data, k, x, distances, indices)
+	}
+	return Nearest(me.Data, k, x, distances, indices)
+}
+
+// nearestTies is [NearestTies] or [NearestParallelTies] with the model's tie-breaking, depending on [Model.Workers],
+// or their data-masked or weighted variants if [Model.DataMasks] or [Model.BitWeights] is set.
+// Overwrites the given slices, growing them if necessary.
+func (me *Model) nearestTies(k int, x uint64, distances []int, indices []int) ([]int, []int) {
+	if me.DataMasks != nil {
+		return me.nearestMaskedTies(k, x, 1<<64-1, distances, indices)
+	}
+	if me.BitWeights != nil {
+		return me.nearestWeightedTies(k, x, distances, indices)
+	}
+	if me.Workers > 1 {
+		return NearestParallelTies(me.Data, k, x, me.Workers, me.TieBreaking, me.TieBreakingSeed, distances[:0], indices[:0])
+	}
+	return NearestTies(me.Data, k, x, me.TieBreaking, me.TieBreakingSeed, distances[:0], indices[:0])
+}
+
+// nearestV is [NearestV] or [NearestParallelV], depending on [Model.Workers].
+// If [Model.DataMasks] or [Model.BitWeights] is set, it is [Model.nearest] instead.
+func (me *Model) nearestV(k int, x uint64, batch []uint32, distances []int, indices []int) int {
+	if me.DataMasks != nil || me.BitWeights != nil {
+		return me.nearest(k, x, distances, indices)
+	}
+	if me.Workers > 1 {
+		return NearestParallelV(me.Data, k, x, me.Workers, batch, distances, indices)
+	}
+	return NearestV(me.Data, k, x, batch, distances, indices)
+}
+
+// nearestMasked is [NearestMasked], or [NearestDataMasked] if [Model.DataMasks] is set
+// ([NearestDataMaskedNormalized] if [Model.MaskedDistanceNormalization] is set), searched concurrently depending on [Model.Workers].
+func (me *Model) nearestMasked(k int, x, mask uint64, distances []int, indices []int) int {
+	if me.DataMasks == nil {
+		return NearestMasked(me.Data, k, x, mask, distances, indices)
+	}
+	normalize := me.MaskedDistanceNormalization
+	if me.Workers > 1 {
+		return nearestParallel(len(me.Data), k, me.Workers, distances, indices, func(_, _, lo, hi int, distances, indices []int) int {
+			return nearestDataMasked(me.Data[lo:hi], me.DataMasks[lo:hi], k, x, mask, normalize, distances, indices)
+		})
+	}
+	return nearestDataMasked(me.Data, me.DataMasks, k, x, mask, normalize, distances, indices)
+}
+
+// nearestMaskedTies is [NearestMaskedTies], or [NearestDataMaskedTies] if [Model.DataMasks] is set
+// ([NearestDataMaskedNormalizedTies] if [Model.MaskedDistanceNormalization] is set), with the model's tie-breaking,
+// searched concurrently depending on [Model.Workers].
+// Overwrites the given slices, growing them if necessary.
+func (me *Model) nearestMaskedTies(k int, x, mask uint64, distances []int, indices []int) ([]int, []int) {
+	if me.DataMasks == nil {
+		if me.Workers > 1 {
+			return nearestParallelTies(len(me.Data), k, me.Workers, 64, me.TieBreaking, me.TieBreakingSeed, distances[:0], indices[:0], func(c *topk.Counting, lo, hi int) {
+				pushNearestMasked(c, me.Data[lo:hi], x, mask)
+			})
+		}
+		return NearestMaskedTies(me.Data, k, x, mask, me.TieBreaking, me.TieBreakingSeed, distances[:0], indices[:0])
+	}
+	normalize := me.MaskedDistanceNormalization
+	if me.Workers > 1 {
+		return nearestParallelTies(len(me.Data), k, me.Workers, 64, me.TieBreaking, me.TieBreakingSeed, distances[:0], indices[:0], func(c *topk.Counting, lo, hi int) {
+			pushNearestDataMasked(c, me.Data[lo:hi], me.DataMasks[lo:hi], x, mask, normalize)
+		})
+	}
+	return nearestDataMaskedTies(me.Data, me.DataMasks, k, x, mask, normalize, me.TieBreaking, me.TieBreakingSeed, distances[:0], indices[:0])
+}
+
+// nearestWeightedTies is [NearestWeightedTies] with the model's tie-breaking, searched concurrently depending on [Model.Workers].
+func (me *Model) nearestWeightedTies(k int, x uint64, distances []int, indices []int) ([]int, []int) {
+	if weights := me.BitWeights; me.Workers > 1 && weights.Max() > weightedTiesMaxCounting && k > 0 {
+		return appendHeapTies(len(me.Data), k, me.TieBreaking, me.TieBreakingSeed, distances[:0], indices[:0], func(distances, indices []int) int {
+			return NearestWeightedParallel(me.Data, weights, k, x, me.Workers, distances, indices)
+		}, func(i int) int {
+			return weights.Distance64(x, me.Data[i])
+		})
+	}
+	if me.Workers > 1 {
+		return nearestParallelTies(len(me.Data), k, me.Workers, me.BitWeights.Max(), me.TieBreaking, me.TieBreakingSeed, distances[:0], indices[:0], func(c *topk.Counting, lo, hi int) {
+			pushNearestWeighted(c, me.Data[lo:hi], me.BitWeights, x)
+		})
+	}
+	return NearestWeightedTies(me.Data, me.BitWeights, k, x, me.TieBreaking, me.TieBreakingSeed, distances[:0], indices[:0])
+}
+
+// nearestFloatWeighted is [NearestWeighted] or [NearestWeightedParallel] with [Model.FloatBitWeights], depending on [Model.Workers],
+// with the ties at the k-th nearest distance broken by [Model.TieBreaking].
+// Returns the distance and index slices, truncated to the number of neighbors found, or grown if there are more than k.
+func (me *Model) nearestFloatWeighted(k int, x uint64, distances []float64, indices []int) ([]float64, []int) {
+	weights := me.FloatBitWeights
+	if me.Workers > 1 {
+		k = NearestWeightedParallel(me.Data, weights, k, x, me.Workers, distances, indices)
+	} else {
+		k = NearestWeighted(me.Data, weights, k, x, distances, indices)
+	}
+	return selectTies(len(me.Data), k, me.TieBreaking, me.TieBreakingSeed, distances, indices, func(i int) float64 {
+		return weights.Distance64(x, me.Data[i])
+	})
+}
+
+// normalizeMasked rescales the distances of the given neighbors found with the query mask `mask` to 64 bits
+// if [Model.MaskedDistanceNormalization] is set (see [NormalizeMaskedDistances]).
+// With data masks, the distances are already rescaled by the search.
+func (me *Model) normalizeMasked(mask uint64, distances []int) {
+	if me.MaskedDistanceNormalization && me.DataMasks == nil {
+		NormalizeMaskedDistances(distances, bits.OnesCount64(mask), 64)
+	}
+}
+
+// within is [Within], or [WithinDataMasked] or [WithinWeighted] if [Model.DataMasks] or [Model.BitWeights] is set.
+func (me *Model) within(r int, x uint64, limit int, distances []int, indices []int) ([]int, []int) {
+	if me.DataMasks != nil {
+		return withinDataMasked(me.Data, me.DataMasks, r, x, 1<<64-1, me.MaskedDistanceNormalization, limit, distances, indices)
+	}
+	if me.BitWeights != nil {
+		return WithinWeighted(me.Data, me.BitWeights, r, x, limit, distances, indices)
+	}
+	return Within(me.Data, r, x, limit, distances, indices)
+}
+
+// Finds all points within Hamming distance `r` of the given point, in index order.
+// Reuses the model's neighbor heap slices, growing them as needed.
+// Returns the distance and index slices.
+func (me *Model) FindWithin(r int, x uint64) ([]int, []int) {
+	me.HeapDistances, me.HeapIndices = me.within(r, x, -1, me.HeapDistances[:0], me.HeapIndices[:0])
+	return me.HeapDistances, me.HeapIndices
+}
+
+// Finds the points within Hamming distance `r` of the given point, in index order.
+// Appends their distances and indices in the dataset to the provided slices, up to `limit` neighbors if `limit` is non-negative.
+// Returns the distance and index slices.
+func (me *Model) FindWithinInto(r int, x uint64, limit int, distances []int, indices []int) ([]int, []int) {
+	return me.within(r, x, limit, distances, indices)
+}
+
+// Predicts the label of a single input point from all points within Hamming distance `r`.
+// Reuses the model's neighbor heap slices, growing them as needed.
+// Returns the number of neighbors found.
+func (me *Model) PredictWithin(r int, x uint64, votes VoteCounter) int {
+	distances, indices := me.FindWithin(r, x)
+	me.normalizeMasked(1<<64-1, distances)
+	me.Vote(len(indices), distances, indices, votes)
+	return len(indices)
+}
+
+// Predicts the label of a single input point from the points within Hamming distance `r`, up to `limit` neighbors if `limit` is non-negative.
+// Uses the given slices (truncated to length 0) for the neighbors, which should have enough capacity to avoid allocation.
+// Returns the number of neighbors found.
+func (me *Model) PredictWithinInto(r int, x uint64, limit int, distances []int, indices []int, votes VoteCounter) int {
+	distances, indices = me.within(r, x, limit, distances[:0], indices[:0])
+	me.normalizeMasked(1<<64-1, distances)
+	me.Vote(len(indices), distances, indices, votes)
+	return len(indices)
 }
 
 // Predicts the label of a single input point, using the given slices for the neighbor heap.
@@ -109,6 +694,50 @@ func (me *Model) Vote(k int, distances []int, indices []int, votes VoteCounter)
 	}
 }
 
+// VoteWeighted is [Model.Vote] for neighbors with floating-point distances, such as those found by the FindWeighted methods.
+// With [DistanceWeightingCustom], [Model.DistanceWeightingFunc] is passed the distances rounded to the nearest integer.
+func (me *Model) VoteWeighted(k int, distances []float64, indices []int, votes VoteCounter) {
+	votes.Clear()
+	for i := range k {
+		index := indices[i]
+		w := me.floatWeight(distances[i])
+		if me.Values != nil {
+			w *= me.Values[index]
+		}
+		votes.Add(me.Labels[index], w)
+	}
+}
+
+// VoteSimilar is [Model.Vote] for neighbors with similarities, such as those found by the FindSimilar methods.
+// Each neighbor is weighted by [Model.SimilarityWeightingFunc] of its similarity, if set, instead of by distance.
+func (me *Model) VoteSimilar(k int, similarities []float64, indices []int, votes VoteCounter) {
+	votes.Clear()
+	for i := range k {
+		index := indices[i]
+		w := 1.0
+		if me.SimilarityWeightingFunc != nil {
+			w = me.SimilarityWeightingFunc(similarities[i])
+		}
+		if me.Values != nil {
+			w *= me.Values[index]
+		}
+		votes.Add(me.Labels[index], w)
+	}
+}
+
+// floatWeight returns the weight of a neighbor at the given floating-point distance according to [Model.DistanceWeighting].
+func (me *Model) floatWeight(dist float64) float64 {
+	switch me.DistanceWeighting {
+	case DistanceWeightingLinear:
+		return 1 / (1 + dist)
+	case DistanceWeightingQuadratic:
+		return 1 / (1 + dist*dist)
+	case DistanceWeightingCustom:
+		return me.DistanceWeightingFunc(int(math.Round(dist)))
+	}
+	return 1
+}
+
 func (me *Model) votes1vc(k int, indices []int, votes VoteCounter, f func(int) float64, distances []int) {
 	for i := range k {
 		index := indices[i]
@@ -197,5 +826,52 @@ func (me DistanceWeighting) String() string {
 	return "unknown"
 }
 
+// Selection determines how the k nearest neighbors are selected among the data points.
+// All selections find the same neighbors, but may return them in a different order.
+type Selection int
+
+const (
+	// Keep the nearest neighbors in a binary max-heap.
+	SelectionHeap Selection = iota
+	// Count the candidates at each distance, lowering the distance threshold as soon as there are k closer ones.
+	// Faster than [SelectionHeap] for large k. Returns the neighbors in index order.
+	SelectionCounting
+	// Use [SelectionCounting] for large k, and [SelectionHeap] otherwise.
+	SelectionAuto
+)
+
+// Smallest k for which [SelectionAuto] selects by counting, for single-word and wider data points.
+const (
+	selectionAutoMinK     = 256
+	selectionAutoMinKWide = 64
+)
+
+func (me Selection) String() string {
+	switch me {
+	case SelectionHeap:
+		return "heap"
+	case SelectionCounting:
+		return "counting"
+	case SelectionAuto:
+		return "auto"
+	}
+	return "unknown"
+}
+
+// counting returns whether to select k neighbors of points with the given number of words by counting.
+// Selection by counting only applies to sequential searches (see [Model.Workers]).
+func (me Selection) counting(k, words int) bool {
+	switch me {
+	case SelectionCounting:
+		return true
+	case SelectionAuto:
+		if words > 1 {
+			return k >= selectionAutoMinKWide
+		}
+		return k >= selectionAutoMinK
+	}
+	return false
+}
+
 func DistanceWeightingFuncLinear(dist int) float64    { return 1.0 / float64(1+dist) }
 func DistanceWeightingFuncQuadratic(dist int) float64 { return 1.0 / float64(1+(dist*dist)) }
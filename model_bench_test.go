@@ -39,7 +39,76 @@ func BenchmarkModel(b *testing.B) {
 						model.Find(k, query)
 					}
 				})
+				b.Run(fmt.Sprintf("Op=FindV_bits=64_N=%d_k=%d", dataSize, k), func(b *testing.B) {
+					batch := make([]uint32, max(k, 1024))
+					model.PreallocateHeap(k)
+					b.ResetTimer()
+					for n := 0; n < b.N; n++ {
+						model.FindV(k, query, batch)
+					}
+				})
 			}
 		}
 	}
 }
+
+func BenchmarkModel_FindBatch(b *testing.B) {
+	type bench struct {
+		dataSize   []int
+		numQueries []int
+		k          []int
+	}
+	benches := []bench{
+		{dataSize: []int{1000, 1_000_000}, numQueries: []int{100, 1000}, k: []int{3, 10, 100}},
+	}
+	for _, bench := range benches {
+		for _, dataSize := range bench.dataSize {
+			data := testrandom.Data(dataSize)
+			model := bitknn.Fit(data, nil)
+			for _, numQueries := range bench.numQueries {
+				queries := testrandom.Data(numQueries)
+				for _, k := range bench.k {
+					distances, indices := make([][]int, numQueries), make([][]int, numQueries)
+					for q := range queries {
+						distances[q], indices[q] = make([]int, k+1), make([]int, k+1)
+					}
+
+					b.Run(fmt.Sprintf("Op=FindBatch_bits=64_N=%d_k=%d_queries=%d", dataSize, k, numQueries), func(b *testing.B) {
+						for n := 0; n < b.N; n++ {
+							model.FindBatch(k, queries, distances, indices)
+						}
+					})
+					b.Run(fmt.Sprintf("Op=FindLoop_bits=64_N=%d_k=%d_queries=%d", dataSize, k, numQueries), func(b *testing.B) {
+						for n := 0; n < b.N; n++ {
+							for q, x := range queries {
+								model.FindInto(k, x, distances[q], indices[q])
+							}
+						}
+					})
+				}
+			}
+		}
+	}
+}
+
+func BenchmarkSearcher_Parallel(b *testing.B) {
+	const k = 10
+	for _, dataSize := range []int{100_000, 1_000_000} {
+		for _, workers := range []int{2, 4, 8} {
+			data := testrandom.Data(dataSize)
+			labels := testrandom.Labels(dataSize)
+			model := bitknn.Fit(data, labels, bitknn.WithWorkers(workers))
+			query := testrandom.Query()
+
+			b.Run(fmt.Sprintf("Op=Predict_bits=64_N=%d_k=%d_workers=%d", dataSize, k, workers), func(b *testing.B) {
+				searcher := model.NewSearcher()
+				searcher.Predict(k, query, bitknn.DiscardVotes)
+				b.ReportAllocs()
+				b.ResetTimer()
+				for n := 0; n < b.N; n++ {
+					searcher.Predict(k, query, bitknn.DiscardVotes)
+				}
+			})
+		}
+	}
+}
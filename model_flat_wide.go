@@ -0,0 +1,269 @@
+package bitknn
+
+import (
+	"iter"
+
+	"github.com/keilerkonzept/bitknn/internal/topk"
+)
+
+// Create a k-NN model for the given wide data points and labels.
+// The data points are stored consecutively in `data`, each with `stride` words.
+// Panics if `stride` is not positive, if `len(data)` is not a multiple of it, if `labels` is non-nil and doesn't have a label per data point,
+// or if the options set [Model.BitWeights] or [Model.WideDataMasks], which the flat search functions don't support.
+func FitFlatWide(data []uint64, stride int, labels []int, opts ...Option) *FlatWideModel {
+	if stride <= 0 {
+		panic("bitknn: the stride of a FlatWideModel must be positive")
+	}
+	if len(data)%stride != 0 {
+		panic("bitknn: the length of the flat data must be a multiple of the stride")
+	}
+	if labels != nil && len(labels) != len(data)/stride {
+		panic("bitknn: the number of labels must match the number of data points")
+	}
+	m := &FlatWideModel{
+		Narrow:   fit(nil, labels, opts),
+		FlatData: data,
+		Stride:   stride,
+	}
+	checkFlatWide(m.Narrow)
+	return m
+}
+
+// checkFlatWide panics if the model sets options that a [FlatWideModel] would otherwise silently ignore.
+func checkFlatWide(m *Model) {
+	if !supportsFlatWide(m) {
+		panic("bitknn: FlatWideModel doesn't support bit weights or data masks")
+	}
+}
+
+func supportsFlatWide(m *Model) bool {
+	return m.BitWeights == nil && m.WideDataMasks == nil
+}
+
+// A k-NN model for wide data points stored in a single flat slice with a fixed stride.
+// Compared to [WideModel], it saves a slice header per data point, and its data is always contiguous.
+// Queries must have [FlatWideModel.Stride] words, or no neighbors are found.
+type FlatWideModel struct {
+	Narrow *Model
+
+	// Input data points, stored consecutively.
+	FlatData []uint64
+	// Number of words per data point.
+	Stride int
+
+	// Worker goroutines of the parallel searches into the model's own neighbor heap (see [FlatWideModel.Close]).
+	workers *shardWorkers
+}
+
+// Close stops the worker goroutines that the Find and Predict methods keep between queries. See [Model.Close].
+func (me *FlatWideModel) Close() {
+	me.workers.close()
+	me.workers = nil
+}
+
+// Len returns the number of data points.
+func (me *FlatWideModel) Len() int {
+	if me.Stride == 0 {
+		return 0
+	}
+	return len(me.FlatData) / me.Stride
+}
+
+// Point returns the `i`-th data point.
+func (me *FlatWideModel) Point(i int) []uint64 {
+	return me.FlatData[i*me.Stride : (i+1)*me.Stride : (i+1)*me.Stride]
+}
+
+func (me *FlatWideModel) PreallocateHeap(k int) {
+	me.Narrow.PreallocateHeap(k)
+}
+
+// Finds the nearest neighbors of the given point.
+// Writes their distances and indices in the dataset into the pre-allocated slices.
+// Returns the distance and index slices, truncated to the actual number of neighbors found.
+func (me *FlatWideModel) Find(k int, x []uint64) ([]int, []int) {
+	me.PreallocateHeap(k)
+	if k, ok := me.nearestOnWorkers(&me.workers, k, x, nil, me.Narrow.HeapDistances, me.Narrow.HeapIndices); ok {
+		return me.Narrow.sort(me.Narrow.HeapDistances[:k], me.Narrow.HeapIndices[:k])
+	}
+	return me.FindInto(k, x, me.Narrow.HeapDistances, me.Narrow.HeapIndices)
+}
+
+// FindV is [FlatWideModel.Find], but vectorized (on ARM64 with NEON, and on amd64 with AVX2 or AVX-512 instructions).
+// The provided [batch] slice must have length >=k and is used to pre-compute batches of distances.
+func (me *FlatWideModel) FindV(k int, x []uint64, batch []uint32) ([]int, []int) {
+	me.PreallocateHeap(k)
+	if k, ok := me.nearestOnWorkers(&me.workers, k, x, batch, me.Narrow.HeapDistances, me.Narrow.HeapIndices); ok {
+		return me.Narrow.sort(me.Narrow.HeapDistances[:k], me.Narrow.HeapIndices[:k])
+	}
+	return me.FindIntoV(k, x, batch, me.Narrow.HeapDistances, me.Narrow.HeapIndices)
+}
+
+// FindSorted is [FlatWideModel.Find], but returns the neighbors sorted by ascending distance, and equal distances by ascending index.
+func (me *FlatWideModel) FindSorted(k int, x []uint64) ([]int, []int) {
+	distances, indices := me.Find(k, x)
+	SortNeighbors(distances, indices)
+	return distances, indices
+}
+
+// FindSeq returns an iterator over the nearest neighbors of the given point as (index, distance) pairs, sorted as by [FlatWideModel.FindSorted].
+// The neighbors are searched when the iteration starts, reusing the model's neighbor heap slices.
+func (me *FlatWideModel) FindSeq(k int, x []uint64) iter.Seq2[int, int] {
+	return func(yield func(int, int) bool) {
+		for index, dist := range Neighbors(me.FindSorted(k, x)) {
+			if !yield(index, dist) {
+				return
+			}
+		}
+	}
+}
+
+// Finds the nearest neighbors of the given point.
+// Writes their distances and indices in the dataset into the provided slices.
+// The slices should be pre-allocated to length k+1.
+// Returns the distance and index slices, truncated to the actual number of neighbors found.
+// With [TieBreakingIncludeAll], the slices are grown if there are more than k neighbors.
+func (me *FlatWideModel) FindInto(k int, x []uint64, distances []int, indices []int) ([]int, []int) {
+	if me.Narrow.TieBreaking != TieBreakingLowestIndex {
+		return me.Narrow.sort(me.nearestTies(k, x, distances, indices))
+	}
+	k = me.nearest(k, x, distances, indices)
+	return me.Narrow.sort(distances[:k], indices[:k])
+}
+
+// FindIntoV is [FlatWideModel.FindInto], but vectorized (on ARM64 with NEON, and on amd64 with AVX2 or AVX-512 instructions).
+// The provided [batch] slice must have length >=k and is used to pre-compute batches of distances.
+func (me *FlatWideModel) FindIntoV(k int, x []uint64, batch []uint32, distances []int, indices []int) ([]int, []int) {
+	if me.Narrow.TieBreaking != TieBreakingLowestIndex {
+		return me.Narrow.sort(me.nearestTies(k, x, distances, indices))
+	}
+	k = me.nearestV(k, x, batch, distances, indices)
+	return me.Narrow.sort(distances[:k], indices[:k])
+}
+
+// Predicts the label of a single input point. Reuses two slices of length K+1 for the neighbor heap.
+// Returns the number of neighbors found.
+func (me *FlatWideModel) Predict(k int, x []uint64, votes VoteCounter) int {
+	me.PreallocateHeap(k)
+	if k, ok := me.nearestOnWorkers(&me.workers, k, x, nil, me.Narrow.HeapDistances, me.Narrow.HeapIndices); ok {
+		me.Narrow.Vote(k, me.Narrow.HeapDistances, me.Narrow.HeapIndices, votes)
+		return k
+	}
+	return me.PredictInto(k, x, me.Narrow.HeapDistances, me.Narrow.HeapIndices, votes)
+}
+
+// Predicts the label of a single input point, using the given slices for the neighbor heap.
+// Returns the number of neighbors found.
+func (me *FlatWideModel) PredictInto(k int, x []uint64, distances []int, indices []int, votes VoteCounter) int {
+	if me.Narrow.TieBreaking != TieBreakingLowestIndex {
+		distances, indices = me.nearestTies(k, x, distances, indices)
+		k = len(indices)
+	} else {
+		k = me.nearest(k, x, distances, indices)
+	}
+	me.Narrow.Vote(k, distances, indices, votes)
+	return k
+}
+
+// PredictV is [FlatWideModel.Predict], but vectorized (on ARM64 with NEON, and on amd64 with AVX2 or AVX-512 instructions).
+// The provided [batch] slice must have length >=k and is used to pre-compute batches of distances.
+func (me *FlatWideModel) PredictV(k int, x []uint64, batch []uint32, votes VoteCounter) int {
+	me.PreallocateHeap(k)
+	if k, ok := me.nearestOnWorkers(&me.workers, k, x, batch, me.Narrow.HeapDistances, me.Narrow.HeapIndices); ok {
+		me.Narrow.Vote(k, me.Narrow.HeapDistances, me.Narrow.HeapIndices, votes)
+		return k
+	}
+	return me.PredictIntoV(k, x, batch, me.Narrow.HeapDistances, me.Narrow.HeapIndices, votes)
+}
+
+// PredictIntoV is [FlatWideModel.PredictInto], but vectorized (on ARM64 with NEON, and on amd64 with AVX2 or AVX-512 instructions).
+// The provided [batch] slice must have length >=k and is used to pre-compute batches of distances.
+func (me *FlatWideModel) PredictIntoV(k int, x []uint64, batch []uint32, distances []int, indices []int, votes VoteCounter) int {
+	if me.Narrow.TieBreaking != TieBreakingLowestIndex {
+		return me.PredictInto(k, x, distances, indices, votes)
+	}
+	k = me.nearestV(k, x, batch, distances, indices)
+	me.Narrow.Vote(k, distances, indices, votes)
+	return k
+}
+
+// Predicts the target of a single input point from the [Model.Values] of its nearest neighbors (see [Model.Aggregate]).
+// Reuses the model's neighbor heap slices.
+func (me *FlatWideModel) Regress(k int, x []uint64) Regression {
+	me.PreallocateHeap(k)
+	return me.RegressInto(k, x, me.Narrow.HeapDistances, me.Narrow.HeapIndices)
+}
+
+// Predicts the target of a single input point from the [Model.Values] of its nearest neighbors (see [Model.Aggregate]),
+// using the given slices for the neighbor heap.
+func (me *FlatWideModel) RegressInto(k int, x []uint64, distances []int, indices []int) Regression {
+	if me.Narrow.TieBreaking != TieBreakingLowestIndex {
+		distances, indices = me.nearestTies(k, x, distances, indices)
+		return me.Narrow.Aggregate(len(indices), distances, indices)
+	}
+	k = me.nearest(k, x, distances, indices)
+	return me.Narrow.Aggregate(k, distances, indices)
+}
+
+// nearest is [NearestFlat], searching shards of the data concurrently if [Model.Workers] > 1,
+// or [NearestFlatCounting] if selected by [Model.Selection].
+func (me *FlatWideModel) nearest(k int, x []uint64, distances []int, indices []int) int {
+	s := me.Stride
+	if workers := me.Narrow.Workers; workers > 1 && len(x) == s {
+		return nearestParallel(me.Len(), k, workers, distances, indices, func(_, _, lo, hi int, distances, indices []int) int {
+			return NearestFlat(me.FlatData[lo*s:hi*s], s, k, x, distances, indices)
+		})
+	}
+	if me.Narrow.Selection.counting(k, s) {
+		return NearestFlatCounting(me.FlatData, s, k, x, distances, indices)
+	}
+	return NearestFlat(me.FlatData, s, k, x, distances, indices)
+}
+
+// nearestOnWorkers is [NearestFlat] in parallel, or [NearestFlatV] if `batch` is set, into the given neighbor heap,
+// searching the shards on the given workers, which are replaced if they can't search enough shards.
+// Returns false without searching unless the model's search is a plain parallel Hamming distance search.
+func (me *FlatWideModel) nearestOnWorkers(workers **shardWorkers, k int, x []uint64, batch []uint32, distances, indices []int) (int, bool) {
+	m, s := me.Narrow, me.Stride
+	if m.Workers <= 1 || m.TieBreaking != TieBreakingLowestIndex || len(x) != s {
+		return 0, false
+	}
+	n := me.Len()
+	shards := parallelShards(n, m.Workers)
+	if batch != nil && k > 0 {
+		shards = min(shards, len(batch)/k)
+	}
+	if shards <= 1 || k == 0 {
+		return 0, false
+	}
+	*workers = shardWorkersFor(*workers, shards)
+	q := shardQuery{n: n, k: k, shards: shards, flatData: me.FlatData, stride: s, wideX: x, batch: batch}
+	return (*workers).nearest(q, distances, indices), true
+}
+
+// nearestTies is [NearestFlatTies] with the model's tie-breaking, searching shards of the data concurrently if [Model.Workers] > 1.
+// Overwrites the given slices, growing them if necessary.
+func (me *FlatWideModel) nearestTies(k int, x []uint64, distances []int, indices []int) ([]int, []int) {
+	m, s := me.Narrow, me.Stride
+	if m.Workers > 1 && len(x) == s {
+		return nearestParallelTies(me.Len(), k, m.Workers, 64*s, m.TieBreaking, m.TieBreakingSeed, distances[:0], indices[:0], func(c *topk.Counting, lo, hi int) {
+			pushNearestFlat(c, me.FlatData[lo*s:hi*s], x)
+		})
+	}
+	return NearestFlatTies(me.FlatData, s, k, x, m.TieBreaking, m.TieBreakingSeed, distances[:0], indices[:0])
+}
+
+// nearestV is [NearestFlatV], searching shards of the data concurrently if [Model.Workers] > 1.
+func (me *FlatWideModel) nearestV(k int, x []uint64, batch []uint32, distances []int, indices []int) int {
+	s := me.Stride
+	if workers := me.Narrow.Workers; workers > 1 && len(x) == s {
+		if k > 0 {
+			workers = min(workers, len(batch)/k)
+		}
+		return nearestParallel(me.Len(), k, workers, distances, indices, func(w, shards, lo, hi int, distances, indices []int) int {
+			b := len(batch) / shards
+			return NearestFlatV(me.FlatData[lo*s:hi*s], s, k, x, batch[w*b:(w+1)*b], distances, indices)
+		})
+	}
+	return NearestFlatV(me.FlatData, s, k, x, batch, distances, indices)
+}
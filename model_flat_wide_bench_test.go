@@ -0,0 +1,67 @@
+package bitknn_test
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/keilerkonzept/bitknn"
+	"github.com/keilerkonzept/bitknn/internal/testrandom"
+	"github.com/keilerkonzept/bitknn/pack"
+)
+
+// Compares the flat layout with a [][]uint64 whose rows are scattered in memory (as when built incrementally),
+// and with one re-allocated by [pack.ReallocateFlat].
+func BenchmarkFlatWideModel(b *testing.B) {
+	for _, dim := range []int{2, 4, 16} {
+		for _, dataSize := range []int{100_000, 1_000_000} {
+			for _, k := range []int{10} {
+				data := testrandom.WideData(dim, dataSize)
+				scattered := slices.Clone(data)
+				testrandom.Source.Shuffle(len(scattered), func(i, j int) {
+					scattered[i], scattered[j] = scattered[j], scattered[i]
+				})
+				contiguous := slices.Clone(scattered)
+				pack.ReallocateFlat(contiguous)
+				query := testrandom.WideQuery(dim)
+				batch := make([]uint32, 1000)
+				scatteredModel := bitknn.FitWide(scattered, nil)
+				contiguousModel := bitknn.FitWide(contiguous, nil)
+				flatModel := bitknn.FitFlatWide(pack.Flatten(scattered), dim, nil)
+				models := []struct {
+					layout string
+					find   func()
+					findV  func()
+				}{
+					{
+						"scattered",
+						func() { scatteredModel.Find(k, query) },
+						func() { scatteredModel.FindV(k, query, batch) },
+					},
+					{
+						"ReallocateFlat",
+						func() { contiguousModel.Find(k, query) },
+						func() { contiguousModel.FindV(k, query, batch) },
+					},
+					{
+						"flat",
+						func() { flatModel.Find(k, query) },
+						func() { flatModel.FindV(k, query, batch) },
+					},
+				}
+				for _, m := range models {
+					b.Run(fmt.Sprintf("Op=Find_layout=%s_bits=%d_N=%d_k=%d", m.layout, dim*64, dataSize, k), func(b *testing.B) {
+						for n := 0; n < b.N; n++ {
+							m.find()
+						}
+					})
+					b.Run(fmt.Sprintf("Op=FindV_layout=%s_bits=%d_N=%d_k=%d", m.layout, dim*64, dataSize, k), func(b *testing.B) {
+						for n := 0; n < b.N; n++ {
+							m.findV()
+						}
+					})
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package bitknn_test
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/keilerkonzept/bitknn"
+	"github.com/keilerkonzept/bitknn/internal/testrandom"
+	"github.com/keilerkonzept/bitknn/pack"
+	"pgregory.net/rapid"
+)
+
+func TestFlatWideModel_EquivWideModel(t *testing.T) {
+	rapid.Check(t, func(t *rapid.T) {
+		dims := rapid.IntRange(1, 10).Draw(t, "dims")
+		data := rapid.SliceOf(rapid.SliceOfN(rapid.Uint64(), dims, dims)).Draw(t, "data")
+		labels := rapid.SliceOfN(rapid.IntRange(0, 3), len(data), len(data)).Draw(t, "labels")
+		k := rapid.IntRange(0, 100).Draw(t, "k")
+		batch := make([]uint32, rapid.IntRange(max(k, 1), 200).Draw(t, "batch"))
+		workers := rapid.IntRange(1, 4).Draw(t, "workers")
+		q := rapid.SliceOfN(rapid.Uint64(), dims, dims).Draw(t, "q")
+
+		wide := bitknn.FitWide(data, labels, bitknn.WithLinearDistanceWeighting())
+		flat := bitknn.FitFlatWide(pack.Flatten(data), dims, labels, bitknn.WithLinearDistanceWeighting(), bitknn.WithWorkers(workers))
+		if flat.Len() != len(data) {
+			t.Fatal("flat model should have as many points as the wide model", flat.Len(), len(data))
+		}
+		for i, d := range data {
+			if diff := cmp.Diff(d, flat.Point(i)); diff != "" {
+				t.Fatal(diff)
+			}
+		}
+
+		wd, wi := wide.Find(k, q)
+		fd, fi := flat.Find(k, q)
+		if diff := cmp.Diff(sortedNeighbors(wd, wi), sortedNeighbors(fd, fi)); diff != "" {
+			t.Fatal("FlatWideModel.Find should find the same neighbors as WideModel.Find", diff)
+		}
+		fd, fi = flat.FindV(k, q, batch)
+		if diff := cmp.Diff(sortedNeighbors(wd, wi), sortedNeighbors(fd, fi)); diff != "" {
+			t.Fatal("FlatWideModel.FindV should find the same neighbors as WideModel.Find", diff)
+		}
+
+		wideVotes, flatVotes := make([]float64, 4), make([]float64, 4)
+		wide.Predict(k, q, bitknn.VoteSlice(wideVotes))
+		flat.Predict(k, q, bitknn.VoteSlice(flatVotes))
+		if diff := cmp.Diff(wideVotes, flatVotes); diff != "" {
+			t.Fatal("FlatWideModel.Predict should vote like WideModel.Predict", diff)
+		}
+		clear(flatVotes)
+		flat.PredictV(k, q, batch, bitknn.VoteSlice(flatVotes))
+		if diff := cmp.Diff(wideVotes, flatVotes); diff != "" {
+			t.Fatal("FlatWideModel.PredictV should vote like WideModel.Predict", diff)
+		}
+	})
+}
+
+func TestNearestFlat_EquivNearestWide(t *testing.T) {
+	rapid.Check(t, func(t *rapid.T) {
+		dims := rapid.IntRange(1, 10).Draw(t, "dims")
+		data := rapid.SliceOf(rapid.SliceOfN(rapid.Uint64(), dims, dims)).Draw(t, "data")
+		k := rapid.IntRange(0, 100).Draw(t, "k")
+		batch := make([]uint32, rapid.IntRange(max(k, 1), 200).Draw(t, "batch"))
+		q := rapid.SliceOfN(rapid.Uint64(), dims, dims).Draw(t, "q")
+		flat := pack.Flatten(data)
+
+		distances, indices := make([]int, k+1), make([]int, k+1)
+		n := bitknn.NearestWide(data, k, q, distances, indices)
+		flatDistances, flatIndices := make([]int, k+1), make([]int, k+1)
+		if m := bitknn.NearestFlat(flat, dims, k, q, flatDistances, flatIndices); m != n {
+			t.Fatal("NearestFlat should find as many neighbors as NearestWide", m, n)
+		}
+		if diff := cmp.Diff([][]int{distances[:n], indices[:n]}, [][]int{flatDistances[:n], flatIndices[:n]}); diff != "" {
+			t.Fatal("NearestFlat should find the same neighbors as NearestWide", diff)
+		}
+		if m := bitknn.NearestFlatV(flat, dims, k, q, batch, flatDistances, flatIndices); m != n {
+			t.Fatal("NearestFlatV should find as many neighbors as NearestWide", m, n)
+		}
+		if diff := cmp.Diff([][]int{distances[:n], indices[:n]}, [][]int{flatDistances[:n], flatIndices[:n]}); diff != "" {
+			t.Fatal("NearestFlatV should find the same neighbors as NearestWide", diff)
+		}
+	})
+}
+
+func TestFlatWideModel_QueryLength(t *testing.T) {
+	rapid.Check(t, func(t *rapid.T) {
+		dims := rapid.IntRange(1, 4).Draw(t, "dims")
+		data := testrandom.WideData(dims, rapid.IntRange(1, 3000).Draw(t, "size"))
+		k := rapid.IntRange(1, 20).Draw(t, "k")
+		tieBreaking := rapid.SampledFrom(tieBreakings).Draw(t, "tieBreaking")
+		workers := rapid.IntRange(1, 4).Draw(t, "workers")
+		// A query one word short or long would read misaligned data points.
+		q := testrandom.WideQuery(dims + rapid.SampledFrom([]int{-1, 1}).Draw(t, "offset"))
+		flat := bitknn.FitFlatWide(pack.Flatten(data), dims, nil, bitknn.WithTieBreaking(tieBreaking), bitknn.WithWorkers(workers))
+
+		if distances, indices := flat.Find(k, q); len(distances) != 0 || len(indices) != 0 {
+			t.Fatal("FlatWideModel.Find should find no neighbors", distances, indices)
+		}
+		if distances, indices := flat.FindV(k, q, make([]uint32, k)); len(distances) != 0 || len(indices) != 0 {
+			t.Fatal("FlatWideModel.FindV should find no neighbors", distances, indices)
+		}
+		votes := make(bitknn.VoteMap)
+		if n := flat.Predict(k, q, votes); n != 0 || len(votes) != 0 {
+			t.Fatal("FlatWideModel.Predict should find no neighbors", n, votes)
+		}
+		distances, indices := make([]int, k+1), make([]int, k+1)
+		if n := bitknn.NearestFlat(pack.Flatten(data), dims, k, q, distances, indices); n != 0 {
+			t.Fatal("NearestFlat should find no neighbors", n)
+		}
+	})
+}
+
+func TestFlatWideModel_Workers(t *testing.T) {
+	const dims, k = 3, 50
+	data := testrandom.WideData(dims, 5000)
+	q := testrandom.WideQuery(dims)
+	batch := make([]uint32, 400)
+	wide := bitknn.FitWide(data, nil)
+	flat := bitknn.FitFlatWide(pack.Flatten(data), dims, nil, bitknn.WithWorkers(4))
+
+	wd, wi := wide.Find(k, q)
+	fd, fi := flat.Find(k, q)
+	if diff := cmp.Diff(sortedNeighbors(wd, wi), sortedNeighbors(fd, fi)); diff != "" {
+		t.Fatal(diff)
+	}
+	fd, fi = flat.FindV(k, q, batch)
+	if diff := cmp.Diff(sortedNeighbors(wd, wi), sortedNeighbors(fd, fi)); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func TestFitFlatWide_RejectsUnsupportedOptions(t *testing.T) {
+	data := []uint64{0b0000, 0b1111}
+	for name, opt := range map[string]bitknn.Option{
+		"BitWeights":    bitknn.WithBitWeights(bitknn.ByteWeights([]int{1, 2, 3, 4, 5, 6, 7, 8})),
+		"WideDataMasks": bitknn.WithWideDataMasks([][]uint64{{1}, {1}}),
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatal("FitFlatWide should panic with", name)
+				}
+			}()
+			bitknn.FitFlatWide(data, 1, nil, opt)
+		}()
+	}
+}
+
+func TestFitFlatWide_RejectsInvalidLayout(t *testing.T) {
+	for name, fit := range map[string]func(){
+		"zero stride":     func() { bitknn.FitFlatWide([]uint64{1, 2}, 0, nil) },
+		"negative stride": func() { bitknn.FitFlatWide([]uint64{1, 2}, -1, nil) },
+		"ragged data":     func() { bitknn.FitFlatWide([]uint64{1, 2, 3}, 2, nil) },
+		"too few labels":  func() { bitknn.FitFlatWide([]uint64{1, 2, 3, 4}, 2, []int{0}) },
+		"too many labels": func() { bitknn.FitFlatWide([]uint64{1, 2, 3, 4}, 2, []int{0, 1, 0}) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatal("FitFlatWide should panic with", name)
+				}
+			}()
+			fit()
+		}()
+	}
+}
@@ -0,0 +1,144 @@
+package bitknn
+
+import (
+	"math/bits"
+	"math/rand/v2"
+
+	"github.com/keilerkonzept/bitknn/internal/heap"
+	"github.com/keilerkonzept/bitknn/internal/slice"
+)
+
+// Seed for the bit-sampling masks drawn by [FitLSH].
+const lshSeed = 0xB17C
+
+// Create an approximate k-NN model for the given data points and labels.
+// The points are indexed in `tables` hash tables, each keyed by `bitsPerTable` randomly sampled bits.
+// More tables increase recall; more bits per table make buckets smaller and queries faster.
+func FitLSH(data []uint64, labels []int, tables int, bitsPerTable int, opts ...Option) *LSHModel {
+	return FitLSHMasks(data, labels, BitSampleMasks(tables, bitsPerTable, lshSeed), opts...)
+}
+
+// Create an approximate k-NN model for the given data points and labels.
+// Each mask defines one hash table, keyed by the bits of a point selected by the mask.
+func FitLSHMasks(data []uint64, labels []int, masks []uint64, opts ...Option) *LSHModel {
+	m := &LSHModel{
+		Narrow:       Fit(data, labels, opts...),
+		Masks:        masks,
+		TableIndices: make([][]int, len(masks)),
+		Buckets:      make([]map[uint64]slice.IndexRange, len(masks)),
+	}
+	for t, mask := range masks {
+		m.TableIndices[t], m.Buckets[t] = bucketIndices(len(data), func(i int) uint64 {
+			return data[i] & mask
+		})
+	}
+	return m
+}
+
+// BitSampleMasks returns `tables` masks with `bitsPerTable` distinct bits set in each, drawn using the given seed.
+func BitSampleMasks(tables int, bitsPerTable int, seed uint64) []uint64 {
+	rng := rand.New(rand.NewPCG(seed, seed))
+	bitsPerTable = min(max(bitsPerTable, 0), 64)
+	masks := make([]uint64, tables)
+	for t := range masks {
+		for _, b := range rng.Perm(64)[:bitsPerTable] {
+			masks[t] |= 1 << b
+		}
+	}
+	return masks
+}
+
+// An approximate k-NN model for uint64s, using bit-sampling locality-sensitive hashing.
+// Queries only scan the points sharing a bucket with the query point in at least one table.
+//
+// Queries are searched sequentially regardless of [Model.Workers], and [Model.TieBreaking] is ignored:
+// of several candidates at the k-th nearest distance, those found first are returned.
+// The candidates are compared by the plain Hamming distance, ignoring [Model.BitWeights] and [Model.DataMasks],
+// and always selected with a heap, ignoring [Model.Selection].
+// The neighbors are sorted if [Model.Sorted] is set.
+type LSHModel struct {
+	Narrow *Model
+
+	// Bit-sampling masks, one per hash table.
+	Masks []uint64
+	// Indices of the data points for each table, grouped by bucket.
+	TableIndices [][]int
+	// Bucket ranges in [LSHModel.TableIndices] for each table, by bucket key.
+	Buckets []map[uint64]slice.IndexRange
+}
+
+func (me *LSHModel) PreallocateHeap(k int) {
+	me.Narrow.PreallocateHeap(k)
+}
+
+// Finds the (approximate) nearest neighbors of the given point.
+// Writes their distances and indices in the dataset into the pre-allocated slices.
+// Returns the distance and index slices, truncated to the actual number of neighbors found.
+func (me *LSHModel) Find(k int, x uint64) ([]int, []int) {
+	me.PreallocateHeap(k)
+	return me.FindInto(k, x, me.Narrow.HeapDistances, me.Narrow.HeapIndices)
+}
+
+// Finds the (approximate) nearest neighbors of the given point.
+// Writes their distances and indices in the dataset into the provided slices.
+// The slices should be pre-allocated to length k+1.
+// Returns the distance and index slices, truncated to the actual number of neighbors found.
+func (me *LSHModel) FindInto(k int, x uint64, distances []int, indices []int) ([]int, []int) {
+	k = me.nearest(k, x, distances, indices)
+	return me.Narrow.sort(distances[:k], indices[:k])
+}
+
+// Predicts the label of a single input point. Each call allocates two new slices of length K+1 for the neighbor heap.
+func (me *LSHModel) PredictAlloc(k int, x uint64, votes VoteCounter) {
+	distances, indices := make([]int, k+1), make([]int, k+1)
+	me.PredictInto(k, x, distances, indices, votes)
+}
+
+// Predicts the label of a single input point. Reuses two slices of length K+1 for the neighbor heap.
+func (me *LSHModel) Predict(k int, x uint64, votes VoteCounter) {
+	me.PreallocateHeap(k)
+	me.PredictInto(k, x, me.Narrow.HeapDistances, me.Narrow.HeapIndices, votes)
+}
+
+// Predicts the label of a single input point, using the given slices for the neighbor heap.
+func (me *LSHModel) PredictInto(k int, x uint64, distances []int, indices []int, votes VoteCounter) {
+	k = me.nearest(k, x, distances, indices)
+	me.Narrow.Vote(k, distances, indices, votes)
+}
+
+// nearest is [Nearest], restricted to the buckets matching `x`.
+// A point found in several tables is only considered in the first one.
+func (me *LSHModel) nearest(k int, x uint64, distances, indices []int) int {
+	if k == 0 {
+		return 0
+	}
+	heap := heap.MakeMax(distances, indices)
+	distance0 := &distances[0]
+	data := me.Narrow.Data
+
+	for t, mask := range me.Masks {
+		bucket, ok := me.Buckets[t][x&mask]
+		if !ok {
+			continue
+		}
+	candidates:
+		for _, i := range me.TableIndices[t][bucket.Offset : bucket.Offset+bucket.Length] {
+			d := data[i]
+			for _, previous := range me.Masks[:t] {
+				if (x^d)&previous == 0 {
+					continue candidates
+				}
+			}
+			dist := bits.OnesCount64(x ^ d)
+			if heap.Len() < k {
+				heap.Push(dist, i)
+				continue
+			}
+			if dist >= *distance0 {
+				continue
+			}
+			heap.PushPop(dist, i)
+		}
+	}
+	return heap.Len()
+}
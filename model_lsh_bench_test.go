@@ -0,0 +1,42 @@
+package bitknn_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/keilerkonzept/bitknn"
+	"github.com/keilerkonzept/bitknn/internal/testrandom"
+)
+
+func BenchmarkLSHModel(b *testing.B) {
+	type bench struct {
+		dataSize     []int
+		k            []int
+		tables       []int
+		bitsPerTable []int
+	}
+	benches := []bench{
+		{dataSize: []int{1000, 1_000_000}, k: []int{3, 10, 100}, tables: []int{4, 16}, bitsPerTable: []int{8, 16}},
+	}
+	for _, bench := range benches {
+		for _, dataSize := range bench.dataSize {
+			data := testrandom.Data(dataSize)
+			labels := testrandom.Labels(dataSize)
+			query := testrandom.Query()
+			for _, tables := range bench.tables {
+				for _, bitsPerTable := range bench.bitsPerTable {
+					model := bitknn.FitLSH(data, labels, tables, bitsPerTable)
+					for _, k := range bench.k {
+						b.Run(fmt.Sprintf("Op=Find_bits=64_N=%d_k=%d_tables=%d_bitsPerTable=%d", dataSize, k, tables, bitsPerTable), func(b *testing.B) {
+							model.PreallocateHeap(k)
+							b.ResetTimer()
+							for n := 0; n < b.N; n++ {
+								model.Find(k, query)
+							}
+						})
+					}
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package bitknn_test
+
+import (
+	"math/bits"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/keilerkonzept/bitknn"
+	"pgregory.net/rapid"
+)
+
+func TestLSHModel_SingleBucketEquivNearest(t *testing.T) {
+	rapid.Check(t, func(t *rapid.T) {
+		k := rapid.IntRange(0, 100).Draw(t, "k")
+		data := rapid.SliceOf(rapid.Uint64()).Draw(t, "data")
+		tables := rapid.IntRange(1, 4).Draw(t, "tables")
+		q := rapid.Uint64().Draw(t, "q")
+
+		model := bitknn.FitLSH(data, nil, tables, 0)
+		ld, _ := model.Find(k, q)
+
+		distances, indices := make([]int, k+1), make([]int, k+1)
+		n := bitknn.Nearest(data, k, q, distances, indices)
+
+		ld = slices.Clone(ld)
+		slices.Sort(ld)
+		slices.Sort(distances[:n])
+		if !reflect.DeepEqual(ld, distances[:n]) {
+			t.Fatal(ld, distances[:n])
+		}
+	})
+}
+
+func TestLSHModel_Find(t *testing.T) {
+	rapid.Check(t, func(t *rapid.T) {
+		k := rapid.IntRange(1, 100).Draw(t, "k")
+		data := rapid.SliceOfN(rapid.Uint64(), 1, 1000).Draw(t, "data")
+		tables := rapid.IntRange(1, 8).Draw(t, "tables")
+		bitsPerTable := rapid.IntRange(1, 16).Draw(t, "bitsPerTable")
+		j := rapid.IntRange(0, len(data)-1).Draw(t, "j")
+		q := data[j]
+
+		model := bitknn.FitLSH(data, nil, tables, bitsPerTable)
+		ld, li := model.Find(k, q)
+
+		distances, indices := make([]int, k+1), make([]int, k+1)
+		n := bitknn.Nearest(data, k, q, distances, indices)
+
+		if len(ld) > n {
+			t.Fatal("LSH should not find more neighbors than exist", len(ld), n)
+		}
+		if !slices.Contains(ld, 0) {
+			t.Fatal("LSH should find the query point itself", ld)
+		}
+		seen := make(map[int]bool)
+		for i, index := range li {
+			if seen[index] {
+				t.Fatal("LSH should not return duplicate neighbors", li)
+			}
+			seen[index] = true
+			if ld[i] != bits.OnesCount64(q^data[index]) {
+				t.Fatal("LSH should return correct distances", ld[i], index)
+			}
+		}
+		ld = slices.Clone(ld)
+		slices.Sort(ld)
+		slices.Sort(distances[:n])
+		for i := range ld {
+			if ld[i] < distances[i] {
+				t.Fatal("LSH should not find nearer neighbors than the exact search", ld, distances[:n])
+			}
+		}
+	})
+}
+
+func TestLSHModel_Predict(t *testing.T) {
+	data := []uint64{0b0000, 0b1111, 0b0011, 0b0101}
+	labels := []int{0, 1, 1, 0}
+	values := []float64{1.0, 2.0, 3.0, 4.0}
+	k := 2
+
+	model := bitknn.FitLSH(data, labels, 2, 0, bitknn.WithValues(values))
+	x := uint64(0b0010)
+	votes := make([]float64, 2)
+	model.Predict(k, x, bitknn.VoteSlice(votes))
+	expectedVotes := []float64{1, 3}
+	if !reflect.DeepEqual(expectedVotes, votes) {
+		t.Fatal(expectedVotes, votes)
+	}
+	clear(votes)
+	model.PredictAlloc(k, x, bitknn.VoteSlice(votes))
+	if !reflect.DeepEqual(expectedVotes, votes) {
+		t.Fatal(expectedVotes, votes)
+	}
+	clear(votes)
+	model.Predict(0, x, bitknn.VoteSlice(votes))
+	if !reflect.DeepEqual([]float64{0, 0}, votes) {
+		t.Fatal(votes)
+	}
+}
+
+func TestBitSampleMasks(t *testing.T) {
+	rapid.Check(t, func(t *rapid.T) {
+		tables := rapid.IntRange(0, 100).Draw(t, "tables")
+		bitsPerTable := rapid.IntRange(-1, 65).Draw(t, "bitsPerTable")
+		seed := rapid.Uint64().Draw(t, "seed")
+		masks := bitknn.BitSampleMasks(tables, bitsPerTable, seed)
+		if len(masks) != tables {
+			t.Fatal(len(masks))
+		}
+		for _, mask := range masks {
+			if bits.OnesCount64(mask) != min(max(bitsPerTable, 0), 64) {
+				t.Fatal(mask)
+			}
+		}
+		if !reflect.DeepEqual(masks, bitknn.BitSampleMasks(tables, bitsPerTable, seed)) {
+			t.Fatal("masks should be deterministic for a given seed")
+		}
+	})
+}
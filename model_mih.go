@@ -0,0 +1,193 @@
+package bitknn
+
+import (
+	"math/bits"
+
+	"github.com/keilerkonzept/bitknn/internal/heap"
+	"github.com/keilerkonzept/bitknn/internal/slice"
+)
+
+// Create an exact k-NN model for the given data points and labels, using multi-index hashing.
+// Each point is split into `substrings` disjoint bit ranges, each indexed in its own hash table.
+// A good choice for the number of substrings is about 64/log2(len(data)).
+// Panics if the options set [Model.BitWeights] or [Model.DataMasks], since the tables only certify plain Hamming distances.
+func FitMIH(data []uint64, labels []int, substrings int, opts ...Option) *MIHModel {
+	m := &MIHModel{
+		Narrow:       Fit(data, labels, opts...),
+		Masks:        SubstringMasks(64, substrings),
+		TableIndices: make([][]int, substrings),
+		Buckets:      make([]map[uint64]slice.IndexRange, substrings),
+	}
+	if m.Narrow.BitWeights != nil || m.Narrow.DataMasks != nil {
+		panic("bitknn: FitMIH doesn't support bit weights or data masks")
+	}
+	for t, mask := range m.Masks {
+		m.TableIndices[t], m.Buckets[t] = bucketIndices(len(data), func(i int) uint64 {
+			return data[i] & mask
+		})
+	}
+	return m
+}
+
+// SubstringMasks splits the lowest `bits` bits of a uint64 into `substrings` contiguous, disjoint masks of (almost) equal width.
+func SubstringMasks(bits int, substrings int) []uint64 {
+	masks := make([]uint64, substrings)
+	offset := 0
+	for t := range masks {
+		width := bits / substrings
+		if t < bits%substrings {
+			width++
+		}
+		masks[t] = (1<<width - 1) << offset
+		offset += width
+	}
+	return masks
+}
+
+// An exact k-NN model for uint64s, using multi-index hashing.
+//
+// By the pigeonhole principle, a point within distance `r` of the query matches the query within
+// distance `r/m` on at least one of the `m` substrings. Queries search the substring tables at increasing radii,
+// until the k nearest neighbors are certified.
+//
+// The tables are searched sequentially regardless of [Model.Workers], and return the same neighbors as [Model.Find]:
+// of several neighbors at the k-th nearest distance, those with the lowest indices.
+// Unless [Model.TieBreaking] is [TieBreakingLowestIndex], the queries are instead searched like by [Model.Find], without the tables.
+// The neighbors are sorted if [Model.Sorted] is set.
+type MIHModel struct {
+	Narrow *Model
+
+	// Substring masks, one per hash table.
+	Masks []uint64
+	// Indices of the data points for each table, grouped by bucket.
+	TableIndices [][]int
+	// Bucket ranges in [MIHModel.TableIndices] for each table, by bucket key (the masked data point).
+	Buckets []map[uint64]slice.IndexRange
+}
+
+func (me *MIHModel) PreallocateHeap(k int) {
+	me.Narrow.PreallocateHeap(k)
+}
+
+// Finds the nearest neighbors of the given point.
+// Writes their distances and indices in the dataset into the pre-allocated slices.
+// Returns the distance and index slices, truncated to the actual number of neighbors found.
+func (me *MIHModel) Find(k int, x uint64) ([]int, []int) {
+	me.PreallocateHeap(k)
+	return me.FindInto(k, x, me.Narrow.HeapDistances, me.Narrow.HeapIndices)
+}
+
+// Finds the nearest neighbors of the given point.
+// Writes their distances and indices in the dataset into the provided slices.
+// The slices should be pre-allocated to length k+1.
+// Returns the distance and index slices, truncated to the actual number of neighbors found.
+// With [TieBreakingIncludeAll], the slices are grown if there are more than k neighbors.
+func (me *MIHModel) FindInto(k int, x uint64, distances []int, indices []int) ([]int, []int) {
+	if me.Narrow.TieBreaking != TieBreakingLowestIndex {
+		return me.Narrow.sort(me.Narrow.nearestTies(k, x, distances, indices))
+	}
+	k = me.nearest(k, x, distances, indices)
+	return me.Narrow.sort(distances[:k], indices[:k])
+}
+
+// Predicts the label of a single input point. Each call allocates two new slices of length K+1 for the neighbor heap.
+func (me *MIHModel) PredictAlloc(k int, x uint64, votes VoteCounter) {
+	distances, indices := make([]int, k+1), make([]int, k+1)
+	me.PredictInto(k, x, distances, indices, votes)
+}
+
+// Predicts the label of a single input point. Reuses two slices of length K+1 for the neighbor heap.
+func (me *MIHModel) Predict(k int, x uint64, votes VoteCounter) {
+	me.PreallocateHeap(k)
+	me.PredictInto(k, x, me.Narrow.HeapDistances, me.Narrow.HeapIndices, votes)
+}
+
+// Predicts the label of a single input point, using the given slices for the neighbor heap.
+func (me *MIHModel) PredictInto(k int, x uint64, distances []int, indices []int, votes VoteCounter) {
+	if me.Narrow.TieBreaking != TieBreakingLowestIndex {
+		distances, indices = me.Narrow.nearestTies(k, x, distances, indices)
+		k = len(indices)
+	} else {
+		k = me.nearest(k, x, distances, indices)
+	}
+	me.Narrow.Vote(k, distances, indices, votes)
+}
+
+// Approximate costs of a table lookup and of a candidate check, relative to a distance computation in [Nearest].
+const (
+	mihLookupCost    = 128
+	mihCandidateCost = 16
+)
+
+// Number of substring keys of a wide query kept on the stack during the search; more are allocated.
+const mihStackKeys = 16
+
+// nearest is [Nearest], using the substring tables.
+// Falls back to [Model.nearest] once the search is estimated to be more expensive than a linear scan.
+func (me *MIHModel) nearest(k int, x uint64, distances, indices []int) int {
+	data := me.Narrow.Data
+	k = min(k, len(data))
+	m := len(me.Masks)
+	if k == 0 || m == 0 {
+		return me.Narrow.nearest(k, x, distances, indices)
+	}
+	heap := heap.MakeMax(distances, indices)
+	distance0 := &distances[0]
+
+	cost := uint64(0)
+	for s := 0; s <= 64; s++ {
+		for _, mask := range me.Masks {
+			cost += mihLookupCost * binomial(bits.OnesCount64(mask), s)
+		}
+		if cost > uint64(len(data)) {
+			return me.Narrow.nearest(k, x, distances, indices)
+		}
+		for t, mask := range me.Masks {
+			width := bits.OnesCount64(mask)
+			if s > width {
+				continue
+			}
+			shift := bits.TrailingZeros64(mask)
+			key := x & mask
+			flip := uint64(1)<<s - 1
+			for n := binomial(width, s); n > 0; n-- {
+				bucket, ok := me.Buckets[t][key^(flip<<shift)]
+				if n > 1 {
+					flip = nextCombination(flip)
+				}
+				if !ok {
+					continue
+				}
+				cost += mihCandidateCost * uint64(bucket.Length)
+				if cost > uint64(len(data)) {
+					return me.Narrow.nearest(k, x, distances, indices)
+				}
+			candidates:
+				for _, i := range me.TableIndices[t][bucket.Offset : bucket.Offset+bucket.Length] {
+					z := x ^ data[i]
+					// skip points already found at a smaller radius, or in an earlier table at this radius
+					for u, other := range me.Masks {
+						if d := bits.OnesCount64(z & other); d < s || (d == s && u < t) {
+							continue candidates
+						}
+					}
+					dist := bits.OnesCount64(z)
+					if heap.Len() < k {
+						heap.Push(dist, i)
+						continue
+					}
+					// candidates aren't found in index order, so ties at the k-th nearest distance are resolved by the heap
+					if dist > *distance0 {
+						continue
+					}
+					heap.PushPop(dist, i)
+				}
+			}
+		}
+		// all points within distance m*(s+1)-1 have been found
+		if heap.Len() == k && *distance0 < m*(s+1) {
+			break
+		}
+	}
+	return heap.Len()
+}
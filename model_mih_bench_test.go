@@ -0,0 +1,75 @@
+package bitknn_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/keilerkonzept/bitknn"
+	"github.com/keilerkonzept/bitknn/internal/testrandom"
+	"github.com/keilerkonzept/bitknn/pack"
+)
+
+func BenchmarkMIHModel(b *testing.B) {
+	type bench struct {
+		dataSize   []int
+		k          []int
+		substrings []int
+	}
+	benches := []bench{
+		{dataSize: []int{1000}, k: []int{3, 10}, substrings: []int{8}},
+		{dataSize: []int{1_000_000}, k: []int{3, 10, 100}, substrings: []int{3, 4}},
+	}
+	for _, bench := range benches {
+		for _, dataSize := range bench.dataSize {
+			data := testrandom.Data(dataSize)
+			labels := testrandom.Labels(dataSize)
+			query := testrandom.Query()
+			for _, substrings := range bench.substrings {
+				model := bitknn.FitMIH(data, labels, substrings)
+				for _, k := range bench.k {
+					b.Run(fmt.Sprintf("Op=Find_bits=64_N=%d_k=%d_substrings=%d", dataSize, k, substrings), func(b *testing.B) {
+						model.PreallocateHeap(k)
+						b.ResetTimer()
+						for n := 0; n < b.N; n++ {
+							model.Find(k, query)
+						}
+					})
+				}
+			}
+		}
+	}
+}
+
+func BenchmarkWideMIHModel(b *testing.B) {
+	type bench struct {
+		dim        []int
+		dataSize   []int
+		k          []int
+		substrings []int
+	}
+	benches := []bench{
+		{dim: []int{2, 16}, dataSize: []int{1000, 1_000_000}, k: []int{3, 10, 100}, substrings: []int{8, 16}},
+	}
+	for _, bench := range benches {
+		for _, dim := range bench.dim {
+			for _, dataSize := range bench.dataSize {
+				data := testrandom.WideData(dim, dataSize)
+				pack.ReallocateFlat(data)
+				labels := testrandom.Labels(dataSize)
+				query := testrandom.WideQuery(dim)
+				for _, substrings := range bench.substrings {
+					model := bitknn.FitWideMIH(data, labels, substrings)
+					for _, k := range bench.k {
+						b.Run(fmt.Sprintf("Op=Find_bits=%d_N=%d_k=%d_substrings=%d", dim*64, dataSize, k, substrings), func(b *testing.B) {
+							model.PreallocateHeap(k)
+							b.ResetTimer()
+							for n := 0; n < b.N; n++ {
+								model.Find(k, query)
+							}
+						})
+					}
+				}
+			}
+		}
+	}
+}
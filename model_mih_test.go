@@ -0,0 +1,166 @@
+package bitknn_test
+
+import (
+	"math/bits"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/keilerkonzept/bitknn"
+	"pgregory.net/rapid"
+)
+
+// clusteredData draws points close to a few random centers, so that exact indices can certify neighbors at small radii.
+func clusteredData(t *rapid.T, dims int) [][]uint64 {
+	centers := rapid.SliceOfN(rapid.SliceOfN(rapid.Uint64(), dims, dims), 1, 8).Draw(t, "centers")
+	n := rapid.IntRange(0, 2000).Draw(t, "n")
+	data := make([][]uint64, n)
+	for i := range data {
+		c := centers[rapid.IntRange(0, len(centers)-1).Draw(t, "center")]
+		data[i] = slices.Clone(c)
+		for range rapid.IntRange(0, 8).Draw(t, "flips") {
+			b := rapid.IntRange(0, 64*dims-1).Draw(t, "bit")
+			data[i][b/64] ^= 1 << (b % 64)
+		}
+	}
+	return data
+}
+
+func TestMIHModel_EquivNearest(t *testing.T) {
+	rapid.Check(t, func(t *rapid.T) {
+		k := rapid.IntRange(0, 100).Draw(t, "k")
+		substrings := rapid.IntRange(1, 16).Draw(t, "substrings")
+		var data []uint64
+		for _, d := range clusteredData(t, 1) {
+			data = append(data, d[0])
+		}
+		data = append(data, rapid.SliceOf(rapid.Uint64()).Draw(t, "random")...)
+		q := rapid.Uint64().Draw(t, "q")
+		if len(data) > 0 && rapid.Bool().Draw(t, "near") {
+			q = data[rapid.IntRange(0, len(data)-1).Draw(t, "j")] ^ 0b101
+		}
+
+		model := bitknn.FitMIH(data, nil, substrings)
+		md, mi := model.Find(k, q)
+
+		distances, indices := make([]int, k+1), make([]int, k+1)
+		n := bitknn.Nearest(data, k, q, distances, indices)
+		if len(md) != n {
+			t.Fatal("MIH should find as many neighbors as the exact search", len(md), n)
+		}
+		seen := make(map[int]bool)
+		for i, index := range mi {
+			if seen[index] {
+				t.Fatal("MIH should not return duplicate neighbors", mi)
+			}
+			seen[index] = true
+			if md[i] != bits.OnesCount64(q^data[index]) {
+				t.Fatal("MIH should return correct distances", md[i], index)
+			}
+		}
+		bitknn.SortNeighbors(md, mi)
+		bitknn.SortNeighbors(distances[:n], indices[:n])
+		if !reflect.DeepEqual(md, distances[:n]) || !reflect.DeepEqual(mi, indices[:n]) {
+			t.Fatal(md, distances[:n], mi, indices[:n])
+		}
+	})
+}
+
+func TestMIHModel_Options(t *testing.T) {
+	rapid.Check(t, func(t *rapid.T) {
+		k := rapid.IntRange(0, 50).Draw(t, "k")
+		substrings := rapid.IntRange(1, 16).Draw(t, "substrings")
+		dims := rapid.IntRange(1, 2).Draw(t, "dims")
+		wideData := clusteredData(t, dims)
+		tieBreaking := rapid.SampledFrom(tieBreakings).Draw(t, "tieBreaking")
+		opts := []bitknn.Option{bitknn.WithTieBreaking(tieBreaking), bitknn.WithSorted()}
+		q := slices.Clone(rapid.SampledFrom(append(wideData, make([]uint64, dims))).Draw(t, "q"))
+		q[0] ^= 0b101
+
+		finds := map[string][2]func() ([]int, []int){
+			"WideMIHModel": {
+				func() ([]int, []int) { return bitknn.FitWide(wideData, nil, opts...).Find(k, q) },
+				func() ([]int, []int) { return bitknn.FitWideMIH(wideData, nil, substrings, opts...).Find(k, q) },
+			},
+		}
+		if dims == 1 {
+			data := make([]uint64, len(wideData))
+			for i, d := range wideData {
+				data[i] = d[0]
+			}
+			finds["MIHModel"] = [2]func() ([]int, []int){
+				func() ([]int, []int) { return bitknn.Fit(data, nil, opts...).Find(k, q[0]) },
+				func() ([]int, []int) { return bitknn.FitMIH(data, nil, substrings, opts...).Find(k, q[0]) },
+			}
+		}
+		for name, find := range finds {
+			expectedDistances, expectedIndices := find[0]()
+			distances, indices := find[1]()
+			if !slices.IsSorted(distances) {
+				t.Fatal(name, "should sort the neighbors", distances)
+			}
+			if !reflect.DeepEqual(expectedDistances, distances) || !reflect.DeepEqual(expectedIndices, indices) {
+				t.Fatal(name, expectedDistances, distances, expectedIndices, indices)
+			}
+		}
+	})
+}
+
+func TestFitMIH_RejectsWeightsAndMasks(t *testing.T) {
+	data := []uint64{0b0000, 0b1111}
+	for name, opt := range map[string]bitknn.Option{
+		"BitWeights": bitknn.WithBitWeights(bitknn.ByteWeights([]int{1, 2, 3, 4, 5, 6, 7, 8})),
+		"DataMasks":  bitknn.WithDataMasks([]uint64{1, 1}),
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatal("FitMIH should panic with", name)
+				}
+			}()
+			bitknn.FitMIH(data, nil, 4, opt)
+		}()
+	}
+}
+
+func TestMIHModel_Predict(t *testing.T) {
+	data := []uint64{0b0000, 0b1111, 0b0011, 0b0101}
+	labels := []int{0, 1, 1, 0}
+	values := []float64{1.0, 2.0, 3.0, 4.0}
+	k := 2
+
+	model := bitknn.FitMIH(data, labels, 4, bitknn.WithValues(values))
+	x := uint64(0b0010)
+	votes := make([]float64, 2)
+	expectedVotes := []float64{1, 3}
+
+	model.Predict(k, x, bitknn.VoteSlice(votes))
+	if !reflect.DeepEqual(expectedVotes, votes) {
+		t.Fatal(expectedVotes, votes)
+	}
+	model.PredictAlloc(k, x, bitknn.VoteSlice(votes))
+	if !reflect.DeepEqual(expectedVotes, votes) {
+		t.Fatal(expectedVotes, votes)
+	}
+}
+
+func TestSubstringMasks(t *testing.T) {
+	rapid.Check(t, func(t *rapid.T) {
+		n := rapid.IntRange(1, 64).Draw(t, "bits")
+		substrings := rapid.IntRange(1, 64).Draw(t, "substrings")
+		masks := bitknn.SubstringMasks(n, substrings)
+		union := uint64(0)
+		for _, mask := range masks {
+			if union&mask != 0 {
+				t.Fatal("substring masks should be disjoint", masks)
+			}
+			union |= mask
+			if w := bits.OnesCount64(mask); w < n/substrings || w > n/substrings+1 {
+				t.Fatal("substring masks should have almost equal widths", masks)
+			}
+		}
+		if union != 1<<n-1 {
+			t.Fatal("substring masks should cover all bits", masks)
+		}
+	})
+}
@@ -0,0 +1,207 @@
+package bitknn
+
+import (
+	"math/bits"
+
+	"github.com/keilerkonzept/bitknn/internal/heap"
+	"github.com/keilerkonzept/bitknn/internal/slice"
+)
+
+// Create an exact k-NN model for the given wide data points and labels, using multi-index hashing.
+// Each point is split into `substrings` disjoint bit ranges, each indexed in its own hash table.
+// Substrings are at most 64 bits wide, so `substrings` is rounded up to the number of words per data point.
+// Panics if the options set [Model.BitWeights] or [Model.WideDataMasks], as [FitMIH].
+func FitWideMIH(data [][]uint64, labels []int, substrings int, opts ...Option) *WideMIHModel {
+	words := 0
+	if len(data) > 0 {
+		words = len(data[0])
+	}
+	substrings = max(substrings, words)
+	m := &WideMIHModel{
+		Wide:         FitWide(data, labels, opts...),
+		Ranges:       SubstringRanges(64*words, substrings),
+		TableIndices: make([][]int, substrings),
+		Buckets:      make([]map[uint64]slice.IndexRange, substrings),
+	}
+	if m.Wide.Narrow.BitWeights != nil || m.Wide.Narrow.WideDataMasks != nil {
+		panic("bitknn: FitWideMIH doesn't support bit weights or data masks")
+	}
+	for t, r := range m.Ranges {
+		m.TableIndices[t], m.Buckets[t] = bucketIndices(len(data), func(i int) uint64 {
+			return r.Of(data[i])
+		})
+	}
+	return m
+}
+
+// A contiguous range of bits in a wide data point.
+type BitRange struct {
+	Offset int
+	Width  int
+}
+
+// Of returns the bits of `x` in the range, for ranges of width <= 64.
+func (me BitRange) Of(x []uint64) uint64 {
+	if me.Width == 0 {
+		return 0
+	}
+	w, b := me.Offset/64, me.Offset%64
+	v := x[w] >> b
+	if b+me.Width > 64 {
+		v |= x[w+1] << (64 - b)
+	}
+	if me.Width < 64 {
+		v &= 1<<me.Width - 1
+	}
+	return v
+}
+
+// SubstringRanges splits `bits` bits into `substrings` contiguous, disjoint ranges of (almost) equal width.
+func SubstringRanges(bits int, substrings int) []BitRange {
+	ranges := make([]BitRange, substrings)
+	offset := 0
+	for t := range ranges {
+		width := bits / substrings
+		if t < bits%substrings {
+			width++
+		}
+		ranges[t] = BitRange{Offset: offset, Width: width}
+		offset += width
+	}
+	return ranges
+}
+
+// An exact k-NN model for slices of uint64s, using multi-index hashing.
+// See [MIHModel], also for how the [Model] options apply to it.
+type WideMIHModel struct {
+	Wide *WideModel
+
+	// Substring bit ranges, one per hash table.
+	Ranges []BitRange
+	// Indices of the data points for each table, grouped by bucket.
+	TableIndices [][]int
+	// Bucket ranges in [WideMIHModel.TableIndices] for each table, by bucket key (the substring of the data point).
+	Buckets []map[uint64]slice.IndexRange
+}
+
+func (me *WideMIHModel) PreallocateHeap(k int) {
+	me.Wide.PreallocateHeap(k)
+}
+
+// Finds the nearest neighbors of the given point.
+// Writes their distances and indices in the dataset into the pre-allocated slices.
+// Returns the distance and index slices, truncated to the actual number of neighbors found.
+func (me *WideMIHModel) Find(k int, x []uint64) ([]int, []int) {
+	me.PreallocateHeap(k)
+	return me.FindInto(k, x, me.Wide.Narrow.HeapDistances, me.Wide.Narrow.HeapIndices)
+}
+
+// Finds the nearest neighbors of the given point.
+// Writes their distances and indices in the dataset into the provided slices.
+// The slices should be pre-allocated to length k+1.
+// Returns the distance and index slices, truncated to the actual number of neighbors found.
+// With [TieBreakingIncludeAll], the slices are grown if there are more than k neighbors.
+func (me *WideMIHModel) FindInto(k int, x []uint64, distances []int, indices []int) ([]int, []int) {
+	if me.Wide.Narrow.TieBreaking != TieBreakingLowestIndex {
+		return me.Wide.Narrow.sort(me.Wide.nearestTies(k, x, distances, indices))
+	}
+	k = me.nearest(k, x, distances, indices)
+	return me.Wide.Narrow.sort(distances[:k], indices[:k])
+}
+
+// Predicts the label of a single input point. Reuses two slices of length K+1 for the neighbor heap.
+// Returns the number of neighbors found.
+func (me *WideMIHModel) Predict(k int, x []uint64, votes VoteCounter) int {
+	me.PreallocateHeap(k)
+	return me.PredictInto(k, x, me.Wide.Narrow.HeapDistances, me.Wide.Narrow.HeapIndices, votes)
+}
+
+// Predicts the label of a single input point, using the given slices for the neighbor heap.
+// Returns the number of neighbors found.
+func (me *WideMIHModel) PredictInto(k int, x []uint64, distances []int, indices []int, votes VoteCounter) int {
+	if me.Wide.Narrow.TieBreaking != TieBreakingLowestIndex {
+		distances, indices = me.Wide.nearestTies(k, x, distances, indices)
+		k = len(indices)
+	} else {
+		k = me.nearest(k, x, distances, indices)
+	}
+	me.Wide.Narrow.Vote(k, distances, indices, votes)
+	return k
+}
+
+// nearest is [NearestWide], using the substring tables.
+// Falls back to [WideModel.nearest] once the search is estimated to be more expensive than a linear scan.
+func (me *WideMIHModel) nearest(k int, x []uint64, distances, indices []int) int {
+	data := me.Wide.WideData
+	k = min(k, len(data))
+	m := len(me.Ranges)
+	if k == 0 || m == 0 {
+		return me.Wide.nearest(k, x, distances, indices)
+	}
+	heap := heap.MakeMax(distances, indices)
+	distance0 := &distances[0]
+	var buf [mihStackKeys]uint64
+	keys := buf[:0]
+	for _, r := range me.Ranges {
+		keys = append(keys, r.Of(x))
+	}
+	scanCost := uint64(len(data) * len(x))
+
+	cost := uint64(0)
+	for s := 0; s <= 64; s++ {
+		for _, r := range me.Ranges {
+			cost += mihLookupCost * binomial(r.Width, s)
+		}
+		if cost > scanCost {
+			return me.Wide.nearest(k, x, distances, indices)
+		}
+		for t, r := range me.Ranges {
+			if s > r.Width {
+				continue
+			}
+			key := keys[t]
+			flip := uint64(1)<<s - 1
+			for n := binomial(r.Width, s); n > 0; n-- {
+				bucket, ok := me.Buckets[t][key^flip]
+				if n > 1 {
+					flip = nextCombination(flip)
+				}
+				if !ok {
+					continue
+				}
+				cost += mihCandidateCost * uint64(bucket.Length)
+				if cost > scanCost {
+					return me.Wide.nearest(k, x, distances, indices)
+				}
+			candidates:
+				for _, i := range me.TableIndices[t][bucket.Offset : bucket.Offset+bucket.Length] {
+					d := data[i]
+					// skip points already found at a smaller radius, or in an earlier table at this radius
+					for u, other := range me.Ranges {
+						if sd := bits.OnesCount64(keys[u] ^ other.Of(d)); sd < s || (sd == s && u < t) {
+							continue candidates
+						}
+					}
+					dist := 0
+					for j, x := range x {
+						dist += bits.OnesCount64(d[j] ^ x)
+					}
+					if heap.Len() < k {
+						heap.Push(dist, i)
+						continue
+					}
+					// candidates aren't found in index order, so ties at the k-th nearest distance are resolved by the heap
+					if dist > *distance0 {
+						continue
+					}
+					heap.PushPop(dist, i)
+				}
+			}
+		}
+		// all points within distance m*(s+1)-1 have been found
+		if heap.Len() == k && *distance0 < m*(s+1) {
+			break
+		}
+	}
+	return heap.Len()
+}
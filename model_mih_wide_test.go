@@ -0,0 +1,142 @@
+package bitknn_test
+
+import (
+	"math/bits"
+	"reflect"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/keilerkonzept/bitknn"
+	"github.com/keilerkonzept/bitknn/internal/testrandom"
+	"pgregory.net/rapid"
+)
+
+func TestWideMIHModel_EquivNearestWide(t *testing.T) {
+	rapid.Check(t, func(t *rapid.T) {
+		k := rapid.IntRange(0, 100).Draw(t, "k")
+		dims := rapid.IntRange(1, 16).Draw(t, "dims")
+		substrings := rapid.IntRange(0, 64).Draw(t, "substrings")
+		data := clusteredData(t, dims)
+		data = append(data, rapid.SliceOf(rapid.SliceOfN(rapid.Uint64(), dims, dims)).Draw(t, "random")...)
+		q := rapid.SliceOfN(rapid.Uint64(), dims, dims).Draw(t, "q")
+		if len(data) > 0 && rapid.Bool().Draw(t, "near") {
+			q = slices.Clone(data[rapid.IntRange(0, len(data)-1).Draw(t, "j")])
+			q[0] ^= 0b101
+		}
+
+		model := bitknn.FitWideMIH(data, nil, substrings)
+		md, mi := model.Find(k, q)
+
+		distances, indices := make([]int, k+1), make([]int, k+1)
+		n := bitknn.NearestWide(data, k, q, distances, indices)
+		if len(md) != n {
+			t.Fatal("MIH should find as many neighbors as the exact search", len(md), n)
+		}
+		seen := make(map[int]bool)
+		for i, index := range mi {
+			if seen[index] {
+				t.Fatal("MIH should not return duplicate neighbors", mi)
+			}
+			seen[index] = true
+			dist := 0
+			for j := range q {
+				dist += bits.OnesCount64(q[j] ^ data[index][j])
+			}
+			if md[i] != dist {
+				t.Fatal("MIH should return correct distances", md[i], index)
+			}
+		}
+		bitknn.SortNeighbors(md, mi)
+		bitknn.SortNeighbors(distances[:n], indices[:n])
+		if !reflect.DeepEqual(md, distances[:n]) || !reflect.DeepEqual(mi, indices[:n]) {
+			t.Fatal(md, distances[:n], mi, indices[:n])
+		}
+	})
+}
+
+func TestFitWideMIH_RejectsWeightsAndMasks(t *testing.T) {
+	data := [][]uint64{{0b0000}, {0b1111}}
+	for name, opt := range map[string]bitknn.Option{
+		"BitWeights":    bitknn.WithBitWeights(bitknn.ByteWeights([]int{1, 2, 3, 4, 5, 6, 7, 8})),
+		"WideDataMasks": bitknn.WithWideDataMasks([][]uint64{{1}, {1}}),
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatal("FitWideMIH should panic with", name)
+				}
+			}()
+			bitknn.FitWideMIH(data, nil, 4, opt)
+		}()
+	}
+}
+
+func TestWideMIHModel_Concurrent(t *testing.T) {
+	const (
+		k          = 10
+		dims       = 3
+		goroutines = 8
+	)
+	data := testrandom.WideData(dims, 2000)
+	queries := testrandom.WideData(dims, 100)
+	for _, substrings := range []int{6, 32} {
+		model := bitknn.FitWideMIH(data, nil, substrings)
+		expectedNeighbors := make([][]neighbor, len(queries))
+		for q, x := range queries {
+			expectedNeighbors[q] = sortedNeighbors(model.Find(k, x))
+		}
+
+		var wg sync.WaitGroup
+		for range goroutines {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				distances, indices := make([]int, k+1), make([]int, k+1)
+				for q, x := range queries {
+					if actual := sortedNeighbors(model.FindInto(k, x, distances, indices)); !reflect.DeepEqual(expectedNeighbors[q], actual) {
+						t.Errorf("query %d: expected neighbors %v, got %v", q, expectedNeighbors[q], actual)
+					}
+				}
+			}()
+		}
+		wg.Wait()
+	}
+}
+
+func TestWideMIHModel_Predict(t *testing.T) {
+	data := [][]uint64{{0b0000, 0}, {0b1111, 0}, {0b0011, 0}, {0b0101, 0}}
+	labels := []int{0, 1, 1, 0}
+	values := []float64{1.0, 2.0, 3.0, 4.0}
+	k := 2
+
+	model := bitknn.FitWideMIH(data, labels, 8, bitknn.WithValues(values))
+	x := []uint64{0b0010, 0}
+	votes := make([]float64, 2)
+	if n := model.Predict(k, x, bitknn.VoteSlice(votes)); n != k {
+		t.Fatal(n)
+	}
+	expectedVotes := []float64{1, 3}
+	if !reflect.DeepEqual(expectedVotes, votes) {
+		t.Fatal(expectedVotes, votes)
+	}
+}
+
+func TestBitRange_Of(t *testing.T) {
+	rapid.Check(t, func(t *rapid.T) {
+		dims := rapid.IntRange(1, 8).Draw(t, "dims")
+		x := rapid.SliceOfN(rapid.Uint64(), dims, dims).Draw(t, "x")
+		offset := rapid.IntRange(0, 64*dims-1).Draw(t, "offset")
+		width := rapid.IntRange(0, min(64, 64*dims-offset)).Draw(t, "width")
+		v := bitknn.BitRange{Offset: offset, Width: width}.Of(x)
+		for b := range 64 {
+			expected := uint64(0)
+			if b < width {
+				expected = x[(offset+b)/64] >> ((offset + b) % 64) & 1
+			}
+			if v>>b&1 != expected {
+				t.Fatal(b, v)
+			}
+		}
+	})
+}
@@ -4,7 +4,9 @@ import (
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/keilerkonzept/bitknn"
+	"pgregory.net/rapid"
 )
 
 func Test_DistanceWeighting_String(t *testing.T) {
@@ -23,6 +25,21 @@ func Test_DistanceWeighting_String(t *testing.T) {
 	}
 }
 
+func Test_Selection_String(t *testing.T) {
+	ss := []bitknn.Selection{
+		bitknn.SelectionHeap,
+		bitknn.SelectionCounting,
+		bitknn.SelectionAuto,
+		-1, // invalid
+	}
+	names := []string{"heap", "counting", "auto", "unknown"}
+	for i, s := range ss {
+		if s.String() != names[i] {
+			t.Errorf("%q != %q", s.String(), names[i])
+		}
+	}
+}
+
 func Test_Model_Predict_PredictRealloc(t *testing.T) {
 	data := []uint64{0b0000, 0b1111, 0b0011, 0b0101}
 	labels := []int{0, 1, 1, 0}
@@ -112,6 +129,31 @@ func Test_Model_PredictV(t *testing.T) {
 	}
 }
 
+func Test_Model_FindV_PredictV_Equiv_Find_Predict(t *testing.T) {
+	rapid.Check(t, func(t *rapid.T) {
+		k := rapid.IntRange(0, 100).Draw(t, "k")
+		data := rapid.SliceOf(rapid.Uint64()).Draw(t, "data")
+		labels := rapid.SliceOfN(rapid.IntRange(0, 3), len(data), len(data)).Draw(t, "labels")
+		q := rapid.Uint64().Draw(t, "q")
+		batch := make([]uint32, rapid.IntRange(max(k, 1), 300).Draw(t, "batchSize"))
+		m1 := bitknn.Fit(data, labels, bitknn.WithLinearDistanceWeighting())
+		m2 := bitknn.Fit(data, labels, bitknn.WithLinearDistanceWeighting())
+
+		ds, is := m1.Find(k, q)
+		vds, vis := m2.FindV(k, q, batch)
+		if diff := cmp.Diff([][]int{ds, is}, [][]int{vds, vis}); diff != "" {
+			t.Fatal(diff)
+		}
+
+		votes, vvotes := make([]float64, 4), make([]float64, 4)
+		m1.Predict(k, q, bitknn.VoteSlice(votes))
+		m2.PredictV(k, q, batch, bitknn.VoteSlice(vvotes))
+		if diff := cmp.Diff(votes, vvotes); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+}
+
 func Test_Model_PredictD(t *testing.T) {
 	data := []uint64{0b0000, 0b1111, 0b0011, 0b0101}
 	labels := []int{0, 1, 1, 0}
@@ -234,3 +276,51 @@ func Test_Model_PredictC(t *testing.T) {
 		t.Error(diff)
 	}
 }
+
+func Test_Model_PredictWithin(t *testing.T) {
+	data := []uint64{0b0000, 0b1111, 0b0011, 0b0101}
+	labels := []int{0, 1, 1, 0}
+	values := []float64{1.0, 2.0, 3.0, 4.0}
+
+	model := bitknn.Fit(data, labels, bitknn.WithValues(values))
+
+	x := uint64(0b0001)
+	votes := make([]float64, 2)
+	{
+		n := model.PredictWithin(1, x, bitknn.VoteSlice(votes))
+		if n != 3 {
+			t.Errorf("Expected 3 neighbors, got %d", n)
+		}
+		expectedVotes := []float64{5, 3}
+		if diff := cmp.Diff(expectedVotes, votes); diff != "" {
+			t.Error(diff)
+		}
+	}
+	{
+		distances, indices := make([]int, 0, 4), make([]int, 0, 4)
+		n := model.PredictWithinInto(1, x, 2, distances, indices, bitknn.VoteSlice(votes))
+		if n != 2 {
+			t.Errorf("Expected 2 neighbors, got %d", n)
+		}
+		expectedVotes := []float64{1, 3}
+		if diff := cmp.Diff(expectedVotes, votes); diff != "" {
+			t.Error(diff)
+		}
+		var counter bitknn.VoteCounter = bitknn.VoteSlice(votes)
+		allocs := testing.AllocsPerRun(10, func() {
+			model.PredictWithinInto(1, x, -1, distances, indices, counter)
+		})
+		if allocs != 0 {
+			t.Errorf("Expected no allocations, got %v", allocs)
+		}
+	}
+	{
+		distances, indices := model.FindWithinInto(0, x, -1, nil, nil)
+		if diff := cmp.Diff([]int{}, distances, cmpopts.EquateEmpty()); diff != "" {
+			t.Error(diff)
+		}
+		if diff := cmp.Diff([]int{}, indices, cmpopts.EquateEmpty()); diff != "" {
+			t.Error(diff)
+		}
+	}
+}
@@ -1,11 +1,21 @@
 package bitknn
 
+import (
+	"iter"
+
+	"github.com/keilerkonzept/bitknn/internal/topk"
+)
+
 // Create a k-NN model for the given data points and labels.
+// With the [WithSimilarity] or [WithMetric] option, counts the bits set in each data point (see [Model.OnesCounts]).
 func FitWide(data [][]uint64, labels []int, opts ...Option) *WideModel {
 	m := &WideModel{
-		Narrow:   Fit(nil, labels, opts...),
+		Narrow:   fit(nil, labels, opts),
 		WideData: data,
 	}
+	if m.Narrow.countOnes {
+		m.CountOnes()
+	}
 	return m
 }
 
@@ -15,6 +25,15 @@ type WideModel struct {
 
 	// Input data points.
 	WideData [][]uint64
+
+	// Worker goroutines of the parallel searches into the model's own neighbor heap (see [WideModel.Close]).
+	workers *shardWorkers
+}
+
+// Close stops the worker goroutines that the Find and Predict methods keep between queries. See [Model.Close].
+func (me *WideModel) Close() {
+	me.workers.close()
+	me.workers = nil
 }
 
 func (me *WideModel) PreallocateHeap(k int) {
@@ -26,58 +45,517 @@ func (me *WideModel) PreallocateHeap(k int) {
 // Returns the distance and index slices, truncated to the actual number of neighbors found.
 func (me *WideModel) Find(k int, x []uint64) ([]int, []int) {
 	me.PreallocateHeap(k)
+	if k, ok := me.nearestOnWorkers(&me.workers, k, x, nil, me.Narrow.HeapDistances, me.Narrow.HeapIndices); ok {
+		return me.Narrow.sort(me.Narrow.HeapDistances[:k], me.Narrow.HeapIndices[:k])
+	}
 	return me.FindInto(k, x, me.Narrow.HeapDistances, me.Narrow.HeapIndices)
 }
 
-// FindV is [WideModel.Find], but vectorizable (currently only on ARM64 with NEON instructions).
+// FindV is [WideModel.Find], but vectorized (on ARM64 with NEON, and on amd64 with AVX2 or AVX-512 instructions).
 // The provided [batch] slice must have length >=k and is used to pre-compute batches of distances.
 func (me *WideModel) FindV(k int, x []uint64, batch []uint32) ([]int, []int) {
 	me.PreallocateHeap(k)
+	if k, ok := me.nearestOnWorkers(&me.workers, k, x, batch, me.Narrow.HeapDistances, me.Narrow.HeapIndices); ok {
+		return me.Narrow.sort(me.Narrow.HeapDistances[:k], me.Narrow.HeapIndices[:k])
+	}
 	return me.FindIntoV(k, x, batch, me.Narrow.HeapDistances, me.Narrow.HeapIndices)
 }
 
+// FindSorted is [WideModel.Find], but returns the neighbors sorted by ascending distance, and equal distances by ascending index.
+func (me *WideModel) FindSorted(k int, x []uint64) ([]int, []int) {
+	distances, indices := me.Find(k, x)
+	SortNeighbors(distances, indices)
+	return distances, indices
+}
+
+// FindSeq returns an iterator over the nearest neighbors of the given point as (index, distance) pairs, sorted as by [WideModel.FindSorted].
+// The neighbors are searched when the iteration starts, reusing the model's neighbor heap slices.
+func (me *WideModel) FindSeq(k int, x []uint64) iter.Seq2[int, int] {
+	return func(yield func(int, int) bool) {
+		for index, dist := range Neighbors(me.FindSorted(k, x)) {
+			if !yield(index, dist) {
+				return
+			}
+		}
+	}
+}
+
 // Finds the nearest neighbors of the given point.
 // Writes their distances and indices in the dataset into the provided slices.
 // The slices should be pre-allocated to length k+1.
 // Returns the distance and index slices, truncated to the actual number of neighbors found.
+// With [TieBreakingIncludeAll], the slices are grown if there are more than k neighbors.
 func (me *WideModel) FindInto(k int, x []uint64, distances []int, indices []int) ([]int, []int) {
-	k = NearestWide(me.WideData, k, x, distances, indices)
-	return distances[:k], indices[:k]
+	if me.Narrow.TieBreaking != TieBreakingLowestIndex {
+		return me.Narrow.sort(me.nearestTies(k, x, distances, indices))
+	}
+	k = me.nearest(k, x, distances, indices)
+	return me.Narrow.sort(distances[:k], indices[:k])
 }
 
-// FindIntoV is [WideModel.FindInto], but vectorizable (currently only on ARM64 with NEON instructions).
+// FindIntoV is [WideModel.FindInto], but vectorized (on ARM64 with NEON, and on amd64 with AVX2 or AVX-512 instructions).
 // The provided [batch] slice must have length >=k and is used to pre-compute batches of distances.
 func (me *WideModel) FindIntoV(k int, x []uint64, batch []uint32, distances []int, indices []int) ([]int, []int) {
-	k = NearestWideV(me.WideData, k, x, batch, distances, indices)
-	return distances[:k], indices[:k]
+	if me.Narrow.TieBreaking != TieBreakingLowestIndex {
+		return me.Narrow.sort(me.nearestTies(k, x, distances, indices))
+	}
+	k = me.nearestV(k, x, batch, distances, indices)
+	return me.Narrow.sort(distances[:k], indices[:k])
+}
+
+// Finds the nearest neighbors of the given point, only counting the bits set in `mask` (see [NearestWideMasked]).
+// Reuses the model's neighbor heap slices.
+// Returns the distance and index slices, truncated to the actual number of neighbors found.
+func (me *WideModel) FindMasked(k int, x, mask []uint64) ([]int, []int) {
+	me.PreallocateHeap(k)
+	return me.FindMaskedInto(k, x, mask, me.Narrow.HeapDistances, me.Narrow.HeapIndices)
+}
+
+// FindMaskedV is [WideModel.FindMasked], but vectorized (on ARM64 with NEON, and on amd64 with AVX-512 instructions).
+// The provided [batch] slice must have length >=k and is used to pre-compute batches of distances.
+func (me *WideModel) FindMaskedV(k int, x, mask []uint64, batch []uint32) ([]int, []int) {
+	me.PreallocateHeap(k)
+	if me.Narrow.TieBreaking != TieBreakingLowestIndex {
+		return me.FindMaskedInto(k, x, mask, me.Narrow.HeapDistances, me.Narrow.HeapIndices)
+	}
+	k = me.nearestMaskedV(k, x, mask, batch, me.Narrow.HeapDistances, me.Narrow.HeapIndices)
+	return me.Narrow.sort(me.Narrow.HeapDistances[:k], me.Narrow.HeapIndices[:k])
+}
+
+// Finds the nearest neighbors of the given point, only counting the bits set in `mask` (see [NearestWideMasked]).
+// Writes their distances and indices in the dataset into the provided slices, which should be pre-allocated to length k+1.
+// Returns the distance and index slices, truncated to the actual number of neighbors found.
+// With [TieBreakingIncludeAll], the slices are grown if there are more than k neighbors.
+func (me *WideModel) FindMaskedInto(k int, x, mask []uint64, distances []int, indices []int) ([]int, []int) {
+	if me.Narrow.TieBreaking != TieBreakingLowestIndex {
+		return me.Narrow.sort(me.nearestMaskedTies(k, x, mask, distances, indices))
+	}
+	k = me.nearestMasked(k, x, mask, distances, indices)
+	return me.Narrow.sort(distances[:k], indices[:k])
+}
+
+// Finds the nearest neighbors of each of the given points, scanning the dataset only once for all of them.
+// Writes the distances and indices of the neighbors of `queries[q]` into the provided slices `distances[q]` and `indices[q]`,
+// which should be pre-allocated to length k+1.
+// Returns the smallest number of neighbors found for any query, which, with the supported tie-breaking policies,
+// is the number found for every query.
+// Unless [Model.TieBreaking] is [TieBreakingLowestIndex], or if [Model.WideDataMasks] or [Model.BitWeights] is set, the queries are searched one by one.
+// [TieBreakingIncludeAll] isn't supported, since the number of neighbors can differ between queries and exceed k+1:
+// then nothing is searched, and 0 is returned.
+func (me *WideModel) FindBatch(k int, queries [][]uint64, distances [][]int, indices [][]int) int {
+	if me.Narrow.TieBreaking == TieBreakingIncludeAll {
+		return 0
+	}
+	if m := me.Narrow; m.TieBreaking != TieBreakingLowestIndex || m.WideDataMasks != nil || m.BitWeights != nil {
+		n := min(k, len(me.WideData))
+		for q, x := range queries {
+			d, _ := me.FindInto(k, x, distances[q], indices[q])
+			n = min(n, len(d))
+		}
+		return n
+	}
+	k = NearestWideBatch(me.WideData, k, queries, distances, indices)
+	for q := range queries {
+		me.Narrow.sort(distances[q][:k], indices[q][:k])
+	}
+	return k
 }
 
 // Predicts the label of a single input point. Reuses two slices of length K+1 for the neighbor heap.
 // Returns the number of neighbors found.
 func (me *WideModel) Predict(k int, x []uint64, votes VoteCounter) int {
 	me.PreallocateHeap(k)
+	if k, ok := me.nearestOnWorkers(&me.workers, k, x, nil, me.Narrow.HeapDistances, me.Narrow.HeapIndices); ok {
+		me.Narrow.Vote(k, me.Narrow.HeapDistances, me.Narrow.HeapIndices, votes)
+		return k
+	}
 	return me.PredictInto(k, x, me.Narrow.HeapDistances, me.Narrow.HeapIndices, votes)
 }
 
 // Predicts the label of a single input point, using the given slices for the neighbor heap.
 // Returns the number of neighbors found.
 func (me *WideModel) PredictInto(k int, x []uint64, distances []int, indices []int, votes VoteCounter) int {
-	k = NearestWide(me.WideData, k, x, distances, indices)
+	if me.Narrow.TieBreaking != TieBreakingLowestIndex {
+		distances, indices = me.nearestTies(k, x, distances, indices)
+		k = len(indices)
+	} else {
+		k = me.nearest(k, x, distances, indices)
+	}
+	me.normalizeMasked(x, nil, distances[:k])
 	me.Narrow.Vote(k, distances, indices, votes)
 	return k
 }
 
-// PredictV is [WideModel.Predict], but vectorizable (currently only on ARM64 with NEON instructions).
+// Predicts the label of a single input point from its nearest neighbors, only counting the bits set in `mask` (see [NearestWideMasked]).
+// Reuses the model's neighbor heap slices.
+// Returns the number of neighbors found.
+func (me *WideModel) PredictMasked(k int, x, mask []uint64, votes VoteCounter) int {
+	me.PreallocateHeap(k)
+	return me.PredictMaskedInto(k, x, mask, me.Narrow.HeapDistances, me.Narrow.HeapIndices, votes)
+}
+
+// Predicts the label of a single input point from its nearest neighbors, only counting the bits set in `mask` (see [NearestWideMasked]),
+// using the given slices for the neighbor heap.
+// If [Model.MaskedDistanceNormalization] is set, the neighbors' distances are rescaled to the full width before weighting them.
+// Returns the number of neighbors found.
+func (me *WideModel) PredictMaskedInto(k int, x, mask []uint64, distances []int, indices []int, votes VoteCounter) int {
+	if me.Narrow.TieBreaking != TieBreakingLowestIndex {
+		distances, indices = me.nearestMaskedTies(k, x, mask, distances, indices)
+		k = len(indices)
+	} else {
+		k = me.nearestMasked(k, x, mask, distances, indices)
+	}
+	me.voteMasked(k, x, mask, distances, indices, votes)
+	return k
+}
+
+// PredictMaskedV is [WideModel.PredictMasked], but vectorized (on ARM64 with NEON, and on amd64 with AVX-512 instructions).
+// The provided [batch] slice must have length >=k and is used to pre-compute batches of distances.
+func (me *WideModel) PredictMaskedV(k int, x, mask []uint64, batch []uint32, votes VoteCounter) int {
+	me.PreallocateHeap(k)
+	distances, indices := me.Narrow.HeapDistances, me.Narrow.HeapIndices
+	if me.Narrow.TieBreaking != TieBreakingLowestIndex {
+		return me.PredictMaskedInto(k, x, mask, distances, indices, votes)
+	}
+	k = me.nearestMaskedV(k, x, mask, batch, distances, indices)
+	me.voteMasked(k, x, mask, distances, indices, votes)
+	return k
+}
+
+// voteMasked is [Model.Vote] for neighbors by masked distance, normalizing their distances if [Model.MaskedDistanceNormalization] is set.
+func (me *WideModel) voteMasked(k int, x, mask []uint64, distances []int, indices []int, votes VoteCounter) {
+	me.normalizeMasked(x, mask, distances[:k])
+	me.Narrow.Vote(k, distances, indices, votes)
+}
+
+// normalizeMasked rescales the distances of the given neighbors of `x` found with the query mask `mask` (or none if nil) to the full width
+// if [Model.MaskedDistanceNormalization] is set (see [NormalizeMaskedDistances]).
+// With data masks, the distances are already rescaled by the search.
+func (me *WideModel) normalizeMasked(x, mask []uint64, distances []int) {
+	if me.Narrow.MaskedDistanceNormalization && me.Narrow.WideDataMasks == nil && mask != nil {
+		NormalizeMaskedDistances(distances, onesCount(mask), 64*len(x))
+	}
+}
+
+// Finds the nearest neighbors of the given point by the weighted Hamming distance with [Model.FloatBitWeights] (see [NearestWideWeighted]).
+// Reuses the model's neighbor heap slices.
+// Returns the distance and index slices, truncated to the actual number of neighbors found.
+func (me *WideModel) FindWeighted(k int, x []uint64) ([]float64, []int) {
+	me.Narrow.preallocateFloatHeap(k)
+	return me.FindWeightedInto(k, x, me.Narrow.HeapFloatDistances, me.Narrow.HeapIndices)
+}
+
+// Finds the nearest neighbors of the given point by the weighted Hamming distance with [Model.FloatBitWeights] (see [NearestWideWeighted]).
+// Writes their distances and indices in the dataset into the provided slices, which should be pre-allocated to length k+1.
+// Returns the distance and index slices, truncated to the actual number of neighbors found.
+// With [TieBreakingIncludeAll], the slices are grown if there are more than k neighbors.
+func (me *WideModel) FindWeightedInto(k int, x []uint64, distances []float64, indices []int) ([]float64, []int) {
+	distances, indices = me.nearestFloatWeighted(k, x, distances, indices)
+	if me.Narrow.Sorted {
+		SortNeighbors(distances, indices)
+	}
+	return distances, indices
+}
+
+// Predicts the label of a single input point from its nearest neighbors by the weighted Hamming distance with [Model.FloatBitWeights].
+// Reuses the model's neighbor heap slices.
+// Returns the number of neighbors found.
+func (me *WideModel) PredictWeighted(k int, x []uint64, votes VoteCounter) int {
+	me.Narrow.preallocateFloatHeap(k)
+	return me.PredictWeightedInto(k, x, me.Narrow.HeapFloatDistances, me.Narrow.HeapIndices, votes)
+}
+
+// Predicts the label of a single input point from its nearest neighbors by the weighted Hamming distance with [Model.FloatBitWeights],
+// using the given slices for the neighbor heap (see [Model.VoteWeighted]).
+// Returns the number of neighbors found.
+func (me *WideModel) PredictWeightedInto(k int, x []uint64, distances []float64, indices []int, votes VoteCounter) int {
+	distances, indices = me.nearestFloatWeighted(k, x, distances, indices)
+	me.Narrow.VoteWeighted(len(indices), distances, indices, votes)
+	return len(indices)
+}
+
+// Finds the data points most similar to the given point by [Model.Similarity] or [Model.Metric] (see [NearestWideSimilar]).
+// Reuses the model's neighbor heap slices.
+// Returns the similarity and index slices, truncated to the actual number of neighbors found.
+func (me *WideModel) FindSimilar(k int, x []uint64) ([]float64, []int) {
+	me.Narrow.preallocateFloatHeap(k)
+	return me.FindSimilarInto(k, x, me.Narrow.HeapFloatDistances, me.Narrow.HeapIndices)
+}
+
+// Finds the data points most similar to the given point by [Model.Similarity] or [Model.Metric] (see [NearestWideSimilar]).
+// Writes their similarities and indices in the dataset into the provided slices, which should be pre-allocated to length k+1.
+// Returns the similarity and index slices, truncated to the actual number of neighbors found.
+// With [TieBreakingIncludeAll], the slices are grown if there are more than k neighbors.
+// With [Model.Sorted], the neighbors are sorted by descending similarity, and equal similarities by ascending index.
+func (me *WideModel) FindSimilarInto(k int, x []uint64, similarities []float64, indices []int) ([]float64, []int) {
+	similarities, indices = me.nearestSimilar(k, x, similarities, indices)
+	if me.Narrow.Sorted {
+		SortSimilarNeighbors(similarities, indices)
+	}
+	return similarities, indices
+}
+
+// Predicts the label of a single input point from its most similar data points by [Model.Similarity] or [Model.Metric].
+// Reuses the model's neighbor heap slices.
+// Returns the number of neighbors found.
+func (me *WideModel) PredictSimilar(k int, x []uint64, votes VoteCounter) int {
+	me.Narrow.preallocateFloatHeap(k)
+	return me.PredictSimilarInto(k, x, me.Narrow.HeapFloatDistances, me.Narrow.HeapIndices, votes)
+}
+
+// Predicts the label of a single input point from its most similar data points by [Model.Similarity] or [Model.Metric],
+// using the given slices for the neighbor heap (see [Model.VoteSimilar]).
+// Returns the number of neighbors found.
+func (me *WideModel) PredictSimilarInto(k int, x []uint64, similarities []float64, indices []int, votes VoteCounter) int {
+	similarities, indices = me.nearestSimilar(k, x, similarities, indices)
+	me.Narrow.VoteSimilar(len(indices), similarities, indices, votes)
+	return len(indices)
+}
+
+// CountOnes sets [Model.OnesCounts] for the model's wide data points.
+func (me *WideModel) CountOnes() {
+	me.Narrow.OnesCounts = WideOnesCounts(me.WideData)
+}
+
+// PredictV is [WideModel.Predict], but vectorized (on ARM64 with NEON, and on amd64 with AVX2 or AVX-512 instructions).
 // The provided [batch] slice must have length >=k and is used to pre-compute batches of distances.
 func (me *WideModel) PredictV(k int, x []uint64, batch []uint32, votes VoteCounter) int {
 	me.PreallocateHeap(k)
+	if k, ok := me.nearestOnWorkers(&me.workers, k, x, batch, me.Narrow.HeapDistances, me.Narrow.HeapIndices); ok {
+		me.Narrow.Vote(k, me.Narrow.HeapDistances, me.Narrow.HeapIndices, votes)
+		return k
+	}
 	return me.PredictIntoV(k, x, batch, me.Narrow.HeapDistances, me.Narrow.HeapIndices, votes)
 }
 
-// PredictIntoV is [WideModel.PredictInto], but vectorizable (currently only on ARM64 with NEON instructions).
+// PredictIntoV is [WideModel.PredictInto], but vectorized (on ARM64 with NEON, and on amd64 with AVX2 or AVX-512 instructions).
 // The provided [batch] slice must have length >=k and is used to pre-compute batches of distances.
 func (me *WideModel) PredictIntoV(k int, x []uint64, batch []uint32, distances []int, indices []int, votes VoteCounter) int {
-	k = NearestWideV(me.WideData, k, x, batch, distances, indices)
+	if me.Narrow.TieBreaking != TieBreakingLowestIndex {
+		return me.PredictInto(k, x, distances, indices, votes)
+	}
+	k = me.nearestV(k, x, batch, distances, indices)
+	me.normalizeMasked(x, nil, distances[:k])
 	me.Narrow.Vote(k, distances, indices, votes)
 	return k
 }
+
+// Predicts the target of a single input point from the [Model.Values] of its nearest neighbors (see [Model.Aggregate]).
+// Reuses the model's neighbor heap slices.
+func (me *WideModel) Regress(k int, x []uint64) Regression {
+	me.PreallocateHeap(k)
+	return me.RegressInto(k, x, me.Narrow.HeapDistances, me.Narrow.HeapIndices)
+}
+
+// Predicts the target of a single input point from the [Model.Values] of its nearest neighbors (see [Model.Aggregate]),
+// using the given slices for the neighbor heap.
+func (me *WideModel) RegressInto(k int, x []uint64, distances []int, indices []int) Regression {
+	if me.Narrow.TieBreaking != TieBreakingLowestIndex {
+		distances, indices = me.nearestTies(k, x, distances, indices)
+		k = len(indices)
+	} else {
+		k = me.nearest(k, x, distances, indices)
+	}
+	me.normalizeMasked(x, nil, distances[:k])
+	return me.Narrow.Aggregate(k, distances, indices)
+}
+
+// nearest is [NearestWide] or [NearestWideParallel], depending on [Model.Workers],
+// their early-abandoning variants if [Model.EarlyAbandon] is set,
+// [NearestWideCounting] if selected by [Model.Selection], [NearestWideDataMasked] if [Model.WideDataMasks] is set,
+// or [NearestWideWeighted] if [Model.BitWeights] is set.
+func (me *WideModel) nearest(k int, x []uint64, distances []int, indices []int) int {
+	workers := me.Narrow.Workers
+	switch {
+	case me.Narrow.WideDataMasks != nil:
+		return me.nearestMasked(k, x, nil, distances, indices)
+	case me.Narrow.BitWeights != nil && workers > 1:
+		return NearestWideWeightedParallel(me.WideData, me.Narrow.BitWeights, k, x, workers, distances, indices)
+	case me.Narrow.BitWeights != nil:
+		return NearestWideWeighted(me.WideData, me.Narrow.BitWeights, k, x, distances, indices)
+	case workers > 1 && me.Narrow.EarlyAbandon:
+		return NearestWideEarlyAbandonParallel(me.WideData, k, x, workers, distances, indices)
+	case workers > 1:
+		return NearestWideParallel(me.WideData, k, x, workers, distances, indices)
+	case me.Narrow.Selection.counting(k, len(x)):
+		return NearestWideCounting(me.WideData, k, x, distances, indices)
+	case me.Narrow.EarlyAbandon:
+		return NearestWideEarlyAbandon(me.WideData, k, x, distances, indices)
+	}
+	return NearestWide(me.WideData, k, x, distances, indices)
+}
+
+// nearestTies is [NearestWideTies] or [NearestWideParallelTies] with the model's tie-breaking, depending on [Model.Workers],
+// or their data-masked or weighted variants if [Model.WideDataMasks] or [Model.BitWeights] is set.
+// Overwrites the given slices, growing them if necessary.
+func (me *WideModel) nearestTies(k int, x []uint64, distances []int, indices []int) ([]int, []int) {
+	m := me.Narrow
+	if m.WideDataMasks != nil {
+		return me.nearestMaskedTies(k, x, nil, distances, indices)
+	}
+	if weights := m.BitWeights; weights != nil {
+		if m.Workers > 1 && weights.Max() > weightedTiesMaxCounting && k > 0 {
+			return appendHeapTies(len(me.WideData), k, m.TieBreaking, m.TieBreakingSeed, distances[:0], indices[:0], func(distances, indices []int) int {
+				return NearestWideWeightedParallel(me.WideData, weights, k, x, m.Workers, distances, indices)
+			}, func(i int) int {
+				return weights.Distance(x, me.WideData[i])
+			})
+		}
+		if m.Workers > 1 {
+			return nearestParallelTies(len(me.WideData), k, m.Workers, m.BitWeights.Max(), m.TieBreaking, m.TieBreakingSeed, distances[:0], indices[:0], func(c *topk.Counting, lo, hi int) {
+				pushNearestWideWeighted(c, me.WideData[lo:hi], m.BitWeights, x)
+			})
+		}
+		return NearestWideWeightedTies(me.WideData, m.BitWeights, k, x, m.TieBreaking, m.TieBreakingSeed, distances[:0], indices[:0])
+	}
+	if m.Workers > 1 {
+		return NearestWideParallelTies(me.WideData, k, x, m.Workers, m.TieBreaking, m.TieBreakingSeed, distances[:0], indices[:0])
+	}
+	return NearestWideTies(me.WideData, k, x, m.TieBreaking, m.TieBreakingSeed, distances[:0], indices[:0])
+}
+
+// nearestV is [NearestWideV] or [NearestWideParallelV], depending on [Model.Workers].
+// If [Model.WideDataMasks] or [Model.BitWeights] is set, it is [WideModel.nearest] instead.
+func (me *WideModel) nearestV(k int, x []uint64, batch []uint32, distances []int, indices []int) int {
+	if me.Narrow.WideDataMasks != nil || me.Narrow.BitWeights != nil {
+		return me.nearest(k, x, distances, indices)
+	}
+	if workers := me.Narrow.Workers; workers > 1 {
+		return NearestWideParallelV(me.WideData, k, x, workers, batch, distances, indices)
+	}
+	return NearestWideV(me.WideData, k, x, batch, distances, indices)
+}
+
+// nearestFloatWeighted is [NearestWideWeighted] or [NearestWideWeightedParallel] with [Model.FloatBitWeights], depending on [Model.Workers],
+// with the ties at the k-th nearest distance broken by [Model.TieBreaking].
+// Returns the distance and index slices, truncated to the number of neighbors found, or grown if there are more than k.
+func (me *WideModel) nearestFloatWeighted(k int, x []uint64, distances []float64, indices []int) ([]float64, []int) {
+	m := me.Narrow
+	weights := m.FloatBitWeights
+	if m.Workers > 1 {
+		k = NearestWideWeightedParallel(me.WideData, weights, k, x, m.Workers, distances, indices)
+	} else {
+		k = NearestWideWeighted(me.WideData, weights, k, x, distances, indices)
+	}
+	return selectTies(len(me.WideData), k, m.TieBreaking, m.TieBreakingSeed, distances, indices, func(i int) float64 {
+		return weights.Distance(x, me.WideData[i])
+	})
+}
+
+// nearestSimilar is [NearestWideSimilar] or [NearestWideSimilarParallel] with the model's metric, depending on [Model.Workers],
+// with the ties at the k-th highest similarity broken by [Model.TieBreaking].
+// Returns the similarity and index slices, truncated to the number of neighbors found, or grown if there are more than k.
+func (me *WideModel) nearestSimilar(k int, x []uint64, similarities []float64, indices []int) ([]float64, []int) {
+	m := me.Narrow
+	metric := m.metric()
+	if m.Workers > 1 {
+		k = NearestWideSimilarParallel(me.WideData, m.OnesCounts, metric, k, x, m.Workers, similarities, indices)
+	} else {
+		k = NearestWideSimilar(me.WideData, m.OnesCounts, metric, k, x, similarities, indices)
+	}
+	if m.TieBreaking == TieBreakingLowestIndex {
+		return similarities[:k], indices[:k]
+	}
+	nx := onesCount(x)
+	negate(similarities[:k])
+	similarities, indices = selectTies(len(me.WideData), k, m.TieBreaking, m.TieBreakingSeed, similarities, indices, func(i int) float64 {
+		return -wideSimilarity(metric, x, nx, me.WideData[i])
+	})
+	negate(similarities)
+	return similarities, indices
+}
+
+// nearestMasked is [NearestWideMasked], or [NearestWideDataMasked] if [Model.WideDataMasks] is set
+// ([NearestWideDataMaskedNormalized] if [Model.MaskedDistanceNormalization] is set), searched concurrently depending on [Model.Workers].
+// Without data masks, `mask` must not be nil.
+func (me *WideModel) nearestMasked(k int, x, mask []uint64, distances []int, indices []int) int {
+	masks := me.Narrow.WideDataMasks
+	if masks == nil {
+		return NearestWideMasked(me.WideData, k, x, mask, distances, indices)
+	}
+	normalize := me.Narrow.MaskedDistanceNormalization
+	if workers := me.Narrow.Workers; workers > 1 {
+		return nearestParallel(len(me.WideData), k, workers, distances, indices, func(_, _, lo, hi int, distances, indices []int) int {
+			return nearestWideDataMasked(me.WideData[lo:hi], masks[lo:hi], k, x, mask, normalize, distances, indices)
+		})
+	}
+	return nearestWideDataMasked(me.WideData, masks, k, x, mask, normalize, distances, indices)
+}
+
+// nearestMaskedTies is [NearestWideMaskedTies], or [NearestWideDataMaskedTies] if [Model.WideDataMasks] is set
+// ([NearestWideDataMaskedNormalizedTies] if [Model.MaskedDistanceNormalization] is set), with the model's tie-breaking,
+// searched concurrently depending on [Model.Workers].
+// Without data masks, `mask` must not be nil. Overwrites the given slices, growing them if necessary.
+func (me *WideModel) nearestMaskedTies(k int, x, mask []uint64, distances []int, indices []int) ([]int, []int) {
+	m := me.Narrow
+	if m.WideDataMasks == nil {
+		if m.Workers > 1 {
+			return nearestParallelTies(len(me.WideData), k, m.Workers, 64*len(x), m.TieBreaking, m.TieBreakingSeed, distances[:0], indices[:0], func(c *topk.Counting, lo, hi int) {
+				pushNearestWideMasked(c, me.WideData[lo:hi], x, mask)
+			})
+		}
+		return NearestWideMaskedTies(me.WideData, k, x, mask, m.TieBreaking, m.TieBreakingSeed, distances[:0], indices[:0])
+	}
+	normalize := m.MaskedDistanceNormalization
+	if m.Workers > 1 {
+		return nearestParallelTies(len(me.WideData), k, m.Workers, 64*len(x), m.TieBreaking, m.TieBreakingSeed, distances[:0], indices[:0], func(c *topk.Counting, lo, hi int) {
+			pushNearestWideDataMasked(c, me.WideData[lo:hi], m.WideDataMasks[lo:hi], x, mask, normalize)
+		})
+	}
+	return nearestWideDataMaskedTies(me.WideData, m.WideDataMasks, k, x, mask, normalize, m.TieBreaking, m.TieBreakingSeed, distances[:0], indices[:0])
+}
+
+// nearestMaskedV is [NearestWideMaskedV], or [WideModel.nearestMasked] if [Model.WideDataMasks] is set.
+func (me *WideModel) nearestMaskedV(k int, x, mask []uint64, batch []uint32, distances []int, indices []int) int {
+	if me.Narrow.WideDataMasks != nil {
+		return me.nearestMasked(k, x, mask, distances, indices)
+	}
+	return NearestWideMaskedV(me.WideData, k, x, mask, batch, distances, indices)
+}
+
+// within is [WithinWide], or [WithinWideDataMasked] or [WithinWideWeighted] if [Model.WideDataMasks] or [Model.BitWeights] is set.
+func (me *WideModel) within(r int, x []uint64, limit int, distances []int, indices []int) ([]int, []int) {
+	if masks := me.Narrow.WideDataMasks; masks != nil {
+		return withinWideDataMasked(me.WideData, masks, r, x, nil, me.Narrow.MaskedDistanceNormalization, limit, distances, indices)
+	}
+	if weights := me.Narrow.BitWeights; weights != nil {
+		return WithinWideWeighted(me.WideData, weights, r, x, limit, distances, indices)
+	}
+	return WithinWide(me.WideData, r, x, limit, distances, indices)
+}
+
+// Finds all points within Hamming distance `r` of the given point, in index order.
+// Reuses the model's neighbor heap slices, growing them as needed.
+// Returns the distance and index slices.
+func (me *WideModel) FindWithin(r int, x []uint64) ([]int, []int) {
+	m := me.Narrow
+	m.HeapDistances, m.HeapIndices = me.within(r, x, -1, m.HeapDistances[:0], m.HeapIndices[:0])
+	return m.HeapDistances, m.HeapIndices
+}
+
+// Finds the points within Hamming distance `r` of the given point, in index order.
+// Appends their distances and indices in the dataset to the provided slices, up to `limit` neighbors if `limit` is non-negative.
+// Returns the distance and index slices.
+func (me *WideModel) FindWithinInto(r int, x []uint64, limit int, distances []int, indices []int) ([]int, []int) {
+	return me.within(r, x, limit, distances, indices)
+}
+
+// Predicts the label of a single input point from all points within Hamming distance `r`.
+// Reuses the model's neighbor heap slices, growing them as needed.
+// Returns the number of neighbors found.
+func (me *WideModel) PredictWithin(r int, x []uint64, votes VoteCounter) int {
+	distances, indices := me.FindWithin(r, x)
+	me.normalizeMasked(x, nil, distances)
+	me.Narrow.Vote(len(indices), distances, indices, votes)
+	return len(indices)
+}
+
+// Predicts the label of a single input point from the points within Hamming distance `r`, up to `limit` neighbors if `limit` is non-negative.
+// Uses the given slices (truncated to length 0) for the neighbors, which should have enough capacity to avoid allocation.
+// Returns the number of neighbors found.
+func (me *WideModel) PredictWithinInto(r int, x []uint64, limit int, distances []int, indices []int, votes VoteCounter) int {
+	distances, indices = me.within(r, x, limit, distances[:0], indices[:0])
+	me.normalizeMasked(x, nil, distances)
+	me.Narrow.Vote(len(indices), distances, indices, votes)
+	return len(indices)
+}
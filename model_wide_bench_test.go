@@ -21,6 +21,7 @@ func BenchmarkWideModel(b *testing.B) {
 		{dim: []int{1}, dataSize: []int{1000, 1_000_000}, k: []int{3, 10, 100}, batch: nil},
 		{dim: []int{2, 10}, dataSize: []int{1000, 1_000_000}, k: []int{3, 10, 100}, batch: []int{1000}},
 		{dim: []int{128}, dataSize: []int{1_000_000}, k: []int{10}, batch: []int{1000}},
+		{dim: []int{64}, dataSize: []int{1_000_000}, k: []int{10}, batch: []int{1000}},
 	}
 	for _, bench := range benches {
 		for _, dim := range bench.dim {
@@ -30,6 +31,7 @@ func BenchmarkWideModel(b *testing.B) {
 					pack.ReallocateFlat(data)
 					labels := testrandom.Labels(dataSize)
 					model := bitknn.FitWide(data, labels)
+					earlyAbandonModel := bitknn.FitWide(data, labels, bitknn.WithEarlyAbandon())
 					query := testrandom.WideQuery(dim)
 					b.Run(fmt.Sprintf("Op=Predict_bits=%d_N=%d_k=%d", dim*64, dataSize, k), func(b *testing.B) {
 						model.PreallocateHeap(k)
@@ -45,6 +47,16 @@ func BenchmarkWideModel(b *testing.B) {
 							model.Find(k, query)
 						}
 					})
+					// early abandoning only applies to thousands of bits (see BenchmarkWideModel_EarlyAbandon)
+					if dim >= 64 {
+						b.Run(fmt.Sprintf("Op=FindEarlyAbandon_bits=%d_N=%d_k=%d", dim*64, dataSize, k), func(b *testing.B) {
+							earlyAbandonModel.PreallocateHeap(k)
+							b.ResetTimer()
+							for n := 0; n < b.N; n++ {
+								earlyAbandonModel.Find(k, query)
+							}
+						})
+					}
 					for _, batchSize := range bench.batch {
 						batchSize = min(batchSize, dataSize)
 						batchSize = max(batchSize, k)
@@ -62,3 +74,65 @@ func BenchmarkWideModel(b *testing.B) {
 		}
 	}
 }
+
+// BenchmarkWideModel_EarlyAbandon compares [bitknn.WideModel.Find] with and without [bitknn.WithEarlyAbandon] on clustered data,
+// where the distances to points in other clusters quickly exceed the k-th nearest distance.
+// The widths are 4096 to 8192 bits: for 8 words or fewer, the early-abandoning search is the full one.
+func BenchmarkWideModel_EarlyAbandon(b *testing.B) {
+	const dataSize, clusters, sparsity = 100_000, 16, 3
+	for _, dim := range []int{64, 96, 128} {
+		for _, k := range []int{3, 10, 100} {
+			data := testrandom.ClusteredWideData(dim, dataSize, clusters, sparsity)
+			pack.ReallocateFlat(data)
+			query := testrandom.Noisy(data[0], sparsity)
+			model := bitknn.FitWide(data, nil)
+			earlyAbandonModel := bitknn.FitWide(data, nil, bitknn.WithEarlyAbandon())
+			b.Run(fmt.Sprintf("Op=Find_bits=%d_N=%d_k=%d", dim*64, dataSize, k), func(b *testing.B) {
+				model.PreallocateHeap(k)
+				b.ResetTimer()
+				for n := 0; n < b.N; n++ {
+					model.Find(k, query)
+				}
+			})
+			b.Run(fmt.Sprintf("Op=FindEarlyAbandon_bits=%d_N=%d_k=%d", dim*64, dataSize, k), func(b *testing.B) {
+				earlyAbandonModel.PreallocateHeap(k)
+				b.ResetTimer()
+				for n := 0; n < b.N; n++ {
+					earlyAbandonModel.Find(k, query)
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkWideModel_FindBatch(b *testing.B) {
+	for _, dim := range []int{2, 10, 128} {
+		for _, dataSize := range []int{1000, 100_000} {
+			for _, numQueries := range []int{100} {
+				for _, k := range []int{3, 10, 100} {
+					data := testrandom.WideData(dim, dataSize)
+					pack.ReallocateFlat(data)
+					model := bitknn.FitWide(data, nil)
+					queries := testrandom.WideData(dim, numQueries)
+					distances, indices := make([][]int, numQueries), make([][]int, numQueries)
+					for q := range queries {
+						distances[q], indices[q] = make([]int, k+1), make([]int, k+1)
+					}
+
+					b.Run(fmt.Sprintf("Op=FindBatch_bits=%d_N=%d_k=%d_queries=%d", dim*64, dataSize, k, numQueries), func(b *testing.B) {
+						for n := 0; n < b.N; n++ {
+							model.FindBatch(k, queries, distances, indices)
+						}
+					})
+					b.Run(fmt.Sprintf("Op=FindLoop_bits=%d_N=%d_k=%d_queries=%d", dim*64, dataSize, k, numQueries), func(b *testing.B) {
+						for n := 0; n < b.N; n++ {
+							for q, x := range queries {
+								model.FindInto(k, x, distances[q], indices[q])
+							}
+						}
+					})
+				}
+			}
+		}
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"testing"
 
 	"github.com/keilerkonzept/bitknn"
+	"github.com/keilerkonzept/bitknn/internal/testrandom"
 	"pgregory.net/rapid"
 )
 
@@ -149,3 +150,78 @@ func TestModel_PredictV_Equiv_Predict(t *testing.T) {
 		}
 	})
 }
+
+func TestNearestWideEarlyAbandon_Equiv_NearestWide(t *testing.T) {
+	rapid.Check(t, func(t *rapid.T) {
+		k := rapid.IntRange(0, 50).Draw(t, "k")
+		dims := rapid.IntRange(1, 40).Draw(t, "dims")
+		q := rapid.SliceOfN(rapid.Uint64(), dims, dims).Draw(t, "q")
+		// Points close to the query, so that some of the others are abandoned early.
+		n := rapid.IntRange(0, 300).Draw(t, "n")
+		data := make([][]uint64, n)
+		for i := range data {
+			data[i] = testrandom.Noisy(q, rapid.IntRange(0, 4).Draw(t, "sparsity"))
+		}
+		workers := rapid.IntRange(1, 4).Draw(t, "workers")
+
+		distances, indices := make([]int, k+1), make([]int, k+1)
+		count := bitknn.NearestWide(data, k, q, distances, indices)
+		ed, ei := make([]int, k+1), make([]int, k+1)
+		if ecount := bitknn.NearestWideEarlyAbandon(data, k, q, ed, ei); ecount != count {
+			t.Fatal(ecount, count)
+		}
+		if !reflect.DeepEqual(distances[:count], ed[:count]) || !reflect.DeepEqual(indices[:count], ei[:count]) {
+			t.Fatal(distances[:count], indices[:count], ed[:count], ei[:count])
+		}
+
+		m := bitknn.FitWide(data, nil, bitknn.WithEarlyAbandon(), bitknn.WithWorkers(workers))
+		md, mi := m.Find(k, q)
+		if expected, actual := sortedNeighbors(distances[:count], indices[:count]), sortedNeighbors(md, mi); !reflect.DeepEqual(expected, actual) {
+			t.Fatal(expected, actual)
+		}
+	})
+}
+
+func TestModel_FindWithin_64bitWideEquivNarrow(t *testing.T) {
+	rapid.Check(t, func(t *rapid.T) {
+		data := rapid.SliceOf(rapid.Uint64()).Draw(t, "data")
+		dataWide := make([][]uint64, len(data))
+		for i := range data {
+			dataWide[i] = []uint64{data[i]}
+		}
+		labels := rapid.SliceOfN(rapid.IntRange(0, 3), len(data), len(data)).Draw(t, "labels")
+		r := rapid.IntRange(0, 64).Draw(t, "r")
+		q := rapid.Uint64().Draw(t, "q")
+		limit := rapid.IntRange(-1, 100).Draw(t, "limit")
+
+		narrow := bitknn.Fit(data, labels)
+		wide := bitknn.FitWide(dataWide, labels)
+
+		nd, ni := narrow.FindWithin(r, q)
+		wd, wi := wide.FindWithin(r, []uint64{q})
+		if !slices.Equal(nd, wd) || !slices.Equal(ni, wi) {
+			t.Fatal(nd, ni, wd, wi)
+		}
+		nd, ni = narrow.FindWithinInto(r, q, limit, nil, nil)
+		wd, wi = wide.FindWithinInto(r, []uint64{q}, limit, nil, nil)
+		if !slices.Equal(nd, wd) || !slices.Equal(ni, wi) {
+			t.Fatal(nd, ni, wd, wi)
+		}
+
+		narrowVotes := make(bitknn.VoteMap)
+		wideVotes := make(bitknn.VoteMap)
+		if narrow.PredictWithin(r, q, narrowVotes) != wide.PredictWithin(r, []uint64{q}, wideVotes) {
+			t.Fatal("Wide model should find the same number of neighbors as the narrow model")
+		}
+		if !reflect.DeepEqual(narrowVotes, wideVotes) {
+			t.Fatal(narrowVotes, wideVotes)
+		}
+		n := narrow.PredictWithinInto(r, q, limit, nil, nil, narrowVotes)
+		if n != wide.PredictWithinInto(r, []uint64{q}, limit, nil, nil, wideVotes) {
+			t.Fatal("Wide model should find the same number of neighbors as the narrow model")
+		}
+		if !reflect.DeepEqual(narrowVotes, wideVotes) {
+			t.Fatal(narrowVotes, wideVotes)
+		}
+	})
+}
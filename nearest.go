@@ -4,6 +4,7 @@ import (
 	"math/bits"
 
 	"github.com/keilerkonzept/bitknn/internal/heap"
+	"github.com/keilerkonzept/bitknn/internal/neon"
 )
 
 // Nearest finds the nearest neighbors of the given point `x` by Hamming distance in `data`.
@@ -39,3 +40,81 @@ func Nearest(data []uint64, k int, x uint64, distances, indices []int) int {
 	}
 	return k
 }
+
+// [Nearest], but vectorized (on ARM64 with NEON, and on amd64 with AVX2 or AVX-512 instructions).
+// The `batch` array must have at least length `k`, and is used to pre-compute batches of distances.
+func NearestV(data []uint64, k int, x uint64, batch []uint32, distances, indices []int) int {
+	if k == 0 || len(data) == 0 {
+		return 0
+	}
+	_ = batch[k-1]
+	heap := heap.MakeMax(distances, indices)
+	distance0 := &distances[0]
+
+	k0 := min(k, len(data))
+	batchk0 := batch[:k0:k0]
+	neon.Distances(x, data[:k0:k0], batchk0)
+
+	for i, dist := range batchk0 {
+		heap.Push(int(dist), i)
+	}
+
+	if len(data) <= k {
+		return k0
+	}
+
+	maxDist := *distance0
+
+	b := len(batch)
+	i := k
+	for ; i <= len(data)-b; i += b {
+		neon.Distances(x, data[i:i+b], batch)
+		for j := range batch {
+			dist := int(batch[j])
+			if dist >= maxDist {
+				continue
+			}
+			heap.PushPop(dist, i+j)
+			maxDist = *distance0
+		}
+	}
+
+	remainder := len(data) - i
+	if remainder <= 0 {
+		return k
+	}
+	batch = batch[:remainder]
+
+	neon.Distances(x, data[i:], batch)
+	for j := range batch {
+		dist := int(batch[j])
+		if dist >= maxDist {
+			continue
+		}
+		heap.PushPop(dist, i+j)
+		maxDist = *distance0
+	}
+	return k
+}
+
+// Within finds the points within Hamming distance `r` of the given point `x` in `data`, in index order.
+// The neighbor's distances and indices (in `data`) are appended to the slices `distances` and `indices`.
+// If `limit` is non-negative, at most `limit` neighbors are appended.
+func Within(data []uint64, r int, x uint64, limit int, distances, indices []int) ([]int, []int) {
+	if limit < 0 {
+		limit = len(data)
+	}
+	for i, d := range data {
+		if limit == 0 {
+			break
+		}
+		dist := bits.OnesCount64(x ^ d)
+		if dist > r {
+			continue
+		}
+		distances = append(distances, dist)
+		indices = append(indices, i)
+		limit--
+	}
+	return distances, indices
+}
@@ -0,0 +1,128 @@
+package bitknn
+
+import (
+	"math/bits"
+
+	"github.com/keilerkonzept/bitknn/internal/heap"
+)
+
+// Size in bytes of the data blocks scanned for all queries at once by [NearestBatch] and [NearestWideBatch].
+// Chosen to fit into the L2 cache.
+const batchBlockBytes = 128 << 10
+
+// NearestBatch is [Nearest] for many query points at once.
+// The data is scanned in cache-sized blocks, each of which is searched for all queries before moving on to the next one.
+// The neighbor's distances and indices for `queries[q]` are written to the slices `distances[q]` and `indices[q]`,
+// with the same results as [Nearest].
+// Returns the number of neighbors found for each query.
+// pre:
+//
+//	len(distances) = len(indices) >= len(queries)
+//	cap(distances[q]) = cap(indices[q]) = k+1 >= 1
+func NearestBatch(data []uint64, k int, queries []uint64, distances, indices [][]int) int {
+	k0 := min(k, len(data))
+	for q, x := range queries {
+		heap := heap.MakeMax(distances[q], indices[q])
+		for i, d := range data[:k0] {
+			heap.Push(bits.OnesCount64(x^d), i)
+		}
+	}
+	if len(data) <= k {
+		return k0
+	}
+
+	blockSize := batchBlockBytes / 8
+	for start := k; start < len(data); start += blockSize {
+		block := data[start:min(start+blockSize, len(data))]
+		q := 0
+		for ; q+4 <= len(queries); q += 4 {
+			nearestBlock4(block, start, k, queries[q:q+4:q+4], distances[q:q+4:q+4], indices[q:q+4:q+4])
+		}
+		for ; q < len(queries); q++ {
+			x := queries[q]
+			distances, indices := distances[q], indices[q]
+			heap := heap.MakeMaxLen(distances, indices, k)
+			distance0 := &distances[0]
+			maxDist := *distance0
+			for j, d := range block {
+				dist := bits.OnesCount64(x ^ d)
+				if dist >= maxDist {
+					continue
+				}
+				heap.PushPop(dist, start+j)
+				maxDist = *distance0
+			}
+		}
+	}
+	return k
+}
+
+// nearestBlock4 searches a block of data starting at index `start` for four queries at once.
+func nearestBlock4(block []uint64, start int, k int, queries []uint64, distances, indices [][]int) {
+	x0, x1, x2, x3 := queries[0], queries[1], queries[2], queries[3]
+	h0 := heap.MakeMaxLen(distances[0], indices[0], k)
+	h1 := heap.MakeMaxLen(distances[1], indices[1], k)
+	h2 := heap.MakeMaxLen(distances[2], indices[2], k)
+	h3 := heap.MakeMaxLen(distances[3], indices[3], k)
+	d0, d1, d2, d3 := &distances[0][0], &distances[1][0], &distances[2][0], &distances[3][0]
+	m0, m1, m2, m3 := *d0, *d1, *d2, *d3
+	for j, d := range block {
+		if dist := bits.OnesCount64(x0 ^ d); dist < m0 {
+			h0.PushPop(dist, start+j)
+			m0 = *d0
+		}
+		if dist := bits.OnesCount64(x1 ^ d); dist < m1 {
+			h1.PushPop(dist, start+j)
+			m1 = *d1
+		}
+		if dist := bits.OnesCount64(x2 ^ d); dist < m2 {
+			h2.PushPop(dist, start+j)
+			m2 = *d2
+		}
+		if dist := bits.OnesCount64(x3 ^ d); dist < m3 {
+			h3.PushPop(dist, start+j)
+			m3 = *d3
+		}
+	}
+}
+
+// [NearestBatch], but for wide data.
+func NearestWideBatch(data [][]uint64, k int, queries [][]uint64, distances, indices [][]int) int {
+	k0 := min(k, len(data))
+	for q, x := range queries {
+		heap := heap.MakeMax(distances[q], indices[q])
+		for i, d := range data[:k0] {
+			dist := 0
+			for j, x := range x {
+				dist += bits.OnesCount64(d[j] ^ x)
+			}
+			heap.Push(dist, i)
+		}
+	}
+	if len(data) <= k || len(queries) == 0 {
+		return k0
+	}
+
+	blockSize := max(batchBlockBytes/(8*max(len(queries[0]), 1)), 1)
+	for start := k; start < len(data); start += blockSize {
+		block := data[start:min(start+blockSize, len(data))]
+		for q, x := range queries {
+			distances, indices := distances[q], indices[q]
+			heap := heap.MakeMaxLen(distances, indices, k)
+			distance0 := &distances[0]
+			maxDist := *distance0
+			for i, d := range block {
+				dist := 0
+				for j, x := range x {
+					dist += bits.OnesCount64(d[j] ^ x)
+				}
+				if dist >= maxDist {
+					continue
+				}
+				heap.PushPop(dist, start+i)
+				maxDist = *distance0
+			}
+		}
+	}
+	return k
+}
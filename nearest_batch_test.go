@@ -0,0 +1,126 @@
+package bitknn_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/keilerkonzept/bitknn"
+	"github.com/keilerkonzept/bitknn/internal/testrandom"
+	"pgregory.net/rapid"
+)
+
+func makeHeaps(queries int, k int) ([][]int, [][]int) {
+	distances, indices := make([][]int, queries), make([][]int, queries)
+	for q := range distances {
+		distances[q], indices[q] = make([]int, k+1), make([]int, k+1)
+	}
+	return distances, indices
+}
+
+func TestModel_FindBatch_Equiv_Find(t *testing.T) {
+	rapid.Check(t, func(t *rapid.T) {
+		k := rapid.IntRange(0, 100).Draw(t, "k")
+		n := rapid.SampledFrom([]int{0, 1, 100, 16_384, 16_484, 50_000}).Draw(t, "n")
+		data := testrandom.Data(n)
+		queries := rapid.SliceOf(rapid.Uint64()).Draw(t, "queries")
+
+		model := bitknn.Fit(data, nil)
+		distances, indices := makeHeaps(len(queries), k)
+		count := model.FindBatch(k, queries, distances, indices)
+		for q, x := range queries {
+			ds, is := model.Find(k, x)
+			if count != len(ds) {
+				t.Fatal(count, len(ds))
+			}
+			if !reflect.DeepEqual(ds, distances[q][:count]) {
+				t.Fatal(ds, distances[q][:count])
+			}
+			if !reflect.DeepEqual(is, indices[q][:count]) {
+				t.Fatal(is, indices[q][:count])
+			}
+		}
+	})
+}
+
+func TestWideModel_FindBatch_Equiv_Find(t *testing.T) {
+	rapid.Check(t, func(t *rapid.T) {
+		k := rapid.IntRange(0, 100).Draw(t, "k")
+		dims := rapid.IntRange(1, 100).Draw(t, "dims")
+		n := rapid.SampledFrom([]int{0, 1, 100, 2_000}).Draw(t, "n")
+		data := testrandom.WideData(dims, n)
+		queries := rapid.SliceOf(rapid.SliceOfN(rapid.Uint64(), dims, dims)).Draw(t, "queries")
+
+		model := bitknn.FitWide(data, nil)
+		distances, indices := makeHeaps(len(queries), k)
+		count := model.FindBatch(k, queries, distances, indices)
+		for q, x := range queries {
+			ds, is := model.Find(k, x)
+			if count != len(ds) {
+				t.Fatal(count, len(ds))
+			}
+			if !reflect.DeepEqual(ds, distances[q][:count]) {
+				t.Fatal(ds, distances[q][:count])
+			}
+			if !reflect.DeepEqual(is, indices[q][:count]) {
+				t.Fatal(is, indices[q][:count])
+			}
+		}
+	})
+}
+
+func TestModel_FindBatch_Reuse(t *testing.T) {
+	rapid.Check(t, func(t *rapid.T) {
+		k := rapid.IntRange(0, 20).Draw(t, "k")
+		n := rapid.SampledFrom([]int{0, 1, 100, 1_000}).Draw(t, "n")
+		dims := rapid.IntRange(1, 3).Draw(t, "dims")
+		data := testrandom.WideData(dims, n)
+		narrowData := make([]uint64, n)
+		for i, d := range data {
+			narrowData[i] = d[0]
+		}
+		var opts, narrowOpts []bitknn.Option
+		switch rapid.IntRange(0, 2).Draw(t, "options") {
+		case 0:
+			opts = append(opts, bitknn.WithDataMasks(maskWords(t, n)))
+			wideMasks := make([][]uint64, n)
+			for i := range wideMasks {
+				wideMasks[i] = maskWords(t, dims)
+			}
+			opts = append(opts, bitknn.WithWideDataMasks(wideMasks))
+		case 1:
+			weights, bitWeights := bitWeights(t, dims)
+			opts = append(opts, bitknn.WithBitWeights(bitWeights))
+			narrowOpts = append(narrowOpts, bitknn.WithBitWeights(bitknn.NewBitWeights(weights[:64])))
+		case 2:
+			opts = append(opts, bitknn.WithRandomTieBreaking(rapid.Uint64().Draw(t, "seed")))
+		}
+		narrow := bitknn.Fit(narrowData, nil, append(opts[:len(opts):len(opts)], narrowOpts...)...)
+		wide := bitknn.FitWide(data, nil, opts...)
+
+		// The same buffers are searched into repeatedly, and must keep holding k+1 neighbors.
+		distances, indices := makeHeaps(2, k)
+		for range 2 {
+			queries := rapid.SliceOfN(rapid.SliceOfN(rapid.Uint64(), dims, dims), 2, 2).Draw(t, "queries")
+			count := narrow.FindBatch(k, []uint64{queries[0][0], queries[1][0]}, distances, indices)
+			for q, x := range queries {
+				ds, is := narrow.Find(k, x[0])
+				if count != len(ds) || len(distances[q]) != k+1 || len(indices[q]) != k+1 {
+					t.Fatal(count, len(ds), len(distances[q]), len(indices[q]))
+				}
+				if !reflect.DeepEqual(ds, distances[q][:count]) || !reflect.DeepEqual(is, indices[q][:count]) {
+					t.Fatal(ds, is, distances[q][:count], indices[q][:count])
+				}
+			}
+			count = wide.FindBatch(k, queries, distances, indices)
+			for q, x := range queries {
+				ds, is := wide.Find(k, x)
+				if count != len(ds) || len(distances[q]) != k+1 || len(indices[q]) != k+1 {
+					t.Fatal(count, len(ds), len(distances[q]), len(indices[q]))
+				}
+				if !reflect.DeepEqual(ds, distances[q][:count]) || !reflect.DeepEqual(is, indices[q][:count]) {
+					t.Fatal(ds, is, distances[q][:count], indices[q][:count])
+				}
+			}
+		}
+	})
+}
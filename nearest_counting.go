@@ -0,0 +1,43 @@
+package bitknn
+
+import (
+	"github.com/keilerkonzept/bitknn/internal/topk"
+)
+
+// [Nearest], but selects the neighbors by counting the candidates at each distance instead of using a heap.
+// Finds the same neighbors as [Nearest], but writes them in index order.
+// Faster than [Nearest] for large k, where maintaining the heap dominates.
+func NearestCounting(data []uint64, k int, x uint64, distances, indices []int) int {
+	if k == 0 {
+		return 0
+	}
+	c := topk.Get(k, 64)
+	defer topk.Put(c)
+	pushNearest(c, data, x)
+	distances, _ = c.Append(distances[:0], indices[:0])
+	return len(distances)
+}
+
+// [NearestCounting], but for wide data.
+func NearestWideCounting(data [][]uint64, k int, x []uint64, distances, indices []int) int {
+	if k == 0 {
+		return 0
+	}
+	c := topk.Get(k, 64*len(x))
+	defer topk.Put(c)
+	pushNearestWide(c, data, x)
+	distances, _ = c.Append(distances[:0], indices[:0])
+	return len(distances)
+}
+
+// [NearestCounting], but for wide data stored in a single flat slice (see [NearestFlat]).
+func NearestFlatCounting(data []uint64, stride int, k int, x []uint64, distances, indices []int) int {
+	if k == 0 || stride == 0 || len(x) != stride {
+		return 0
+	}
+	c := topk.Get(k, 64*len(x))
+	defer topk.Put(c)
+	pushNearestFlat(c, data, x)
+	distances, _ = c.Append(distances[:0], indices[:0])
+	return len(distances)
+}
@@ -0,0 +1,128 @@
+package bitknn_test
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/keilerkonzept/bitknn"
+	"github.com/keilerkonzept/bitknn/internal/testrandom"
+	"github.com/keilerkonzept/bitknn/pack"
+	"pgregory.net/rapid"
+)
+
+func TestNearestCounting_Equiv_Nearest(t *testing.T) {
+	rapid.Check(t, func(t *rapid.T) {
+		k := rapid.IntRange(0, 200).Draw(t, "k")
+		n := rapid.SampledFrom([]int{0, 10, 100, 1000, 5000}).Draw(t, "n")
+		data := testrandom.Data(n)
+		q := rapid.Uint64().Draw(t, "q")
+
+		distances, indices := make([]int, k+1), make([]int, k+1)
+		count := bitknn.Nearest(data, k, q, distances, indices)
+		cd, ci := make([]int, k+1), make([]int, k+1)
+		if ccount := bitknn.NearestCounting(data, k, q, cd, ci); ccount != count {
+			t.Fatal(ccount, count)
+		}
+		expected := sortedNeighbors(distances[:count], indices[:count])
+		if actual := sortedNeighbors(cd[:count], ci[:count]); !reflect.DeepEqual(expected, actual) {
+			t.Fatal(expected, actual)
+		}
+	})
+}
+
+func TestNearestWideCounting_Equiv_NearestWide(t *testing.T) {
+	rapid.Check(t, func(t *rapid.T) {
+		k := rapid.IntRange(0, 200).Draw(t, "k")
+		dims := rapid.IntRange(1, 8).Draw(t, "dims")
+		n := rapid.SampledFrom([]int{0, 10, 100, 1000, 5000}).Draw(t, "n")
+		data := testrandom.WideData(dims, n)
+		q := rapid.SliceOfN(rapid.Uint64(), dims, dims).Draw(t, "q")
+
+		distances, indices := make([]int, k+1), make([]int, k+1)
+		count := bitknn.NearestWide(data, k, q, distances, indices)
+		expected := sortedNeighbors(distances[:count], indices[:count])
+
+		cd, ci := make([]int, k+1), make([]int, k+1)
+		if ccount := bitknn.NearestWideCounting(data, k, q, cd, ci); ccount != count {
+			t.Fatal(ccount, count)
+		}
+		if actual := sortedNeighbors(cd[:count], ci[:count]); !reflect.DeepEqual(expected, actual) {
+			t.Fatal(expected, actual)
+		}
+		if ccount := bitknn.NearestFlatCounting(pack.Flatten(data), dims, k, q, cd, ci); ccount != count {
+			t.Fatal(ccount, count)
+		}
+		if actual := sortedNeighbors(cd[:count], ci[:count]); !reflect.DeepEqual(expected, actual) {
+			t.Fatal(expected, actual)
+		}
+	})
+}
+
+func TestModel_WithSelection(t *testing.T) {
+	rapid.Check(t, func(t *rapid.T) {
+		k := rapid.SampledFrom([]int{0, 1, 10, 100, 300}).Draw(t, "k")
+		dims := rapid.IntRange(1, 4).Draw(t, "dims")
+		n := rapid.SampledFrom([]int{0, 100, 5000}).Draw(t, "n")
+		selection := rapid.SampledFrom([]bitknn.Selection{bitknn.SelectionCounting, bitknn.SelectionAuto}).Draw(t, "selection")
+		data := testrandom.WideData(dims, n)
+		narrowData := make([]uint64, n)
+		for i := range data {
+			narrowData[i] = data[i][0]
+		}
+		labels := testrandom.Labels(n)
+		q := rapid.SliceOfN(rapid.Uint64(), dims, dims).Draw(t, "q")
+
+		{
+			heap := bitknn.Fit(narrowData, labels)
+			counting := bitknn.Fit(narrowData, labels, bitknn.WithSelection(selection))
+			hd, hi := heap.Find(k, q[0])
+			cd, ci := counting.Find(k, q[0])
+			if !reflect.DeepEqual(sortedNeighbors(hd, hi), sortedNeighbors(cd, ci)) {
+				t.Fatal(hd, hi, cd, ci)
+			}
+			hv, cv := make(bitknn.VoteMap), make(bitknn.VoteMap)
+			heap.Predict(k, q[0], hv)
+			counting.Predict(k, q[0], cv)
+			if !reflect.DeepEqual(hv, cv) {
+				t.Fatal(hv, cv)
+			}
+		}
+		{
+			heap := bitknn.FitWide(data, labels)
+			counting := bitknn.FitWide(data, labels, bitknn.WithSelection(selection))
+			flat := bitknn.FitFlatWide(pack.Flatten(data), dims, labels, bitknn.WithSelection(selection))
+			hd, hi := heap.Find(k, q)
+			cd, ci := counting.Find(k, q)
+			if !reflect.DeepEqual(sortedNeighbors(hd, hi), sortedNeighbors(cd, ci)) {
+				t.Fatal(hd, hi, cd, ci)
+			}
+			cd, ci = flat.Find(k, q)
+			if !reflect.DeepEqual(sortedNeighbors(hd, hi), sortedNeighbors(cd, ci)) {
+				t.Fatal(hd, hi, cd, ci)
+			}
+		}
+	})
+}
+
+func BenchmarkNearestCounting(b *testing.B) {
+	const dataSize = 100_000
+	for _, dim := range []int{1, 2, 10, 128} {
+		data := testrandom.WideData(dim, dataSize)
+		pack.ReallocateFlat(data)
+		query := testrandom.WideQuery(dim)
+		for _, k := range []int{3, 10, 100, 1000} {
+			distances, indices := make([]int, k+1), make([]int, k+1)
+			b.Run(fmt.Sprintf("Op=Heap_bits=%d_N=%d_k=%d", dim*64, dataSize, k), func(b *testing.B) {
+				for n := 0; n < b.N; n++ {
+					bitknn.NearestWide(data, k, query, distances, indices)
+				}
+			})
+			b.Run(fmt.Sprintf("Op=Counting_bits=%d_N=%d_k=%d", dim*64, dataSize, k), func(b *testing.B) {
+				for n := 0; n < b.N; n++ {
+					bitknn.NearestWideCounting(data, k, query, distances, indices)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package bitknn
+
+import (
+	"math/bits"
+
+	"github.com/keilerkonzept/bitknn/internal/heap"
+	"github.com/keilerkonzept/bitknn/internal/neon"
+)
+
+// [NearestWide], but for wide data stored in a single flat slice.
+// The data points are stored consecutively, each with `stride` words.
+// Finds no neighbors unless `x` has `stride` words.
+func NearestFlat(data []uint64, stride int, k int, x []uint64, distances, indices []int) int {
+	s := stride
+	if s == 0 || len(x) != s {
+		return 0
+	}
+	heap := heap.MakeMax(distances, indices)
+	distance0 := &distances[0]
+
+	n := len(data) / s
+	k0 := min(k, n)
+	for i := range k0 {
+		d := data[i*s : (i+1)*s]
+		dist := 0
+		for j, x := range x {
+			dist += bits.OnesCount64(d[j] ^ x)
+		}
+		heap.Push(dist, i)
+	}
+
+	if n <= k {
+		return k0
+	}
+
+	maxDist := *distance0
+	for i := k; i < n; i++ {
+		d := data[i*s : (i+1)*s]
+		dist := 0
+		for j, x := range x {
+			dist += bits.OnesCount64(d[j] ^ x)
+		}
+		if dist >= maxDist {
+			continue
+		}
+		heap.PushPop(dist, i)
+		maxDist = *distance0
+	}
+	return k
+}
+
+// [NearestFlat], but vectorized (on ARM64 with NEON, and on amd64 with AVX2 or AVX-512 instructions).
+// The `batch` array must have at least length `k`, and is used to pre-compute batches of distances.
+func NearestFlatV(data []uint64, stride int, k int, x []uint64, batch []uint32, distances, indices []int) int {
+	s := stride
+	if k == 0 || s == 0 || len(x) != s || len(data) < s {
+		return 0
+	}
+	_ = batch[k-1]
+	heap := heap.MakeMax(distances, indices)
+	distance0 := &distances[0]
+
+	n := len(data) / s
+	k0 := min(k, n)
+	batchk0 := batch[:k0:k0]
+	neon.DistancesFlat(x, data[:k0*s], batchk0)
+
+	for i, dist := range batchk0 {
+		heap.Push(int(dist), i)
+	}
+
+	if n <= k {
+		return k0
+	}
+
+	maxDist := *distance0
+
+	b := len(batch)
+	i := k
+	for ; i <= n-b; i += b {
+		neon.DistancesFlat(x, data[i*s:(i+b)*s], batch)
+		for j := range batch {
+			dist := int(batch[j])
+			if dist >= maxDist {
+				continue
+			}
+			heap.PushPop(dist, i+j)
+			maxDist = *distance0
+		}
+	}
+
+	remainder := n - i
+	if remainder <= 0 {
+		return k
+	}
+	batch = batch[:remainder]
+
+	neon.DistancesFlat(x, data[i*s:n*s], batch)
+	for j := range batch {
+		dist := int(batch[j])
+		if dist >= maxDist {
+			continue
+		}
+		heap.PushPop(dist, i+j)
+		maxDist = *distance0
+	}
+	return k
+}
@@ -0,0 +1,497 @@
+package bitknn
+
+import (
+	"math/bits"
+
+	"github.com/keilerkonzept/bitknn/internal/heap"
+	"github.com/keilerkonzept/bitknn/internal/neon"
+	"github.com/keilerkonzept/bitknn/internal/topk"
+)
+
+// [Nearest], but only counting the bits set in `mask`, i.e. by the masked Hamming distance `popcount((x ^ d) & mask)`.
+// The bits cleared in the mask are "don't care" bits, such as missing features of the query.
+func NearestMasked(data []uint64, k int, x, mask uint64, distances, indices []int) int {
+	heap := heap.MakeMax(distances, indices)
+	distance0 := &distances[0]
+
+	k0 := min(k, len(data))
+
+	for i, d := range data[:k0] {
+		dist := bits.OnesCount64((x ^ d) & mask)
+		heap.Push(dist, i)
+	}
+
+	if len(data) <= k {
+		return k0
+	}
+
+	maxDist := *distance0
+	_ = data[k]
+	for i := k; i < len(data); i++ {
+		dist := bits.OnesCount64((x ^ data[i]) & mask)
+		if dist >= maxDist {
+			continue
+		}
+		heap.PushPop(dist, i)
+		maxDist = *distance0
+	}
+	return k
+}
+
+// [NearestWide], but only counting the bits set in `mask` (see [NearestMasked]), which must have the same length as `x`.
+func NearestWideMasked(data [][]uint64, k int, x, mask []uint64, distances, indices []int) int {
+	heap := heap.MakeMax(distances, indices)
+	distance0 := &distances[0]
+	mask = mask[:len(x)]
+
+	k0 := min(k, len(data))
+	for i, d := range data[:k0] {
+		dist := 0
+		for j, x := range x {
+			dist += bits.OnesCount64((d[j] ^ x) & mask[j])
+		}
+		heap.Push(dist, i)
+	}
+
+	if len(data) <= k {
+		return k0
+	}
+
+	maxDist := *distance0
+	_ = data[k]
+	for i := k; i < len(data); i++ {
+		dist := 0
+		d := data[i]
+		for j, x := range x {
+			dist += bits.OnesCount64((d[j] ^ x) & mask[j])
+		}
+		if dist >= maxDist {
+			continue
+		}
+		heap.PushPop(dist, i)
+		maxDist = *distance0
+	}
+	return k
+}
+
+// [NearestWideMasked], but vectorized (on ARM64 with NEON, and on amd64 with AVX-512 instructions).
+// The `batch` array must have at least length `k`, and is used to pre-compute batches of distances.
+func NearestWideMaskedV(data [][]uint64, k int, x, mask []uint64, batch []uint32, distances, indices []int) int {
+	if k == 0 || len(data) == 0 {
+		return 0
+	}
+	_ = batch[k-1]
+	heap := heap.MakeMax(distances, indices)
+	distance0 := &distances[0]
+	mask = mask[:len(x)]
+
+	k0 := min(k, len(data))
+	datak0 := data[:k0:k0]
+
+	batchk0 := batch[:k0:k0]
+	neon.DistancesWideMasked(x, mask, datak0, batchk0)
+
+	for i, dist := range batchk0 {
+		heap.Push(int(dist), i)
+	}
+
+	if len(data) <= k {
+		return k0
+	}
+
+	maxDist := *distance0
+
+	b := len(batch)
+	_ = data[k]
+	i := k
+	for ; i <= len(data)-b; i += b {
+		neon.DistancesWideMasked(x, mask, data[i:i+b], batch)
+		for j := range batch {
+			dist := int(batch[j])
+			if dist >= maxDist {
+				continue
+			}
+			heap.PushPop(dist, i+j)
+			maxDist = *distance0
+		}
+	}
+
+	remainder := len(data) - i
+	if remainder <= 0 {
+		return k
+	}
+	_ = batch[remainder-1]
+
+	neon.DistancesWideMasked(x, mask, data[i:], batch)
+	for j := range remainder {
+		dist := int(batch[j])
+		if dist >= maxDist {
+			continue
+		}
+		heap.PushPop(dist, i+j)
+		maxDist = *distance0
+	}
+	return k
+}
+
+// NormalizeMaskedDistances rescales the given masked Hamming distances, counting `active` of `width` bits,
+// to the full width (rounding to the nearest integer), as if the unmasked bits differed in the same proportion.
+// If no bits are active, the distances are left unchanged.
+func NormalizeMaskedDistances(distances []int, active, width int) {
+	if active == 0 || active == width {
+		return
+	}
+	for i, dist := range distances {
+		distances[i] = normalizeMaskedDistance(dist, active, width)
+	}
+}
+
+// normalizeMaskedDistance rescales a single masked distance (see [NormalizeMaskedDistances]).
+func normalizeMaskedDistance(dist, active, width int) int {
+	if active == 0 {
+		return dist
+	}
+	return (dist*width + active/2) / active
+}
+
+// onesCount returns the number of bits set in the given words.
+func onesCount(words []uint64) int {
+	n := 0
+	for _, w := range words {
+		n += bits.OnesCount64(w)
+	}
+	return n
+}
+
+// [Nearest], but only counting the bits that are known for both the query and each data point,
+// i.e. by the distance `popcount((x ^ data[i]) & masks[i] & mask)`,
+// where `masks` are the validity masks of the data points (of the same length as `data`), and `mask` is the query's.
+// Data points without any bits in common with the query are at the maximum distance 64, so that they are found last.
+func NearestDataMasked(data, masks []uint64, k int, x, mask uint64, distances, indices []int) int {
+	return nearestDataMasked(data, masks, k, x, mask, false, distances, indices)
+}
+
+// [NearestDataMasked], but by the distance rescaled to 64 bits by the number of bits known for both the query and each data point,
+// i.e. by `64 * mismatches / comparable` bits, rounded to the nearest integer (see [NormalizeDataMaskedDistances]).
+// Unlike normalizing the distances of the neighbors found by [NearestDataMasked], this finds the nearest neighbors by the rescaled distance.
+// Data points without any bits in common with the query are at distance 64.
+func NearestDataMaskedNormalized(data, masks []uint64, k int, x, mask uint64, distances, indices []int) int {
+	return nearestDataMasked(data, masks, k, x, mask, true, distances, indices)
+}
+
+// nearestDataMasked is [NearestDataMasked], or [NearestDataMaskedNormalized] if `normalize` is set.
+func nearestDataMasked(data, masks []uint64, k int, x, mask uint64, normalize bool, distances, indices []int) int {
+	heap := heap.MakeMax(distances, indices)
+	distance0 := &distances[0]
+	masks = masks[:len(data)]
+
+	k0 := min(k, len(data))
+
+	for i, d := range data[:k0] {
+		dist := dataMaskedDistance(d, masks[i], x, mask, normalize)
+		heap.Push(dist, i)
+	}
+
+	if len(data) <= k {
+		return k0
+	}
+
+	maxDist := *distance0
+	_ = data[k]
+	for i := k; i < len(data); i++ {
+		dist := dataMaskedDistance(data[i], masks[i], x, mask, normalize)
+		if dist >= maxDist {
+			continue
+		}
+		heap.PushPop(dist, i)
+		maxDist = *distance0
+	}
+	return k
+}
+
+// [NearestDataMasked], but for wide data. The query mask `mask` must either have the same length as `x`,
+// or be nil to only count the bits known for each data point.
+// Data points without any bits in common with the query are at the maximum distance `64 * len(x)`.
+func NearestWideDataMasked(data, masks [][]uint64, k int, x, mask []uint64, distances, indices []int) int {
+	return nearestWideDataMasked(data, masks, k, x, mask, false, distances, indices)
+}
+
+// [NearestWideDataMasked], but by the distance rescaled to the full width `64 * len(x)` (see [NearestDataMaskedNormalized]).
+func NearestWideDataMaskedNormalized(data, masks [][]uint64, k int, x, mask []uint64, distances, indices []int) int {
+	return nearestWideDataMasked(data, masks, k, x, mask, true, distances, indices)
+}
+
+// nearestWideDataMasked is [NearestWideDataMasked], or [NearestWideDataMaskedNormalized] if `normalize` is set.
+func nearestWideDataMasked(data, masks [][]uint64, k int, x, mask []uint64, normalize bool, distances, indices []int) int {
+	heap := heap.MakeMax(distances, indices)
+	distance0 := &distances[0]
+	masks = masks[:len(data)]
+
+	k0 := min(k, len(data))
+	for i, d := range data[:k0] {
+		dist := dataMaskedDistanceWide(d, masks[i], x, mask, normalize)
+		heap.Push(dist, i)
+	}
+
+	if len(data) <= k {
+		return k0
+	}
+
+	maxDist := *distance0
+	_ = data[k]
+	for i := k; i < len(data); i++ {
+		dist := dataMaskedDistanceWide(data[i], masks[i], x, mask, normalize)
+		if dist >= maxDist {
+			continue
+		}
+		heap.PushPop(dist, i)
+		maxDist = *distance0
+	}
+	return k
+}
+
+// [NearestTies], but by the distance of [NearestMasked].
+func NearestMaskedTies(data []uint64, k int, x, mask uint64, tieBreaking TieBreaking, seed uint64, distances, indices []int) ([]int, []int) {
+	if k == 0 {
+		return distances, indices
+	}
+	c := topk.Get(k, 64)
+	defer topk.Put(c)
+	c.SetTies(tieBreaking.ties(), seed)
+	pushNearestMasked(c, data, x, mask)
+	return c.Append(distances, indices)
+}
+
+// [NearestWideTies], but by the distance of [NearestWideMasked].
+func NearestWideMaskedTies(data [][]uint64, k int, x, mask []uint64, tieBreaking TieBreaking, seed uint64, distances, indices []int) ([]int, []int) {
+	if k == 0 {
+		return distances, indices
+	}
+	c := topk.Get(k, 64*len(x))
+	defer topk.Put(c)
+	c.SetTies(tieBreaking.ties(), seed)
+	pushNearestWideMasked(c, data, x, mask)
+	return c.Append(distances, indices)
+}
+
+// [NearestTies], but by the distance of [NearestDataMasked].
+func NearestDataMaskedTies(data, masks []uint64, k int, x, mask uint64, tieBreaking TieBreaking, seed uint64, distances, indices []int) ([]int, []int) {
+	return nearestDataMaskedTies(data, masks, k, x, mask, false, tieBreaking, seed, distances, indices)
+}
+
+// [NearestTies], but by the distance of [NearestDataMaskedNormalized].
+func NearestDataMaskedNormalizedTies(data, masks []uint64, k int, x, mask uint64, tieBreaking TieBreaking, seed uint64, distances, indices []int) ([]int, []int) {
+	return nearestDataMaskedTies(data, masks, k, x, mask, true, tieBreaking, seed, distances, indices)
+}
+
+// nearestDataMaskedTies is [NearestDataMaskedTies], or [NearestDataMaskedNormalizedTies] if `normalize` is set.
+func nearestDataMaskedTies(data, masks []uint64, k int, x, mask uint64, normalize bool, tieBreaking TieBreaking, seed uint64, distances, indices []int) ([]int, []int) {
+	if k == 0 {
+		return distances, indices
+	}
+	c := topk.Get(k, 64)
+	defer topk.Put(c)
+	c.SetTies(tieBreaking.ties(), seed)
+	pushNearestDataMasked(c, data, masks, x, mask, normalize)
+	return c.Append(distances, indices)
+}
+
+// [NearestWideTies], but by the distance of [NearestWideDataMasked].
+func NearestWideDataMaskedTies(data, masks [][]uint64, k int, x, mask []uint64, tieBreaking TieBreaking, seed uint64, distances, indices []int) ([]int, []int) {
+	return nearestWideDataMaskedTies(data, masks, k, x, mask, false, tieBreaking, seed, distances, indices)
+}
+
+// [NearestWideTies], but by the distance of [NearestWideDataMaskedNormalized].
+func NearestWideDataMaskedNormalizedTies(data, masks [][]uint64, k int, x, mask []uint64, tieBreaking TieBreaking, seed uint64, distances, indices []int) ([]int, []int) {
+	return nearestWideDataMaskedTies(data, masks, k, x, mask, true, tieBreaking, seed, distances, indices)
+}
+
+// nearestWideDataMaskedTies is [NearestWideDataMaskedTies], or [NearestWideDataMaskedNormalizedTies] if `normalize` is set.
+func nearestWideDataMaskedTies(data, masks [][]uint64, k int, x, mask []uint64, normalize bool, tieBreaking TieBreaking, seed uint64, distances, indices []int) ([]int, []int) {
+	if k == 0 {
+		return distances, indices
+	}
+	c := topk.Get(k, 64*len(x))
+	defer topk.Put(c)
+	c.SetTies(tieBreaking.ties(), seed)
+	pushNearestWideDataMasked(c, data, masks, x, mask, normalize)
+	return c.Append(distances, indices)
+}
+
+// [Within], but by the distance of [NearestDataMasked].
+func WithinDataMasked(data, masks []uint64, r int, x, mask uint64, limit int, distances, indices []int) ([]int, []int) {
+	return withinDataMasked(data, masks, r, x, mask, false, limit, distances, indices)
+}
+
+// withinDataMasked is [WithinDataMasked], or by the distance of [NearestDataMaskedNormalized] if `normalize` is set.
+func withinDataMasked(data, masks []uint64, r int, x, mask uint64, normalize bool, limit int, distances, indices []int) ([]int, []int) {
+	if limit < 0 {
+		limit = len(data)
+	}
+	masks = masks[:len(data)]
+	for i, d := range data {
+		if limit == 0 {
+			break
+		}
+		dist := dataMaskedDistance(d, masks[i], x, mask, normalize)
+		if dist > r {
+			continue
+		}
+		distances = append(distances, dist)
+		indices = append(indices, i)
+		limit--
+	}
+	return distances, indices
+}
+
+// [WithinWide], but by the distance of [NearestWideDataMasked].
+func WithinWideDataMasked(data, masks [][]uint64, r int, x, mask []uint64, limit int, distances, indices []int) ([]int, []int) {
+	return withinWideDataMasked(data, masks, r, x, mask, false, limit, distances, indices)
+}
+
+// withinWideDataMasked is [WithinWideDataMasked], or by the distance of [NearestWideDataMaskedNormalized] if `normalize` is set.
+func withinWideDataMasked(data, masks [][]uint64, r int, x, mask []uint64, normalize bool, limit int, distances, indices []int) ([]int, []int) {
+	if limit < 0 {
+		limit = len(data)
+	}
+	masks = masks[:len(data)]
+	for i, d := range data {
+		if limit == 0 {
+			break
+		}
+		dist := dataMaskedDistanceWide(d, masks[i], x, mask, normalize)
+		if dist > r {
+			continue
+		}
+		distances = append(distances, dist)
+		indices = append(indices, i)
+		limit--
+	}
+	return distances, indices
+}
+
+// NormalizeDataMaskedDistances rescales the distances of the given neighbors found by [NearestDataMasked] to 64 bits,
+// each by the number of bits known for both the query and the neighbor, i.e. to `64 * mismatches / comparable` bits (see [NormalizeMaskedDistances]).
+// The distances of neighbors without comparable bits, the maximum distance 64, are left unchanged.
+// To find the nearest neighbors by the rescaled distance, use [NearestDataMaskedNormalized] instead.
+func NormalizeDataMaskedDistances(distances, indices []int, masks []uint64, mask uint64) {
+	for i, dist := range distances {
+		distances[i] = normalizeMaskedDistance(dist, bits.OnesCount64(masks[indices[i]]&mask), 64)
+	}
+}
+
+// [NormalizeDataMaskedDistances], but for neighbors found by [NearestWideDataMasked], whose distances are rescaled to the full width of the data points.
+// To find the nearest neighbors by the rescaled distance, use [NearestWideDataMaskedNormalized] instead.
+func NormalizeWideDataMaskedDistances(distances, indices []int, masks [][]uint64, mask []uint64) {
+	for i, dist := range distances {
+		m := masks[indices[i]]
+		distances[i] = normalizeMaskedDistance(dist, dataMaskedOnesCount(m, mask), 64*len(m))
+	}
+}
+
+// pushNearestMasked is [pushNearest] by the distance of [NearestMasked].
+func pushNearestMasked(c *topk.Counting, data []uint64, x, mask uint64) {
+	t := c.Threshold()
+	for i, d := range data {
+		dist := bits.OnesCount64((x ^ d) & mask)
+		if dist > t {
+			continue
+		}
+		c.Push(dist, i)
+		t = c.Threshold()
+	}
+}
+
+// pushNearestWideMasked is [pushNearestWide] by the distance of [NearestWideMasked].
+func pushNearestWideMasked(c *topk.Counting, data [][]uint64, x, mask []uint64) {
+	t := c.Threshold()
+	mask = mask[:len(x)]
+	for i, d := range data {
+		dist := 0
+		for j, x := range x {
+			dist += bits.OnesCount64((d[j] ^ x) & mask[j])
+		}
+		if dist > t {
+			continue
+		}
+		c.Push(dist, i)
+		t = c.Threshold()
+	}
+}
+
+// pushNearestDataMasked is [pushNearest] by the distance of [NearestDataMasked], or of [NearestDataMaskedNormalized] if `normalize` is set.
+func pushNearestDataMasked(c *topk.Counting, data, masks []uint64, x, mask uint64, normalize bool) {
+	t := c.Threshold()
+	masks = masks[:len(data)]
+	for i, d := range data {
+		dist := dataMaskedDistance(d, masks[i], x, mask, normalize)
+		if dist > t {
+			continue
+		}
+		c.Push(dist, i)
+		t = c.Threshold()
+	}
+}
+
+// pushNearestWideDataMasked is [pushNearestWide] by the distance of [NearestWideDataMasked],
+// or of [NearestWideDataMaskedNormalized] if `normalize` is set.
+func pushNearestWideDataMasked(c *topk.Counting, data, masks [][]uint64, x, mask []uint64, normalize bool) {
+	t := c.Threshold()
+	masks = masks[:len(data)]
+	for i, d := range data {
+		dist := dataMaskedDistanceWide(d, masks[i], x, mask, normalize)
+		if dist > t {
+			continue
+		}
+		c.Push(dist, i)
+		t = c.Threshold()
+	}
+}
+
+// dataMaskedDistance returns the distance of [NearestDataMasked] between the data point `d` with validity mask `m`,
+// and the query `x` with mask `mask`, or that of [NearestDataMaskedNormalized] if `normalize` is set.
+func dataMaskedDistance(d, m, x, mask uint64, normalize bool) int {
+	known := m & mask
+	if known == 0 {
+		return 64
+	}
+	dist := bits.OnesCount64((x ^ d) & known)
+	if normalize {
+		return normalizeMaskedDistance(dist, bits.OnesCount64(known), 64)
+	}
+	return dist
+}
+
+// dataMaskedDistanceWide returns the distance of [NearestWideDataMasked] between the data point `d` with validity mask `m`,
+// and the query `x` with mask `mask`, which may be nil, or that of [NearestWideDataMaskedNormalized] if `normalize` is set.
+func dataMaskedDistanceWide(d, m, x, mask []uint64, normalize bool) int {
+	dist, known := 0, 0
+	for j, x := range x {
+		k := m[j]
+		if mask != nil {
+			k &= mask[j]
+		}
+		dist += bits.OnesCount64((d[j] ^ x) & k)
+		known += bits.OnesCount64(k)
+	}
+	width := 64 * len(x)
+	switch {
+	case known == 0:
+		return width
+	case normalize:
+		return normalizeMaskedDistance(dist, known, width)
+	}
+	return dist
+}
+
+// dataMaskedOnesCount returns the number of bits set in both the data point mask `m` and the query mask `mask`, which may be nil.
+func dataMaskedOnesCount(m, mask []uint64) int {
+	if mask == nil {
+		return onesCount(m)
+	}
+	n := 0
+	for j, m := range m {
+		n += bits.OnesCount64(m & mask[j])
+	}
+	return n
+}
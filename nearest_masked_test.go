@@ -0,0 +1,589 @@
+package bitknn_test
+
+import (
+	gocmp "cmp"
+	"math"
+	"math/bits"
+	"slices"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/keilerkonzept/bitknn"
+	"github.com/keilerkonzept/bitknn/internal/testrandom"
+	"github.com/keilerkonzept/bitknn/internal/topk"
+	"pgregory.net/rapid"
+)
+
+// maskWords draws masks that are mostly all-ones, all-zeros, or sparse.
+func maskWords(t *rapid.T, n int) []uint64 {
+	return rapid.SliceOfN(rapid.OneOf(
+		rapid.SampledFrom([]uint64{0, 1<<64 - 1}),
+		rapid.Uint64(),
+	), n, n).Draw(t, "mask")
+}
+
+func TestNearestMasked_Equiv_Nearest(t *testing.T) {
+	rapid.Check(t, func(t *rapid.T) {
+		k := rapid.IntRange(0, 50).Draw(t, "k")
+		data := rapid.SliceOf(rapid.Uint64()).Draw(t, "data")
+		x := rapid.Uint64().Draw(t, "x")
+		mask := maskWords(t, 1)[0]
+
+		// Masking the query and the data points is equivalent to masking their difference.
+		masked := make([]uint64, len(data))
+		for i, d := range data {
+			masked[i] = d & mask
+		}
+		distances, indices := make([]int, k+1), make([]int, k+1)
+		n := bitknn.Nearest(masked, k, x&mask, distances, indices)
+		md, mi := make([]int, k+1), make([]int, k+1)
+		mn := bitknn.NearestMasked(data, k, x, mask, md, mi)
+		if diff := cmp.Diff([][]int{distances[:n], indices[:n]}, [][]int{md[:mn], mi[:mn]}); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+}
+
+func TestNearestWideMasked_Equiv_NearestWide(t *testing.T) {
+	rapid.Check(t, func(t *rapid.T) {
+		k := rapid.IntRange(0, 50).Draw(t, "k")
+		dims := rapid.IntRange(1, 20).Draw(t, "dims")
+		size := rapid.IntRange(0, 500).Draw(t, "size")
+		data := testrandom.WideData(dims, size)
+		x := testrandom.WideQuery(dims)
+		mask := maskWords(t, dims)
+
+		masked := make([][]uint64, len(data))
+		for i, d := range data {
+			masked[i] = make([]uint64, dims)
+			for j := range d {
+				masked[i][j] = d[j] & mask[j]
+			}
+		}
+		maskedX := make([]uint64, dims)
+		for j := range x {
+			maskedX[j] = x[j] & mask[j]
+		}
+		distances, indices := make([]int, k+1), make([]int, k+1)
+		n := bitknn.NearestWide(masked, k, maskedX, distances, indices)
+		expected := [][]int{distances[:n], indices[:n]}
+
+		md, mi := make([]int, k+1), make([]int, k+1)
+		mn := bitknn.NearestWideMasked(data, k, x, mask, md, mi)
+		if diff := cmp.Diff(expected, [][]int{md[:mn], mi[:mn]}); diff != "" {
+			t.Fatal(diff)
+		}
+		for _, batchSize := range []int{k, k + 1, 7, 256} {
+			batch := make([]uint32, max(k, 1, batchSize))
+			vd, vi := make([]int, k+1), make([]int, k+1)
+			vn := bitknn.NearestWideMaskedV(data, k, x, mask, batch, vd, vi)
+			if diff := cmp.Diff(expected, [][]int{vd[:vn], vi[:vn]}); diff != "" {
+				t.Fatal(batchSize, diff)
+			}
+		}
+	})
+}
+
+func TestNearestMaskedTies_Oracle(t *testing.T) {
+	rapid.Check(t, func(t *rapid.T) {
+		k := rapid.IntRange(0, 50).Draw(t, "k")
+		// Few distinct values, so that there are many ties.
+		data := rapid.SliceOf(rapid.Uint64Range(0, 15)).Draw(t, "data")
+		x := rapid.Uint64Range(0, 15).Draw(t, "x")
+		mask := maskWords(t, 1)[0]
+		tieBreaking := rapid.SampledFrom(tieBreakings).Draw(t, "tieBreaking")
+		seed := rapid.Uint64().Draw(t, "seed")
+
+		all := make([]int, len(data))
+		wideData := make([][]uint64, len(data))
+		for i, d := range data {
+			all[i] = bits.OnesCount64((x ^ d) & mask)
+			wideData[i] = []uint64{d}
+		}
+		expected := slices.Concat(tiesOracle(k, all, tieBreaking, seed))
+		for name, find := range map[string]func() ([]int, []int){
+			"NearestMaskedTies": func() ([]int, []int) {
+				return bitknn.NearestMaskedTies(data, k, x, mask, tieBreaking, seed, nil, nil)
+			},
+			"NearestWideMaskedTies": func() ([]int, []int) {
+				return bitknn.NearestWideMaskedTies(wideData, k, []uint64{x}, []uint64{mask}, tieBreaking, seed, nil, nil)
+			},
+		} {
+			distances, indices := find()
+			bitknn.SortNeighbors(distances, indices)
+			if diff := cmp.Diff(expected, slices.Concat(distances, indices), cmpopts.EquateEmpty()); diff != "" {
+				t.Fatal(name, diff)
+			}
+		}
+	})
+}
+
+func TestNormalizeMaskedDistances(t *testing.T) {
+	for _, tc := range []struct {
+		distances     []int
+		active, width int
+		expected      []int
+	}{
+		{[]int{0, 1, 2, 3}, 4, 8, []int{0, 2, 4, 6}},
+		{[]int{1, 2}, 3, 64, []int{21, 43}},
+		{[]int{1, 2}, 64, 64, []int{1, 2}},
+		{[]int{0, 0}, 0, 64, []int{0, 0}},
+	} {
+		distances := slices.Clone(tc.distances)
+		bitknn.NormalizeMaskedDistances(distances, tc.active, tc.width)
+		if diff := cmp.Diff(tc.expected, distances); diff != "" {
+			t.Error(diff)
+		}
+	}
+}
+
+func TestModel_FindMasked_PredictMasked(t *testing.T) {
+	rapid.Check(t, func(t *rapid.T) {
+		k := rapid.IntRange(1, 20).Draw(t, "k")
+		size := rapid.IntRange(0, 300).Draw(t, "size")
+		data := testrandom.Data(size)
+		labels := testrandom.Labels(size)
+		x := testrandom.Query()
+		mask := maskWords(t, 1)[0]
+		tieBreaking := rapid.SampledFrom(tieBreakings).Draw(t, "tieBreaking")
+		normalize := rapid.Bool().Draw(t, "normalize")
+		opts := []bitknn.Option{
+			bitknn.WithLinearDistanceWeighting(),
+			bitknn.WithTieBreaking(tieBreaking),
+			bitknn.WithWorkers(rapid.IntRange(1, 4).Draw(t, "workers")),
+			bitknn.WithSorted(),
+		}
+		if normalize {
+			opts = append(opts, bitknn.WithMaskedDistanceNormalization())
+		}
+		model := bitknn.Fit(data, labels, opts...)
+
+		expectedDistances, expectedIndices := bitknn.NearestMaskedTies(data, k, x, mask, tieBreaking, 0, nil, nil)
+		bitknn.SortNeighbors(expectedDistances, expectedIndices)
+		n := len(expectedIndices)
+		actualDistances, actualIndices := model.FindMasked(k, x, mask)
+		if diff := cmp.Diff([][]int{expectedDistances, expectedIndices}, [][]int{actualDistances, actualIndices}, cmpopts.EquateEmpty()); diff != "" {
+			t.Fatal(diff)
+		}
+
+		if normalize {
+			bitknn.NormalizeMaskedDistances(expectedDistances, bits.OnesCount64(mask), 64)
+		}
+		expected := make(bitknn.VoteMap)
+		model.Vote(n, expectedDistances, expectedIndices, expected)
+		actual := make(bitknn.VoteMap)
+		if actualN := model.PredictMasked(k, x, mask, actual); actualN != n {
+			t.Fatal(actualN, n)
+		}
+		if diff := cmp.Diff(expected, actual, cmpopts.EquateApprox(0, eps)); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+}
+
+func TestWideModel_FindMasked_PredictMasked(t *testing.T) {
+	rapid.Check(t, func(t *rapid.T) {
+		k := rapid.IntRange(1, 20).Draw(t, "k")
+		dims := rapid.IntRange(1, 4).Draw(t, "dims")
+		size := rapid.IntRange(0, 300).Draw(t, "size")
+		data := testrandom.WideData(dims, size)
+		labels := testrandom.Labels(size)
+		x := testrandom.WideQuery(dims)
+		mask := maskWords(t, dims)
+		tieBreaking := rapid.SampledFrom(tieBreakings).Draw(t, "tieBreaking")
+		normalize := rapid.Bool().Draw(t, "normalize")
+		opts := []bitknn.Option{
+			bitknn.WithQuadraticDistanceWeighting(),
+			bitknn.WithTieBreaking(tieBreaking),
+			bitknn.WithWorkers(rapid.IntRange(1, 4).Draw(t, "workers")),
+			bitknn.WithSorted(),
+		}
+		if normalize {
+			opts = append(opts, bitknn.WithMaskedDistanceNormalization())
+		}
+		model := bitknn.FitWide(data, labels, opts...)
+
+		expectedDistances, expectedIndices := bitknn.NearestWideMaskedTies(data, k, x, mask, tieBreaking, 0, nil, nil)
+		bitknn.SortNeighbors(expectedDistances, expectedIndices)
+		n := len(expectedIndices)
+		expectedNeighbors := [][]int{expectedDistances, expectedIndices}
+		actualDistances, actualIndices := model.FindMasked(k, x, mask)
+		if diff := cmp.Diff(expectedNeighbors, [][]int{actualDistances, actualIndices}, cmpopts.EquateEmpty()); diff != "" {
+			t.Fatal(diff)
+		}
+		batch := make([]uint32, k)
+		actualDistances, actualIndices = model.FindMaskedV(k, x, mask, batch)
+		if diff := cmp.Diff(expectedNeighbors, [][]int{actualDistances, actualIndices}, cmpopts.EquateEmpty()); diff != "" {
+			t.Fatal(diff)
+		}
+
+		if normalize {
+			active := 0
+			for _, m := range mask {
+				active += bits.OnesCount64(m)
+			}
+			bitknn.NormalizeMaskedDistances(expectedDistances, active, 64*dims)
+		}
+		expected := make(bitknn.VoteMap)
+		model.Narrow.Vote(n, expectedDistances, expectedIndices, expected)
+		for name, predict := range map[string]func(votes bitknn.VoteCounter) int{
+			"PredictMasked":  func(votes bitknn.VoteCounter) int { return model.PredictMasked(k, x, mask, votes) },
+			"PredictMaskedV": func(votes bitknn.VoteCounter) int { return model.PredictMaskedV(k, x, mask, batch, votes) },
+		} {
+			actual := make(bitknn.VoteMap)
+			if actualN := predict(actual); actualN != n {
+				t.Fatal(name, actualN, n)
+			}
+			if diff := cmp.Diff(expected, actual, cmpopts.EquateApprox(0, eps)); diff != "" {
+				t.Fatal(name, diff)
+			}
+		}
+	})
+}
+
+// nearestOracle returns the k nearest neighbors by the given distances of all data points, sorted by distance and index.
+func nearestOracle[D int | float64](k int, all []D) ([]D, []int) {
+	indices := make([]int, len(all))
+	for i := range indices {
+		indices[i] = i
+	}
+	slices.SortStableFunc(indices, func(i, j int) int { return gocmp.Compare(all[i], all[j]) })
+	indices = indices[:min(k, len(indices))]
+	distances := make([]D, len(indices))
+	for i, index := range indices {
+		distances[i] = all[index]
+	}
+	return distances, indices
+}
+
+// tiesOracle is [nearestOracle] with the given tie-breaking, and `seed` for [bitknn.TieBreakingRandom].
+func tiesOracle[D int | float64](k int, all []D, tieBreaking bitknn.TieBreaking, seed uint64) ([]D, []int) {
+	indices := make([]int, len(all))
+	for i := range indices {
+		indices[i] = i
+	}
+	slices.SortFunc(indices, func(i, j int) int {
+		c := gocmp.Compare(all[i], all[j])
+		switch tieBreaking {
+		case bitknn.TieBreakingHighestIndex:
+			return gocmp.Or(c, gocmp.Compare(j, i))
+		case bitknn.TieBreakingRandom:
+			return gocmp.Or(c, gocmp.Compare(topk.Key(seed, i), topk.Key(seed, j)))
+		}
+		return gocmp.Or(c, gocmp.Compare(i, j))
+	})
+	n := min(k, len(indices))
+	if tieBreaking == bitknn.TieBreakingIncludeAll {
+		for n > 0 && n < len(indices) && all[indices[n]] == all[indices[n-1]] {
+			n++
+		}
+	}
+	indices = indices[:n]
+	slices.SortFunc(indices, func(i, j int) int { return gocmp.Or(gocmp.Compare(all[i], all[j]), gocmp.Compare(i, j)) })
+	distances := make([]D, len(indices))
+	for i, index := range indices {
+		distances[i] = all[index]
+	}
+	return distances, indices
+}
+
+// withinOracle returns the data points within distance `r` by the given distances of all data points, in index order.
+func withinOracle[D int | float64](r D, all []D) ([]D, []int) {
+	var distances []D
+	var indices []int
+	for i, dist := range all {
+		if dist <= r {
+			distances = append(distances, dist)
+			indices = append(indices, i)
+		}
+	}
+	return distances, indices
+}
+
+func TestNearestDataMasked_Oracle(t *testing.T) {
+	rapid.Check(t, func(t *rapid.T) {
+		k := rapid.IntRange(0, 50).Draw(t, "k")
+		r := rapid.IntRange(0, 64).Draw(t, "r")
+		size := rapid.IntRange(0, 300).Draw(t, "size")
+		data := testrandom.Data(size)
+		masks := maskWords(t, size)
+		x := testrandom.Query()
+		mask := maskWords(t, 1)[0]
+
+		all, normalized := make([]int, size), make([]int, size)
+		for i, d := range data {
+			known := bits.OnesCount64(masks[i] & mask)
+			all[i] = bits.OnesCount64((x ^ d) & masks[i] & mask)
+			normalized[i] = int(math.Round(64 * float64(all[i]) / float64(known)))
+			if known == 0 {
+				all[i], normalized[i] = 64, 64
+			}
+		}
+		expected := slices.Concat(nearestOracle(k, all))
+
+		distances, indices := make([]int, k+1), make([]int, k+1)
+		n := bitknn.NearestDataMasked(data, masks, k, x, mask, distances, indices)
+		bitknn.SortNeighbors(distances[:n], indices[:n])
+		if diff := cmp.Diff(expected, slices.Concat(distances[:n], indices[:n])); diff != "" {
+			t.Fatal(diff)
+		}
+		distances, indices = bitknn.NearestDataMaskedTies(data, masks, k, x, mask, bitknn.TieBreakingLowestIndex, 0, nil, nil)
+		bitknn.SortNeighbors(distances, indices)
+		if diff := cmp.Diff(expected, slices.Concat(distances, indices)); diff != "" {
+			t.Fatal(diff)
+		}
+		distances, indices = bitknn.WithinDataMasked(data, masks, r, x, mask, -1, nil, nil)
+		if diff := cmp.Diff(slices.Concat(withinOracle(r, all)), slices.Concat(distances, indices)); diff != "" {
+			t.Fatal(diff)
+		}
+
+		expected = slices.Concat(nearestOracle(k, normalized))
+		distances, indices = make([]int, k+1), make([]int, k+1)
+		n = bitknn.NearestDataMaskedNormalized(data, masks, k, x, mask, distances, indices)
+		bitknn.SortNeighbors(distances[:n], indices[:n])
+		if diff := cmp.Diff(expected, slices.Concat(distances[:n], indices[:n])); diff != "" {
+			t.Fatal(diff)
+		}
+		distances, indices = bitknn.NearestDataMaskedNormalizedTies(data, masks, k, x, mask, bitknn.TieBreakingLowestIndex, 0, nil, nil)
+		bitknn.SortNeighbors(distances, indices)
+		if diff := cmp.Diff(expected, slices.Concat(distances, indices)); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+}
+
+func TestNearestWideDataMasked_Oracle(t *testing.T) {
+	rapid.Check(t, func(t *rapid.T) {
+		k := rapid.IntRange(0, 50).Draw(t, "k")
+		r := rapid.IntRange(0, 256).Draw(t, "r")
+		dims := rapid.IntRange(1, 4).Draw(t, "dims")
+		size := rapid.IntRange(0, 300).Draw(t, "size")
+		data := testrandom.WideData(dims, size)
+		masks := make([][]uint64, size)
+		for i := range masks {
+			masks[i] = maskWords(t, dims)
+		}
+		x := testrandom.WideQuery(dims)
+		var mask []uint64
+		if rapid.Bool().Draw(t, "query mask") {
+			mask = maskWords(t, dims)
+		}
+
+		all, normalized := make([]int, size), make([]int, size)
+		for i, d := range data {
+			known := 0
+			for j := range x {
+				m := masks[i][j]
+				if mask != nil {
+					m &= mask[j]
+				}
+				all[i] += bits.OnesCount64((x[j] ^ d[j]) & m)
+				known += bits.OnesCount64(m)
+			}
+			normalized[i] = int(math.Round(64 * float64(dims*all[i]) / float64(known)))
+			if known == 0 {
+				all[i], normalized[i] = 64*dims, 64*dims
+			}
+		}
+		expected := slices.Concat(nearestOracle(k, all))
+
+		distances, indices := make([]int, k+1), make([]int, k+1)
+		n := bitknn.NearestWideDataMasked(data, masks, k, x, mask, distances, indices)
+		bitknn.SortNeighbors(distances[:n], indices[:n])
+		if diff := cmp.Diff(expected, slices.Concat(distances[:n], indices[:n])); diff != "" {
+			t.Fatal(diff)
+		}
+		distances, indices = bitknn.NearestWideDataMaskedTies(data, masks, k, x, mask, bitknn.TieBreakingLowestIndex, 0, nil, nil)
+		bitknn.SortNeighbors(distances, indices)
+		if diff := cmp.Diff(expected, slices.Concat(distances, indices)); diff != "" {
+			t.Fatal(diff)
+		}
+		distances, indices = bitknn.WithinWideDataMasked(data, masks, r, x, mask, -1, nil, nil)
+		if diff := cmp.Diff(slices.Concat(withinOracle(r, all)), slices.Concat(distances, indices)); diff != "" {
+			t.Fatal(diff)
+		}
+
+		expected = slices.Concat(nearestOracle(k, normalized))
+		distances, indices = make([]int, k+1), make([]int, k+1)
+		n = bitknn.NearestWideDataMaskedNormalized(data, masks, k, x, mask, distances, indices)
+		bitknn.SortNeighbors(distances[:n], indices[:n])
+		if diff := cmp.Diff(expected, slices.Concat(distances[:n], indices[:n])); diff != "" {
+			t.Fatal(diff)
+		}
+		distances, indices = bitknn.NearestWideDataMaskedNormalizedTies(data, masks, k, x, mask, bitknn.TieBreakingLowestIndex, 0, nil, nil)
+		bitknn.SortNeighbors(distances, indices)
+		if diff := cmp.Diff(expected, slices.Concat(distances, indices)); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+}
+
+func TestNormalizeDataMaskedDistances(t *testing.T) {
+	masks := []uint64{0b1111, 0, 1<<64 - 1, 0b11}
+	distances, indices := []int{1, 0, 3, 1}, []int{0, 1, 2, 3}
+	bitknn.NormalizeDataMaskedDistances(distances, indices, masks, 0b0111)
+	if diff := cmp.Diff([]int{21, 0, 64, 32}, distances); diff != "" {
+		t.Error(diff)
+	}
+
+	wideMasks := [][]uint64{{0b1111, 0}, {0, 0}, {1<<64 - 1, 1<<64 - 1}}
+	distances, indices = []int{1, 0, 3}, []int{0, 1, 2}
+	bitknn.NormalizeWideDataMaskedDistances(distances, indices, wideMasks, nil)
+	if diff := cmp.Diff([]int{32, 0, 3}, distances); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestModel_DataMasks(t *testing.T) {
+	rapid.Check(t, func(t *rapid.T) {
+		k := rapid.IntRange(1, 20).Draw(t, "k")
+		size := rapid.SampledFrom([]int{0, 1, 10, 300, 3000}).Draw(t, "size")
+		data := testrandom.Data(size)
+		masks := maskWords(t, size)
+		labels := testrandom.Labels(size)
+		values := testrandom.Values(size)
+		x := testrandom.Query()
+		mask := maskWords(t, 1)[0]
+		tieBreaking := rapid.SampledFrom(tieBreakings).Draw(t, "tieBreaking")
+		normalize := rapid.Bool().Draw(t, "normalize")
+		opts := []bitknn.Option{
+			bitknn.WithDataMasks(masks),
+			bitknn.WithValues(values),
+			bitknn.WithLinearDistanceWeighting(),
+			bitknn.WithTieBreaking(tieBreaking),
+			bitknn.WithWorkers(rapid.IntRange(1, 4).Draw(t, "workers")),
+			bitknn.WithSorted(),
+		}
+		if normalize {
+			opts = append(opts, bitknn.WithMaskedDistanceNormalization())
+		}
+		model := bitknn.Fit(data, labels, opts...)
+		nearestTies := bitknn.NearestDataMaskedTies
+		if normalize {
+			nearestTies = bitknn.NearestDataMaskedNormalizedTies
+		}
+
+		expectedDistances, expectedIndices := nearestTies(data, masks, k, x, 1<<64-1, tieBreaking, 0, nil, nil)
+		bitknn.SortNeighbors(expectedDistances, expectedIndices)
+		expected := [][]int{expectedDistances, expectedIndices}
+		for name, find := range map[string]func() ([]int, []int){
+			"Find":  func() ([]int, []int) { return model.Find(k, x) },
+			"FindV": func() ([]int, []int) { return model.FindV(k, x, make([]uint32, k)) },
+		} {
+			distances, indices := find()
+			if diff := cmp.Diff(expected, [][]int{distances, indices}, cmpopts.EquateEmpty()); diff != "" {
+				t.Fatal(name, diff)
+			}
+		}
+
+		expectedVotes := make(bitknn.VoteMap)
+		model.Vote(len(expectedIndices), expectedDistances, expectedIndices, expectedVotes)
+		votes := make(bitknn.VoteMap)
+		model.Predict(k, x, votes)
+		if diff := cmp.Diff(expectedVotes, votes, cmpopts.EquateApprox(0, eps)); diff != "" {
+			t.Fatal(diff)
+		}
+		expectedRegression := model.Aggregate(len(expectedIndices), expectedDistances, expectedIndices)
+		if regression := model.Regress(k, x); math.Abs(regression.Value-expectedRegression.Value) > eps || regression.Neighbors != expectedRegression.Neighbors {
+			t.Fatalf("expected %+v, got %+v", expectedRegression, regression)
+		}
+
+		expectedDistances, expectedIndices = nearestTies(data, masks, k, x, mask, tieBreaking, 0, nil, nil)
+		bitknn.SortNeighbors(expectedDistances, expectedIndices)
+		actualDistances, actualIndices := model.FindMasked(k, x, mask)
+		if diff := cmp.Diff([][]int{expectedDistances, expectedIndices}, [][]int{actualDistances, actualIndices}, cmpopts.EquateEmpty()); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+}
+
+func TestWideModel_DataMasks(t *testing.T) {
+	rapid.Check(t, func(t *rapid.T) {
+		k := rapid.IntRange(1, 20).Draw(t, "k")
+		dims := rapid.IntRange(1, 4).Draw(t, "dims")
+		size := rapid.SampledFrom([]int{0, 1, 10, 300, 3000}).Draw(t, "size")
+		data := testrandom.WideData(dims, size)
+		masks := make([][]uint64, size)
+		for i := range masks {
+			masks[i] = maskWords(t, dims)
+		}
+		labels := testrandom.Labels(size)
+		x := testrandom.WideQuery(dims)
+		mask := maskWords(t, dims)
+		tieBreaking := rapid.SampledFrom(tieBreakings).Draw(t, "tieBreaking")
+		normalize := rapid.Bool().Draw(t, "normalize")
+		opts := []bitknn.Option{
+			bitknn.WithWideDataMasks(masks),
+			bitknn.WithQuadraticDistanceWeighting(),
+			bitknn.WithTieBreaking(tieBreaking),
+			bitknn.WithWorkers(rapid.IntRange(1, 4).Draw(t, "workers")),
+			bitknn.WithSorted(),
+		}
+		if normalize {
+			opts = append(opts, bitknn.WithMaskedDistanceNormalization())
+		}
+		model := bitknn.FitWide(data, labels, opts...)
+		nearestTies := bitknn.NearestWideDataMaskedTies
+		if normalize {
+			nearestTies = bitknn.NearestWideDataMaskedNormalizedTies
+		}
+
+		expectedDistances, expectedIndices := nearestTies(data, masks, k, x, nil, tieBreaking, 0, nil, nil)
+		bitknn.SortNeighbors(expectedDistances, expectedIndices)
+		expected := [][]int{expectedDistances, expectedIndices}
+		for name, find := range map[string]func() ([]int, []int){
+			"Find":  func() ([]int, []int) { return model.Find(k, x) },
+			"FindV": func() ([]int, []int) { return model.FindV(k, x, make([]uint32, k)) },
+		} {
+			distances, indices := find()
+			if diff := cmp.Diff(expected, [][]int{distances, indices}, cmpopts.EquateEmpty()); diff != "" {
+				t.Fatal(name, diff)
+			}
+		}
+
+		expectedVotes := make(bitknn.VoteMap)
+		model.Narrow.Vote(len(expectedIndices), expectedDistances, expectedIndices, expectedVotes)
+		votes := make(bitknn.VoteMap)
+		model.Predict(k, x, votes)
+		if diff := cmp.Diff(expectedVotes, votes, cmpopts.EquateApprox(0, eps)); diff != "" {
+			t.Fatal(diff)
+		}
+
+		expectedDistances, expectedIndices = nearestTies(data, masks, k, x, mask, tieBreaking, 0, nil, nil)
+		bitknn.SortNeighbors(expectedDistances, expectedIndices)
+		expected = [][]int{expectedDistances, expectedIndices}
+		for name, find := range map[string]func() ([]int, []int){
+			"FindMasked":  func() ([]int, []int) { return model.FindMasked(k, x, mask) },
+			"FindMaskedV": func() ([]int, []int) { return model.FindMaskedV(k, x, mask, make([]uint32, k)) },
+		} {
+			actualDistances, actualIndices := find()
+			if diff := cmp.Diff(expected, [][]int{actualDistances, actualIndices}, cmpopts.EquateEmpty()); diff != "" {
+				t.Fatal(name, diff)
+			}
+		}
+	})
+}
+
+func TestModel_DataMasks_NoAlloc(t *testing.T) {
+	const k, size = 10, 1000
+	data, wideData := testrandom.Data(size), testrandom.WideData(4, size)
+	masks, wideMasks := testrandom.Data(size), testrandom.WideData(4, size)
+	labels := testrandom.Labels(size)
+	opts := []bitknn.Option{bitknn.WithLinearDistanceWeighting(), bitknn.WithMaskedDistanceNormalization()}
+	model := bitknn.Fit(data, labels, append(opts, bitknn.WithDataMasks(masks))...)
+	wideModel := bitknn.FitWide(wideData, labels, append(opts, bitknn.WithWideDataMasks(wideMasks))...)
+	distances, indices := make([]int, k+1), make([]int, k+1)
+	var votes bitknn.VoteCounter = make(bitknn.VoteSlice, 256)
+	x, wideX := testrandom.Query(), testrandom.WideQuery(4)
+	for name, f := range map[string]func(){
+		"Model.FindInto":        func() { model.FindInto(k, x, distances, indices) },
+		"Model.PredictInto":     func() { model.PredictInto(k, x, distances, indices, votes) },
+		"WideModel.FindInto":    func() { wideModel.FindInto(k, wideX, distances, indices) },
+		"WideModel.PredictInto": func() { wideModel.PredictInto(k, wideX, distances, indices, votes) },
+	} {
+		if allocs := testing.AllocsPerRun(10, f); allocs != 0 {
+			t.Errorf("%s: %v allocations", name, allocs)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package bitknn
+
+import (
+	"runtime"
+	"sync"
+
+	"github.com/keilerkonzept/bitknn/internal/heap"
+	"github.com/keilerkonzept/bitknn/internal/slice"
+)
+
+// Minimum number of data points per shard searched by a single goroutine.
+const parallelMinShardSize = 1024
+
+// NearestParallel is [Nearest], but splits `data` into up to `workers` shards that are searched concurrently.
+// The neighbors found in each shard are merged into the slices `distances` and `indices`.
+// Returns the same neighbors as [Nearest], possibly in a different order.
+// Allocates a neighbor heap for each shard.
+func NearestParallel(data []uint64, k int, x uint64, workers int, distances, indices []int) int {
+	return nearestParallel(len(data), k, workers, distances, indices, func(_, _, lo, hi int, distances, indices []int) int {
+		return Nearest(data[lo:hi], k, x, distances, indices)
+	})
+}
+
+// [NearestParallel], but vectorized (on ARM64 with NEON, and on amd64 with AVX2 or AVX-512 instructions).
+// The `batch` array is split between the shards, each of which gets a part of length at least `k`.
+// The number of shards is reduced if necessary.
+func NearestParallelV(data []uint64, k int, x uint64, workers int, batch []uint32, distances, indices []int) int {
+	if k > 0 {
+		workers = min(workers, len(batch)/k)
+	}
+	return nearestParallel(len(data), k, workers, distances, indices, func(w, shards, lo, hi int, distances, indices []int) int {
+		b := len(batch) / shards
+		return NearestV(data[lo:hi], k, x, batch[w*b:(w+1)*b], distances, indices)
+	})
+}
+
+// [NearestParallel], but for wide data.
+func NearestWideParallel(data [][]uint64, k int, x []uint64, workers int, distances, indices []int) int {
+	return nearestParallel(len(data), k, workers, distances, indices, func(_, _, lo, hi int, distances, indices []int) int {
+		return NearestWide(data[lo:hi], k, x, distances, indices)
+	})
+}
+
+// [NearestWideParallel], but using [NearestWideEarlyAbandon] to search each shard.
+func NearestWideEarlyAbandonParallel(data [][]uint64, k int, x []uint64, workers int, distances, indices []int) int {
+	return nearestParallel(len(data), k, workers, distances, indices, func(_, _, lo, hi int, distances, indices []int) int {
+		return NearestWideEarlyAbandon(data[lo:hi], k, x, distances, indices)
+	})
+}
+
+// [NearestParallel], but vectorized (on ARM64 with NEON, and on amd64 with AVX2 or AVX-512 instructions).
+// The `batch` array is split between the shards, each of which gets a part of length at least `k`.
+// The number of shards is reduced if necessary.
+func NearestWideParallelV(data [][]uint64, k int, x []uint64, workers int, batch []uint32, distances, indices []int) int {
+	if k > 0 {
+		workers = min(workers, len(batch)/k)
+	}
+	return nearestParallel(len(data), k, workers, distances, indices, func(w, shards, lo, hi int, distances, indices []int) int {
+		b := len(batch) / shards
+		return NearestWideV(data[lo:hi], k, x, batch[w*b:(w+1)*b], distances, indices)
+	})
+}
+
+// shardBounds returns the bounds of the `w`-th of `shards` near-equal parts of `n` data points.
+func shardBounds(n, shards, w int) (int, int) {
+	return w * n / shards, (w + 1) * n / shards
+}
+
+// parallelShards returns the number of shards of `n` data points searched concurrently by up to `workers` goroutines.
+func parallelShards(n, workers int) int {
+	return min(workers, n/parallelMinShardSize)
+}
+
+// nearestParallel runs `nearest` for shards of `n` data points concurrently, and merges their results.
+func nearestParallel[D int | float64](n, k, workers int, distances []D, indices []int, nearest func(w, shards, lo, hi int, distances []D, indices []int) int) int {
+	shards := parallelShards(n, workers)
+	if shards <= 1 || k == 0 {
+		return nearest(0, 1, 0, n, distances, indices)
+	}
+	shardDistances := make([]D, shards*(k+1))
+	shardIndices := make([]int, shards*(k+1))
+	counts := make([]int, shards)
+	var wg sync.WaitGroup
+	wg.Add(shards)
+	for w := range shards {
+		go func() {
+			defer wg.Done()
+			lo, hi := shardBounds(n, shards, w)
+			counts[w] = nearest(w, shards, lo, hi, shardDistances[w*(k+1):(w+1)*(k+1)], shardIndices[w*(k+1):(w+1)*(k+1)])
+		}()
+	}
+	wg.Wait()
+	return mergeShards(n, k, counts, shardDistances, shardIndices, distances, indices)
+}
+
+// mergeShards merges the neighbors found in each of the `len(counts)` shards of `n` data points,
+// whose heaps of length k+1 are laid out one after another in `shardDistances` and `shardIndices`,
+// into the slices `distances` and `indices`. Returns the number of neighbors.
+func mergeShards[D int | float64](n, k int, counts []int, shardDistances []D, shardIndices []int, distances []D, indices []int) int {
+	heap := heap.MakeMax(distances, indices)
+	for w, count := range counts {
+		lo, _ := shardBounds(n, len(counts), w)
+		for j := range count {
+			dist, i := shardDistances[w*(k+1)+j], lo+shardIndices[w*(k+1)+j]
+			if heap.Len() < k {
+				heap.Push(dist, i)
+				continue
+			}
+			heap.PushPop(dist, i)
+		}
+	}
+	return heap.Len()
+}
+
+// shardQuery is a query searched by [shardWorkers], in narrow data, in wide data, or in flat wide data if `stride` is set.
+type shardQuery struct {
+	n, k, shards int
+
+	data []uint64
+	x    uint64
+
+	wideData     [][]uint64
+	wideX        []uint64
+	earlyAbandon bool
+
+	flatData []uint64
+	stride   int
+
+	// Distance batch buffer split between the shards for the vectorized search, if set.
+	batch []uint32
+}
+
+// nearest searches the `w`-th shard of the query's data.
+func (me *shardQuery) nearest(w int, distances, indices []int) int {
+	lo, hi := shardBounds(me.n, me.shards, w)
+	var batch []uint32
+	if me.batch != nil {
+		b := len(me.batch) / me.shards
+		batch = me.batch[w*b : (w+1)*b]
+	}
+	switch s := me.stride; {
+	case s > 0 && batch != nil:
+		return NearestFlatV(me.flatData[lo*s:hi*s], s, me.k, me.wideX, batch, distances, indices)
+	case s > 0:
+		return NearestFlat(me.flatData[lo*s:hi*s], s, me.k, me.wideX, distances, indices)
+	case me.wideData == nil && batch != nil:
+		return NearestV(me.data[lo:hi], me.k, me.x, batch, distances, indices)
+	case me.wideData == nil:
+		return Nearest(me.data[lo:hi], me.k, me.x, distances, indices)
+	case batch != nil:
+		return NearestWideV(me.wideData[lo:hi], me.k, me.wideX, batch, distances, indices)
+	case me.earlyAbandon:
+		return NearestWideEarlyAbandon(me.wideData[lo:hi], me.k, me.wideX, distances, indices)
+	}
+	return NearestWide(me.wideData[lo:hi], me.k, me.wideX, distances, indices)
+}
+
+// shardWorkers searches the shards of a query concurrently on persistent goroutines, with a neighbor heap for each shard,
+// so that a parallel search doesn't allocate. The calling goroutine searches the first shard itself.
+// The goroutines stop when the shardWorkers are closed, or else once they are garbage collected. Must not be used concurrently.
+type shardWorkers struct {
+	pool *shardPool
+}
+
+// shardPool is the state of [shardWorkers] shared with the worker goroutines,
+// which don't reference the shardWorkers themselves so that they can be garbage collected.
+type shardPool struct {
+	// Shards to search, received by the worker goroutines.
+	tasks chan int
+	wg    sync.WaitGroup
+
+	// Current query.
+	query shardQuery
+
+	// Neighbor heaps of the shards, of length k+1 each, and the numbers of neighbors found.
+	distances []int
+	indices   []int
+	counts    []int
+}
+
+// newShardWorkers starts `shards-1` worker goroutines.
+func newShardWorkers(shards int) *shardWorkers {
+	pool := &shardPool{
+		tasks:  make(chan int, shards-1),
+		counts: make([]int, shards),
+	}
+	for range shards - 1 {
+		go pool.run()
+	}
+	me := &shardWorkers{pool: pool}
+	// a safety net for workers that aren't closed
+	runtime.SetFinalizer(me, func(me *shardWorkers) { close(me.pool.tasks) })
+	return me
+}
+
+// shardWorkersFor returns the given workers if they can search `shards` shards, or new ones, closing the given workers.
+func shardWorkersFor(workers *shardWorkers, shards int) *shardWorkers {
+	if workers != nil && len(workers.pool.counts) >= shards {
+		return workers
+	}
+	workers.close()
+	return newShardWorkers(shards)
+}
+
+// close stops the worker goroutines. Does nothing if the workers are nil.
+// The workers must not be used afterwards.
+func (me *shardWorkers) close() {
+	if me == nil {
+		return
+	}
+	runtime.SetFinalizer(me, nil)
+	close(me.pool.tasks)
+}
+
+// nearest searches the query's shards concurrently, and merges their neighbors into the slices `distances` and `indices`.
+// Returns the number of neighbors found.
+func (me *shardWorkers) nearest(q shardQuery, distances, indices []int) int {
+	p := me.pool
+	p.query = q
+	size := q.shards * (q.k + 1)
+	p.distances = slice.OrAlloc(p.distances, size)
+	p.indices = slice.OrAlloc(p.indices, size)
+	p.wg.Add(q.shards - 1)
+	for w := 1; w < q.shards; w++ {
+		p.tasks <- w
+	}
+	p.search(0)
+	p.wg.Wait()
+	return mergeShards(q.n, q.k, p.counts[:q.shards], p.distances, p.indices, distances, indices)
+}
+
+func (me *shardPool) run() {
+	for w := range me.tasks {
+		me.search(w)
+		me.wg.Done()
+	}
+}
+
+// search searches the `w`-th shard of the current query into its neighbor heap.
+func (me *shardPool) search(w int) {
+	size := me.query.k + 1
+	me.counts[w] = me.query.nearest(w, me.distances[w*size:(w+1)*size], me.indices[w*size:(w+1)*size])
+}
@@ -0,0 +1,169 @@
+package bitknn_test
+
+import (
+	"cmp"
+	"fmt"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/keilerkonzept/bitknn"
+	"github.com/keilerkonzept/bitknn/internal/testrandom"
+	"pgregory.net/rapid"
+)
+
+type neighbor struct{ Distance, Index int }
+
+// sortedNeighbors returns the given neighbors, sorted by distance and index.
+func sortedNeighbors(distances, indices []int) []neighbor {
+	out := make([]neighbor, len(distances))
+	for i := range out {
+		out[i] = neighbor{distances[i], indices[i]}
+	}
+	slices.SortFunc(out, func(a, b neighbor) int {
+		return cmp.Or(cmp.Compare(a.Distance, b.Distance), cmp.Compare(a.Index, b.Index))
+	})
+	return out
+}
+
+func TestNearestParallel_Equiv_Nearest(t *testing.T) {
+	rapid.Check(t, func(t *rapid.T) {
+		k := rapid.IntRange(0, 200).Draw(t, "k")
+		n := rapid.SampledFrom([]int{0, 100, 2048, 5000, 20_000}).Draw(t, "n")
+		workers := rapid.IntRange(0, 8).Draw(t, "workers")
+		data := testrandom.Data(n)
+		q := rapid.Uint64().Draw(t, "q")
+
+		distances, indices := make([]int, k+1), make([]int, k+1)
+		count := bitknn.Nearest(data, k, q, distances, indices)
+		pd, pi := make([]int, k+1), make([]int, k+1)
+		pcount := bitknn.NearestParallel(data, k, q, workers, pd, pi)
+		if count != pcount {
+			t.Fatal(count, pcount)
+		}
+		expected := sortedNeighbors(distances[:count], indices[:count])
+		actual := sortedNeighbors(pd[:pcount], pi[:pcount])
+		if !reflect.DeepEqual(expected, actual) {
+			t.Fatal(expected, actual)
+		}
+
+		batch := make([]uint32, rapid.IntRange(max(k, 1), 4*k+100).Draw(t, "batchSize"))
+		pcount = bitknn.NearestParallelV(data, k, q, workers, batch, pd, pi)
+		if count != pcount {
+			t.Fatal(count, pcount)
+		}
+		if actual := sortedNeighbors(pd[:pcount], pi[:pcount]); !reflect.DeepEqual(expected, actual) {
+			t.Fatal(expected, actual)
+		}
+	})
+}
+
+func TestNearestWideParallel_Equiv_NearestWide(t *testing.T) {
+	rapid.Check(t, func(t *rapid.T) {
+		k := rapid.IntRange(0, 200).Draw(t, "k")
+		dims := rapid.IntRange(1, 8).Draw(t, "dims")
+		n := rapid.SampledFrom([]int{0, 100, 2048, 5000}).Draw(t, "n")
+		workers := rapid.IntRange(0, 8).Draw(t, "workers")
+		batchSize := rapid.IntRange(k, 4*k+100).Draw(t, "batchSize")
+		data := testrandom.WideData(dims, n)
+		q := rapid.SliceOfN(rapid.Uint64(), dims, dims).Draw(t, "q")
+
+		distances, indices := make([]int, k+1), make([]int, k+1)
+		count := bitknn.NearestWide(data, k, q, distances, indices)
+		expected := sortedNeighbors(distances[:count], indices[:count])
+
+		pd, pi := make([]int, k+1), make([]int, k+1)
+		pcount := bitknn.NearestWideParallel(data, k, q, workers, pd, pi)
+		if count != pcount {
+			t.Fatal(count, pcount)
+		}
+		if actual := sortedNeighbors(pd[:pcount], pi[:pcount]); !reflect.DeepEqual(expected, actual) {
+			t.Fatal(expected, actual)
+		}
+
+		batch := make([]uint32, batchSize)
+		pcount = bitknn.NearestWideParallelV(data, k, q, workers, batch, pd, pi)
+		if count != pcount {
+			t.Fatal(count, pcount)
+		}
+		if actual := sortedNeighbors(pd[:pcount], pi[:pcount]); !reflect.DeepEqual(expected, actual) {
+			t.Fatal(expected, actual)
+		}
+	})
+}
+
+func TestModel_WithWorkers(t *testing.T) {
+	rapid.Check(t, func(t *rapid.T) {
+		k := rapid.IntRange(0, 100).Draw(t, "k")
+		dims := rapid.IntRange(1, 4).Draw(t, "dims")
+		n := rapid.SampledFrom([]int{0, 100, 5000}).Draw(t, "n")
+		workers := rapid.IntRange(2, 8).Draw(t, "workers")
+		data := testrandom.WideData(dims, n)
+		narrowData := make([]uint64, n)
+		for i := range data {
+			narrowData[i] = data[i][0]
+		}
+		labels := testrandom.Labels(n)
+		q := rapid.SliceOfN(rapid.Uint64(), dims, dims).Draw(t, "q")
+
+		{
+			sequential := bitknn.Fit(narrowData, labels, bitknn.WithLinearDistanceWeighting())
+			parallel := bitknn.Fit(narrowData, labels, bitknn.WithLinearDistanceWeighting(), bitknn.WithWorkers(workers))
+			sd, si := sequential.Find(k, q[0])
+			pd, pi := parallel.Find(k, q[0])
+			if !reflect.DeepEqual(sortedNeighbors(sd, si), sortedNeighbors(pd, pi)) {
+				t.Fatal(sd, si, pd, pi)
+			}
+			batch := make([]uint32, max(k, 1)*workers)
+			pd, pi = parallel.FindV(k, q[0], batch)
+			if !reflect.DeepEqual(sortedNeighbors(sd, si), sortedNeighbors(pd, pi)) {
+				t.Fatal(sd, si, pd, pi)
+			}
+			sv, pv := make(bitknn.VoteMap), make(bitknn.VoteMap)
+			sequential.Predict(k, q[0], sv)
+			parallel.Predict(k, q[0], pv)
+			if len(sv) != len(pv) {
+				t.Fatal(sv, pv)
+			}
+			for label, v := range sv {
+				if pv[label]-v > eps || v-pv[label] > eps {
+					t.Fatal(sv, pv)
+				}
+			}
+		}
+		{
+			sequential := bitknn.FitWide(data, labels)
+			parallel := bitknn.FitWide(data, labels, bitknn.WithWorkers(workers))
+			sd, si := sequential.Find(k, q)
+			pd, pi := parallel.Find(k, q)
+			if !reflect.DeepEqual(sortedNeighbors(sd, si), sortedNeighbors(pd, pi)) {
+				t.Fatal(sd, si, pd, pi)
+			}
+			batch := make([]uint32, max(k, 1)*workers)
+			pd, pi = parallel.FindV(k, q, batch)
+			if !reflect.DeepEqual(sortedNeighbors(sd, si), sortedNeighbors(pd, pi)) {
+				t.Fatal(sd, si, pd, pi)
+			}
+		}
+	})
+}
+
+func BenchmarkNearestWideParallel(b *testing.B) {
+	for _, dim := range []int{2, 10} {
+		for _, dataSize := range []int{1_000_000} {
+			for _, k := range []int{10, 100} {
+				data := testrandom.WideData(dim, dataSize)
+				query := testrandom.WideQuery(dim)
+				distances := make([]int, k+1)
+				indices := make([]int, k+1)
+				for _, workers := range []int{1, 2, 4, 8} {
+					b.Run(fmt.Sprintf("bits=%d_N=%d_k=%d_workers=%d", dim*64, dataSize, k, workers), func(b *testing.B) {
+						for n := 0; n < b.N; n++ {
+							bitknn.NearestWideParallel(data, k, query, workers, distances, indices)
+						}
+					})
+				}
+			}
+		}
+	}
+}
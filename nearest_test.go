@@ -2,12 +2,15 @@ package bitknn_test
 
 import (
 	"fmt"
+	"math/bits"
 	"math/rand/v2"
+	"slices"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/keilerkonzept/bitknn"
 	"github.com/keilerkonzept/bitknn/internal/testrandom"
+	"pgregory.net/rapid"
 )
 
 func TestNearest(t *testing.T) {
@@ -35,6 +38,74 @@ func TestNearest(t *testing.T) {
 	}
 }
 
+func TestNearestV_Equiv_Nearest(t *testing.T) {
+	rapid.Check(t, func(t *rapid.T) {
+		k := rapid.IntRange(0, 300).Draw(t, "k")
+		data := rapid.SliceOf(rapid.Uint64()).Draw(t, "data")
+		q := rapid.Uint64().Draw(t, "q")
+		batchSizes := []int{0, len(data), len(data) - 1, len(data) - 2, k + 1, 2048}
+		distances, indices := make([]int, k+1), make([]int, k+1)
+		count := bitknn.Nearest(data, k, q, distances, indices)
+		for _, batchSize := range batchSizes {
+			batch := make([]uint32, max(k, 1, batchSize))
+			vd, vi := make([]int, k+1), make([]int, k+1)
+			vcount := bitknn.NearestV(data, k, q, batch, vd, vi)
+			if count != vcount {
+				t.Fatal(count, vcount)
+			}
+			if diff := cmp.Diff([][]int{distances[:count], indices[:count]}, [][]int{vd[:vcount], vi[:vcount]}); diff != "" {
+				t.Fatal(batchSize, diff)
+			}
+		}
+	})
+}
+
+func TestWithin(t *testing.T) {
+	data := []uint64{0b0000, 0b1111, 0b0011, 0b0101}
+	x := uint64(0b0001)
+
+	distances, indices := bitknn.Within(data, 1, x, -1, nil, nil)
+	if diff := cmp.Diff([]int{1, 1, 1}, distances); diff != "" {
+		t.Error(diff)
+	}
+	if diff := cmp.Diff([]int{0, 2, 3}, indices); diff != "" {
+		t.Error(diff)
+	}
+
+	distances, indices = bitknn.Within(data, 1, x, 2, distances[:0], indices[:0])
+	if diff := cmp.Diff([]int{0, 2}, indices); diff != "" {
+		t.Error(diff)
+	}
+	if len(distances) != 2 {
+		t.Error(distances)
+	}
+}
+
+func TestWithin_Oracle(t *testing.T) {
+	rapid.Check(t, func(t *rapid.T) {
+		data := rapid.SliceOf(rapid.Uint64()).Draw(t, "data")
+		r := rapid.IntRange(0, 64).Draw(t, "r")
+		x := rapid.Uint64().Draw(t, "x")
+		limit := rapid.IntRange(-1, 100).Draw(t, "limit")
+
+		distances, indices := bitknn.Within(data, r, x, limit, nil, nil)
+		var expected []int
+		for i, d := range data {
+			if bits.OnesCount64(x^d) <= r && (limit < 0 || len(expected) < limit) {
+				expected = append(expected, i)
+			}
+		}
+		if !slices.Equal(expected, indices) {
+			t.Fatal(expected, indices)
+		}
+		for i, index := range indices {
+			if distances[i] != bits.OnesCount64(x^data[index]) {
+				t.Fatal(distances[i], index)
+			}
+		}
+	})
+}
+
 func BenchmarkNearest(b *testing.B) {
 	for _, dataSize := range []int{1000, 100_000, 1_000_000} {
 		for _, k := range []int{3, 10, 100} {
@@ -49,6 +120,18 @@ func BenchmarkNearest(b *testing.B) {
 					bitknn.Nearest(data, k, query, distances, indices)
 				}
 			})
+			b.Run(fmt.Sprintf("Op=V_N=%d_k=%d", dataSize, k), func(b *testing.B) {
+				query := rand.Uint64()
+				data := testrandom.Data(dataSize)
+				distances := make([]int, k+1)
+				indices := make([]int, k+1)
+				batch := make([]uint32, max(k, 1024))
+
+				b.ResetTimer()
+				for n := 0; n < b.N; n++ {
+					bitknn.NearestV(data, k, query, batch, distances, indices)
+				}
+			})
 		}
 	}
 }
@@ -0,0 +1,259 @@
+package bitknn
+
+import (
+	"cmp"
+	"math/bits"
+	"slices"
+	"sync"
+
+	"github.com/keilerkonzept/bitknn/internal/heap"
+	"github.com/keilerkonzept/bitknn/internal/topk"
+)
+
+// TieBreaking determines which of several neighbors at the k-th nearest distance are returned.
+// The neighbors closer than that are the same for all of them.
+type TieBreaking int
+
+const (
+	// Prefer neighbors with lower indices. The default, and the only one supported by the heap-based search functions like [Nearest].
+	TieBreakingLowestIndex TieBreaking = iota
+	// Prefer neighbors with higher indices.
+	TieBreakingHighestIndex
+	// Prefer neighbors in a pseudo-random order determined by a seed and the neighbors' indices.
+	// The order is the same for every search with the same seed.
+	TieBreakingRandom
+	// Return all neighbors at the k-th nearest distance, so possibly more than k neighbors.
+	TieBreakingIncludeAll
+)
+
+func (me TieBreaking) String() string {
+	switch me {
+	case TieBreakingLowestIndex:
+		return "lowest-index"
+	case TieBreakingHighestIndex:
+		return "highest-index"
+	case TieBreakingRandom:
+		return "random"
+	case TieBreakingIncludeAll:
+		return "include-all"
+	}
+	return "unknown"
+}
+
+func (me TieBreaking) ties() topk.Ties {
+	switch me {
+	case TieBreakingHighestIndex:
+		return topk.TiesLast
+	case TieBreakingRandom:
+		return topk.TiesKeyed
+	case TieBreakingIncludeAll:
+		return topk.TiesAll
+	}
+	return topk.TiesFirst
+}
+
+// NearestTies is [Nearest] with the given tie-breaking, and `seed` for [TieBreakingRandom].
+// Appends the neighbors' distances and indices to the given slices, in index order.
+// Returns the distance and index slices.
+// The neighbors are the same for every search path with the same tie-breaking (see [NearestParallelTies]).
+func NearestTies(data []uint64, k int, x uint64, tieBreaking TieBreaking, seed uint64, distances, indices []int) ([]int, []int) {
+	if k == 0 {
+		return distances, indices
+	}
+	c := topk.Get(k, 64)
+	defer topk.Put(c)
+	c.SetTies(tieBreaking.ties(), seed)
+	pushNearest(c, data, x)
+	return c.Append(distances, indices)
+}
+
+// [NearestTies], but for wide data.
+func NearestWideTies(data [][]uint64, k int, x []uint64, tieBreaking TieBreaking, seed uint64, distances, indices []int) ([]int, []int) {
+	if k == 0 {
+		return distances, indices
+	}
+	c := topk.Get(k, 64*len(x))
+	defer topk.Put(c)
+	c.SetTies(tieBreaking.ties(), seed)
+	pushNearestWide(c, data, x)
+	return c.Append(distances, indices)
+}
+
+// [NearestTies], but for wide data stored in a single flat slice (see [NearestFlat]).
+func NearestFlatTies(data []uint64, stride int, k int, x []uint64, tieBreaking TieBreaking, seed uint64, distances, indices []int) ([]int, []int) {
+	if k == 0 || stride == 0 || len(x) != stride {
+		return distances, indices
+	}
+	c := topk.Get(k, 64*len(x))
+	defer topk.Put(c)
+	c.SetTies(tieBreaking.ties(), seed)
+	pushNearestFlat(c, data, x)
+	return c.Append(distances, indices)
+}
+
+// NearestParallelTies is [NearestTies], but splits `data` into up to `workers` shards that are searched concurrently.
+// Returns the same neighbors as [NearestTies], in the same order.
+func NearestParallelTies(data []uint64, k int, x uint64, workers int, tieBreaking TieBreaking, seed uint64, distances, indices []int) ([]int, []int) {
+	return nearestParallelTies(len(data), k, workers, 64, tieBreaking, seed, distances, indices, func(c *topk.Counting, lo, hi int) {
+		pushNearest(c, data[lo:hi], x)
+	})
+}
+
+// [NearestParallelTies], but for wide data.
+func NearestWideParallelTies(data [][]uint64, k int, x []uint64, workers int, tieBreaking TieBreaking, seed uint64, distances, indices []int) ([]int, []int) {
+	return nearestParallelTies(len(data), k, workers, 64*len(x), tieBreaking, seed, distances, indices, func(c *topk.Counting, lo, hi int) {
+		pushNearestWide(c, data[lo:hi], x)
+	})
+}
+
+// nearestParallelTies runs `push` for shards of `n` data points concurrently, each into its own selector
+// whose indices are offset by the start of the shard, and merges their results.
+// Since each shard's selection contains all of its points that can be selected overall, merging them in shard order
+// selects the same neighbors as a sequential search.
+func nearestParallelTies(n, k, workers, maxDistance int, tieBreaking TieBreaking, seed uint64, distances, indices []int, push func(c *topk.Counting, lo, hi int)) ([]int, []int) {
+	if k == 0 {
+		return distances, indices
+	}
+	newCounting := func() *topk.Counting {
+		c := topk.Get(k, maxDistance)
+		c.SetTies(tieBreaking.ties(), seed)
+		return c
+	}
+	shards := parallelShards(n, workers)
+	if shards <= 1 {
+		c := newCounting()
+		defer topk.Put(c)
+		push(c, 0, n)
+		return c.Append(distances, indices)
+	}
+	cs := make([]*topk.Counting, shards)
+	var wg sync.WaitGroup
+	wg.Add(shards)
+	for w := range shards {
+		go func() {
+			defer wg.Done()
+			lo, hi := shardBounds(n, shards, w)
+			c := newCounting()
+			c.SetOffset(lo)
+			push(c, lo, hi)
+			cs[w] = c
+		}()
+	}
+	wg.Wait()
+
+	merged := newCounting()
+	defer topk.Put(merged)
+	var shardDistances, shardIndices []int
+	for _, c := range cs {
+		shardDistances, shardIndices = c.Append(shardDistances[:0], shardIndices[:0])
+		topk.Put(c)
+		for j, dist := range shardDistances {
+			if dist > merged.Threshold() {
+				continue
+			}
+			merged.Push(dist, shardIndices[j])
+		}
+	}
+	return merged.Append(distances, indices)
+}
+
+// selectTies re-selects the neighbors at the k-th nearest distance with the given tie-breaking, and `seed` for [TieBreakingRandom],
+// given the `k` nearest neighbors among `n` data points found by a heap search, which prefers lower indices,
+// and the distance of the i-th data point.
+// Since the neighbors closer than the k-th nearest distance are the same for all tie-breaking policies,
+// only the data points at that distance are searched again, by comparing each distance for equality.
+// Overwrites the given slices, growing them if necessary, and returns them.
+func selectTies[D int | float64](n, k int, tieBreaking TieBreaking, seed uint64, distances []D, indices []int, distance func(i int) D) ([]D, []int) {
+	if k == 0 || tieBreaking == TieBreakingLowestIndex {
+		return distances[:k], indices[:k]
+	}
+	t := slices.Max(distances[:k])
+	closer := 0
+	for i, dist := range distances[:k] {
+		if dist < t {
+			distances[closer], indices[closer] = dist, indices[i]
+			closer++
+		}
+	}
+	distances, indices = distances[:closer], indices[:closer]
+	for i := range n {
+		if distance(i) == t {
+			distances = append(distances, t)
+			indices = append(indices, i)
+		}
+	}
+	ties, keep := indices[closer:], k-closer
+	switch tieBreaking {
+	case TieBreakingHighestIndex:
+		copy(ties, ties[len(ties)-keep:])
+	case TieBreakingRandom:
+		slices.SortFunc(ties, func(a, b int) int { return cmp.Compare(topk.Key(seed, a), topk.Key(seed, b)) })
+		slices.Sort(ties[:keep])
+	case TieBreakingIncludeAll:
+		keep = len(ties)
+	}
+	return distances[:closer+keep], indices[:closer+keep]
+}
+
+// appendHeapTies is a ties search for distances too large for a [topk.Counting] selector: it runs `nearest` into a neighbor heap
+// of length k+1 after the end of the given slices, re-selects the neighbors at the k-th nearest distance with [selectTies],
+// and appends the neighbors to the slices in index order.
+func appendHeapTies(n, k int, tieBreaking TieBreaking, seed uint64, distances, indices []int, nearest func(distances, indices []int) int, distance func(i int) int) ([]int, []int) {
+	m := len(distances)
+	distances, indices = slices.Grow(distances, k+1)[:m+k+1], slices.Grow(indices, k+1)[:m+k+1]
+	k = nearest(distances[m:], indices[m:])
+	d, i := selectTies(n, k, tieBreaking, seed, distances[m:], indices[m:], distance)
+	heap.SortFunc(d, i, func(a, b int) bool { return i[a] < i[b] })
+	return append(distances[:m], d...), append(indices[:m], i...)
+}
+
+// pushNearest pushes the data points that may be among the nearest neighbors of `x` to the selector.
+func pushNearest(c *topk.Counting, data []uint64, x uint64) {
+	t := c.Threshold()
+	for i, d := range data {
+		dist := bits.OnesCount64(d ^ x)
+		if dist > t {
+			continue
+		}
+		c.Push(dist, i)
+		t = c.Threshold()
+	}
+}
+
+// [pushNearest], but for wide data.
+func pushNearestWide(c *topk.Counting, data [][]uint64, x []uint64) {
+	t := c.Threshold()
+	for i, d := range data {
+		dist := 0
+		for j, x := range x {
+			dist += bits.OnesCount64(d[j] ^ x)
+		}
+		if dist > t {
+			continue
+		}
+		c.Push(dist, i)
+		t = c.Threshold()
+	}
+}
+
+// [pushNearest], but for wide data stored in a single flat slice, each data point with as many words as `x`.
+func pushNearestFlat(c *topk.Counting, data []uint64, x []uint64) {
+	s := len(x)
+	if s == 0 {
+		return
+	}
+	t := c.Threshold()
+	n := len(data) / s
+	for i := range n {
+		d := data[i*s : (i+1)*s]
+		dist := 0
+		for j, x := range x {
+			dist += bits.OnesCount64(d[j] ^ x)
+		}
+		if dist > t {
+			continue
+		}
+		c.Push(dist, i)
+		t = c.Threshold()
+	}
+}
@@ -0,0 +1,203 @@
+package bitknn_test
+
+import (
+	"cmp"
+	"math/bits"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/keilerkonzept/bitknn"
+	"github.com/keilerkonzept/bitknn/internal/testrandom"
+	"github.com/keilerkonzept/bitknn/internal/topk"
+	"github.com/keilerkonzept/bitknn/pack"
+	"pgregory.net/rapid"
+)
+
+var tieBreakings = []bitknn.TieBreaking{
+	bitknn.TieBreakingLowestIndex,
+	bitknn.TieBreakingHighestIndex,
+	bitknn.TieBreakingRandom,
+	bitknn.TieBreakingIncludeAll,
+}
+
+func TestTieBreaking_String(t *testing.T) {
+	names := []string{"lowest-index", "highest-index", "random", "include-all"}
+	for i, tb := range tieBreakings {
+		if tb.String() != names[i] {
+			t.Errorf("%q != %q", tb.String(), names[i])
+		}
+	}
+	if s := bitknn.TieBreaking(-1).String(); s != "unknown" {
+		t.Error(s)
+	}
+}
+
+// nearestTiesOracle returns the k nearest neighbors of `x` with the given tie-breaking, in index order.
+func nearestTiesOracle(data []uint64, k int, x uint64, tieBreaking bitknn.TieBreaking, seed uint64) []neighbor {
+	all := make([]neighbor, len(data))
+	for i, d := range data {
+		all[i] = neighbor{bits.OnesCount64(d ^ x), i}
+	}
+	slices.SortFunc(all, func(a, b neighbor) int {
+		c := cmp.Compare(a.Distance, b.Distance)
+		switch tieBreaking {
+		case bitknn.TieBreakingHighestIndex:
+			return cmp.Or(c, cmp.Compare(b.Index, a.Index))
+		case bitknn.TieBreakingRandom:
+			return cmp.Or(c, cmp.Compare(topk.Key(seed, a.Index), topk.Key(seed, b.Index)))
+		}
+		return cmp.Or(c, cmp.Compare(a.Index, b.Index))
+	})
+	n := min(k, len(all))
+	if tieBreaking == bitknn.TieBreakingIncludeAll {
+		for n > 0 && n < len(all) && all[n].Distance == all[n-1].Distance {
+			n++
+		}
+	}
+	out := all[:n]
+	slices.SortFunc(out, func(a, b neighbor) int { return cmp.Compare(a.Index, b.Index) })
+	return out
+}
+
+// neighbors returns the given neighbors without sorting them.
+func neighbors(distances, indices []int) []neighbor {
+	out := make([]neighbor, len(distances))
+	for i := range out {
+		out[i] = neighbor{distances[i], indices[i]}
+	}
+	return out
+}
+
+func TestNearestTies_Oracle(t *testing.T) {
+	rapid.Check(t, func(t *rapid.T) {
+		k := rapid.IntRange(0, 50).Draw(t, "k")
+		// Few distinct values, so that there are many ties.
+		data := rapid.SliceOf(rapid.Uint64Range(0, 15)).Draw(t, "data")
+		x := rapid.Uint64Range(0, 15).Draw(t, "x")
+		tieBreaking := rapid.SampledFrom(tieBreakings).Draw(t, "tieBreaking")
+		seed := rapid.Uint64().Draw(t, "seed")
+
+		expected := nearestTiesOracle(data, k, x, tieBreaking, seed)
+		if tieBreaking == bitknn.TieBreakingLowestIndex {
+			distances, indices := make([]int, k+1), make([]int, k+1)
+			n := bitknn.Nearest(data, k, x, distances, indices)
+			if actual := sortedNeighbors(distances[:n], indices[:n]); !reflect.DeepEqual(sortedNeighbors(neighborSlices(expected)), actual) {
+				t.Fatal("Nearest should break ties by lowest index", expected, actual)
+			}
+		}
+		distances, indices := bitknn.NearestTies(data, k, x, tieBreaking, seed, nil, nil)
+		if actual := neighbors(distances, indices); !reflect.DeepEqual(expected, actual) && len(expected)+len(actual) > 0 {
+			t.Fatal(expected, actual)
+		}
+	})
+}
+
+// neighborSlices is the inverse of [neighbors].
+func neighborSlices(ns []neighbor) ([]int, []int) {
+	distances, indices := make([]int, len(ns)), make([]int, len(ns))
+	for i, n := range ns {
+		distances[i], indices[i] = n.Distance, n.Index
+	}
+	return distances, indices
+}
+
+func TestTieBreaking_SamePathsSameNeighbors(t *testing.T) {
+	rapid.Check(t, func(t *rapid.T) {
+		k := rapid.SampledFrom([]int{0, 1, 5, 50}).Draw(t, "k")
+		dims := rapid.IntRange(1, 3).Draw(t, "dims")
+		n := rapid.SampledFrom([]int{0, 100, 5000}).Draw(t, "n")
+		workers := rapid.IntRange(2, 4).Draw(t, "workers")
+		tieBreaking := rapid.SampledFrom(tieBreakings[1:]).Draw(t, "tieBreaking")
+		seed := rapid.Uint64().Draw(t, "seed")
+		// Sparse data, so that there are many ties.
+		data := testrandom.ClusteredWideData(dims, n, 1, 5)
+		narrowData := make([]uint64, n)
+		for i := range data {
+			narrowData[i] = data[i][0]
+		}
+		labels := testrandom.Labels(n)
+		q := testrandom.Noisy(make([]uint64, dims), 5)
+		queries := [][]uint64{q, testrandom.Noisy(make([]uint64, dims), 5)}
+		opt := bitknn.WithTieBreaking(tieBreaking)
+		if tieBreaking == bitknn.TieBreakingRandom {
+			opt = bitknn.WithRandomTieBreaking(seed)
+		}
+
+		{
+			expected := nearestTiesOracle(narrowData, k, q[0], tieBreaking, seed)
+			check := func(name string) func(distances, indices []int) {
+				return func(distances, indices []int) {
+					if actual := neighbors(distances, indices); !reflect.DeepEqual(expected, actual) && len(expected)+len(actual) > 0 {
+						t.Fatal(name, expected, actual)
+					}
+				}
+			}
+			check("NearestParallelTies")(bitknn.NearestParallelTies(narrowData, k, q[0], workers, tieBreaking, seed, nil, nil))
+			sequential := bitknn.Fit(narrowData, labels, opt)
+			parallel := bitknn.Fit(narrowData, labels, opt, bitknn.WithWorkers(workers))
+			check("Model.Find")(sequential.Find(k, q[0]))
+			check("Model.Find (parallel)")(parallel.Find(k, q[0]))
+			check("Model.FindV")(sequential.FindV(k, q[0], make([]uint32, max(k, 1))))
+			check("Searcher.Find")(parallel.NewSearcher().Find(k, q[0]))
+			distances, indices := make([][]int, 2), make([][]int, 2)
+			for i := range distances {
+				distances[i], indices[i] = make([]int, k+1), make([]int, k+1)
+			}
+			if n := sequential.FindBatch(k, []uint64{queries[1][0], q[0]}, distances, indices); tieBreaking != bitknn.TieBreakingIncludeAll {
+				check("Model.FindBatch")(distances[1][:n], indices[1][:n])
+			} else if n != 0 {
+				t.Fatal(n)
+			}
+
+			sv, pv := make(bitknn.VoteMap), make(bitknn.VoteMap)
+			sequential.Predict(k, q[0], sv)
+			parallel.NewSearcher().Predict(k, q[0], pv)
+			if !reflect.DeepEqual(sv, pv) {
+				t.Fatal(sv, pv)
+			}
+		}
+		{
+			sequential := bitknn.FitWide(data, labels, opt)
+			parallel := bitknn.FitWide(data, labels, opt, bitknn.WithWorkers(workers))
+			flat := bitknn.FitFlatWide(pack.Flatten(data), dims, labels, opt, bitknn.WithWorkers(workers))
+			ed, ei := bitknn.NearestWideTies(data, k, q, tieBreaking, seed, nil, nil)
+			expected := neighbors(ed, ei)
+			check := func(name string) func(distances, indices []int) {
+				return func(distances, indices []int) {
+					if actual := neighbors(distances, indices); !reflect.DeepEqual(expected, actual) && len(expected)+len(actual) > 0 {
+						t.Fatal(name, expected, actual)
+					}
+				}
+			}
+			check("NearestWideParallelTies")(bitknn.NearestWideParallelTies(data, k, q, workers, tieBreaking, seed, nil, nil))
+			check("NearestFlatTies")(bitknn.NearestFlatTies(pack.Flatten(data), dims, k, q, tieBreaking, seed, nil, nil))
+			check("WideModel.Find")(sequential.Find(k, q))
+			check("WideModel.Find (parallel)")(parallel.Find(k, q))
+			check("WideModel.FindV")(parallel.FindV(k, q, make([]uint32, max(k, 1))))
+			check("FlatWideModel.Find")(flat.Find(k, q))
+			check("FlatWideModel.FindV")(flat.FindV(k, q, make([]uint32, max(k, 1))))
+			check("WideSearcher.Find")(parallel.NewSearcher().Find(k, q))
+			distances, indices := make([][]int, 2), make([][]int, 2)
+			for i := range distances {
+				distances[i], indices[i] = make([]int, k+1), make([]int, k+1)
+			}
+			if n := sequential.FindBatch(k, queries, distances, indices); tieBreaking != bitknn.TieBreakingIncludeAll {
+				check("WideModel.FindBatch")(distances[0][:n], indices[0][:n])
+			} else if n != 0 {
+				t.Fatal(n)
+			}
+
+			sv, fv := make(bitknn.VoteMap), make(bitknn.VoteMap)
+			if n := sequential.Predict(k, q, sv); n != len(expected) {
+				t.Fatal(n, len(expected))
+			}
+			if n := flat.PredictV(k, q, make([]uint32, max(k, 1)), fv); n != len(expected) {
+				t.Fatal(n, len(expected))
+			}
+			if !reflect.DeepEqual(sv, fv) {
+				t.Fatal(sv, fv)
+			}
+		}
+	})
+}
@@ -0,0 +1,187 @@
+package bitknn
+
+import (
+	"github.com/keilerkonzept/bitknn/internal/heap"
+	"github.com/keilerkonzept/bitknn/internal/topk"
+)
+
+// [Nearest], but by the weighted Hamming distance with the given weights of the bits (see [BitWeights.Distance64]).
+func NearestWeighted[W int | float64](data []uint64, weights *BitWeights[W], k int, x uint64, distances []W, indices []int) int {
+	heap := heap.MakeMax(distances, indices)
+	distance0 := &distances[0]
+
+	k0 := min(k, len(data))
+
+	for i, d := range data[:k0] {
+		dist := weights.Distance64(x, d)
+		heap.Push(dist, i)
+	}
+
+	if len(data) <= k {
+		return k0
+	}
+
+	maxDist := *distance0
+	_ = data[k]
+	for i := k; i < len(data); i++ {
+		dist := weights.Distance64(x, data[i])
+		if dist >= maxDist {
+			continue
+		}
+		heap.PushPop(dist, i)
+		maxDist = *distance0
+	}
+	return k
+}
+
+// [NearestWide], but by the weighted Hamming distance with the given weights of the bits (see [BitWeights.Distance]).
+func NearestWideWeighted[W int | float64](data [][]uint64, weights *BitWeights[W], k int, x []uint64, distances []W, indices []int) int {
+	heap := heap.MakeMax(distances, indices)
+	distance0 := &distances[0]
+
+	k0 := min(k, len(data))
+	for i, d := range data[:k0] {
+		dist := weights.Distance(x, d)
+		heap.Push(dist, i)
+	}
+
+	if len(data) <= k {
+		return k0
+	}
+
+	maxDist := *distance0
+	_ = data[k]
+	for i := k; i < len(data); i++ {
+		dist := weights.Distance(x, data[i])
+		if dist >= maxDist {
+			continue
+		}
+		heap.PushPop(dist, i)
+		maxDist = *distance0
+	}
+	return k
+}
+
+// [NearestParallel], but by the weighted Hamming distance with the given weights of the bits (see [NearestWeighted]).
+func NearestWeightedParallel[W int | float64](data []uint64, weights *BitWeights[W], k int, x uint64, workers int, distances []W, indices []int) int {
+	return nearestParallel(len(data), k, workers, distances, indices, func(_, _, lo, hi int, distances []W, indices []int) int {
+		return NearestWeighted(data[lo:hi], weights, k, x, distances, indices)
+	})
+}
+
+// [NearestWideParallel], but by the weighted Hamming distance with the given weights of the bits (see [NearestWideWeighted]).
+func NearestWideWeightedParallel[W int | float64](data [][]uint64, weights *BitWeights[W], k int, x []uint64, workers int, distances []W, indices []int) int {
+	return nearestParallel(len(data), k, workers, distances, indices, func(_, _, lo, hi int, distances []W, indices []int) int {
+		return NearestWideWeighted(data[lo:hi], weights, k, x, distances, indices)
+	})
+}
+
+// Largest [BitWeights.Max] for which the weighted ties searches count the neighbors at each distance (see [NearestWeightedTies]).
+const weightedTiesMaxCounting = 1 << 16
+
+// [NearestTies], but by the weighted Hamming distance with the given integer weights of the bits (see [NearestWeighted]).
+// If the largest possible distance [BitWeights.Max] is small, the neighbors are counted at each distance, like by [NearestTies].
+// Otherwise, they are found by a heap search, after which the data points at the k-th nearest distance are searched again.
+func NearestWeightedTies(data []uint64, weights *BitWeights[int], k int, x uint64, tieBreaking TieBreaking, seed uint64, distances, indices []int) ([]int, []int) {
+	if k == 0 {
+		return distances, indices
+	}
+	if weights.Max() > weightedTiesMaxCounting {
+		return appendHeapTies(len(data), k, tieBreaking, seed, distances, indices, func(distances, indices []int) int {
+			return NearestWeighted(data, weights, k, x, distances, indices)
+		}, func(i int) int {
+			return weights.Distance64(x, data[i])
+		})
+	}
+	c := topk.Get(k, weights.Max())
+	defer topk.Put(c)
+	c.SetTies(tieBreaking.ties(), seed)
+	pushNearestWeighted(c, data, weights, x)
+	return c.Append(distances, indices)
+}
+
+// [NearestWideTies], but by the weighted Hamming distance with the given integer weights of the bits (see [NearestWideWeighted]).
+// Searches like [NearestWeightedTies], depending on [BitWeights.Max].
+func NearestWideWeightedTies(data [][]uint64, weights *BitWeights[int], k int, x []uint64, tieBreaking TieBreaking, seed uint64, distances, indices []int) ([]int, []int) {
+	if k == 0 {
+		return distances, indices
+	}
+	if weights.Max() > weightedTiesMaxCounting {
+		return appendHeapTies(len(data), k, tieBreaking, seed, distances, indices, func(distances, indices []int) int {
+			return NearestWideWeighted(data, weights, k, x, distances, indices)
+		}, func(i int) int {
+			return weights.Distance(x, data[i])
+		})
+	}
+	c := topk.Get(k, weights.Max())
+	defer topk.Put(c)
+	c.SetTies(tieBreaking.ties(), seed)
+	pushNearestWideWeighted(c, data, weights, x)
+	return c.Append(distances, indices)
+}
+
+// [Within], but by the weighted Hamming distance with the given weights of the bits (see [NearestWeighted]).
+func WithinWeighted[W int | float64](data []uint64, weights *BitWeights[W], r W, x uint64, limit int, distances []W, indices []int) ([]W, []int) {
+	if limit < 0 {
+		limit = len(data)
+	}
+	for i, d := range data {
+		if limit == 0 {
+			break
+		}
+		dist := weights.Distance64(x, d)
+		if dist > r {
+			continue
+		}
+		distances = append(distances, dist)
+		indices = append(indices, i)
+		limit--
+	}
+	return distances, indices
+}
+
+// [WithinWide], but by the weighted Hamming distance with the given weights of the bits (see [NearestWideWeighted]).
+func WithinWideWeighted[W int | float64](data [][]uint64, weights *BitWeights[W], r W, x []uint64, limit int, distances []W, indices []int) ([]W, []int) {
+	if limit < 0 {
+		limit = len(data)
+	}
+	for i, d := range data {
+		if limit == 0 {
+			break
+		}
+		dist := weights.Distance(x, d)
+		if dist > r {
+			continue
+		}
+		distances = append(distances, dist)
+		indices = append(indices, i)
+		limit--
+	}
+	return distances, indices
+}
+
+// pushNearestWeighted is [pushNearest] by the distance of [NearestWeighted].
+func pushNearestWeighted(c *topk.Counting, data []uint64, weights *BitWeights[int], x uint64) {
+	t := c.Threshold()
+	for i, d := range data {
+		dist := weights.Distance64(x, d)
+		if dist > t {
+			continue
+		}
+		c.Push(dist, i)
+		t = c.Threshold()
+	}
+}
+
+// pushNearestWideWeighted is [pushNearestWide] by the distance of [NearestWideWeighted].
+func pushNearestWideWeighted(c *topk.Counting, data [][]uint64, weights *BitWeights[int], x []uint64) {
+	t := c.Threshold()
+	for i, d := range data {
+		dist := weights.Distance(x, d)
+		if dist > t {
+			continue
+		}
+		c.Push(dist, i)
+		t = c.Threshold()
+	}
+}
@@ -0,0 +1,404 @@
+package bitknn_test
+
+import (
+	"math"
+	"slices"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/keilerkonzept/bitknn"
+	"github.com/keilerkonzept/bitknn/internal/testrandom"
+	"pgregory.net/rapid"
+)
+
+// bitWeights draws integer weights of the bits of data points with the given number of words, mostly of whole bytes.
+func bitWeights(t *rapid.T, dims int) ([]int, *bitknn.BitWeights[int]) {
+	weights := rapid.SliceOfN(rapid.IntRange(0, 4), 8*dims, 8*dims).Draw(t, "byte weights")
+	out := make([]int, 64*dims)
+	for i := range out {
+		out[i] = weights[i/8]
+	}
+	return out, bitknn.ByteWeights(weights)
+}
+
+// floatBitWeights is [bitWeights] with the weights scaled to floats.
+func floatBitWeights(t *rapid.T, dims int) *bitknn.BitWeights[float64] {
+	weights := rapid.SliceOfN(rapid.IntRange(0, 4), 8*dims, 8*dims).Draw(t, "byte weights")
+	out := make([]float64, len(weights))
+	for i, w := range weights {
+		out[i] = float64(w) / 8
+	}
+	return bitknn.ByteWeights(out)
+}
+
+func TestNearestWeighted_Oracle(t *testing.T) {
+	rapid.Check(t, func(t *rapid.T) {
+		k := rapid.IntRange(0, 50).Draw(t, "k")
+		size := rapid.IntRange(0, 300).Draw(t, "size")
+		data := testrandom.Data(size)
+		x := testrandom.Query()
+		weights, bitWeights := bitWeights(t, 1)
+		r := rapid.IntRange(0, bitWeights.Max()).Draw(t, "r")
+
+		all := make([]int, size)
+		for i, d := range data {
+			all[i] = weightedDistanceOracle(weights, []uint64{x}, []uint64{d})
+		}
+		expected := slices.Concat(nearestOracle(k, all))
+
+		distances, indices := make([]int, k+1), make([]int, k+1)
+		n := bitknn.NearestWeighted(data, bitWeights, k, x, distances, indices)
+		bitknn.SortNeighbors(distances[:n], indices[:n])
+		if diff := cmp.Diff(expected, slices.Concat(distances[:n], indices[:n])); diff != "" {
+			t.Fatal(diff)
+		}
+		n = bitknn.NearestWeightedParallel(data, bitWeights, k, x, 4, distances, indices)
+		bitknn.SortNeighbors(distances[:n], indices[:n])
+		if diff := cmp.Diff(expected, slices.Concat(distances[:n], indices[:n])); diff != "" {
+			t.Fatal(diff)
+		}
+		tiesDistances, tiesIndices := bitknn.NearestWeightedTies(data, bitWeights, k, x, bitknn.TieBreakingLowestIndex, 0, nil, nil)
+		bitknn.SortNeighbors(tiesDistances, tiesIndices)
+		if diff := cmp.Diff(expected, slices.Concat(tiesDistances, tiesIndices)); diff != "" {
+			t.Fatal(diff)
+		}
+		withinDistances, withinIndices := bitknn.WithinWeighted(data, bitWeights, r, x, -1, nil, nil)
+		if diff := cmp.Diff(slices.Concat(withinOracle(r, all)), slices.Concat(withinDistances, withinIndices)); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+}
+
+func TestNearestWideWeighted_Oracle(t *testing.T) {
+	rapid.Check(t, func(t *rapid.T) {
+		k := rapid.IntRange(0, 50).Draw(t, "k")
+		dims := rapid.IntRange(1, 4).Draw(t, "dims")
+		size := rapid.IntRange(0, 300).Draw(t, "size")
+		data := testrandom.WideData(dims, size)
+		x := testrandom.WideQuery(dims)
+		weights, bitWeights := bitWeights(t, dims)
+		r := rapid.IntRange(0, bitWeights.Max()).Draw(t, "r")
+
+		all := make([]int, size)
+		for i, d := range data {
+			all[i] = weightedDistanceOracle(weights, x, d)
+		}
+		expected := slices.Concat(nearestOracle(k, all))
+
+		distances, indices := make([]int, k+1), make([]int, k+1)
+		n := bitknn.NearestWideWeighted(data, bitWeights, k, x, distances, indices)
+		bitknn.SortNeighbors(distances[:n], indices[:n])
+		if diff := cmp.Diff(expected, slices.Concat(distances[:n], indices[:n])); diff != "" {
+			t.Fatal(diff)
+		}
+		n = bitknn.NearestWideWeightedParallel(data, bitWeights, k, x, 4, distances, indices)
+		bitknn.SortNeighbors(distances[:n], indices[:n])
+		if diff := cmp.Diff(expected, slices.Concat(distances[:n], indices[:n])); diff != "" {
+			t.Fatal(diff)
+		}
+		tiesDistances, tiesIndices := bitknn.NearestWideWeightedTies(data, bitWeights, k, x, bitknn.TieBreakingLowestIndex, 0, nil, nil)
+		bitknn.SortNeighbors(tiesDistances, tiesIndices)
+		if diff := cmp.Diff(expected, slices.Concat(tiesDistances, tiesIndices)); diff != "" {
+			t.Fatal(diff)
+		}
+		withinDistances, withinIndices := bitknn.WithinWideWeighted(data, bitWeights, r, x, -1, nil, nil)
+		if diff := cmp.Diff(slices.Concat(withinOracle(r, all)), slices.Concat(withinDistances, withinIndices)); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+}
+
+func TestNearestWeightedTies_LargeWeights(t *testing.T) {
+	rapid.Check(t, func(t *rapid.T) {
+		k := rapid.IntRange(0, 20).Draw(t, "k")
+		dims := rapid.IntRange(1, 2).Draw(t, "dims")
+		size := rapid.SampledFrom([]int{0, 1, 10, 300, 3000}).Draw(t, "size")
+		data := testrandom.WideData(dims, size)
+		x := testrandom.WideQuery(dims)
+		weights, _ := bitWeights(t, dims)
+		for i := range weights {
+			weights[i] <<= 40
+		}
+		bitWeights := bitknn.NewBitWeights(weights)
+		tieBreaking := rapid.SampledFrom(tieBreakings).Draw(t, "tieBreaking")
+		seed := rapid.Uint64().Draw(t, "seed")
+
+		all := make([]int, size)
+		for i, d := range data {
+			all[i] = weightedDistanceOracle(weights, x, d)
+		}
+		expected := slices.Concat(tiesOracle(k, all, tieBreaking, seed))
+
+		// The neighbors are appended to the given slices in index order.
+		distances, indices := bitknn.NearestWideWeightedTies(data, bitWeights, k, x, tieBreaking, seed, []int{-1}, []int{-1})
+		if distances[0] != -1 || indices[0] != -1 || !slices.IsSorted(indices[1:]) {
+			t.Fatal(distances, indices)
+		}
+		bitknn.SortNeighbors(distances[1:], indices[1:])
+		if diff := cmp.Diff(expected, slices.Concat(distances[1:], indices[1:])); diff != "" {
+			t.Fatal(diff)
+		}
+
+		model := bitknn.FitWide(data, nil, bitknn.WithBitWeights(bitWeights), bitknn.WithTieBreaking(tieBreaking),
+			withSeed(seed), bitknn.WithWorkers(rapid.IntRange(1, 4).Draw(t, "workers")), bitknn.WithSorted())
+		distances, indices = model.Find(k, x)
+		if diff := cmp.Diff(expected, slices.Concat(distances, indices), cmpopts.EquateEmpty()); diff != "" {
+			t.Fatal(diff)
+		}
+		if dims == 1 {
+			narrowData := make([]uint64, size)
+			for i, d := range data {
+				narrowData[i] = d[0]
+			}
+			distances, indices = bitknn.NearestWeightedTies(narrowData, bitWeights, k, x[0], tieBreaking, seed, nil, nil)
+			bitknn.SortNeighbors(distances, indices)
+			if diff := cmp.Diff(expected, slices.Concat(distances, indices), cmpopts.EquateEmpty()); diff != "" {
+				t.Fatal(diff)
+			}
+			narrow := bitknn.Fit(narrowData, nil, bitknn.WithBitWeights(bitWeights), bitknn.WithTieBreaking(tieBreaking),
+				withSeed(seed), bitknn.WithWorkers(4), bitknn.WithSorted())
+			distances, indices = narrow.Find(k, x[0])
+			if diff := cmp.Diff(expected, slices.Concat(distances, indices), cmpopts.EquateEmpty()); diff != "" {
+				t.Fatal(diff)
+			}
+		}
+	})
+}
+
+func TestNearestWideWeighted_Float(t *testing.T) {
+	rapid.Check(t, func(t *rapid.T) {
+		k := rapid.IntRange(0, 50).Draw(t, "k")
+		dims := rapid.IntRange(1, 4).Draw(t, "dims")
+		size := rapid.IntRange(0, 300).Draw(t, "size")
+		data := testrandom.WideData(dims, size)
+		x := testrandom.WideQuery(dims)
+		bitWeights := floatBitWeights(t, dims)
+
+		// Weights that are multiples of 1/8 add up exactly.
+		all := make([]float64, size)
+		for i, d := range data {
+			all[i] = bitWeights.Distance(x, d)
+		}
+		expectedDistances, expectedIndices := nearestOracle(k, all)
+
+		distances, indices := make([]float64, k+1), make([]int, k+1)
+		n := bitknn.NearestWideWeighted(data, bitWeights, k, x, distances, indices)
+		bitknn.SortNeighbors(distances[:n], indices[:n])
+		if diff := cmp.Diff(expectedDistances, distances[:n], cmpopts.EquateEmpty()); diff != "" {
+			t.Fatal(diff)
+		}
+		if diff := cmp.Diff(expectedIndices, indices[:n], cmpopts.EquateEmpty()); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+}
+
+func TestModel_BitWeights(t *testing.T) {
+	rapid.Check(t, func(t *rapid.T) {
+		k := rapid.IntRange(1, 20).Draw(t, "k")
+		size := rapid.SampledFrom([]int{0, 1, 10, 300, 3000}).Draw(t, "size")
+		dims := rapid.IntRange(1, 3).Draw(t, "dims")
+		data := testrandom.WideData(dims, size)
+		labels := testrandom.Labels(size)
+		x := testrandom.WideQuery(dims)
+		_, bitWeights := bitWeights(t, dims)
+		r := rapid.IntRange(0, bitWeights.Max()).Draw(t, "r")
+		tieBreaking := rapid.SampledFrom(tieBreakings).Draw(t, "tieBreaking")
+		opts := []bitknn.Option{
+			bitknn.WithBitWeights(bitWeights),
+			bitknn.WithLinearDistanceWeighting(),
+			bitknn.WithTieBreaking(tieBreaking),
+			bitknn.WithWorkers(rapid.IntRange(1, 4).Draw(t, "workers")),
+			bitknn.WithSorted(),
+		}
+		model := bitknn.FitWide(data, labels, opts...)
+
+		expectedDistances, expectedIndices := bitknn.NearestWideWeightedTies(data, bitWeights, k, x, tieBreaking, 0, nil, nil)
+		bitknn.SortNeighbors(expectedDistances, expectedIndices)
+		expected := [][]int{expectedDistances, expectedIndices}
+		expectedVotes := make(bitknn.VoteMap)
+		model.Narrow.Vote(len(expectedIndices), expectedDistances, expectedIndices, expectedVotes)
+		withinDistances, withinIndices := bitknn.WithinWideWeighted(data, bitWeights, r, x, -1, nil, nil)
+		expectedWithin := [][]int{withinDistances, withinIndices}
+
+		finds := map[string]func() ([]int, []int){
+			"WideModel.Find":  func() ([]int, []int) { return model.Find(k, x) },
+			"WideModel.FindV": func() ([]int, []int) { return model.FindV(k, x, make([]uint32, k)) },
+		}
+		predicts := map[string]func(votes bitknn.VoteCounter){
+			"WideModel.Predict": func(votes bitknn.VoteCounter) { model.Predict(k, x, votes) },
+		}
+		withins := map[string]func() ([]int, []int){
+			"WideModel.FindWithin": func() ([]int, []int) { return model.FindWithin(r, x) },
+		}
+		if dims == 1 {
+			narrowData := make([]uint64, size)
+			for i, d := range data {
+				narrowData[i] = d[0]
+			}
+			narrow := bitknn.Fit(narrowData, labels, opts...)
+			finds["Model.Find"] = func() ([]int, []int) { return narrow.Find(k, x[0]) }
+			finds["Model.FindV"] = func() ([]int, []int) { return narrow.FindV(k, x[0], make([]uint32, k)) }
+			predicts["Model.Predict"] = func(votes bitknn.VoteCounter) { narrow.Predict(k, x[0], votes) }
+			withins["Model.FindWithin"] = func() ([]int, []int) { return narrow.FindWithin(r, x[0]) }
+		}
+		for name, find := range finds {
+			distances, indices := find()
+			if diff := cmp.Diff(expected, [][]int{distances, indices}, cmpopts.EquateEmpty()); diff != "" {
+				t.Fatal(name, diff)
+			}
+		}
+		for name, predict := range predicts {
+			votes := make(bitknn.VoteMap)
+			predict(votes)
+			if diff := cmp.Diff(expectedVotes, votes, cmpopts.EquateApprox(0, eps)); diff != "" {
+				t.Fatal(name, diff)
+			}
+		}
+		for name, within := range withins {
+			distances, indices := within()
+			if diff := cmp.Diff(expectedWithin, [][]int{distances, indices}, cmpopts.EquateEmpty()); diff != "" {
+				t.Fatal(name, diff)
+			}
+		}
+	})
+}
+
+func TestModel_FindWeighted(t *testing.T) {
+	rapid.Check(t, func(t *rapid.T) {
+		k := rapid.IntRange(1, 20).Draw(t, "k")
+		size := rapid.SampledFrom([]int{0, 1, 10, 300, 3000}).Draw(t, "size")
+		dims := rapid.IntRange(1, 3).Draw(t, "dims")
+		data := testrandom.WideData(dims, size)
+		labels := testrandom.Labels(size)
+		values := testrandom.Values(size)
+		x := testrandom.WideQuery(dims)
+		bitWeights := floatBitWeights(t, dims)
+		tieBreaking := rapid.SampledFrom(tieBreakings).Draw(t, "tieBreaking")
+		opts := []bitknn.Option{
+			bitknn.WithFloatBitWeights(bitWeights),
+			bitknn.WithValues(values),
+			bitknn.WithQuadraticDistanceWeighting(),
+			bitknn.WithTieBreaking(tieBreaking),
+			bitknn.WithWorkers(rapid.IntRange(1, 4).Draw(t, "workers")),
+			bitknn.WithSorted(),
+		}
+		model := bitknn.FitWide(data, labels, opts...)
+
+		// The weights are multiples of 1/8, so the distances are exact, and there are many ties.
+		all := make([]float64, size)
+		for i, d := range data {
+			all[i] = bitWeights.Distance(x, d)
+		}
+		expectedDistances, expectedIndices := tiesOracle(k, all, tieBreaking, 0)
+		n := len(expectedIndices)
+		expectedVotes := make(bitknn.VoteMap)
+		for i, index := range expectedIndices {
+			expectedVotes.Add(labels[index], values[index]/(1+expectedDistances[i]*expectedDistances[i]))
+		}
+
+		finds := map[string]func() ([]float64, []int){
+			"WideModel.FindWeighted": func() ([]float64, []int) { return model.FindWeighted(k, x) },
+		}
+		predicts := map[string]func(votes bitknn.VoteCounter) int{
+			"WideModel.PredictWeighted": func(votes bitknn.VoteCounter) int { return model.PredictWeighted(k, x, votes) },
+		}
+		if dims == 1 {
+			narrowData := make([]uint64, size)
+			for i, d := range data {
+				narrowData[i] = d[0]
+			}
+			narrow := bitknn.Fit(narrowData, labels, opts...)
+			finds["Model.FindWeighted"] = func() ([]float64, []int) { return narrow.FindWeighted(k, x[0]) }
+			predicts["Model.PredictWeighted"] = func(votes bitknn.VoteCounter) int { return narrow.PredictWeighted(k, x[0], votes) }
+		}
+		for name, find := range finds {
+			actualDistances, actualIndices := find()
+			if diff := cmp.Diff(expectedDistances, actualDistances, cmpopts.EquateEmpty()); diff != "" {
+				t.Fatal(name, diff)
+			}
+			if diff := cmp.Diff(expectedIndices, actualIndices, cmpopts.EquateEmpty()); diff != "" {
+				t.Fatal(name, diff)
+			}
+		}
+		for name, predict := range predicts {
+			votes := make(bitknn.VoteMap)
+			if actualN := predict(votes); actualN != n {
+				t.Fatal(name, actualN, n)
+			}
+			if diff := cmp.Diff(expectedVotes, votes, cmpopts.EquateApprox(0, eps)); diff != "" {
+				t.Fatal(name, diff)
+			}
+		}
+	})
+}
+
+func TestModel_VoteWeighted_Custom(t *testing.T) {
+	model := bitknn.Fit(nil, []int{0, 1}, bitknn.WithDistanceWeightingFunc(func(dist int) float64 { return float64(10 - dist) }))
+	votes := make(bitknn.VoteSlice, 2)
+	model.VoteWeighted(2, []float64{1.4, 1.6}, []int{0, 1}, votes)
+	if diff := cmp.Diff(bitknn.VoteSlice{9, 8}, votes); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestModel_BitWeights_NoAlloc(t *testing.T) {
+	const k, size = 10, 1000
+	data, wideData := testrandom.Data(size), testrandom.WideData(4, size)
+	labels := testrandom.Labels(size)
+	weights := make([]int, 32)
+	floatWeights := make([]float64, 32)
+	for i := range weights {
+		weights[i] = i % 3
+		floatWeights[i] = math.Sqrt(float64(i))
+	}
+	model := bitknn.Fit(data, labels,
+		bitknn.WithLinearDistanceWeighting(),
+		bitknn.WithBitWeights(bitknn.ByteWeights(weights[:8])),
+		bitknn.WithFloatBitWeights(bitknn.ByteWeights(floatWeights[:8])),
+	)
+	wideModel := bitknn.FitWide(wideData, labels,
+		bitknn.WithLinearDistanceWeighting(),
+		bitknn.WithBitWeights(bitknn.ByteWeights(weights)),
+		bitknn.WithFloatBitWeights(bitknn.ByteWeights(floatWeights)),
+	)
+	distances, indices := make([]int, k+1), make([]int, k+1)
+	floatDistances := make([]float64, k+1)
+	var votes bitknn.VoteCounter = make(bitknn.VoteSlice, 256)
+	x, wideX := testrandom.Query(), testrandom.WideQuery(4)
+	for name, f := range map[string]func(){
+		"Model.FindInto":                func() { model.FindInto(k, x, distances, indices) },
+		"Model.PredictInto":             func() { model.PredictInto(k, x, distances, indices, votes) },
+		"Model.PredictWeightedInto":     func() { model.PredictWeightedInto(k, x, floatDistances, indices, votes) },
+		"WideModel.FindInto":            func() { wideModel.FindInto(k, wideX, distances, indices) },
+		"WideModel.PredictInto":         func() { wideModel.PredictInto(k, wideX, distances, indices, votes) },
+		"WideModel.PredictWeightedInto": func() { wideModel.PredictWeightedInto(k, wideX, floatDistances, indices, votes) },
+	} {
+		if allocs := testing.AllocsPerRun(10, f); allocs != 0 {
+			t.Errorf("%s: %v allocations", name, allocs)
+		}
+	}
+}
+
+// withSeed sets the seed of [bitknn.TieBreakingRandom] without changing the tie-breaking.
+func withSeed(seed uint64) bitknn.Option {
+	return func(m *bitknn.Model) { m.TieBreakingSeed = seed }
+}
+
+func TestFit_RejectsWideBitWeights(t *testing.T) {
+	for name, opt := range map[string]bitknn.Option{
+		"BitWeights":      bitknn.WithBitWeights(bitknn.ByteWeights(make([]int, 9))),
+		"FloatBitWeights": bitknn.WithFloatBitWeights(bitknn.NewBitWeights(make([]float64, 65))),
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatal("Fit should panic with wide", name)
+				}
+			}()
+			bitknn.Fit([]uint64{0}, nil, opt)
+		}()
+	}
+	bitknn.FitWide([][]uint64{{0, 0}}, nil, bitknn.WithBitWeights(bitknn.ByteWeights(make([]int, 16))))
+}
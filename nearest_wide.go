@@ -42,7 +42,65 @@ func NearestWide(data [][]uint64, k int, x []uint64, distances, indices []int) i
 	return k
 }
 
-// [NearestWide], but vectorizable (currently only on ARM64 with NEON instructions).
+// Number of words after which [NearestWideEarlyAbandon] compares the running distance to the current k-th nearest distance.
+const earlyAbandonWords = 8
+
+// [NearestWide], but abandons the distance computation for a data point as soon as its partial distance
+// reaches the distance of the current k-th nearest neighbor, checking every few words.
+// Finds the same neighbors as [NearestWide], in the same order.
+// Faster than [NearestWide] for very wide data (thousands of bits), where most points are abandoned early.
+func NearestWideEarlyAbandon(data [][]uint64, k int, x []uint64, distances, indices []int) int {
+	if len(x) <= earlyAbandonWords {
+		return NearestWide(data, k, x, distances, indices)
+	}
+	heap := heap.MakeMax(distances, indices)
+	distance0 := &distances[0]
+
+	k0 := min(k, len(data))
+	for i, d := range data[:k0] {
+		dist := 0
+		for j, x := range x {
+			dist += bits.OnesCount64(d[j] ^ x)
+		}
+		heap.Push(dist, i)
+	}
+
+	if len(data) <= k {
+		return k0
+	}
+
+	maxDist := *distance0
+	_ = data[k]
+	blocks := len(x) - len(x)%earlyAbandonWords
+	xTail := x[blocks:]
+points:
+	for i := k; i < len(data); i++ {
+		dist := 0
+		d := data[i][:len(x)]
+		for j := 0; j < blocks; j += earlyAbandonWords {
+			d, x := d[j:j+earlyAbandonWords], x[j:j+earlyAbandonWords]
+			dist += bits.OnesCount64(d[0]^x[0]) + bits.OnesCount64(d[1]^x[1]) +
+				bits.OnesCount64(d[2]^x[2]) + bits.OnesCount64(d[3]^x[3]) +
+				bits.OnesCount64(d[4]^x[4]) + bits.OnesCount64(d[5]^x[5]) +
+				bits.OnesCount64(d[6]^x[6]) + bits.OnesCount64(d[7]^x[7])
+			if dist >= maxDist {
+				continue points
+			}
+		}
+		dTail := d[blocks:]
+		for j, x := range xTail {
+			dist += bits.OnesCount64(dTail[j] ^ x)
+		}
+		if dist >= maxDist {
+			continue
+		}
+		heap.PushPop(dist, i)
+		maxDist = *distance0
+	}
+	return k
+}
+
+// [NearestWide], but vectorized (on ARM64 with NEON, and on amd64 with AVX2 or AVX-512 instructions).
 // The `batch` array must have at least length `k`, and is used to pre-compute batches of distances.
 func NearestWideV(data [][]uint64, k int, x []uint64, batch []uint32, distances, indices []int) int {
 	if k == 0 || len(data) == 0 {
@@ -100,3 +158,26 @@ func NearestWideV(data [][]uint64, k int, x []uint64, batch []uint32, distances,
 	}
 	return k
 }
+
+// [Within], but for wide data.
+func WithinWide(data [][]uint64, r int, x []uint64, limit int, distances, indices []int) ([]int, []int) {
+	if limit < 0 {
+		limit = len(data)
+	}
+	for i, d := range data {
+		if limit == 0 {
+			break
+		}
+		dist := 0
+		for j, x := range x {
+			dist += bits.OnesCount64(d[j] ^ x)
+		}
+		if dist > r {
+			continue
+		}
+		distances = append(distances, dist)
+		indices = append(indices, i)
+		limit--
+	}
+	return distances, indices
+}
@@ -0,0 +1,32 @@
+package bitknn
+
+import (
+	"iter"
+
+	"github.com/keilerkonzept/bitknn/internal/heap"
+)
+
+// SortNeighbors sorts the given neighbors in place by ascending distance, and equal distances by ascending index.
+// Doesn't allocate.
+func SortNeighbors[D int | float64](distances []D, indices []int) {
+	heap.Sort(distances, indices)
+}
+
+// SortSimilarNeighbors sorts the given neighbors in place by descending similarity, and equal similarities by ascending index.
+// Doesn't allocate.
+func SortSimilarNeighbors(similarities []float64, indices []int) {
+	negate(similarities)
+	heap.Sort(similarities, indices)
+	negate(similarities)
+}
+
+// Neighbors returns an iterator over the given neighbors as (index, distance) pairs, in the given order.
+func Neighbors(distances, indices []int) iter.Seq2[int, int] {
+	return func(yield func(int, int) bool) {
+		for i, index := range indices {
+			if !yield(index, distances[i]) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package bitknn_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/keilerkonzept/bitknn"
+	"github.com/keilerkonzept/bitknn/internal/testrandom"
+	"github.com/keilerkonzept/bitknn/pack"
+	"pgregory.net/rapid"
+)
+
+func TestFindSorted(t *testing.T) {
+	rapid.Check(t, func(t *rapid.T) {
+		k := rapid.IntRange(0, 100).Draw(t, "k")
+		dims := rapid.IntRange(1, 3).Draw(t, "dims")
+		n := rapid.SampledFrom([]int{0, 10, 1000}).Draw(t, "n")
+		data := testrandom.ClusteredWideData(dims, n, 4, 3)
+		narrowData := make([]uint64, n)
+		for i := range data {
+			narrowData[i] = data[i][0]
+		}
+		q := testrandom.WideQuery(dims)
+		tieBreaking := rapid.SampledFrom(tieBreakings).Draw(t, "tieBreaking")
+		opts := []bitknn.Option{bitknn.WithTieBreaking(tieBreaking)}
+		if rapid.Bool().Draw(t, "parallel") {
+			opts = append(opts, bitknn.WithWorkers(3))
+		}
+
+		check := func(name string, expected []neighbor) func(distances, indices []int) {
+			return func(distances, indices []int) {
+				if actual := neighbors(distances, indices); !reflect.DeepEqual(expected, actual) {
+					t.Fatal(name, expected, actual)
+				}
+			}
+		}
+		{
+			m := bitknn.Fit(narrowData, nil, opts...)
+			expected := sortedNeighbors(m.Find(k, q[0]))
+			check("Model.FindSorted", expected)(m.FindSorted(k, q[0]))
+			var seq []neighbor
+			for index, dist := range m.FindSeq(k, q[0]) {
+				seq = append(seq, neighbor{dist, index})
+			}
+			if len(expected) > 0 && !reflect.DeepEqual(expected, seq) {
+				t.Fatal("Model.FindSeq", expected, seq)
+			}
+			sorted := bitknn.Fit(narrowData, nil, append(opts, bitknn.WithSorted())...)
+			check("Model.Find", expected)(sorted.Find(k, q[0]))
+			check("Model.FindV", expected)(sorted.FindV(k, q[0], make([]uint32, max(k, 1))))
+			check("Searcher.Find", expected)(sorted.NewSearcher().Find(k, q[0]))
+			distances, indices := [][]int{make([]int, k+1)}, [][]int{make([]int, k+1)}
+			if count := sorted.FindBatch(k, q[:1], distances, indices); tieBreaking != bitknn.TieBreakingIncludeAll {
+				check("Model.FindBatch", expected)(distances[0][:count], indices[0][:count])
+			} else if count != 0 {
+				t.Fatal("Model.FindBatch", count)
+			}
+		}
+		{
+			m := bitknn.FitWide(data, nil, opts...)
+			flat := bitknn.FitFlatWide(pack.Flatten(data), dims, nil, opts...)
+			expected := sortedNeighbors(m.Find(k, q))
+			check("WideModel.FindSorted", expected)(m.FindSorted(k, q))
+			check("FlatWideModel.FindSorted", expected)(flat.FindSorted(k, q))
+			var seq []neighbor
+			for index, dist := range flat.FindSeq(k, q) {
+				seq = append(seq, neighbor{dist, index})
+			}
+			if len(expected) > 0 && !reflect.DeepEqual(expected, seq) {
+				t.Fatal("FlatWideModel.FindSeq", expected, seq)
+			}
+			sorted := bitknn.FitWide(data, nil, append(opts, bitknn.WithSorted())...)
+			check("WideModel.Find", expected)(sorted.Find(k, q))
+			check("WideModel.FindV", expected)(sorted.FindV(k, q, make([]uint32, max(k, 1))))
+			check("WideSearcher.Find", expected)(sorted.NewSearcher().Find(k, q))
+			distances, indices := [][]int{make([]int, k+1)}, [][]int{make([]int, k+1)}
+			if count := sorted.FindBatch(k, [][]uint64{q}, distances, indices); tieBreaking != bitknn.TieBreakingIncludeAll {
+				check("WideModel.FindBatch", expected)(distances[0][:count], indices[0][:count])
+			} else if count != 0 {
+				t.Fatal("WideModel.FindBatch", count)
+			}
+		}
+	})
+}
+
+func TestFindSeq_Break(t *testing.T) {
+	m := bitknn.FitWide(testrandom.WideData(2, 100), nil)
+	q := testrandom.WideQuery(2)
+	expected, _ := m.FindSorted(10, q)
+	var distances []int
+	for _, dist := range m.FindSeq(10, q) {
+		if len(distances) == 3 {
+			break
+		}
+		distances = append(distances, dist)
+	}
+	if !reflect.DeepEqual(expected[:3], distances) {
+		t.Fatal(expected, distances)
+	}
+}
+
+func TestModel_FindSorted_NoAlloc(t *testing.T) {
+	const k = 10
+	m := bitknn.Fit(testrandom.Data(1000), nil)
+	q := testrandom.Query()
+	m.PreallocateHeap(k)
+	if allocs := testing.AllocsPerRun(10, func() { m.FindSorted(k, q) }); allocs != 0 {
+		t.Fatal(allocs)
+	}
+}
@@ -2,11 +2,59 @@ package bitknn
 
 type Option func(*Model)
 
-// Assign vote values for each data point.
+// Assign vote values for each data point, which are also the targets of the Regress methods.
 func WithValues(v []float64) Option {
 	return func(o *Model) { o.Values = v }
 }
 
+// Assign validity masks for each data point, only counting the bits known for both the query and a data point (see [Model.DataMasks]).
+func WithDataMasks(masks []uint64) Option {
+	return func(o *Model) { o.DataMasks = masks }
+}
+
+// Assign validity masks for each data point of a [WideModel] (see [Model.WideDataMasks]).
+func WithWideDataMasks(masks [][]uint64) Option {
+	return func(o *Model) { o.WideDataMasks = masks }
+}
+
+// Search by the weighted Hamming distance with the given integer weights of the bits (see [Model.BitWeights]).
+func WithBitWeights(weights *BitWeights[int]) Option {
+	return func(o *Model) { o.BitWeights = weights }
+}
+
+// Assign floating-point weights of the bits for the FindWeighted and PredictWeighted methods (see [Model.FloatBitWeights]).
+func WithFloatBitWeights(weights *BitWeights[float64]) Option {
+	return func(o *Model) { o.FloatBitWeights = weights }
+}
+
+// Search the FindSimilar and PredictSimilar methods by the given similarity coefficient,
+// and count the bits set in each data point when fitting or reading the model (see [Model.OnesCounts]).
+func WithSimilarity(similarity Similarity) Option {
+	return func(o *Model) {
+		o.Similarity = similarity
+		o.countOnes = true
+	}
+}
+
+// Search the FindSimilar and PredictSimilar methods by the given custom similarity coefficient (see [Model.Metric]),
+// and count the bits set in each data point when fitting or reading the model, as [WithSimilarity].
+func WithMetric(metric Metric) Option {
+	return func(o *Model) {
+		o.Metric = metric
+		o.countOnes = true
+	}
+}
+
+// Weigh the neighbors found by the PredictSimilar methods by their similarity.
+func WithSimilarityWeighting() Option {
+	return WithSimilarityWeightingFunc(func(s float64) float64 { return s })
+}
+
+// Weigh the neighbors found by the PredictSimilar methods by the given function of their similarity.
+func WithSimilarityWeightingFunc(f func(similarity float64) float64) Option {
+	return func(o *Model) { o.SimilarityWeightingFunc = f }
+}
+
 // Apply linear distance weighting (`1 / (1 + dist)`).
 func WithLinearDistanceWeighting() Option {
 	return func(o *Model) { o.DistanceWeighting = DistanceWeightingLinear }
@@ -24,3 +72,60 @@ func WithDistanceWeightingFunc(f func(dist int) float64) Option {
 		o.DistanceWeightingFunc = f
 	}
 }
+
+// Search the data for a single query concurrently, using up to the given number of goroutines.
+func WithWorkers(workers int) Option {
+	return func(o *Model) { o.Workers = workers }
+}
+
+// Abandon distance computations early when searching wide data (see [NearestWideEarlyAbandon]).
+func WithEarlyAbandon() Option {
+	return func(o *Model) { o.EarlyAbandon = true }
+}
+
+// Select the nearest neighbors using the given method (see [Selection]).
+func WithSelection(selection Selection) Option {
+	return func(o *Model) { o.Selection = selection }
+}
+
+// Break ties between neighbors at the k-th nearest distance as given (see [TieBreaking]).
+func WithTieBreaking(tieBreaking TieBreaking) Option {
+	return func(o *Model) { o.TieBreaking = tieBreaking }
+}
+
+// Break ties between neighbors at the k-th nearest distance in a pseudo-random order determined by the given seed.
+func WithRandomTieBreaking(seed uint64) Option {
+	return func(o *Model) {
+		o.TieBreaking = TieBreakingRandom
+		o.TieBreakingSeed = seed
+	}
+}
+
+// Return the neighbors found by the Find methods sorted by ascending distance, and equal distances by ascending index.
+func WithSorted() Option {
+	return func(o *Model) { o.Sorted = true }
+}
+
+// Weigh the neighbors found by the PredictMasked methods by their masked distances rescaled to the full width (see [NormalizeMaskedDistances]),
+// and search models with data masks by the rescaled distance (see [NearestDataMaskedNormalized]).
+func WithMaskedDistanceNormalization() Option {
+	return func(o *Model) { o.MaskedDistanceNormalization = true }
+}
+
+// Aggregate the targets of the nearest neighbors in the Regress methods as given (see [Aggregation]).
+func WithAggregation(aggregation Aggregation) Option {
+	return func(o *Model) { o.Aggregation = aggregation }
+}
+
+// Aggregate the targets of the nearest neighbors in the Regress methods by their trimmed mean,
+// excluding the given fraction of neighbors with the lowest targets and the same fraction with the highest ones.
+// Fractions of one half or more keep only the middle one or two neighbors. Panics if the fraction is negative or NaN.
+func WithTrimmedMean(fraction float64) Option {
+	if !(fraction >= 0) {
+		panic("bitknn: the trim fraction must not be negative or NaN")
+	}
+	return func(o *Model) {
+		o.Aggregation = AggregationTrimmedMean
+		o.TrimFraction = fraction
+	}
+}
@@ -14,3 +14,16 @@ func ReallocateFlat[T any](d [][]T) {
 		j += len(row)
 	}
 }
+
+// Flatten copies the rows of the given 2d slice into a single flat slice.
+func Flatten[T any](d [][]T) []T {
+	n := 0
+	for _, d := range d {
+		n += len(d)
+	}
+	flat := make([]T, 0, n)
+	for _, row := range d {
+		flat = append(flat, row...)
+	}
+	return flat
+}
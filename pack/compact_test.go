@@ -25,3 +25,21 @@ func TestPackReallocateFlat(t *testing.T) {
 		}
 	})
 }
+
+func TestPackFlatten(t *testing.T) {
+	rapid.Check(t, func(t *rapid.T) {
+		dims := rapid.IntRange(0, 100).Draw(t, "dims")
+		n := rapid.IntRange(0, 1000).Draw(t, "n")
+		data := rapid.SliceOfN(rapid.SliceOfN(rapid.Uint64(), dims, dims), n, n).Draw(t, "data")
+
+		flat := pack.Flatten(data)
+		if len(flat) != n*dims {
+			t.Fatal(len(flat), n*dims)
+		}
+		for i, row := range data {
+			if !reflect.DeepEqual(row, flat[i*dims:(i+1)*dims]) {
+				t.Fatalf("Row %d: %v, Flat: %v", i, row, flat[i*dims:(i+1)*dims])
+			}
+		}
+	})
+}
@@ -0,0 +1,5 @@
+//go:build race
+
+package bitknn_test
+
+const raceEnabled = true
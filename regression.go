@@ -0,0 +1,140 @@
+package bitknn
+
+import "github.com/keilerkonzept/bitknn/internal/heap"
+
+// Aggregation determines how the targets of the nearest neighbors are aggregated by the Regress methods.
+type Aggregation int
+
+const (
+	// The distance-weighted mean of the neighbor targets.
+	AggregationMean Aggregation = iota
+	// The distance-weighted median of the neighbor targets.
+	AggregationMedian
+	// The distance-weighted mean of the neighbor targets, excluding the fraction [Model.TrimFraction] of neighbors
+	// with the lowest targets and the same fraction with the highest ones.
+	AggregationTrimmedMean
+)
+
+func (me Aggregation) String() string {
+	switch me {
+	case AggregationMean:
+		return "mean"
+	case AggregationMedian:
+		return "median"
+	case AggregationTrimmedMean:
+		return "trimmed-mean"
+	}
+	return "unknown"
+}
+
+// Regression is the result of a k-NN regression.
+type Regression struct {
+	// Aggregated target of the neighbors, according to [Model.Aggregation].
+	Value float64
+	// Distance-weighted variance of the neighbor targets around their distance-weighted mean.
+	Variance float64
+	// Number of neighbors.
+	Neighbors int
+}
+
+// Aggregates the targets of the given neighbors, which are their [Model.Values], weighted by distance according to [Model.DistanceWeighting].
+// If the weights of all neighbors are zero, e.g. with a [Model.DistanceWeightingFunc] that is zero at their distances, they are weighted equally.
+// Unless [Model.Aggregation] is [AggregationMean], reorders the neighbors by ascending target.
+// Returns the zero [Regression] if there are no neighbors, or if the model has no [Model.Values].
+func (me *Model) Aggregate(k int, distances []int, indices []int) Regression {
+	if k == 0 || me.Values == nil {
+		return Regression{}
+	}
+	distances, indices = distances[:k], indices[:k]
+
+	weight := me.weight
+	mean, total := me.mean(distances, indices, weight)
+	if total == 0 {
+		weight = unitWeight
+		mean, total = me.mean(distances, indices, weight)
+	}
+	var squares float64
+	for i, index := range indices {
+		d := me.Values[index] - mean
+		squares += weight(distances[i]) * d * d
+	}
+	out := Regression{Value: mean, Variance: squares / total, Neighbors: k}
+
+	switch me.Aggregation {
+	case AggregationMedian:
+		me.sortByTarget(distances, indices)
+		out.Value = me.median(distances, indices, weight, total)
+	case AggregationTrimmedMean:
+		me.sortByTarget(distances, indices)
+		trim := 0
+		if f := me.TrimFraction; f > 0 { // negative and NaN fractions trim nothing
+			trim = min(int(min(f, 0.5)*float64(k)), (k-1)/2)
+		}
+		distances, indices = distances[trim:k-trim], indices[trim:k-trim]
+		var trimmedTotal float64
+		if out.Value, trimmedTotal = me.mean(distances, indices, weight); trimmedTotal == 0 {
+			out.Value, _ = me.mean(distances, indices, unitWeight)
+		}
+	}
+	return out
+}
+
+// unitWeight weighs all neighbors equally.
+func unitWeight(int) float64 {
+	return 1
+}
+
+// weight returns the weight of a neighbor at the given distance according to [Model.DistanceWeighting].
+func (me *Model) weight(dist int) float64 {
+	switch me.DistanceWeighting {
+	case DistanceWeightingLinear:
+		return DistanceWeightingFuncLinear(dist)
+	case DistanceWeightingQuadratic:
+		return DistanceWeightingFuncQuadratic(dist)
+	case DistanceWeightingCustom:
+		return me.DistanceWeightingFunc(dist)
+	}
+	return 1
+}
+
+// sortByTarget sorts the given neighbors by ascending target, then by distance and index.
+func (me *Model) sortByTarget(distances []int, indices []int) {
+	heap.SortFunc(distances, indices, func(i, j int) bool {
+		yi, yj := me.Values[indices[i]], me.Values[indices[j]]
+		if yi != yj {
+			return yi < yj
+		}
+		if distances[i] != distances[j] {
+			return distances[i] < distances[j]
+		}
+		return indices[i] < indices[j]
+	})
+}
+
+// median returns the weighted median target of the given neighbors sorted by target, whose total weight is `total`.
+// If the neighbors' weights can be split exactly in half, returns the mean of the targets on either side of the split.
+func (me *Model) median(distances []int, indices []int, weight func(dist int) float64, total float64) float64 {
+	half := total / 2
+	var cumulative float64
+	for i, index := range indices {
+		cumulative += weight(distances[i])
+		if cumulative == half && i+1 < len(indices) {
+			return (me.Values[index] + me.Values[indices[i+1]]) / 2
+		}
+		if cumulative >= half {
+			return me.Values[index]
+		}
+	}
+	return me.Values[indices[len(indices)-1]]
+}
+
+// mean returns the weighted mean target of the given neighbors, and their total weight.
+func (me *Model) mean(distances []int, indices []int, weight func(dist int) float64) (float64, float64) {
+	var sum, total float64
+	for i, index := range indices {
+		w := weight(distances[i])
+		sum += w * me.Values[index]
+		total += w
+	}
+	return sum / total, total
+}
@@ -0,0 +1,242 @@
+package bitknn_test
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"testing"
+
+	"github.com/keilerkonzept/bitknn"
+	"github.com/keilerkonzept/bitknn/internal/testrandom"
+	"pgregory.net/rapid"
+)
+
+func TestAggregation_String(t *testing.T) {
+	as := []bitknn.Aggregation{
+		bitknn.AggregationMean,
+		bitknn.AggregationMedian,
+		bitknn.AggregationTrimmedMean,
+		-1, // invalid
+	}
+	names := []string{"mean", "median", "trimmed-mean", "unknown"}
+	for i, a := range as {
+		if a.String() != names[i] {
+			t.Errorf("%q != %q", a.String(), names[i])
+		}
+	}
+}
+
+func TestModel_Regress(t *testing.T) {
+	data := []uint64{0b0001, 0b0010, 0b0100, 0b1000, 0b1111}
+	values := []float64{1, 2, 3, 10, 100}
+	k := 4
+	x := uint64(0)
+	for _, tc := range []struct {
+		opts     []bitknn.Option
+		expected bitknn.Regression
+	}{
+		{nil, bitknn.Regression{Value: 4, Variance: 12.5, Neighbors: 4}},
+		{[]bitknn.Option{bitknn.WithAggregation(bitknn.AggregationMedian)}, bitknn.Regression{Value: 2.5, Variance: 12.5, Neighbors: 4}},
+		{[]bitknn.Option{bitknn.WithTrimmedMean(0.25)}, bitknn.Regression{Value: 2.5, Variance: 12.5, Neighbors: 4}},
+		{[]bitknn.Option{bitknn.WithTrimmedMean(0.5)}, bitknn.Regression{Value: 2.5, Variance: 12.5, Neighbors: 4}},
+		{[]bitknn.Option{bitknn.WithTrimmedMean(0)}, bitknn.Regression{Value: 4, Variance: 12.5, Neighbors: 4}},
+		// Neighbors whose weights are all zero are weighted equally.
+		{[]bitknn.Option{bitknn.WithDistanceWeightingFunc(zeroWeight)}, bitknn.Regression{Value: 4, Variance: 12.5, Neighbors: 4}},
+		{[]bitknn.Option{bitknn.WithDistanceWeightingFunc(zeroWeight), bitknn.WithAggregation(bitknn.AggregationMedian)}, bitknn.Regression{Value: 2.5, Variance: 12.5, Neighbors: 4}},
+		{[]bitknn.Option{bitknn.WithDistanceWeightingFunc(zeroWeight), bitknn.WithTrimmedMean(0.25)}, bitknn.Regression{Value: 2.5, Variance: 12.5, Neighbors: 4}},
+	} {
+		model := bitknn.Fit(data, nil, append(tc.opts, bitknn.WithValues(values))...)
+		if actual := model.Regress(k, x); actual != tc.expected {
+			t.Errorf("%v: expected %+v, got %+v", model.Aggregation, tc.expected, actual)
+		}
+	}
+
+	model := bitknn.Fit(nil, nil, bitknn.WithValues(nil))
+	if actual := model.Regress(k, x); actual != (bitknn.Regression{}) {
+		t.Errorf("expected zero regression without data, got %+v", actual)
+	}
+	model = bitknn.Fit(data, []int{0, 1, 0, 1, 0})
+	if actual := model.Regress(k, x); actual != (bitknn.Regression{}) {
+		t.Errorf("expected zero regression without values, got %+v", actual)
+	}
+}
+
+// zeroWeight gives all neighbors zero weight.
+func zeroWeight(int) float64 {
+	return 0
+}
+
+// regressOracle computes the regression of the given neighbors' targets from its definition.
+func regressOracle(model *bitknn.Model, distances, indices []int) bitknn.Regression {
+	type neighbor struct {
+		y, w        float64
+		dist, index int
+	}
+	neighbors := make([]neighbor, len(indices))
+	var sum, total float64
+	for i, index := range indices {
+		w := 1.0
+		switch model.DistanceWeighting {
+		case bitknn.DistanceWeightingLinear:
+			w = bitknn.DistanceWeightingFuncLinear(distances[i])
+		case bitknn.DistanceWeightingQuadratic:
+			w = bitknn.DistanceWeightingFuncQuadratic(distances[i])
+		}
+		neighbors[i] = neighbor{model.Values[index], w, distances[i], index}
+		sum += w * model.Values[index]
+		total += w
+	}
+	if len(neighbors) == 0 {
+		return bitknn.Regression{}
+	}
+	mean := sum / total
+	var variance float64
+	for _, n := range neighbors {
+		variance += n.w * (n.y - mean) * (n.y - mean) / total
+	}
+	out := bitknn.Regression{Value: mean, Variance: variance, Neighbors: len(neighbors)}
+
+	slices.SortFunc(neighbors, func(a, b neighbor) int {
+		return cmp.Or(cmp.Compare(a.y, b.y), cmp.Compare(a.dist, b.dist), cmp.Compare(a.index, b.index))
+	})
+	switch model.Aggregation {
+	case bitknn.AggregationMedian:
+		// The smallest target with at least half of the total weight at or below it.
+		below := 0.0
+		for i, n := range neighbors {
+			below += n.w
+			if below >= total/2 {
+				out.Value = n.y
+				if below == total/2 && i+1 < len(neighbors) {
+					out.Value = (n.y + neighbors[i+1].y) / 2
+				}
+				break
+			}
+		}
+	case bitknn.AggregationTrimmedMean:
+		trim := int(model.TrimFraction * float64(len(neighbors)))
+		if 2*trim >= len(neighbors) {
+			trim = (len(neighbors) - 1) / 2
+		}
+		sum, total := 0.0, 0.0
+		for _, n := range neighbors[trim : len(neighbors)-trim] {
+			sum += n.w * n.y
+			total += n.w
+		}
+		out.Value = sum / total
+	}
+	return out
+}
+
+func TestWithTrimmedMean_RejectsNegativeAndNaN(t *testing.T) {
+	for _, fraction := range []float64{-1, -0.1, math.NaN()} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatal("WithTrimmedMean should panic with", fraction)
+				}
+			}()
+			bitknn.WithTrimmedMean(fraction)
+		}()
+	}
+}
+
+func TestModel_Aggregate_TrimFractionOutOfRange(t *testing.T) {
+	data := []uint64{0b0001, 0b0010, 0b0100, 0b1000, 0b1111}
+	values := []float64{1, 2, 3, 10, 100}
+	for _, tc := range []struct {
+		fraction float64
+		expected float64
+	}{
+		{-1, 4},
+		{math.NaN(), 4},
+		{math.Inf(-1), 4},
+		{1, 2.5},
+		{math.Inf(1), 2.5},
+	} {
+		model := bitknn.Fit(data, nil, bitknn.WithValues(values), bitknn.WithAggregation(bitknn.AggregationTrimmedMean))
+		model.TrimFraction = tc.fraction
+		if actual := model.Regress(4, 0); actual.Value != tc.expected {
+			t.Errorf("TrimFraction %v: expected %v, got %v", tc.fraction, tc.expected, actual.Value)
+		}
+	}
+}
+
+func TestModel_Regress_Oracle(t *testing.T) {
+	rapid.Check(t, func(t *rapid.T) {
+		size := rapid.IntRange(0, 100).Draw(t, "size")
+		k := rapid.IntRange(1, 20).Draw(t, "k")
+		data := testrandom.Data(size)
+		values := rapid.SliceOfN(rapid.Float64Range(-100, 100), size, size).Draw(t, "values")
+		x := testrandom.Query()
+		weighting := rapid.SampledFrom([]bitknn.Option{
+			bitknn.WithLinearDistanceWeighting(),
+			bitknn.WithQuadraticDistanceWeighting(),
+			bitknn.WithValues(values), // no weighting
+		}).Draw(t, "weighting")
+		aggregation := rapid.SampledFrom([]bitknn.Option{
+			bitknn.WithAggregation(bitknn.AggregationMean),
+			bitknn.WithAggregation(bitknn.AggregationMedian),
+			bitknn.WithTrimmedMean(rapid.Float64Range(0, 0.6).Draw(t, "trim")),
+		}).Draw(t, "aggregation")
+		model := bitknn.Fit(data, nil, bitknn.WithValues(values), weighting, aggregation)
+
+		distances, indices := model.Find(k, x)
+		expected := regressOracle(model, slices.Clone(distances), slices.Clone(indices))
+		actual := model.Regress(k, x)
+		if actual.Neighbors != expected.Neighbors ||
+			math.Abs(actual.Value-expected.Value) > eps ||
+			math.Abs(actual.Variance-expected.Variance) > eps {
+			t.Fatalf("expected %+v, got %+v", expected, actual)
+		}
+	})
+}
+
+func TestRegress_Wide_Flat_Equiv_Narrow(t *testing.T) {
+	rapid.Check(t, func(t *rapid.T) {
+		size := rapid.IntRange(0, 100).Draw(t, "size")
+		k := rapid.IntRange(1, 20).Draw(t, "k")
+		data := testrandom.Data(size)
+		values := testrandom.Values(size)
+		x := testrandom.Query()
+		tieBreaking := rapid.SampledFrom(tieBreakings).Draw(t, "tieBreaking")
+		aggregation := rapid.SampledFrom([]bitknn.Aggregation{
+			bitknn.AggregationMean,
+			bitknn.AggregationMedian,
+			bitknn.AggregationTrimmedMean,
+		}).Draw(t, "aggregation")
+		opts := []bitknn.Option{
+			bitknn.WithValues(values),
+			bitknn.WithLinearDistanceWeighting(),
+			bitknn.WithTieBreaking(tieBreaking),
+			bitknn.WithAggregation(aggregation),
+		}
+		wideData := make([][]uint64, size)
+		for i, d := range data {
+			wideData[i] = []uint64{d}
+		}
+
+		expected := bitknn.Fit(data, nil, opts...).Regress(k, x)
+		wide := bitknn.FitWide(wideData, nil, opts...).Regress(k, []uint64{x})
+		flat := bitknn.FitFlatWide(data, 1, nil, opts...).Regress(k, []uint64{x})
+		for _, actual := range []bitknn.Regression{wide, flat} {
+			if actual.Neighbors != expected.Neighbors ||
+				math.Abs(actual.Value-expected.Value) > eps ||
+				math.Abs(actual.Variance-expected.Variance) > eps {
+				t.Fatalf("expected %+v, got %+v", expected, actual)
+			}
+		}
+	})
+}
+
+func TestModel_Regress_NoAlloc(t *testing.T) {
+	data := testrandom.Data(1000)
+	values := testrandom.Values(1000)
+	for _, aggregation := range []bitknn.Aggregation{bitknn.AggregationMean, bitknn.AggregationMedian, bitknn.AggregationTrimmedMean} {
+		model := bitknn.Fit(data, nil, bitknn.WithValues(values), bitknn.WithAggregation(aggregation))
+		model.PreallocateHeap(10)
+		if allocs := testing.AllocsPerRun(10, func() { model.Regress(10, 0) }); allocs != 0 {
+			t.Errorf("%v: %v allocations", aggregation, allocs)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package bitknn
+
+import (
+	"sync"
+
+	"github.com/keilerkonzept/bitknn/internal/slice"
+)
+
+// Largest label for which a [Searcher] uses a dense [VoteSlice] vote counter.
+const searcherMaxDenseLabel = 1 << 16
+
+// Default length of the distance batch buffer of a [Searcher] or [WideSearcher].
+const searcherBatchSize = 1024
+
+// NewSearcher returns a [Searcher] for the model, with its own neighbor heap, distance batch buffer and vote counter.
+func (me *Model) NewSearcher() *Searcher {
+	return &Searcher{
+		Model: me,
+		Votes: me.newVoteCounter(),
+	}
+}
+
+// newVoteCounter returns a vote counter for the model's labels:
+// a [VoteSlice] if all labels are small non-negative integers, and a [VoteMap] otherwise.
+func (me *Model) newVoteCounter() VoteCounter {
+	maxLabel := -1
+	for _, label := range me.Labels {
+		if label < 0 || label > searcherMaxDenseLabel {
+			return make(VoteMap)
+		}
+		maxLabel = max(maxLabel, label)
+	}
+	return make(VoteSlice, maxLabel+1)
+}
+
+// A Searcher queries a [Model] using its own buffers instead of [Model.HeapDistances] and [Model.HeapIndices].
+// Any number of Searchers can query the same model concurrently, as long as the model is not modified.
+// A single Searcher must not be used concurrently.
+//
+// If the model searches in parallel (see [Model.Workers]), a Searcher keeps its own worker goroutines and their neighbor heaps
+// between queries, so that it doesn't allocate. This applies to the plain Hamming distance search with the default [Model.TieBreaking].
+// Sequential searches don't allocate either, except with [TieBreakingIncludeAll], where the neighbor slices returned by the Find methods
+// are grown if there are more than k neighbors, as by [Model.FindInto].
+// The goroutines stop on [Searcher.Close], or else once the Searcher is garbage collected.
+type Searcher struct {
+	Model *Model
+
+	// Neighbor heap.
+	Distances []int
+	Indices   []int
+
+	// Distance batch buffer for [Searcher.FindV] and [Searcher.PredictV].
+	Batch []uint32
+
+	// Vote counter used by [Searcher.PredictLabel].
+	Votes VoteCounter
+
+	workers *shardWorkers
+}
+
+func (me *Searcher) PreallocateHeap(k int) {
+	me.Distances = slice.OrAlloc(me.Distances, k+1)
+	me.Indices = slice.OrAlloc(me.Indices, k+1)
+}
+
+// preallocateBatch ensures that the batch buffer has length at least k.
+func (me *Searcher) preallocateBatch(k int) {
+	if len(me.Batch) < k {
+		me.Batch = make([]uint32, max(k, searcherBatchSize))
+	}
+}
+
+// Finds the nearest neighbors of the given point.
+// Returns the distance and index slices, which are only valid until the next call.
+func (me *Searcher) Find(k int, x uint64) ([]int, []int) {
+	me.PreallocateHeap(k)
+	if k, ok := me.Model.nearestOnWorkers(&me.workers, k, x, nil, me.Distances, me.Indices); ok {
+		return me.Model.sort(me.Distances[:k], me.Indices[:k])
+	}
+	return me.Model.FindInto(k, x, me.Distances, me.Indices)
+}
+
+// FindV is [Searcher.Find], but vectorized (on ARM64 with NEON, and on amd64 with AVX2 or AVX-512 instructions).
+func (me *Searcher) FindV(k int, x uint64) ([]int, []int) {
+	me.PreallocateHeap(k)
+	me.preallocateBatch(k)
+	if k, ok := me.Model.nearestOnWorkers(&me.workers, k, x, me.Batch, me.Distances, me.Indices); ok {
+		return me.Model.sort(me.Distances[:k], me.Indices[:k])
+	}
+	return me.Model.FindIntoV(k, x, me.Batch, me.Distances, me.Indices)
+}
+
+// Predicts the label of a single input point.
+// Returns the number of neighbors found.
+func (me *Searcher) Predict(k int, x uint64, votes VoteCounter) int {
+	me.PreallocateHeap(k)
+	if k, ok := me.Model.nearestOnWorkers(&me.workers, k, x, nil, me.Distances, me.Indices); ok {
+		me.Model.Vote(k, me.Distances, me.Indices, votes)
+		return k
+	}
+	return me.Model.predictInto(k, x, me.Distances, me.Indices, votes)
+}
+
+// PredictV is [Searcher.Predict], but vectorized (on ARM64 with NEON, and on amd64 with AVX2 or AVX-512 instructions).
+func (me *Searcher) PredictV(k int, x uint64, votes VoteCounter) int {
+	me.PreallocateHeap(k)
+	me.preallocateBatch(k)
+	if k, ok := me.Model.nearestOnWorkers(&me.workers, k, x, me.Batch, me.Distances, me.Indices); ok {
+		me.Model.Vote(k, me.Distances, me.Indices, votes)
+		return k
+	}
+	return me.Model.predictIntoV(k, x, me.Batch, me.Distances, me.Indices, votes)
+}
+
+// Close stops the searcher's worker goroutines, if any. The searcher can still be used afterwards, starting new ones.
+func (me *Searcher) Close() {
+	me.workers.close()
+	me.workers = nil
+}
+
+// nearestOnWorkers is [NearestParallel], or [NearestParallelV] if `batch` is set, into the given neighbor heap,
+// searching the shards on the given workers, which are replaced if they can't search enough shards.
+// Returns false without searching unless the model's search is a plain parallel Hamming distance search.
+func (me *Model) nearestOnWorkers(workers **shardWorkers, k int, x uint64, batch []uint32, distances, indices []int) (int, bool) {
+	if me.Workers <= 1 || me.TieBreaking != TieBreakingLowestIndex || me.DataMasks != nil || me.BitWeights != nil {
+		return 0, false
+	}
+	shards := parallelShards(len(me.Data), me.Workers)
+	if batch != nil && k > 0 {
+		shards = min(shards, len(batch)/k)
+	}
+	if shards <= 1 || k == 0 {
+		return 0, false
+	}
+	*workers = shardWorkersFor(*workers, shards)
+	q := shardQuery{n: len(me.Data), k: k, shards: shards, data: me.Data, x: x, batch: batch}
+	return (*workers).nearest(q, distances, indices), true
+}
+
+// PredictLabel returns the label with the most votes for a single input point.
+func (me *Searcher) PredictLabel(k int, x uint64) int {
+	me.Predict(k, x, me.Votes)
+	return me.Votes.ArgMax()
+}
+
+// PredictLabelV is [Searcher.PredictLabel], but vectorized (on ARM64 with NEON, and on amd64 with AVX2 or AVX-512 instructions).
+func (me *Searcher) PredictLabelV(k int, x uint64) int {
+	me.PredictV(k, x, me.Votes)
+	return me.Votes.ArgMax()
+}
+
+// A SearcherPool is a [sync.Pool] of [Searcher]s for the same model.
+type SearcherPool struct {
+	pool sync.Pool
+}
+
+// NewSearcherPool returns a pool of [Searcher]s for the given model.
+func NewSearcherPool(model *Model) *SearcherPool {
+	return &SearcherPool{
+		pool: sync.Pool{
+			New: func() any { return model.NewSearcher() },
+		},
+	}
+}
+
+// Get returns a [Searcher] from the pool.
+func (me *SearcherPool) Get() *Searcher {
+	return me.pool.Get().(*Searcher)
+}
+
+// Put returns a [Searcher] to the pool.
+func (me *SearcherPool) Put(s *Searcher) {
+	me.pool.Put(s)
+}
+
+// Predict is [Searcher.Predict], using a [Searcher] from the pool.
+func (me *SearcherPool) Predict(k int, x uint64, votes VoteCounter) int {
+	s := me.Get()
+	defer me.Put(s)
+	return s.Predict(k, x, votes)
+}
+
+// PredictV is [Searcher.PredictV], using a [Searcher] from the pool.
+func (me *SearcherPool) PredictV(k int, x uint64, votes VoteCounter) int {
+	s := me.Get()
+	defer me.Put(s)
+	return s.PredictV(k, x, votes)
+}
+
+// PredictLabel is [Searcher.PredictLabel], using a [Searcher] from the pool.
+func (me *SearcherPool) PredictLabel(k int, x uint64) int {
+	s := me.Get()
+	defer me.Put(s)
+	return s.PredictLabel(k, x)
+}
+
+// PredictLabelV is [Searcher.PredictLabelV], using a [Searcher] from the pool.
+func (me *SearcherPool) PredictLabelV(k int, x uint64) int {
+	s := me.Get()
+	defer me.Put(s)
+	return s.PredictLabelV(k, x)
+}
@@ -0,0 +1,386 @@
+package bitknn_test
+
+import (
+	"maps"
+	"reflect"
+	"runtime"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/keilerkonzept/bitknn"
+	"github.com/keilerkonzept/bitknn/internal/testrandom"
+	"github.com/keilerkonzept/bitknn/pack"
+	"pgregory.net/rapid"
+)
+
+func TestSearcher_Concurrent(t *testing.T) {
+	const (
+		k          = 10
+		goroutines = 8
+	)
+	data := testrandom.Data(2000)
+	labels := testrandom.Labels(len(data))
+	queries := testrandom.Data(100)
+	model := bitknn.Fit(data, labels, bitknn.WithQuadraticDistanceWeighting())
+
+	expectedNeighbors := make([][]neighbor, len(queries))
+	expectedLabels := make([]int, len(queries))
+	for q, x := range queries {
+		distances, indices := model.Find(k, x)
+		expectedNeighbors[q] = sortedNeighbors(distances, indices)
+		votes := make(bitknn.VoteSlice, 256)
+		model.Predict(k, x, votes)
+		expectedLabels[q] = votes.ArgMax()
+	}
+
+	pool := bitknn.NewSearcherPool(model)
+	var wg sync.WaitGroup
+	for range goroutines {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			searcher := model.NewSearcher()
+			votes := make(bitknn.VoteSlice, 256)
+			for q, x := range queries {
+				distances, indices := searcher.Find(k, x)
+				if !reflect.DeepEqual(expectedNeighbors[q], sortedNeighbors(distances, indices)) {
+					t.Errorf("query %d: expected neighbors %v, got %v", q, expectedNeighbors[q], sortedNeighbors(distances, indices))
+				}
+				distances, indices = searcher.FindV(k, x)
+				if !reflect.DeepEqual(expectedNeighbors[q], sortedNeighbors(distances, indices)) {
+					t.Errorf("query %d: expected neighbors %v, got %v", q, expectedNeighbors[q], sortedNeighbors(distances, indices))
+				}
+				for _, label := range []int{
+					searcher.PredictLabel(k, x),
+					searcher.PredictLabelV(k, x),
+					pool.PredictLabel(k, x),
+					pool.PredictLabelV(k, x),
+				} {
+					if label != expectedLabels[q] {
+						t.Errorf("query %d: expected label %d, got %d", q, expectedLabels[q], label)
+					}
+				}
+				for _, n := range []int{
+					pool.Predict(k, x, votes),
+					pool.PredictV(k, x, votes),
+				} {
+					if n != k || votes.ArgMax() != expectedLabels[q] {
+						t.Errorf("query %d: expected label %d, got %d", q, expectedLabels[q], votes.ArgMax())
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestWideSearcher_Concurrent(t *testing.T) {
+	const (
+		k          = 10
+		dims       = 3
+		goroutines = 8
+	)
+	data := testrandom.WideData(dims, 2000)
+	labels := testrandom.Labels(len(data))
+	queries := testrandom.WideData(dims, 100)
+	model := bitknn.FitWide(data, labels, bitknn.WithLinearDistanceWeighting())
+
+	expectedNeighbors := make([][]neighbor, len(queries))
+	expectedLabels := make([]int, len(queries))
+	for q, x := range queries {
+		distances, indices := model.Find(k, x)
+		expectedNeighbors[q] = sortedNeighbors(distances, indices)
+		votes := make(bitknn.VoteSlice, 256)
+		model.Predict(k, x, votes)
+		expectedLabels[q] = votes.ArgMax()
+	}
+
+	pool := bitknn.NewWideSearcherPool(model)
+	var wg sync.WaitGroup
+	for range goroutines {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			searcher := model.NewSearcher()
+			votes := make(bitknn.VoteSlice, 256)
+			for q, x := range queries {
+				distances, indices := searcher.Find(k, x)
+				if !reflect.DeepEqual(expectedNeighbors[q], sortedNeighbors(distances, indices)) {
+					t.Errorf("query %d: expected neighbors %v, got %v", q, expectedNeighbors[q], sortedNeighbors(distances, indices))
+				}
+				distances, indices = searcher.FindV(k, x)
+				if !reflect.DeepEqual(expectedNeighbors[q], sortedNeighbors(distances, indices)) {
+					t.Errorf("query %d: expected neighbors %v, got %v", q, expectedNeighbors[q], sortedNeighbors(distances, indices))
+				}
+				for _, label := range []int{
+					searcher.PredictLabel(k, x),
+					searcher.PredictLabelV(k, x),
+					pool.PredictLabel(k, x),
+					pool.PredictLabelV(k, x),
+				} {
+					if label != expectedLabels[q] {
+						t.Errorf("query %d: expected label %d, got %d", q, expectedLabels[q], label)
+					}
+				}
+				for _, n := range []int{
+					pool.Predict(k, x, votes),
+					pool.PredictV(k, x, votes),
+				} {
+					if n != k || votes.ArgMax() != expectedLabels[q] {
+						t.Errorf("query %d: expected label %d, got %d", q, expectedLabels[q], votes.ArgMax())
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestSearcher_VoteCounter(t *testing.T) {
+	data := []uint64{0b0000, 0b1111, 0b0011}
+	{
+		searcher := bitknn.Fit(data, []int{0, 2, 1}).NewSearcher()
+		if votes, ok := searcher.Votes.(bitknn.VoteSlice); !ok || len(votes) != 3 {
+			t.Errorf("Expected a VoteSlice of length 3, got %#v", searcher.Votes)
+		}
+		if label := searcher.PredictLabel(1, 0b0011); label != 1 {
+			t.Errorf("Expected label 1, got %d", label)
+		}
+	}
+	for _, labels := range [][]int{{0, -1, 1}, {0, 1 << 20, 1}} {
+		searcher := bitknn.Fit(data, labels).NewSearcher()
+		if _, ok := searcher.Votes.(bitknn.VoteMap); !ok {
+			t.Errorf("Expected a VoteMap, got %#v", searcher.Votes)
+		}
+		if label := searcher.PredictLabel(1, 0b1110); label != labels[1] {
+			t.Errorf("Expected label %d, got %d", labels[1], label)
+		}
+	}
+}
+
+func TestSearcher_ZeroAllocations(t *testing.T) {
+	const k = 10
+	data := testrandom.Data(1000)
+	labels := testrandom.Labels(len(data))
+	wideData := testrandom.WideData(2, 1000)
+	model := bitknn.Fit(data, labels)
+	wideModel := bitknn.FitWide(wideData, labels)
+	x, wx := testrandom.Query(), testrandom.WideQuery(2)
+
+	searcher := model.NewSearcher()
+	wideSearcher := wideModel.NewSearcher()
+	pool := bitknn.NewSearcherPool(model)
+	widePool := bitknn.NewWideSearcherPool(wideModel)
+	checks := map[string]func(){
+		"Searcher.Find":            func() { searcher.Find(k, x) },
+		"Searcher.PredictLabel":    func() { searcher.PredictLabel(k, x) },
+		"WideSearcher.Find":        func() { wideSearcher.Find(k, wx) },
+		"WideSearcher.FindV":       func() { wideSearcher.FindV(k, wx) },
+		"WideSearcher.PredictV":    func() { wideSearcher.PredictLabelV(k, wx) },
+		"SearcherPool.Predict":     func() { pool.PredictLabel(k, x) },
+		"WideSearcherPool.Predict": func() { widePool.PredictLabelV(k, wx) },
+	}
+	for _, name := range slices.Sorted(maps.Keys(checks)) {
+		if raceEnabled && slices.Contains([]string{"SearcherPool.Predict", "WideSearcherPool.Predict"}, name) {
+			continue // sync.Pool drops items at random with the race detector enabled
+		}
+		check := checks[name]
+		check()
+		if allocs := testing.AllocsPerRun(100, check); allocs != 0 {
+			t.Errorf("%s: expected no allocations, got %v", name, allocs)
+		}
+	}
+}
+
+func TestSearcher_Parallel(t *testing.T) {
+	rapid.Check(t, func(t *rapid.T) {
+		k := rapid.IntRange(0, 50).Draw(t, "k")
+		dims := rapid.IntRange(1, 3).Draw(t, "dims")
+		n := rapid.SampledFrom([]int{100, 2048, 5000}).Draw(t, "n")
+		workers := rapid.IntRange(2, 8).Draw(t, "workers")
+		data := testrandom.WideData(dims, n)
+		narrowData := make([]uint64, n)
+		for i, d := range data {
+			narrowData[i] = d[0]
+		}
+		labels := testrandom.Labels(n)
+		opts := []bitknn.Option{bitknn.WithWorkers(workers)}
+		if rapid.Bool().Draw(t, "earlyAbandon") {
+			opts = append(opts, bitknn.WithEarlyAbandon())
+		}
+		model := bitknn.Fit(narrowData, labels)
+		wideModel := bitknn.FitWide(data, labels)
+		searcher := bitknn.Fit(narrowData, labels, opts...).NewSearcher()
+		wideSearcher := bitknn.FitWide(data, labels, opts...).NewSearcher()
+
+		// The searchers' workers are reused for several queries.
+		for range 3 {
+			x := testrandom.WideQuery(dims)
+			expected := sortedNeighbors(model.Find(k, x[0]))
+			if actual := sortedNeighbors(searcher.Find(k, x[0])); !reflect.DeepEqual(expected, actual) {
+				t.Fatal("Searcher.Find", expected, actual)
+			}
+			if actual := sortedNeighbors(searcher.FindV(k, x[0])); !reflect.DeepEqual(expected, actual) {
+				t.Fatal("Searcher.FindV", expected, actual)
+			}
+			expectedVotes, actualVotes := make(bitknn.VoteMap), make(bitknn.VoteMap)
+			model.Predict(k, x[0], expectedVotes)
+			searcher.Predict(k, x[0], actualVotes)
+			if !reflect.DeepEqual(expectedVotes, actualVotes) {
+				t.Fatal("Searcher.Predict", expectedVotes, actualVotes)
+			}
+
+			expected = sortedNeighbors(wideModel.Find(k, x))
+			if actual := sortedNeighbors(wideSearcher.Find(k, x)); !reflect.DeepEqual(expected, actual) {
+				t.Fatal("WideSearcher.Find", expected, actual)
+			}
+			if actual := sortedNeighbors(wideSearcher.FindV(k, x)); !reflect.DeepEqual(expected, actual) {
+				t.Fatal("WideSearcher.FindV", expected, actual)
+			}
+			expectedVotes, actualVotes = make(bitknn.VoteMap), make(bitknn.VoteMap)
+			wideModel.Predict(k, x, expectedVotes)
+			wideSearcher.PredictV(k, x, actualVotes)
+			if !reflect.DeepEqual(expectedVotes, actualVotes) {
+				t.Fatal("WideSearcher.PredictV", expectedVotes, actualVotes)
+			}
+		}
+	})
+}
+
+func TestSearcher_Parallel_ZeroAllocations(t *testing.T) {
+	const k = 10
+	data := testrandom.Data(10_000)
+	labels := testrandom.Labels(len(data))
+	wideData := testrandom.WideData(2, len(data))
+	model := bitknn.Fit(data, labels, bitknn.WithWorkers(4))
+	wideModel := bitknn.FitWide(wideData, labels, bitknn.WithWorkers(4))
+	flatModel := bitknn.FitFlatWide(pack.Flatten(wideData), 2, labels, bitknn.WithWorkers(4))
+	x, wx := testrandom.Query(), testrandom.WideQuery(2)
+
+	searcher := model.NewSearcher()
+	wideSearcher := wideModel.NewSearcher()
+	votes, batch := searcher.Votes, make([]uint32, 1024)
+	checks := map[string]func(){
+		"Searcher.Find":             func() { searcher.Find(k, x) },
+		"Searcher.PredictLabel":     func() { searcher.PredictLabel(k, x) },
+		"Searcher.FindV":            func() { searcher.FindV(k, x) },
+		"Searcher.PredictLabelV":    func() { searcher.PredictLabelV(k, x) },
+		"WideSearcher.Find":         func() { wideSearcher.Find(k, wx) },
+		"WideSearcher.PredictV":     func() { wideSearcher.PredictLabelV(k, wx) },
+		"WideSearcher.FindV":        func() { wideSearcher.FindV(k, wx) },
+		"WideSearcher.PredictLabel": func() { wideSearcher.PredictLabel(k, wx) },
+		"Model.Find":                func() { model.Find(k, x) },
+		"Model.Predict":             func() { model.Predict(k, x, votes) },
+		"WideModel.Find":            func() { wideModel.Find(k, wx) },
+		"WideModel.FindV":           func() { wideModel.FindV(k, wx, batch) },
+		"FlatWideModel.Find":        func() { flatModel.Find(k, wx) },
+		"FlatWideModel.FindV":       func() { flatModel.FindV(k, wx, batch) },
+		"FlatWideModel.Predict":     func() { flatModel.Predict(k, wx, votes) },
+	}
+	for _, name := range slices.Sorted(maps.Keys(checks)) {
+		check := checks[name]
+		check()
+		if allocs := testing.AllocsPerRun(100, check); allocs != 0 {
+			t.Errorf("%s: expected no allocations, got %v", name, allocs)
+		}
+	}
+}
+
+func TestSearcher_Parallel_StopsWorkers(t *testing.T) {
+	model := bitknn.Fit(testrandom.Data(10_000), nil, bitknn.WithWorkers(8))
+	before := runtime.NumGoroutine()
+	searcher := model.NewSearcher()
+	searcher.Find(10, testrandom.Query())
+	if runtime.NumGoroutine() <= before {
+		t.Fatal("the searcher should keep its worker goroutines", runtime.NumGoroutine(), before)
+	}
+	searcher = nil
+	for range 100 {
+		runtime.GC()
+		if runtime.NumGoroutine() <= before {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("the worker goroutines should stop once the searcher is garbage collected", runtime.NumGoroutine(), before)
+}
+
+func TestModel_Parallel_Close(t *testing.T) {
+	model := bitknn.Fit(testrandom.Data(10_000), nil, bitknn.WithWorkers(8))
+	searcher := model.NewSearcher()
+	before := runtime.NumGoroutine()
+	expected := sortedNeighbors(model.Find(10, 0))
+	searcher.Find(10, 0)
+	if runtime.NumGoroutine() <= before {
+		t.Fatal("the model and searcher should keep their worker goroutines", runtime.NumGoroutine(), before)
+	}
+	model.Close()
+	searcher.Close()
+	searcher.Close()
+	for range 100 {
+		if runtime.NumGoroutine() <= before {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if runtime.NumGoroutine() > before {
+		t.Fatal("the worker goroutines should stop once closed", runtime.NumGoroutine(), before)
+	}
+	// Closed models and searchers start new workers.
+	if actual := sortedNeighbors(model.Find(10, 0)); !reflect.DeepEqual(expected, actual) {
+		t.Fatal(expected, actual)
+	}
+	if actual := sortedNeighbors(searcher.Find(10, 0)); !reflect.DeepEqual(expected, actual) {
+		t.Fatal(expected, actual)
+	}
+	model.Close()
+	searcher.Close()
+}
+
+// settledGoroutines returns the number of goroutines once the workers of models and searchers from earlier tests
+// that were garbage collected have stopped.
+func settledGoroutines() int {
+	n := runtime.NumGoroutine()
+	for range 100 {
+		runtime.GC()
+		time.Sleep(10 * time.Millisecond)
+		if m := runtime.NumGoroutine(); m >= n {
+			return m
+		}
+		n = runtime.NumGoroutine()
+	}
+	return n
+}
+
+func TestFlatWideModel_Parallel_Close(t *testing.T) {
+	data := testrandom.WideData(2, 10_000)
+	x := testrandom.WideQuery(2)
+	wide := bitknn.FitWide(data, nil)
+	model := bitknn.FitFlatWide(pack.Flatten(data), 2, nil, bitknn.WithWorkers(8))
+	expected := sortedNeighbors(wide.Find(10, x))
+	before := settledGoroutines()
+	if actual := sortedNeighbors(model.Find(10, x)); !reflect.DeepEqual(expected, actual) {
+		t.Fatal(expected, actual)
+	}
+	if runtime.NumGoroutine() <= before {
+		t.Fatal("the model should keep its worker goroutines", runtime.NumGoroutine(), before)
+	}
+	model.Close()
+	model.Close()
+	for range 100 {
+		if runtime.NumGoroutine() <= before {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if runtime.NumGoroutine() > before {
+		t.Fatal("the worker goroutines should stop once closed", runtime.NumGoroutine(), before)
+	}
+	// Closed models start new workers.
+	if actual := sortedNeighbors(model.Find(10, x)); !reflect.DeepEqual(expected, actual) {
+		t.Fatal(expected, actual)
+	}
+	model.Close()
+}
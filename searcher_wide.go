@@ -0,0 +1,177 @@
+package bitknn
+
+import (
+	"sync"
+
+	"github.com/keilerkonzept/bitknn/internal/slice"
+)
+
+// NewSearcher returns a [WideSearcher] for the model, with its own neighbor heap, distance batch buffer and vote counter.
+func (me *WideModel) NewSearcher() *WideSearcher {
+	return &WideSearcher{
+		Model: me,
+		Votes: me.Narrow.newVoteCounter(),
+	}
+}
+
+// A WideSearcher queries a [WideModel] using its own buffers. See [Searcher], also for when it allocates.
+// The worker goroutines stop on [WideSearcher.Close], or else once the WideSearcher is garbage collected.
+type WideSearcher struct {
+	Model *WideModel
+
+	// Neighbor heap.
+	Distances []int
+	Indices   []int
+
+	// Distance batch buffer for [WideSearcher.FindV] and [WideSearcher.PredictV].
+	Batch []uint32
+
+	// Vote counter used by [WideSearcher.PredictLabel].
+	Votes VoteCounter
+
+	workers *shardWorkers
+}
+
+func (me *WideSearcher) PreallocateHeap(k int) {
+	me.Distances = slice.OrAlloc(me.Distances, k+1)
+	me.Indices = slice.OrAlloc(me.Indices, k+1)
+}
+
+// preallocateBatch ensures that the batch buffer has length at least k.
+func (me *WideSearcher) preallocateBatch(k int) {
+	if len(me.Batch) < k {
+		me.Batch = make([]uint32, max(k, searcherBatchSize))
+	}
+}
+
+// Finds the nearest neighbors of the given point.
+// Returns the distance and index slices, which are only valid until the next call.
+func (me *WideSearcher) Find(k int, x []uint64) ([]int, []int) {
+	me.PreallocateHeap(k)
+	if k, ok := me.Model.nearestOnWorkers(&me.workers, k, x, nil, me.Distances, me.Indices); ok {
+		return me.Model.Narrow.sort(me.Distances[:k], me.Indices[:k])
+	}
+	return me.Model.FindInto(k, x, me.Distances, me.Indices)
+}
+
+// FindV is [WideSearcher.Find], but vectorized (on ARM64 with NEON, and on amd64 with AVX2 or AVX-512 instructions).
+func (me *WideSearcher) FindV(k int, x []uint64) ([]int, []int) {
+	me.PreallocateHeap(k)
+	me.preallocateBatch(k)
+	if k, ok := me.Model.nearestOnWorkers(&me.workers, k, x, me.Batch, me.Distances, me.Indices); ok {
+		return me.Model.Narrow.sort(me.Distances[:k], me.Indices[:k])
+	}
+	return me.Model.FindIntoV(k, x, me.Batch, me.Distances, me.Indices)
+}
+
+// Predicts the label of a single input point.
+// Returns the number of neighbors found.
+func (me *WideSearcher) Predict(k int, x []uint64, votes VoteCounter) int {
+	me.PreallocateHeap(k)
+	if k, ok := me.Model.nearestOnWorkers(&me.workers, k, x, nil, me.Distances, me.Indices); ok {
+		me.Model.Narrow.Vote(k, me.Distances, me.Indices, votes)
+		return k
+	}
+	return me.Model.PredictInto(k, x, me.Distances, me.Indices, votes)
+}
+
+// PredictV is [WideSearcher.Predict], but vectorized (on ARM64 with NEON, and on amd64 with AVX2 or AVX-512 instructions).
+func (me *WideSearcher) PredictV(k int, x []uint64, votes VoteCounter) int {
+	me.PreallocateHeap(k)
+	me.preallocateBatch(k)
+	if k, ok := me.Model.nearestOnWorkers(&me.workers, k, x, me.Batch, me.Distances, me.Indices); ok {
+		me.Model.Narrow.Vote(k, me.Distances, me.Indices, votes)
+		return k
+	}
+	return me.Model.PredictIntoV(k, x, me.Batch, me.Distances, me.Indices, votes)
+}
+
+// Close stops the searcher's worker goroutines, if any. The searcher can still be used afterwards, starting new ones.
+func (me *WideSearcher) Close() {
+	me.workers.close()
+	me.workers = nil
+}
+
+// nearestOnWorkers is [NearestWideParallel] (or its early-abandoning variant), or [NearestWideParallelV] if `batch` is set,
+// into the given neighbor heap, searching the shards on the given workers, which are replaced if they can't search enough shards.
+// Returns false without searching unless the model's search is a plain parallel Hamming distance search.
+func (me *WideModel) nearestOnWorkers(workers **shardWorkers, k int, x []uint64, batch []uint32, distances, indices []int) (int, bool) {
+	m, data := me.Narrow, me.WideData
+	if m.Workers <= 1 || m.TieBreaking != TieBreakingLowestIndex || m.WideDataMasks != nil || m.BitWeights != nil {
+		return 0, false
+	}
+	shards := parallelShards(len(data), m.Workers)
+	if batch != nil && k > 0 {
+		shards = min(shards, len(batch)/k)
+	}
+	if shards <= 1 || k == 0 {
+		return 0, false
+	}
+	*workers = shardWorkersFor(*workers, shards)
+	q := shardQuery{n: len(data), k: k, shards: shards, wideData: data, wideX: x, earlyAbandon: m.EarlyAbandon, batch: batch}
+	return (*workers).nearest(q, distances, indices), true
+}
+
+// PredictLabel returns the label with the most votes for a single input point.
+func (me *WideSearcher) PredictLabel(k int, x []uint64) int {
+	me.Predict(k, x, me.Votes)
+	return me.Votes.ArgMax()
+}
+
+// PredictLabelV is [WideSearcher.PredictLabel], but vectorized (on ARM64 with NEON, and on amd64 with AVX2 or AVX-512 instructions).
+func (me *WideSearcher) PredictLabelV(k int, x []uint64) int {
+	me.PredictV(k, x, me.Votes)
+	return me.Votes.ArgMax()
+}
+
+// A WideSearcherPool is a [sync.Pool] of [WideSearcher]s for the same model.
+type WideSearcherPool struct {
+	pool sync.Pool
+}
+
+// NewWideSearcherPool returns a pool of [WideSearcher]s for the given model.
+func NewWideSearcherPool(model *WideModel) *WideSearcherPool {
+	return &WideSearcherPool{
+		pool: sync.Pool{
+			New: func() any { return model.NewSearcher() },
+		},
+	}
+}
+
+// Get returns a [WideSearcher] from the pool.
+func (me *WideSearcherPool) Get() *WideSearcher {
+	return me.pool.Get().(*WideSearcher)
+}
+
+// Put returns a [WideSearcher] to the pool.
+func (me *WideSearcherPool) Put(s *WideSearcher) {
+	me.pool.Put(s)
+}
+
+// Predict is [WideSearcher.Predict], using a [WideSearcher] from the pool.
+func (me *WideSearcherPool) Predict(k int, x []uint64, votes VoteCounter) int {
+	s := me.Get()
+	defer me.Put(s)
+	return s.Predict(k, x, votes)
+}
+
+// PredictV is [WideSearcher.PredictV], using a [WideSearcher] from the pool.
+func (me *WideSearcherPool) PredictV(k int, x []uint64, votes VoteCounter) int {
+	s := me.Get()
+	defer me.Put(s)
+	return s.PredictV(k, x, votes)
+}
+
+// PredictLabel is [WideSearcher.PredictLabel], using a [WideSearcher] from the pool.
+func (me *WideSearcherPool) PredictLabel(k int, x []uint64) int {
+	s := me.Get()
+	defer me.Put(s)
+	return s.PredictLabel(k, x)
+}
+
+// PredictLabelV is [WideSearcher.PredictLabelV], using a [WideSearcher] from the pool.
+func (me *WideSearcherPool) PredictLabelV(k int, x []uint64) int {
+	s := me.Get()
+	defer me.Put(s)
+	return s.PredictLabelV(k, x)
+}
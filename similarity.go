@@ -0,0 +1,276 @@
+package bitknn
+
+import (
+	"math"
+	"math/bits"
+
+	"github.com/keilerkonzept/bitknn/internal/heap"
+)
+
+// Similarity is one of the built-in similarity coefficients of two binary data points, between 0 (nothing in common) and 1 (equal).
+// Each is a [Metric], with the counts `a` (bits set in both points), `b` and `c` (bits set in only one of them),
+// and `d` (bits set in neither) of their [Contingency] table, and `n = a + b + c + d` bits in total.
+type Similarity int
+
+const (
+	// The Tanimoto (Jaccard) coefficient `a / (a + b + c)`, i.e. `popcount(x & y) / popcount(x | y)`. The default.
+	SimilarityTanimoto Similarity = iota
+	// The Dice (Sørensen) coefficient `2a / (2a + b + c)`, i.e. `2 * popcount(x & y) / (popcount(x) + popcount(y))`.
+	SimilarityDice
+	// The Russell–Rao coefficient `a / n`, the fraction of bits set in both points.
+	SimilarityRussellRao
+	// The Sokal–Michener (simple matching) coefficient `(a + d) / n`, the fraction of equal bits.
+	SimilaritySokalMichener
+	// The Rogers–Tanimoto coefficient `(a + d) / (a + d + 2(b + c))`, which counts the unequal bits twice.
+	SimilarityRogersTanimoto
+	// The (second) Kulczynski coefficient `(a / (a + b) + a / (a + c)) / 2`, the mean fraction of each point's bits set in the other.
+	SimilarityKulczynski
+	// The cosine (Ochiai) coefficient `a / sqrt((a + b) * (a + c))`.
+	SimilarityCosine
+)
+
+// builtinSimilarities are the built-in similarity coefficients, registered as metrics under their names.
+var builtinSimilarities = []Similarity{
+	SimilarityTanimoto,
+	SimilarityDice,
+	SimilarityRussellRao,
+	SimilaritySokalMichener,
+	SimilarityRogersTanimoto,
+	SimilarityKulczynski,
+	SimilarityCosine,
+}
+
+func (me Similarity) String() string {
+	switch me {
+	case SimilarityTanimoto:
+		return "tanimoto"
+	case SimilarityDice:
+		return "dice"
+	case SimilarityRussellRao:
+		return "russell-rao"
+	case SimilaritySokalMichener:
+		return "sokal-michener"
+	case SimilarityRogersTanimoto:
+		return "rogers-tanimoto"
+	case SimilarityKulczynski:
+		return "kulczynski"
+	case SimilarityCosine:
+		return "cosine"
+	}
+	return "unknown"
+}
+
+// Coefficient returns the similarity of two data points with the given contingency counts.
+// Where the coefficient divides zero by zero, i.e. for empty data points (or points without bits, for the ones divided by `n`), it is 1.
+// Where only one of the points is empty, the Kulczynski and cosine coefficients are 0.
+func (me Similarity) Coefficient(c Contingency) float64 {
+	switch me {
+	case SimilarityDice:
+		return ratio(2*c.And, c.OnesA+c.OnesB)
+	case SimilarityRussellRao:
+		return ratio(c.And, c.Bits)
+	case SimilaritySokalMichener:
+		return ratio(c.Bits-c.Mismatches(), c.Bits)
+	case SimilarityRogersTanimoto:
+		return ratio(c.Bits-c.Mismatches(), c.Bits+c.Mismatches())
+	case SimilarityKulczynski:
+		if c.OnesA == 0 || c.OnesB == 0 {
+			return ratio(0, c.Or)
+		}
+		return (float64(c.And)/float64(c.OnesA) + float64(c.And)/float64(c.OnesB)) / 2
+	case SimilarityCosine:
+		if c.OnesA == 0 || c.OnesB == 0 {
+			return ratio(0, c.Or)
+		}
+		return float64(c.And) / math.Sqrt(float64(c.OnesA)*float64(c.OnesB))
+	default:
+		return ratio(c.And, c.Or)
+	}
+}
+
+// ratio returns `n / d`, or 1 if both are zero.
+func ratio(n, d int) float64 {
+	if d == 0 {
+		return 1
+	}
+	return float64(n) / float64(d)
+}
+
+// OnesCounts returns the number of bits set in each data point, for the similarity search functions like [NearestSimilar].
+func OnesCounts(data []uint64) []int {
+	out := make([]int, len(data))
+	for i, d := range data {
+		out[i] = bits.OnesCount64(d)
+	}
+	return out
+}
+
+// WideOnesCounts returns the number of bits set in each wide data point, for the similarity search functions like [NearestWideSimilar].
+func WideOnesCounts(data [][]uint64) []int {
+	out := make([]int, len(data))
+	for i, d := range data {
+		out[i] = onesCount(d)
+	}
+	return out
+}
+
+// NearestSimilar finds the `k` data points most similar to `x` by the given similarity coefficient, such as a [Similarity],
+// where `onesCounts` are the numbers of bits set in the data points (see [OnesCounts]), or empty to count them during the search.
+// Writes their similarities and indices into the slices, which must have length at least `k+1`,
+// and returns the number of neighbors found. Ties are broken by lowest index.
+//
+// Data points whose number of bits set bounds their similarity below that of the current k-th most similar neighbor
+// are skipped without comparing their bits (see [Metric]).
+func NearestSimilar(data []uint64, onesCounts []int, metric Metric, k int, x uint64, similarities []float64, indices []int) int {
+	k = nearestSimilar(data, onesCounts, metric, k, x, similarities, indices)
+	negate(similarities[:k])
+	return k
+}
+
+// NearestWideSimilar is [NearestSimilar] for wide data points, where `onesCounts` are as given by [WideOnesCounts].
+func NearestWideSimilar(data [][]uint64, onesCounts []int, metric Metric, k int, x []uint64, similarities []float64, indices []int) int {
+	k = nearestWideSimilar(data, onesCounts, metric, k, x, similarities, indices)
+	negate(similarities[:k])
+	return k
+}
+
+// [NearestParallel], but by similarity (see [NearestSimilar]).
+func NearestSimilarParallel(data []uint64, onesCounts []int, metric Metric, k int, x uint64, workers int, similarities []float64, indices []int) int {
+	k = nearestParallel(len(data), k, workers, similarities, indices, func(_, _, lo, hi int, similarities []float64, indices []int) int {
+		return nearestSimilar(data[lo:hi], shardCounts(onesCounts, lo, hi), metric, k, x, similarities, indices)
+	})
+	negate(similarities[:k])
+	return k
+}
+
+// [NearestWideParallel], but by similarity (see [NearestWideSimilar]).
+func NearestWideSimilarParallel(data [][]uint64, onesCounts []int, metric Metric, k int, x []uint64, workers int, similarities []float64, indices []int) int {
+	k = nearestParallel(len(data), k, workers, similarities, indices, func(_, _, lo, hi int, similarities []float64, indices []int) int {
+		return nearestWideSimilar(data[lo:hi], shardCounts(onesCounts, lo, hi), metric, k, x, similarities, indices)
+	})
+	negate(similarities[:k])
+	return k
+}
+
+// nearestSimilar is [NearestSimilar], but writes the negated similarities, as distances for the max-heap.
+func nearestSimilar(data []uint64, onesCounts []int, metric Metric, k int, x uint64, distances []float64, indices []int) int {
+	heap := heap.MakeMax(distances, indices)
+	distance0 := &distances[0]
+	nx := bits.OnesCount64(x)
+
+	// Negated similarity bounds by the number of bits set in a data point.
+	var bounds [65]float64
+	for n := range bounds {
+		bounds[n] = -metricBound(metric, nx, n, 64)
+	}
+
+	k0 := min(k, len(data))
+	for i, d := range data[:k0] {
+		dist := -metric.Coefficient(newContingency(bits.OnesCount64(x&d), nx, onesCountAt(onesCounts, i, d), 64))
+		heap.Push(dist, i)
+	}
+
+	if len(data) <= k {
+		return k0
+	}
+
+	maxDist := *distance0
+	_ = data[k]
+	for i := k; i < len(data); i++ {
+		n := onesCountAt(onesCounts, i, data[i])
+		if bounds[n] >= maxDist {
+			continue
+		}
+		dist := -metric.Coefficient(newContingency(bits.OnesCount64(x&data[i]), nx, n, 64))
+		if dist >= maxDist {
+			continue
+		}
+		heap.PushPop(dist, i)
+		maxDist = *distance0
+	}
+	return k
+}
+
+// nearestWideSimilar is [NearestWideSimilar], but writes the negated similarities, as distances for the max-heap.
+func nearestWideSimilar(data [][]uint64, onesCounts []int, metric Metric, k int, x []uint64, distances []float64, indices []int) int {
+	heap := heap.MakeMax(distances, indices)
+	distance0 := &distances[0]
+	nx, width := onesCount(x), 64*len(x)
+
+	k0 := min(k, len(data))
+	for i, d := range data[:k0] {
+		dist := -metric.Coefficient(newContingency(andOnesCount(x, d), nx, wideOnesCountAt(onesCounts, i, d), width))
+		heap.Push(dist, i)
+	}
+
+	if len(data) <= k {
+		return k0
+	}
+
+	maxDist := *distance0
+	_ = data[k]
+	for i := k; i < len(data); i++ {
+		n := wideOnesCountAt(onesCounts, i, data[i])
+		if -metricBound(metric, nx, n, width) >= maxDist {
+			continue
+		}
+		dist := -metric.Coefficient(newContingency(andOnesCount(x, data[i]), nx, n, width))
+		if dist >= maxDist {
+			continue
+		}
+		heap.PushPop(dist, i)
+		maxDist = *distance0
+	}
+	return k
+}
+
+// similarity returns the similarity by `metric` of `x`, which has `nx` bits set, and the data point `d`, as compared by [NearestSimilar].
+func similarity(metric Metric, x uint64, nx int, d uint64) float64 {
+	return metric.Coefficient(newContingency(bits.OnesCount64(x&d), nx, bits.OnesCount64(d), 64))
+}
+
+// wideSimilarity is [similarity] for wide data points, as compared by [NearestWideSimilar].
+func wideSimilarity(metric Metric, x []uint64, nx int, d []uint64) float64 {
+	return metric.Coefficient(newContingency(andOnesCount(x, d), nx, onesCount(d), 64*len(x)))
+}
+
+// onesCountAt returns the number of bits set in the i-th data point `d`, from `onesCounts` if they are counted.
+func onesCountAt(onesCounts []int, i int, d uint64) int {
+	if len(onesCounts) == 0 {
+		return bits.OnesCount64(d)
+	}
+	return onesCounts[i]
+}
+
+// wideOnesCountAt is [onesCountAt] for wide data points.
+func wideOnesCountAt(onesCounts []int, i int, d []uint64) int {
+	if len(onesCounts) == 0 {
+		return onesCount(d)
+	}
+	return onesCounts[i]
+}
+
+// shardCounts returns the numbers of bits set in the data points from `lo` to `hi`, or nil if they aren't counted.
+func shardCounts(onesCounts []int, lo, hi int) []int {
+	if len(onesCounts) == 0 {
+		return nil
+	}
+	return onesCounts[lo:hi]
+}
+
+// andOnesCount returns the number of bits set in both `x` and `d`.
+func andOnesCount(x, d []uint64) int {
+	n := 0
+	d = d[:len(x)]
+	for j, w := range x {
+		n += bits.OnesCount64(w & d[j])
+	}
+	return n
+}
+
+// negate negates the given values in place.
+func negate(values []float64) {
+	for i := range values {
+		values[i] = -values[i]
+	}
+}
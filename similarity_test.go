@@ -0,0 +1,400 @@
+package bitknn_test
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"math/bits"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/keilerkonzept/bitknn"
+	"github.com/keilerkonzept/bitknn/internal/testrandom"
+	"pgregory.net/rapid"
+)
+
+var similarities = []bitknn.Similarity{
+	bitknn.SimilarityTanimoto,
+	bitknn.SimilarityDice,
+	bitknn.SimilarityRussellRao,
+	bitknn.SimilaritySokalMichener,
+	bitknn.SimilarityRogersTanimoto,
+	bitknn.SimilarityKulczynski,
+	bitknn.SimilarityCosine,
+}
+
+// similarityOracle returns the similarity of `x` and `d` from the numbers of bits set in both (a), only in `x` (b), only in `d` (c), and in neither of them.
+func similarityOracle(similarity bitknn.Similarity, x, d []uint64) float64 {
+	a, b, c, neither := 0, 0, 0, 0
+	for j := range x {
+		a += bits.OnesCount64(x[j] & d[j])
+		b += bits.OnesCount64(x[j] &^ d[j])
+		c += bits.OnesCount64(d[j] &^ x[j])
+		neither += bits.OnesCount64(^(x[j] | d[j]))
+	}
+	n := a + b + c + neither
+	quotient := func(p, q float64) float64 {
+		if q == 0 {
+			return 1
+		}
+		return p / q
+	}
+	switch similarity {
+	case bitknn.SimilarityDice:
+		return quotient(float64(2*a), float64(2*a+b+c))
+	case bitknn.SimilarityRussellRao:
+		return quotient(float64(a), float64(n))
+	case bitknn.SimilaritySokalMichener:
+		return quotient(float64(a+neither), float64(n))
+	case bitknn.SimilarityRogersTanimoto:
+		return quotient(float64(a+neither), float64(a+neither+2*(b+c)))
+	case bitknn.SimilarityKulczynski:
+		if a+b == 0 || a+c == 0 {
+			return quotient(0, float64(a+b+c))
+		}
+		return (float64(a)/float64(a+b) + float64(a)/float64(a+c)) / 2
+	case bitknn.SimilarityCosine:
+		if a+b == 0 || a+c == 0 {
+			return quotient(0, float64(a+b+c))
+		}
+		return float64(a) / math.Sqrt(float64(a+b)*float64(a+c))
+	default:
+		return quotient(float64(a), float64(a+b+c))
+	}
+}
+
+// similarOracle returns the `k` most similar data points by the given similarities of all data points,
+// sorted by descending similarity, and equal similarities by ascending index.
+func similarOracle(k int, all []float64) ([]float64, []int) {
+	return similarTiesOracle(k, all, bitknn.TieBreakingLowestIndex)
+}
+
+// similarTiesOracle is [similarOracle] with the given tie-breaking.
+func similarTiesOracle(k int, all []float64, tieBreaking bitknn.TieBreaking) ([]float64, []int) {
+	negated := make([]float64, len(all))
+	for i, s := range all {
+		negated[i] = -s
+	}
+	similarities, indices := tiesOracle(k, negated, tieBreaking, 0)
+	for i := range similarities {
+		similarities[i] = -similarities[i]
+	}
+	return similarities, indices
+}
+
+// sparseWideData draws data points with widely varying numbers of bits set, and many ties in similarity.
+func sparseWideData(t *rapid.T, dims, size int) [][]uint64 {
+	data := testrandom.WideData(dims, size)
+	for i, d := range data {
+		width := rapid.IntRange(0, 64).Draw(t, "width")
+		for j := range d {
+			d[j] &= 1<<width - 1
+		}
+		data[i] = d
+	}
+	return data
+}
+
+func TestSimilarity_Coefficient(t *testing.T) {
+	for _, tc := range []struct {
+		similarity        bitknn.Similarity
+		and, onesA, onesB int
+		expected          float64
+	}{
+		{bitknn.SimilarityTanimoto, 0, 0, 0, 1},
+		{bitknn.SimilarityTanimoto, 0, 3, 0, 0},
+		{bitknn.SimilarityTanimoto, 2, 3, 4, 0.4},
+		{bitknn.SimilarityTanimoto, 4, 4, 4, 1},
+		{bitknn.SimilarityDice, 0, 0, 0, 1},
+		{bitknn.SimilarityDice, 0, 3, 0, 0},
+		{bitknn.SimilarityDice, 2, 3, 5, 0.5},
+		{bitknn.SimilarityDice, 4, 4, 4, 1},
+		{bitknn.SimilarityRussellRao, 0, 0, 0, 0},
+		{bitknn.SimilarityRussellRao, 16, 32, 16, 0.25},
+		{bitknn.SimilaritySokalMichener, 0, 0, 0, 1},
+		{bitknn.SimilaritySokalMichener, 8, 16, 24, 0.625},
+		{bitknn.SimilarityRogersTanimoto, 0, 0, 0, 1},
+		{bitknn.SimilarityRogersTanimoto, 8, 16, 24, 40.0 / 88},
+		{bitknn.SimilarityKulczynski, 0, 0, 0, 1},
+		{bitknn.SimilarityKulczynski, 0, 3, 0, 0},
+		{bitknn.SimilarityKulczynski, 2, 4, 8, 0.375},
+		{bitknn.SimilarityCosine, 0, 0, 0, 1},
+		{bitknn.SimilarityCosine, 0, 0, 3, 0},
+		{bitknn.SimilarityCosine, 2, 4, 16, 0.25},
+	} {
+		c := bitknn.Contingency{And: tc.and, Or: tc.onesA + tc.onesB - tc.and, OnesA: tc.onesA, OnesB: tc.onesB, Bits: 64}
+		if actual := tc.similarity.Coefficient(c); actual != tc.expected {
+			t.Errorf("%v%+v = %v != %v", tc.similarity, c, actual, tc.expected)
+		}
+	}
+}
+
+func TestNearestSimilar_Oracle(t *testing.T) {
+	rapid.Check(t, func(t *rapid.T) {
+		k := rapid.IntRange(0, 50).Draw(t, "k")
+		size := rapid.IntRange(0, 300).Draw(t, "size")
+		similarity := rapid.SampledFrom(similarities).Draw(t, "similarity")
+		wideData := sparseWideData(t, 1, size)
+		data := make([]uint64, size)
+		for i, d := range wideData {
+			data[i] = d[0]
+		}
+		x := sparseWideData(t, 1, 1)[0]
+
+		all := make([]float64, size)
+		for i, d := range wideData {
+			all[i] = similarityOracle(similarity, x, d)
+		}
+		expectedSimilarities, expectedIndices := similarOracle(k, all)
+
+		onesCounts := bitknn.OnesCounts(data)
+		actualSimilarities, actualIndices := make([]float64, k+1), make([]int, k+1)
+		for name, nearest := range map[string]func() int{
+			"NearestSimilar": func() int {
+				return bitknn.NearestSimilar(data, onesCounts, similarity, k, x[0], actualSimilarities, actualIndices)
+			},
+			"NearestSimilarParallel": func() int {
+				return bitknn.NearestSimilarParallel(data, onesCounts, similarity, k, x[0], 4, actualSimilarities, actualIndices)
+			},
+			"NearestSimilar (uncounted)": func() int {
+				return bitknn.NearestSimilar(data, nil, similarity, k, x[0], actualSimilarities, actualIndices)
+			},
+			"NearestSimilarParallel (uncounted)": func() int {
+				return bitknn.NearestSimilarParallel(data, nil, similarity, k, x[0], 4, actualSimilarities, actualIndices)
+			},
+		} {
+			n := nearest()
+			bitknn.SortSimilarNeighbors(actualSimilarities[:n], actualIndices[:n])
+			if diff := cmp.Diff(expectedSimilarities, actualSimilarities[:n], cmpopts.EquateEmpty()); diff != "" {
+				t.Fatal(name, diff)
+			}
+			if diff := cmp.Diff(expectedIndices, actualIndices[:n], cmpopts.EquateEmpty()); diff != "" {
+				t.Fatal(name, diff)
+			}
+		}
+	})
+}
+
+func TestNearestWideSimilar_Oracle(t *testing.T) {
+	rapid.Check(t, func(t *rapid.T) {
+		k := rapid.IntRange(0, 50).Draw(t, "k")
+		dims := rapid.IntRange(1, 4).Draw(t, "dims")
+		size := rapid.IntRange(0, 300).Draw(t, "size")
+		similarity := rapid.SampledFrom(similarities).Draw(t, "similarity")
+		data := sparseWideData(t, dims, size)
+		x := sparseWideData(t, dims, 1)[0]
+
+		all := make([]float64, size)
+		for i, d := range data {
+			all[i] = similarityOracle(similarity, x, d)
+		}
+		expectedSimilarities, expectedIndices := similarOracle(k, all)
+
+		onesCounts := bitknn.WideOnesCounts(data)
+		actualSimilarities, actualIndices := make([]float64, k+1), make([]int, k+1)
+		for name, nearest := range map[string]func() int{
+			"NearestWideSimilar": func() int {
+				return bitknn.NearestWideSimilar(data, onesCounts, similarity, k, x, actualSimilarities, actualIndices)
+			},
+			"NearestWideSimilarParallel": func() int {
+				return bitknn.NearestWideSimilarParallel(data, onesCounts, similarity, k, x, 4, actualSimilarities, actualIndices)
+			},
+			"NearestWideSimilar (uncounted)": func() int {
+				return bitknn.NearestWideSimilar(data, nil, similarity, k, x, actualSimilarities, actualIndices)
+			},
+			"NearestWideSimilarParallel (uncounted)": func() int {
+				return bitknn.NearestWideSimilarParallel(data, nil, similarity, k, x, 4, actualSimilarities, actualIndices)
+			},
+		} {
+			n := nearest()
+			bitknn.SortSimilarNeighbors(actualSimilarities[:n], actualIndices[:n])
+			if diff := cmp.Diff(expectedSimilarities, actualSimilarities[:n], cmpopts.EquateEmpty()); diff != "" {
+				t.Fatal(name, diff)
+			}
+			if diff := cmp.Diff(expectedIndices, actualIndices[:n], cmpopts.EquateEmpty()); diff != "" {
+				t.Fatal(name, diff)
+			}
+		}
+	})
+}
+
+func TestModel_FindSimilar(t *testing.T) {
+	rapid.Check(t, func(t *rapid.T) {
+		k := rapid.IntRange(1, 20).Draw(t, "k")
+		size := rapid.SampledFrom([]int{0, 1, 10, 300, 3000}).Draw(t, "size")
+		dims := rapid.IntRange(1, 3).Draw(t, "dims")
+		similarity := rapid.SampledFrom(similarities).Draw(t, "similarity")
+		tieBreaking := rapid.SampledFrom(tieBreakings).Draw(t, "tieBreaking")
+		data := sparseWideData(t, dims, size)
+		labels := testrandom.Labels(size)
+		values := testrandom.Values(size)
+		x := testrandom.WideQuery(dims)
+		opts := []bitknn.Option{
+			bitknn.WithSimilarity(similarity),
+			bitknn.WithSimilarityWeighting(),
+			bitknn.WithValues(values),
+			bitknn.WithTieBreaking(tieBreaking),
+			bitknn.WithWorkers(rapid.IntRange(1, 4).Draw(t, "workers")),
+			bitknn.WithSorted(),
+		}
+		model := bitknn.FitWide(data, labels, opts...)
+
+		all := make([]float64, size)
+		for i, d := range data {
+			all[i] = similarityOracle(similarity, x, d)
+		}
+		expectedSimilarities, expectedIndices := similarTiesOracle(k, all, tieBreaking)
+		expectedVotes := make(bitknn.VoteMap)
+		for i, index := range expectedIndices {
+			expectedVotes.Add(labels[index], values[index]*expectedSimilarities[i])
+		}
+
+		finds := map[string]func() ([]float64, []int){
+			"WideModel.FindSimilar": func() ([]float64, []int) { return model.FindSimilar(k, x) },
+		}
+		predicts := map[string]func(votes bitknn.VoteCounter) int{
+			"WideModel.PredictSimilar": func(votes bitknn.VoteCounter) int { return model.PredictSimilar(k, x, votes) },
+		}
+		if dims == 1 {
+			narrowData := make([]uint64, size)
+			for i, d := range data {
+				narrowData[i] = d[0]
+			}
+			narrow := bitknn.Fit(narrowData, labels, opts...)
+			finds["Model.FindSimilar"] = func() ([]float64, []int) { return narrow.FindSimilar(k, x[0]) }
+			predicts["Model.PredictSimilar"] = func(votes bitknn.VoteCounter) int { return narrow.PredictSimilar(k, x[0], votes) }
+		}
+		for name, find := range finds {
+			actualSimilarities, actualIndices := find()
+			if diff := cmp.Diff(expectedSimilarities, actualSimilarities, cmpopts.EquateEmpty()); diff != "" {
+				t.Fatal(name, diff)
+			}
+			if diff := cmp.Diff(expectedIndices, actualIndices, cmpopts.EquateEmpty()); diff != "" {
+				t.Fatal(name, diff)
+			}
+		}
+		for name, predict := range predicts {
+			votes := make(bitknn.VoteMap)
+			if n := predict(votes); n != len(expectedIndices) {
+				t.Fatal(name, n, len(expectedIndices))
+			}
+			if diff := cmp.Diff(expectedVotes, votes, cmpopts.EquateApprox(0, eps)); diff != "" {
+				t.Fatal(name, diff)
+			}
+		}
+	})
+}
+
+func TestModel_FindSimilar_Default(t *testing.T) {
+	// Without the WithSimilarity option, the models search by the Tanimoto coefficient.
+	model := bitknn.Fit([]uint64{0b1011, 0b0001, 0}, []int{0, 1, 2}, bitknn.WithSorted())
+	similarities, indices := model.FindSimilar(2, 0b0011)
+	if diff := cmp.Diff([]float64{2 / 3.0, 1 / 2.0}, similarities); diff != "" {
+		t.Error(diff)
+	}
+	if diff := cmp.Diff([]int{0, 1}, indices); diff != "" {
+		t.Error(diff)
+	}
+	wide := bitknn.FitWide([][]uint64{{0b1011, 1}, {0b0001, 0}, {0, 0}}, []int{0, 1, 2}, bitknn.WithSorted())
+	similarities, indices = wide.FindSimilar(2, []uint64{0b0011, 0})
+	if diff := cmp.Diff([]float64{2 / 4.0, 1 / 2.0}, similarities); diff != "" {
+		t.Error(diff)
+	}
+	if diff := cmp.Diff([]int{0, 1}, indices); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestModel_VoteSimilar(t *testing.T) {
+	model := bitknn.Fit(nil, []int{0, 1, 0})
+	votes := make(bitknn.VoteSlice, 2)
+	model.VoteSimilar(3, []float64{0.5, 0.25, 1}, []int{0, 1, 2}, votes)
+	if diff := cmp.Diff(bitknn.VoteSlice{2, 1}, votes); diff != "" {
+		t.Error(diff)
+	}
+	model = bitknn.Fit(nil, []int{0, 1, 0}, bitknn.WithSimilarityWeightingFunc(func(s float64) float64 { return s * s }))
+	model.VoteSimilar(3, []float64{0.5, 0.25, 1}, []int{0, 1, 2}, votes)
+	if diff := cmp.Diff(bitknn.VoteSlice{1.25, 0.0625}, votes); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestModel_Similarity_Read(t *testing.T) {
+	data := [][]uint64{{0b1011, 1}, {0b0001, 0}, {0, 0}}
+	model := bitknn.FitWide(data, []int{0, 1, 2}, bitknn.WithSimilarity(bitknn.SimilarityDice))
+	if diff := cmp.Diff([]int{4, 1, 0}, model.Narrow.OnesCounts); diff != "" {
+		t.Fatal(diff)
+	}
+	var buf bytes.Buffer
+	if _, err := model.WriteTo(&buf); !errors.Is(err, bitknn.ErrUnsupportedSetting) {
+		t.Fatal("the similarity coefficient can't be written", err)
+	}
+	if _, err := bitknn.FitWide(data, []int{0, 1, 2}).WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	read, err := bitknn.ReadWideModel(&buf, bitknn.WithSimilarity(bitknn.SimilarityDice))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(model.Narrow.OnesCounts, read.Narrow.OnesCounts); diff != "" {
+		t.Fatal(diff)
+	}
+	similarities, indices := read.FindSimilar(2, []uint64{0b0011, 0})
+	if diff := cmp.Diff([]float64{2 * 2 / 6.0, 2 * 1 / 3.0}, similarities); diff != "" {
+		t.Error(diff)
+	}
+	if diff := cmp.Diff([]int{1, 0}, indices); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestModel_Similarity_NoAlloc(t *testing.T) {
+	const k, size = 10, 1000
+	data, wideData := testrandom.Data(size), testrandom.WideData(4, size)
+	labels := testrandom.Labels(size)
+	opts := []bitknn.Option{
+		bitknn.WithSimilarity(bitknn.SimilarityTanimoto),
+		bitknn.WithSimilarityWeighting(),
+		bitknn.WithSorted(),
+	}
+	model := bitknn.Fit(data, labels, opts...)
+	wideModel := bitknn.FitWide(wideData, labels, opts...)
+	similarities, indices := make([]float64, k+1), make([]int, k+1)
+	var votes bitknn.VoteCounter = make(bitknn.VoteSlice, 256)
+	x, wideX := testrandom.Query(), testrandom.WideQuery(4)
+	for name, f := range map[string]func(){
+		"Model.FindSimilarInto":        func() { model.FindSimilarInto(k, x, similarities, indices) },
+		"Model.PredictSimilarInto":     func() { model.PredictSimilarInto(k, x, similarities, indices, votes) },
+		"WideModel.FindSimilarInto":    func() { wideModel.FindSimilarInto(k, wideX, similarities, indices) },
+		"WideModel.PredictSimilarInto": func() { wideModel.PredictSimilarInto(k, wideX, similarities, indices, votes) },
+	} {
+		if allocs := testing.AllocsPerRun(10, f); allocs != 0 {
+			t.Errorf("%s: %v allocations", name, allocs)
+		}
+	}
+}
+
+func TestModel_Similarity_CountOnes(t *testing.T) {
+	data := [][]uint64{{0b1011, 1}, {0b0001, 0}, {0, 0}}
+	labels := []int{0, 1, 2}
+	if counts := bitknn.FitWide(data, labels).Narrow.OnesCounts; counts != nil {
+		t.Errorf("counted %v without a similarity option", counts)
+	}
+	if counts := bitknn.Fit([]uint64{0b1011}, labels[:1], bitknn.WithMetric(bitknn.SimilarityCosine)).OnesCounts; !cmp.Equal([]int{3}, counts) {
+		t.Errorf("counted %v", counts)
+	}
+	expected := bitknn.FitWide(data, labels, bitknn.WithSimilarity(bitknn.SimilarityDice))
+	wide := &bitknn.WideModel{
+		Narrow:   bitknn.Fit(nil, labels, bitknn.WithSimilarity(bitknn.SimilarityDice)),
+		WideData: data,
+	}
+	similarities, indices := wide.FindSimilar(2, []uint64{0b0011, 0})
+	expectedSimilarities, expectedIndices := expected.FindSimilar(2, []uint64{0b0011, 0})
+	if diff := cmp.Diff(expectedSimilarities, similarities); diff != "" {
+		t.Error(diff)
+	}
+	if diff := cmp.Diff(expectedIndices, indices); diff != "" {
+		t.Error(diff)
+	}
+}
@@ -1,6 +1,13 @@
 package bitknn
 
-import "slices"
+import (
+	"iter"
+	"maps"
+	"math"
+	"slices"
+
+	"github.com/keilerkonzept/bitknn/internal/slice"
+)
 
 // VoteCounter is a k-NN vote counter interface.
 type VoteCounter interface {
@@ -21,16 +28,39 @@ type VoteCounter interface {
 	Add(label int, delta float64)
 }
 
+// TopNVoteCounter is a [VoteCounter] that can also rank its labels by vote count.
+type TopNVoteCounter interface {
+	VoteCounter
+
+	// TopN writes up to `n` labels with the highest vote counts into `out` (truncated to length 0), and returns it.
+	// The labels are sorted by descending vote count, and equal vote counts by ascending label.
+	// Of several labels with the highest vote count, the first one is thus the lowest, which needn't be the one returned by ArgMax.
+	TopN(n int, out []Vote) []Vote
+}
+
+// Vote is a label and its vote count.
+type Vote struct {
+	Label int
+	Count float64
+}
+
+var (
+	_ TopNVoteCounter = DiscardVotes
+	_ TopNVoteCounter = VoteSlice(nil)
+	_ TopNVoteCounter = VoteMap(nil)
+)
+
 type discardVotes int
 
 // DiscardVotes is a no-op vote counter.
 const DiscardVotes = discardVotes(0)
 
-func (me discardVotes) Clear()                       {}
-func (me discardVotes) ArgMax() int                  { return 0 }
-func (me discardVotes) Max() float64                 { return 0 }
-func (me discardVotes) Get(label int) float64        { return 0 }
-func (me discardVotes) Add(label int, delta float64) {}
+func (me discardVotes) Clear()                        {}
+func (me discardVotes) ArgMax() int                   { return 0 }
+func (me discardVotes) Max() float64                  { return 0 }
+func (me discardVotes) Get(label int) float64         { return 0 }
+func (me discardVotes) Add(label int, delta float64)  {}
+func (me discardVotes) TopN(n int, out []Vote) []Vote { return out[:0] }
 
 // VoteSlice is a dense vote counter that stores votes in a slice.
 // It is efficient for small sets of class labels.
@@ -41,7 +71,8 @@ func (me VoteSlice) Clear() {
 	clear(me)
 }
 
-// ArgMax returns the index (label) of the highest vote.
+// ArgMax returns the index (label) of the highest vote, and of several, the highest index.
+// [VoteSlice.TopN] instead ranks the lowest of them first.
 // If there are no votes, it returns 0.
 func (me VoteSlice) ArgMax() int {
 	if len(me) == 0 {
@@ -76,6 +107,64 @@ func (me VoteSlice) Get(label int) float64 {
 	return me[label]
 }
 
+// TopN writes up to `n` labels with the highest vote counts into `out` (truncated to length 0), and returns it.
+// The labels are sorted by descending vote count, and equal vote counts by ascending label,
+// unlike [VoteSlice.ArgMax], which returns the highest of several labels with the highest vote count.
+// Does not allocate if `out` has capacity for min(n, len(me)) votes.
+func (me VoteSlice) TopN(n int, out []Vote) []Vote {
+	out = out[:0]
+	for label, x := range me {
+		out = pushTopN(out, n, Vote{label, x})
+	}
+	return out
+}
+
+// Probabilities writes the normalized class probabilities of the votes into `out`, growing it to the length of the vote slice, and returns it.
+// The probability of each label is proportional to its vote count plus `smoothing` (Laplace smoothing),
+// times its prior probability from `priors` (if not nil, with the same length as the vote slice).
+// If all of these are zero, the probabilities are the normalized priors, or uniform without priors.
+// The output may be the vote slice itself.
+func (me VoteSlice) Probabilities(smoothing float64, priors []float64, out VoteSlice) VoteSlice {
+	out = slice.OrAlloc(out, len(me))
+	var total float64
+	for label, x := range me {
+		p := x + smoothing
+		if priors != nil {
+			p *= priors[label]
+		}
+		out[label] = p
+		total += p
+	}
+	if total == 0 {
+		for label := range out {
+			out[label] = 1
+			if priors != nil {
+				out[label] = priors[label]
+			}
+			total += out[label]
+		}
+	}
+	if total == 0 {
+		return out
+	}
+	for label := range out {
+		out[label] /= total
+	}
+	return out
+}
+
+// Margin returns the difference between the highest and the second-highest vote count.
+// If there is only one label, its vote count is the margin; if there are none, the margin is 0.
+func (me VoteSlice) Margin() float64 {
+	return margin(slices.Values(me))
+}
+
+// Entropy returns the entropy (in nats) of the distribution of the votes, which must be non-negative.
+// It is 0 if all votes are for a single label, or if there are no votes, and ln(n) if they are spread evenly over n labels.
+func (me VoteSlice) Entropy() float64 {
+	return entropy(slices.Values(me))
+}
+
 // VoteMap is a sparse vote counter that stores votes in a map.
 // Good for large sets of class labels.
 type VoteMap map[int]float64
@@ -85,7 +174,8 @@ func (me VoteMap) Clear() {
 	clear(me)
 }
 
-// ArgMax returns the label with the highest vote count.
+// ArgMax returns the label with the highest vote count, and of several, any one of them.
+// [VoteMap.TopN] instead ranks the lowest of them first.
 // If there are no votes, it returns 0.
 func (me VoteMap) ArgMax() int {
 	if len(me) == 0 {
@@ -132,3 +222,130 @@ func (me VoteMap) Add(label int, delta float64) {
 func (me VoteMap) Get(label int) float64 {
 	return me[label]
 }
+
+// TopN writes up to `n` labels with the highest vote counts into `out` (truncated to length 0), and returns it.
+// The labels are sorted by descending vote count, and equal vote counts by ascending label,
+// unlike [VoteMap.ArgMax], which returns any one of several labels with the highest vote count.
+// Does not allocate if `out` has capacity for min(n, len(me)) votes.
+func (me VoteMap) TopN(n int, out []Vote) []Vote {
+	out = out[:0]
+	for label, x := range me {
+		out = pushTopN(out, n, Vote{label, x})
+	}
+	return out
+}
+
+// Probabilities writes the normalized class probabilities of the votes into `out`, and returns it.
+// The map `out` is cleared first and must not be the vote map itself; if it is nil, a new map is allocated.
+// The probability of each label is proportional to its vote count plus `smoothing` (Laplace smoothing),
+// times its prior probability from `priors` (if not nil, with missing labels having prior 0).
+// The labels are those with votes, and those with priors.
+// If all of these are zero, the probabilities are the normalized priors, or uniform without priors.
+func (me VoteMap) Probabilities(smoothing float64, priors map[int]float64, out VoteMap) VoteMap {
+	if out == nil {
+		out = make(VoteMap, len(me)+len(priors))
+	}
+	clear(out)
+	prior := func(label int) float64 {
+		if priors == nil {
+			return 1
+		}
+		return priors[label]
+	}
+	var total float64
+	for label, x := range me {
+		p := (x + smoothing) * prior(label)
+		out[label] = p
+		total += p
+	}
+	for label, q := range priors {
+		if _, ok := me[label]; !ok {
+			p := smoothing * q
+			out[label] = p
+			total += p
+		}
+	}
+	if total == 0 {
+		for label := range out {
+			out[label] = prior(label)
+			total += out[label]
+		}
+	}
+	if total == 0 {
+		return out
+	}
+	for label := range out {
+		out[label] /= total
+	}
+	return out
+}
+
+// Margin returns the difference between the highest and the second-highest vote count.
+// If there is only one label, its vote count is the margin; if there are none, the margin is 0.
+func (me VoteMap) Margin() float64 {
+	return margin(maps.Values(me))
+}
+
+// Entropy returns the entropy (in nats) of the distribution of the votes, which must be non-negative.
+// It is 0 if all votes are for a single label, or if there are no votes, and ln(n) if they are spread evenly over n labels.
+func (me VoteMap) Entropy() float64 {
+	return entropy(maps.Values(me))
+}
+
+// margin returns the difference between the highest and the second-highest of the given vote counts,
+// counting a missing second-highest one as 0.
+func margin(votes iter.Seq[float64]) float64 {
+	var first, second float64
+	n := 0
+	for x := range votes {
+		switch {
+		case n == 0 || x > first:
+			first, second = x, first
+		case n == 1 || x > second:
+			second = x
+		}
+		n++
+	}
+	return first - second
+}
+
+// entropy returns the entropy of the distribution of the given non-negative vote counts.
+func entropy(votes iter.Seq[float64]) float64 {
+	var total float64
+	for x := range votes {
+		total += x
+	}
+	if total == 0 {
+		return 0
+	}
+	var out float64
+	for x := range votes {
+		if x > 0 {
+			p := x / total
+			out -= p * math.Log(p)
+		}
+	}
+	return out
+}
+
+// pushTopN inserts the given vote into the ranking `top` of up to `n` votes, sorted as by [VoteSlice.TopN].
+func pushTopN(top []Vote, n int, v Vote) []Vote {
+	i := len(top)
+	for i > 0 && ranksBefore(v, top[i-1]) {
+		i--
+	}
+	if i >= n {
+		return top
+	}
+	if len(top) < n {
+		top = append(top, Vote{})
+	}
+	copy(top[i+1:], top[i:])
+	top[i] = v
+	return top
+}
+
+// ranksBefore returns whether vote `a` ranks before vote `b` by descending vote count, and then by ascending label.
+func ranksBefore(a, b Vote) bool {
+	return a.Count > b.Count || (a.Count == b.Count && a.Label < b.Label)
+}
@@ -1,9 +1,14 @@
 package bitknn_test
 
 import (
+	gocmp "cmp"
 	"math"
+	"slices"
 	"testing"
 
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+
 	"github.com/keilerkonzept/bitknn"
 	"pgregory.net/rapid"
 )
@@ -221,3 +226,200 @@ func TestVoteMap_Get(t *testing.T) {
 		}
 	})
 }
+
+func TestVoteSlice_Probabilities(t *testing.T) {
+	rapid.Check(t, func(t *rapid.T) {
+		length := rapid.IntRange(0, 20).Draw(t, "length")
+		votes := bitknn.VoteSlice(rapid.SliceOfN(rapid.Float64Range(0, 10), length, length).Draw(t, "votes"))
+		smoothing := rapid.SampledFrom([]float64{0, 1, 0.5}).Draw(t, "smoothing")
+		var priors []float64
+		if rapid.Bool().Draw(t, "priors") {
+			priors = rapid.SliceOfN(rapid.Float64Range(0, 1), length, length).Draw(t, "prior")
+		}
+		prior := func(label int) float64 {
+			if priors == nil {
+				return 1
+			}
+			return priors[label]
+		}
+
+		probabilities := votes.Probabilities(smoothing, priors, nil)
+		var total, priorTotal float64
+		for label, x := range votes {
+			total += (x + smoothing) * prior(label)
+			priorTotal += prior(label)
+		}
+		for label, p := range probabilities {
+			expected := 0.0
+			switch {
+			case total > 0:
+				expected = (votes[label] + smoothing) * prior(label) / total
+			case priorTotal > 0:
+				expected = prior(label) / priorTotal
+			}
+			if math.Abs(p-expected) > eps {
+				t.Fatalf("label %d: expected probability %v, got %v", label, expected, p)
+			}
+		}
+
+		inPlace := votes.Probabilities(smoothing, priors, votes)
+		if diff := cmp.Diff(probabilities, inPlace, cmpopts.EquateEmpty()); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+}
+
+func TestVoteMap_Probabilities_Equiv_VoteSlice(t *testing.T) {
+	rapid.Check(t, func(t *rapid.T) {
+		length := rapid.IntRange(0, 20).Draw(t, "length")
+		votes := bitknn.VoteSlice(rapid.SliceOfN(rapid.Float64Range(0, 10), length, length).Draw(t, "votes"))
+		smoothing := rapid.SampledFrom([]float64{0, 1, 0.5}).Draw(t, "smoothing")
+		priors := rapid.SliceOfN(rapid.Float64Range(0, 1), length, length).Draw(t, "priors")
+
+		// Votes for the labels with priors, some of them missing.
+		voteMap := make(bitknn.VoteMap)
+		priorMap := make(map[int]float64)
+		for label, x := range votes {
+			priorMap[label] = priors[label]
+			if x != 0 || rapid.Bool().Draw(t, "present") {
+				voteMap[label] = x
+			}
+		}
+		expected := votes.Probabilities(smoothing, priors, nil)
+		out := bitknn.VoteMap{-1: 1} // cleared
+		actual := voteMap.Probabilities(smoothing, priorMap, out)
+		if len(actual) != len(expected) {
+			t.Fatalf("expected %d labels, got %d", len(expected), len(actual))
+		}
+		for label, p := range expected {
+			if math.Abs(actual[label]-p) > eps {
+				t.Fatalf("label %d: expected probability %v, got %v", label, p, actual[label])
+			}
+		}
+
+		// Without priors, the labels are those with votes.
+		var total float64
+		for _, x := range voteMap {
+			total += x + smoothing
+		}
+		actual = voteMap.Probabilities(smoothing, nil, nil)
+		if len(actual) != len(voteMap) {
+			t.Fatalf("expected %d labels, got %d", len(voteMap), len(actual))
+		}
+		for label, x := range voteMap {
+			expected := 1 / float64(len(voteMap))
+			if total > 0 {
+				expected = (x + smoothing) / total
+			}
+			if math.Abs(actual[label]-expected) > eps {
+				t.Fatalf("label %d without priors: expected probability %v, got %v", label, expected, actual[label])
+			}
+		}
+	})
+}
+
+func TestVoteSlice_Margin(t *testing.T) {
+	rapid.Check(t, func(t *rapid.T) {
+		votes := bitknn.VoteSlice(rapid.SliceOf(rapid.Float64Range(-10, 10)).Draw(t, "votes"))
+		sorted := slices.Clone(votes)
+		slices.Sort(sorted)
+		slices.Reverse(sorted)
+		sorted = append(sorted, 0, 0)
+		expected := sorted[0] - sorted[1]
+		if len(votes) == 0 {
+			expected = 0
+		}
+		if actual := votes.Margin(); math.Abs(actual-expected) > eps {
+			t.Fatalf("expected margin %v, got %v", expected, actual)
+		}
+
+		voteMap := make(bitknn.VoteMap)
+		for label, x := range votes {
+			voteMap[label] = x
+		}
+		if actual := voteMap.Margin(); math.Abs(actual-expected) > eps {
+			t.Fatalf("map: expected margin %v, got %v", expected, actual)
+		}
+	})
+}
+
+func TestVoteSlice_Entropy(t *testing.T) {
+	for _, tc := range []struct {
+		votes    bitknn.VoteSlice
+		expected float64
+	}{
+		{nil, 0},
+		{bitknn.VoteSlice{0, 0}, 0},
+		{bitknn.VoteSlice{0, 3, 0}, 0},
+		{bitknn.VoteSlice{2, 2}, math.Ln2},
+		{bitknn.VoteSlice{1, 1, 1, 0, 1}, math.Log(4)},
+		{bitknn.VoteSlice{1, 3}, -(0.25*math.Log(0.25) + 0.75*math.Log(0.75))},
+	} {
+		if actual := tc.votes.Entropy(); math.Abs(actual-tc.expected) > eps {
+			t.Errorf("%v: expected entropy %v, got %v", tc.votes, tc.expected, actual)
+		}
+		voteMap := make(bitknn.VoteMap)
+		for label, x := range tc.votes {
+			voteMap[label] = x
+		}
+		if actual := voteMap.Entropy(); math.Abs(actual-tc.expected) > eps {
+			t.Errorf("map %v: expected entropy %v, got %v", tc.votes, tc.expected, actual)
+		}
+	}
+}
+
+// topNOracle ranks all the given votes by sorting them, and returns the first n.
+func topNOracle(votes []bitknn.Vote, n int) []bitknn.Vote {
+	slices.SortFunc(votes, func(a, b bitknn.Vote) int {
+		return gocmp.Or(gocmp.Compare(b.Count, a.Count), gocmp.Compare(a.Label, b.Label))
+	})
+	return votes[:max(0, min(n, len(votes)))]
+}
+
+func TestVoteSlice_TopN(t *testing.T) {
+	rapid.Check(t, func(t *rapid.T) {
+		votes := bitknn.VoteSlice(rapid.SliceOf(rapid.SampledFrom([]float64{0, 1, 2, 2.5, -1})).Draw(t, "votes"))
+		n := rapid.IntRange(-1, 30).Draw(t, "n")
+		all := make([]bitknn.Vote, len(votes))
+		for label, x := range votes {
+			all[label] = bitknn.Vote{Label: label, Count: x}
+		}
+		expected := topNOracle(all, n)
+
+		out := make([]bitknn.Vote, 0, max(n, 0))
+		actual := votes.TopN(n, out)
+		if diff := cmp.Diff(expected, actual, cmpopts.EquateEmpty()); diff != "" {
+			t.Fatal(diff)
+		}
+		if allocs := testing.AllocsPerRun(10, func() { votes.TopN(n, out) }); allocs != 0 {
+			t.Fatal(allocs)
+		}
+
+		voteMap := make(bitknn.VoteMap)
+		for label, x := range votes {
+			voteMap[label] = x
+		}
+		if diff := cmp.Diff(expected, voteMap.TopN(n, out), cmpopts.EquateEmpty()); diff != "" {
+			t.Fatal(diff)
+		}
+		if allocs := testing.AllocsPerRun(10, func() { voteMap.TopN(n, out) }); allocs != 0 {
+			t.Fatal(allocs)
+		}
+	})
+}
+
+func TestVoteCounter_TopN(t *testing.T) {
+	out := make([]bitknn.Vote, 0, 2)
+	for _, tc := range []struct {
+		votes    bitknn.TopNVoteCounter
+		expected []bitknn.Vote
+	}{
+		{bitknn.DiscardVotes, nil},
+		{bitknn.VoteSlice{1, 3, 2, 3}, []bitknn.Vote{{1, 3}, {3, 3}}},
+		{bitknn.VoteMap{10: 1, 5: 3, 7: 3}, []bitknn.Vote{{5, 3}, {7, 3}}},
+	} {
+		if diff := cmp.Diff(tc.expected, tc.votes.TopN(2, out), cmpopts.EquateEmpty()); diff != "" {
+			t.Error(diff)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package bitknn
+
+import "math/bits"
+
+// BitWeights assigns non-negative integer or floating-point weights to the bits of the data points,
+// for the weighted Hamming distance: the sum of the weights of the bits that differ.
+// Bits without a weight don't count.
+//
+// The bits of each word are grouped by weight, so that the distance takes one popcount per distinct weight in each word.
+type BitWeights[W int | float64] struct {
+	// Groups of bits with the same weight in each word.
+	words [][]bitGroup[W]
+	// Sum of all weights, the largest possible distance.
+	max W
+}
+
+// bitGroup is a set of bits of a word with the same weight.
+type bitGroup[W int | float64] struct {
+	mask   uint64
+	weight W
+}
+
+// NewBitWeights returns the weights of the individual bits, where `weights[i]` is the weight of bit `i`,
+// which is bit `i % 64` (counting from the least significant bit) of word `i / 64`.
+// Panics if a weight is negative or NaN, or if the sum of the weights overflows.
+func NewBitWeights[W int | float64](weights []W) *BitWeights[W] {
+	out := &BitWeights[W]{words: make([][]bitGroup[W], (len(weights)+63)/64)}
+	for i, w := range weights {
+		if !(w >= 0) {
+			panic("bitknn: bit weights must not be negative or NaN")
+		}
+		if w == 0 {
+			continue
+		}
+		if out.max+w < out.max {
+			panic("bitknn: the sum of the bit weights overflows")
+		}
+		out.max += w
+		groups := out.words[i/64]
+		bit := uint64(1) << (i % 64)
+		j := 0
+		for j < len(groups) && groups[j].weight != w {
+			j++
+		}
+		if j == len(groups) {
+			groups = append(groups, bitGroup[W]{weight: w})
+		}
+		groups[j].mask |= bit
+		out.words[i/64] = groups
+	}
+	return out
+}
+
+// ByteWeights returns the weights of whole bytes, where `weights[i]` is the weight of each bit of byte `i`, i.e. of bits `8*i` to `8*i+7`.
+// Panics if a weight is negative or NaN.
+func ByteWeights[W int | float64](weights []W) *BitWeights[W] {
+	bitWeights := make([]W, 8*len(weights))
+	for i, w := range weights {
+		for j := range 8 {
+			bitWeights[8*i+j] = w
+		}
+	}
+	return NewBitWeights(bitWeights)
+}
+
+// BitRangeWeights returns the weights of the given ranges of bits, where `weights[i]` is the weight of each bit in `ranges[i]`.
+// The weights of overlapping ranges add up. Panics if a resulting weight is negative or NaN.
+func BitRangeWeights[W int | float64](ranges []BitRange, weights []W) *BitWeights[W] {
+	n := 0
+	for _, r := range ranges {
+		n = max(n, r.Offset+r.Width)
+	}
+	bitWeights := make([]W, n)
+	for i, r := range ranges {
+		for j := r.Offset; j < r.Offset+r.Width; j++ {
+			bitWeights[j] += weights[i]
+		}
+	}
+	return NewBitWeights(bitWeights)
+}
+
+// Words returns the number of words with weighted bits.
+func (me *BitWeights[W]) Words() int {
+	return len(me.words)
+}
+
+// Max returns the sum of all weights, which is the largest possible distance.
+func (me *BitWeights[W]) Max() W {
+	return me.max
+}
+
+// Distance returns the weighted Hamming distance between the wide data points `x` and `d`, which must have the same length.
+func (me *BitWeights[W]) Distance(x, d []uint64) W {
+	var dist W
+	d = d[:len(x)]
+	for j, groups := range me.words[:min(len(me.words), len(x))] {
+		xor := x[j] ^ d[j]
+		for _, g := range groups {
+			dist += W(bits.OnesCount64(xor&g.mask)) * g.weight
+		}
+	}
+	return dist
+}
+
+// Distance64 returns the weighted Hamming distance between the data points `x` and `d`, using the weights of the first word.
+func (me *BitWeights[W]) Distance64(x, d uint64) W {
+	var dist W
+	if len(me.words) == 0 {
+		return dist
+	}
+	xor := x ^ d
+	for _, g := range me.words[0] {
+		dist += W(bits.OnesCount64(xor&g.mask)) * g.weight
+	}
+	return dist
+}
@@ -0,0 +1,128 @@
+package bitknn_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/keilerkonzept/bitknn"
+	"github.com/keilerkonzept/bitknn/internal/testrandom"
+	"pgregory.net/rapid"
+)
+
+// weightedDistanceOracle returns the sum of the weights of the bits that differ between `x` and `d`.
+func weightedDistanceOracle[W int | float64](weights []W, x, d []uint64) W {
+	var dist W
+	for i, w := range weights {
+		if i/64 < len(x) && (x[i/64]^d[i/64])>>(i%64)&1 == 1 {
+			dist += w
+		}
+	}
+	return dist
+}
+
+func TestBitWeights_Distance(t *testing.T) {
+	rapid.Check(t, func(t *rapid.T) {
+		dims := rapid.IntRange(1, 4).Draw(t, "dims")
+		weights := rapid.SliceOfN(rapid.IntRange(0, 5), 0, 64*dims+10).Draw(t, "weights")
+		floatWeights := make([]float64, len(weights))
+		for i, w := range weights {
+			floatWeights[i] = float64(w) / 4
+		}
+		x, d := testrandom.WideQuery(dims), testrandom.WideQuery(dims)
+
+		bitWeights := bitknn.NewBitWeights(weights)
+		if expected, actual := weightedDistanceOracle(weights, x, d), bitWeights.Distance(x, d); actual != expected {
+			t.Fatalf("distance %d != %d", actual, expected)
+		}
+		if expected, actual := weightedDistanceOracle(weights, x[:1], d[:1]), bitWeights.Distance64(x[0], d[0]); actual != expected {
+			t.Fatalf("narrow distance %d != %d", actual, expected)
+		}
+		floatBitWeights := bitknn.NewBitWeights(floatWeights)
+		if expected, actual := weightedDistanceOracle(floatWeights, x, d), floatBitWeights.Distance(x, d); math.Abs(actual-expected) > eps {
+			t.Fatalf("distance %v != %v", actual, expected)
+		}
+
+		total := 0
+		for _, w := range weights {
+			total += w
+		}
+		if bitWeights.Max() != total {
+			t.Fatalf("max %d != %d", bitWeights.Max(), total)
+		}
+		if words := (len(weights) + 63) / 64; bitWeights.Words() != words {
+			t.Fatalf("%d words != %d", bitWeights.Words(), words)
+		}
+	})
+}
+
+func TestByteWeights(t *testing.T) {
+	weights := bitknn.ByteWeights([]int{1, 0, 3})
+	x, d := []uint64{0}, []uint64{0b1_00000011_00000001_00000011}
+	if dist := weights.Distance(x, d); dist != 2*1+1*0+2*3 {
+		t.Errorf("distance %d", dist)
+	}
+	if weights.Max() != 8*4 {
+		t.Errorf("max %d", weights.Max())
+	}
+}
+
+func TestBitRangeWeights(t *testing.T) {
+	weights := bitknn.BitRangeWeights(
+		[]bitknn.BitRange{{Offset: 60, Width: 8}, {Offset: 62, Width: 4}},
+		[]float64{0.5, 2},
+	)
+	if weights.Words() != 2 {
+		t.Errorf("%d words", weights.Words())
+	}
+	x := []uint64{0, 0}
+	for _, tc := range []struct {
+		bit      int
+		expected float64
+	}{
+		{59, 0},
+		{60, 0.5},
+		{62, 2.5},
+		{65, 2.5},
+		{66, 0.5},
+		{68, 0},
+	} {
+		d := []uint64{0, 0}
+		d[tc.bit/64] = 1 << (tc.bit % 64)
+		if dist := weights.Distance(x, d); dist != tc.expected {
+			t.Errorf("bit %d: distance %v != %v", tc.bit, dist, tc.expected)
+		}
+	}
+	if weights.Max() != 8*0.5+4*2 {
+		t.Errorf("max %v", weights.Max())
+	}
+	if dist := weights.Distance64(0, 1<<64-1); dist != 4*0.5+2*2 {
+		t.Errorf("narrow distance %v", dist)
+	}
+}
+
+func TestNewBitWeights_RejectsNegativeAndNaN(t *testing.T) {
+	for name, construct := range map[string]func(){
+		"negative":       func() { bitknn.NewBitWeights([]int{1, -1}) },
+		"NaN":            func() { bitknn.NewBitWeights([]float64{math.NaN()}) },
+		"negative bytes": func() { bitknn.ByteWeights([]float64{-0.5}) },
+		"negative range": func() { bitknn.BitRangeWeights([]bitknn.BitRange{{Offset: 0, Width: 4}}, []int{-2}) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatal("should panic with", name, "weights")
+				}
+			}()
+			construct()
+		}()
+	}
+}
+
+func TestNewBitWeights_RejectsOverflow(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("should panic if the sum of the weights overflows")
+		}
+	}()
+	bitknn.NewBitWeights([]int{math.MaxInt, 1})
+}